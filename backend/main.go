@@ -2,15 +2,74 @@
 package main
 
 import (
+	"context"
+	"dnsmasq-dhcp-backend/pkg/dhcpscript"
 	"dnsmasq-dhcp-backend/pkg/logger"
 	"dnsmasq-dhcp-backend/pkg/uibackend"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
 )
 
+// dhcpScriptName is the name of the symlink to this binary used as dnsmasq --dhcp-script;
+// dnsmasq does not allow to pass additional arguments to the DHCP script, so the
+// "dhcp-script" mode is selected based on the name of the executable
+const dhcpScriptName = "dnsmasq-dhcp-script"
+
 func main() {
+	if filepath.Base(os.Args[0]) == dhcpScriptName {
+		os.Exit(dhcpscript.Run(os.Args[1:]))
+	}
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "dhcp-script":
+			os.Exit(dhcpscript.Run(os.Args[2:]))
+		case "validate":
+			// check the addon options, used by the dnsmasq-init script
+			os.Exit(uibackend.RunValidate(os.Args[2:], os.Stdout))
+		case "export":
+			// export the DHCP clients or the IP address reservations on stdout
+			os.Exit(uibackend.RunExport(os.Args[2:], os.Stdout, os.Stderr))
+		case "import":
+			// convert the configuration of another DHCP server into addon options
+			os.Exit(uibackend.RunImport(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+		case "suggest":
+			// suggest free IP addresses for new IP address reservations
+			os.Exit(uibackend.RunSuggest(os.Args[2:], os.Stdout, os.Stderr))
+		case "resolve-pools":
+			// print the DHCP pools in the format used by the dnsmasq config, used by the dnsmasq-init script
+			os.Exit(uibackend.RunResolvePools(os.Args[2:], os.Stdout, os.Stderr))
+		case "import-leases":
+			// import the leases of another DHCP server, used by the dnsmasq-init script
+			os.Exit(uibackend.RunImportLeases(os.Stdout))
+		}
+	}
+
 	logger := logger.NewCustomLogger("webui-backend")
 
 	logger.Info("Web backend starting")
 
 	ui := uibackend.NewUIBackend(logger)
-	_ = ui.ListenAndServe()
+	if ui == nil {
+		os.Exit(1)
+	}
+
+	// a SIGHUP reloads the addon options
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			ui.TriggerOptionsReload()
+		}
+	}()
+
+	// s6 stops the backend with a SIGTERM: shut down gracefully
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	err := ui.ListenAndServe(ctx)
+	stop()
+	signal.Stop(hup)
+	if err != nil {
+		os.Exit(1)
+	}
 }
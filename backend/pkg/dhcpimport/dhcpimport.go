@@ -0,0 +1,102 @@
+package dhcpimport
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// Format identifies the configuration of another DHCP server
+type Format string
+
+const (
+	FormatOpenWrt Format = "openwrt"
+	FormatPihole  Format = "pihole"
+	FormatISC     Format = "isc"
+	FormatKea     Format = "kea"
+)
+
+// Formats lists all the supported configurations
+var Formats = []Format{FormatOpenWrt, FormatPihole, FormatISC, FormatKea}
+
+// Host is a DHCP client found in the configuration of another DHCP server
+type Host struct {
+	// Location tells where the host is defined, e.g. "line 12"
+	Location string
+
+	Mac net.HardwareAddr
+
+	// IP is invalid for hosts without an IP address reservation, which only provide a name
+	IP netip.Addr
+
+	// Name is the hostname or description of the host, as found in the configuration; maybe empty
+	Name string
+}
+
+// Skipped is a part of the configuration that cannot be imported
+type Skipped struct {
+	Location string
+	Reason   string
+}
+
+func (s Skipped) String() string {
+	return fmt.Sprintf("%s: %s", s.Location, s.Reason)
+}
+
+// Parse reads the given configuration and returns the hosts found inside it, together with the parts
+// that cannot be imported; an error is returned only if the configuration cannot be read at all
+func Parse(format Format, r io.Reader) ([]Host, []Skipped, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch format {
+	case FormatOpenWrt:
+		hosts, skipped := parseOpenWrt(string(data))
+		return hosts, skipped, nil
+	case FormatPihole:
+		hosts, skipped := parseDhcpHostOptions(string(data))
+		return hosts, skipped, nil
+	case FormatISC:
+		return parseISC(string(data))
+	case FormatKea:
+		return parseKea(data)
+	}
+	return nil, nil, fmt.Errorf("unknown format %q: valid values are %v", format, Formats)
+}
+
+// lineLocation returns the Location of something found at the given line number
+func lineLocation(line int) string {
+	return fmt.Sprintf("line %d", line)
+}
+
+// parseIPv4 parses an IPv4 address, the only ones supported by the addon
+func parseIPv4(s string) (netip.Addr, error) {
+	ip, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("invalid IP address %q", s)
+	}
+	if !ip.Is4() {
+		return netip.Addr{}, fmt.Errorf("the IP address %s is not an IPv4 address", s)
+	}
+	return ip, nil
+}
+
+// parseMAC parses an Ethernet MAC address, the only ones supported by the addon; ISC dhcpd also
+// accepts octets written with a single digit, e.g. "0:1b:2c:3d:4e:5f"
+func parseMAC(s string) (net.HardwareAddr, error) {
+	octets := strings.Split(s, ":")
+	for i, o := range octets {
+		if len(o) == 1 {
+			octets[i] = "0" + o
+		}
+	}
+	mac, err := net.ParseMAC(strings.Join(octets, ":"))
+	if err != nil || len(mac) != 6 {
+		return nil, fmt.Errorf("invalid MAC address %q", s)
+	}
+	return mac, nil
+}
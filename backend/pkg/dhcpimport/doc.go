@@ -0,0 +1,19 @@
+/*
+Package dhcpimport reads the static IP address reservations and the host names defined in the
+configuration of other DHCP servers, to ease the migration to this addon.
+
+The supported configurations are:
+  - OpenWrt: the "host" sections of /etc/config/dhcp;
+  - Pi-hole: the dhcp-host options of /etc/dnsmasq.d/04-pihole-static-dhcp.conf, i.e. any dnsmasq dhcp-host option;
+  - ISC dhcpd: the "host" declarations of dhcpd.conf;
+  - Kea: the "reservations" lists of kea-dhcp4.conf.
+
+Only hosts identified by a MAC address are imported; the parts of the configuration that cannot be
+imported (e.g. hosts identified by a DHCP client ID) are reported, together with their location
+in the configuration. Checking the imported hosts against the addon options is up to the caller.
+
+The leases of a running DHCP server can be imported as well, using ParseLeases, from the lease
+database of ISC dhcpd (dhcpd.leases), of Kea (the memfile CSV lease file) or of another dnsmasq instance;
+the format of the lease database is detected automatically.
+*/
+package dhcpimport
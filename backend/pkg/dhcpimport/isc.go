@@ -0,0 +1,145 @@
+package dhcpimport
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"unicode"
+)
+
+// iscToken is a word, a quoted string or one of the punctuation characters of an ISC dhcpd configuration
+type iscToken struct {
+	text   string
+	line   int
+	quoted bool
+}
+
+func (t iscToken) is(punct string) bool {
+	return !t.quoted && t.text == punct
+}
+
+// tokenizeISC splits an ISC dhcpd configuration into tokens, removing comments
+func tokenizeISC(data string) ([]iscToken, error) {
+	var tokens []iscToken
+	line := 1
+	runes := []rune(data)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case c == '\n':
+			line++
+		case unicode.IsSpace(c):
+		case c == '#':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			i-- // the newline is counted by the next iteration
+		case c == '"':
+			start := line
+			var s strings.Builder
+			for i++; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\n' {
+					line++
+				}
+				s.WriteRune(runes[i])
+			}
+			if i == len(runes) {
+				return nil, fmt.Errorf("line %d: unterminated string", start)
+			}
+			tokens = append(tokens, iscToken{text: s.String(), line: start, quoted: true})
+		case strings.ContainsRune("{};,", c):
+			tokens = append(tokens, iscToken{text: string(c), line: line})
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && !strings.ContainsRune("{};,#\"", runes[i]) {
+				i++
+			}
+			tokens = append(tokens, iscToken{text: string(runes[start:i]), line: line})
+			i--
+		}
+	}
+	return tokens, nil
+}
+
+// parseISC reads the "host" declarations of an ISC dhcpd configuration, e.g.
+//
+//	host laptop {
+//	  hardware ethernet aa:bb:cc:dd:ee:ff;
+//	  fixed-address 192.168.1.10;
+//	  option host-name "laptop";
+//	}
+//
+// The host-name option, if any, takes precedence over the name of the declaration.
+func parseISC(data string) ([]Host, []Skipped, error) {
+	tokens, err := tokenizeISC(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var hosts []Host
+	var skipped []Skipped
+	for i := 0; i+2 < len(tokens); i++ {
+		if !tokens[i].is("host") || !tokens[i+2].is("{") {
+			continue
+		}
+		location := lineLocation(tokens[i].line)
+		declName := tokens[i+1].text
+
+		// collect the statements of the declaration
+		var statements [][]iscToken
+		var statement []iscToken
+		depth := 1
+		j := i + 3
+		for ; j < len(tokens) && depth > 0; j++ {
+			switch {
+			case tokens[j].is("{"):
+				depth++
+			case tokens[j].is("}"):
+				depth--
+			case tokens[j].is(";"):
+				statements = append(statements, statement)
+				statement = nil
+			default:
+				statement = append(statement, tokens[j])
+			}
+		}
+		if depth > 0 {
+			return nil, nil, fmt.Errorf("%s: unterminated host declaration", location)
+		}
+		i = j - 1
+
+		var mac net.HardwareAddr
+		var ip netip.Addr
+		var hostName, reason string
+		for _, s := range statements {
+			switch {
+			case len(s) >= 3 && s[0].is("hardware") && s[1].is("ethernet"):
+				if mac, err = parseMAC(s[2].text); err != nil {
+					reason = err.Error()
+				}
+			case len(s) >= 2 && s[0].is("fixed-address"):
+				// only the first address is used: the addon supports one IP address per host
+				if ip, err = parseIPv4(s[1].text); err != nil {
+					reason = err.Error()
+				}
+			case len(s) >= 3 && s[0].is("option") && s[1].is("host-name"):
+				hostName = s[2].text
+			}
+		}
+		if reason == "" && mac == nil {
+			reason = "host without a hardware ethernet address, e.g. identified by dhcp-client-identifier"
+		}
+		if reason != "" {
+			skipped = append(skipped, Skipped{Location: location, Reason: reason})
+			continue
+		}
+
+		name := declName
+		if hostName != "" {
+			name = hostName
+		}
+		hosts = append(hosts, Host{Location: location, Mac: mac, IP: ip, Name: name})
+	}
+	return hosts, skipped, nil
+}
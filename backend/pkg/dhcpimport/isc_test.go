@@ -0,0 +1,60 @@
+package dhcpimport
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseISC(t *testing.T) {
+	config := `
+option domain-name "lan";
+
+subnet 192.168.1.0 netmask 255.255.255.0 {
+  range 192.168.1.50 192.168.1.100;
+
+  # the NAS
+  host nas { hardware ethernet aa:bb:cc:dd:ee:01; fixed-address 192.168.1.10; }
+
+  group {
+    host "tv-host" {
+      hardware ethernet 0:bb:cc:dd:ee:2;
+      fixed-address 192.168.1.11, 192.168.1.12;
+      option host-name "tv";
+    }
+  }
+}
+
+host named-only {
+  hardware ethernet aa:bb:cc:dd:ee:03;
+}
+
+host by-client-id {
+  option dhcp-client-identifier "abc";
+  fixed-address 192.168.1.13;
+}
+
+host by-name {
+  hardware ethernet aa:bb:cc:dd:ee:04;
+  fixed-address nas.lan;
+}
+`
+	hosts, skipped, err := Parse(FormatISC, strings.NewReader(config))
+	require.NoError(t, err)
+	assert.Equal(t, []Host{
+		{Location: "line 8", Mac: mustParseMAC("aa:bb:cc:dd:ee:01"), IP: netip.MustParseAddr("192.168.1.10"), Name: "nas"},
+		{Location: "line 11", Mac: mustParseMAC("00:bb:cc:dd:ee:02"), IP: netip.MustParseAddr("192.168.1.11"), Name: "tv"},
+		{Location: "line 19", Mac: mustParseMAC("aa:bb:cc:dd:ee:03"), Name: "named-only"},
+	}, hosts)
+	require.Len(t, skipped, 2)
+	assert.Equal(t, "line 23", skipped[0].Location)
+	assert.Equal(t, `line 28: invalid IP address "nas.lan"`, skipped[1].String())
+
+	_, _, err = Parse(FormatISC, strings.NewReader("host laptop {\n  hardware ethernet aa:bb:cc:dd:ee:01;\n"))
+	assert.ErrorContains(t, err, "line 1: unterminated host declaration")
+	_, _, err = Parse(FormatISC, strings.NewReader("option domain-name \"lan;\n"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,125 @@
+package dhcpimport
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// stripJSONComments removes the comments allowed by Kea in its JSON configuration files, i.e.
+// "#", "//" and "/* */" comments
+func stripJSONComments(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	inString := false
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case inString:
+			out = append(out, c)
+			if c == '\\' && i+1 < len(data) {
+				i++
+				out = append(out, data[i])
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+			out = append(out, c)
+		case c == '#' || (c == '/' && i+1 < len(data) && data[i+1] == '/'):
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+			if i < len(data) {
+				out = append(out, '\n')
+			}
+		case c == '/' && i+1 < len(data) && data[i+1] == '*':
+			for i += 2; i < len(data) && (data[i] != '*' || i+1 == len(data) || data[i+1] != '/'); i++ {
+				if data[i] == '\n' {
+					out = append(out, '\n')
+				}
+			}
+			i++ // skip the final slash
+		default:
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// parseKea reads all the "reservations" lists of a Kea DHCPv4 configuration, e.g.
+//
+//	{"Dhcp4": {"subnet4": [{"reservations": [
+//	  {"hw-address": "aa:bb:cc:dd:ee:ff", "ip-address": "192.168.1.10", "hostname": "laptop"}
+//	]}]}}
+//
+// Both the global reservations and the ones of each subnet or shared network are imported.
+// The Location of each host is the JSON path of the reservation.
+func parseKea(data []byte) ([]Host, []Skipped, error) {
+	var cfg any
+	if err := json.Unmarshal(stripJSONComments(data), &cfg); err != nil {
+		return nil, nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	var hosts []Host
+	var skipped []Skipped
+	var walk func(path string, v any)
+	walk = func(path string, v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			for _, key := range slices.Sorted(maps.Keys(v)) {
+				childPath := key
+				if path != "" {
+					childPath = path + "." + key
+				}
+				if list, ok := v[key].([]any); ok && key == "reservations" {
+					for i, r := range list {
+						location := fmt.Sprintf("%s[%d]", childPath, i)
+						if reservation, ok := r.(map[string]any); ok {
+							h, reason := parseKeaReservation(location, reservation)
+							if reason != "" {
+								skipped = append(skipped, Skipped{Location: location, Reason: reason})
+							} else {
+								hosts = append(hosts, h)
+							}
+						}
+					}
+					continue
+				}
+				walk(childPath, v[key])
+			}
+		case []any:
+			for i, item := range v {
+				walk(fmt.Sprintf("%s[%d]", path, i), item)
+			}
+		}
+	}
+	walk("", cfg)
+	return hosts, skipped, nil
+}
+
+// parseKeaReservation converts a single Kea reservation; it returns the reason why the reservation
+// cannot be imported, if any
+func parseKeaReservation(location string, r map[string]any) (Host, string) {
+	hwAddress, _ := r["hw-address"].(string)
+	ipAddress, _ := r["ip-address"].(string)
+	hostname, _ := r["hostname"].(string)
+	if hwAddress == "" {
+		return Host{}, "reservation without hw-address, e.g. identified by client-id"
+	}
+
+	h := Host{Location: location, Name: hostname}
+	var err error
+	if h.Mac, err = parseMAC(hwAddress); err != nil {
+		return Host{}, err.Error()
+	}
+	if ipAddress != "" {
+		if h.IP, err = parseIPv4(ipAddress); err != nil {
+			return Host{}, err.Error()
+		}
+	}
+	if !h.IP.IsValid() && h.Name == "" {
+		return Host{}, "reservation without ip-address and hostname"
+	}
+	return h, ""
+}
@@ -0,0 +1,45 @@
+package dhcpimport
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKea(t *testing.T) {
+	config := `{
+  // comments are allowed by Kea
+  "Dhcp4": {
+    /* global reservations */
+    "reservations": [
+      { "hw-address": "aa:bb:cc:dd:ee:01", "ip-address": "192.168.1.10", "hostname": "nas" }
+    ],
+    "subnet4": [
+      {
+        "subnet": "192.168.1.0/24", # the main network
+        "reservations": [
+          { "hw-address": "aa:bb:cc:dd:ee:02", "hostname": "laptop" },
+          { "client-id": "01:aa:bb:cc:dd:ee:03", "ip-address": "192.168.1.12" },
+          { "hw-address": "aa:bb:cc:dd:ee:04", "ip-address": "192.168.1.13", "hostname": "http://not/a/comment" }
+        ]
+      }
+    ]
+  }
+}`
+	hosts, skipped, err := Parse(FormatKea, strings.NewReader(config))
+	require.NoError(t, err)
+	assert.Equal(t, []Host{
+		{Location: "Dhcp4.reservations[0]", Mac: mustParseMAC("aa:bb:cc:dd:ee:01"), IP: netip.MustParseAddr("192.168.1.10"), Name: "nas"},
+		{Location: "Dhcp4.subnet4[0].reservations[0]", Mac: mustParseMAC("aa:bb:cc:dd:ee:02"), Name: "laptop"},
+		{Location: "Dhcp4.subnet4[0].reservations[2]", Mac: mustParseMAC("aa:bb:cc:dd:ee:04"), IP: netip.MustParseAddr("192.168.1.13"), Name: "http://not/a/comment"},
+	}, hosts)
+	assert.Equal(t, []Skipped{
+		{Location: "Dhcp4.subnet4[0].reservations[1]", Reason: "reservation without hw-address, e.g. identified by client-id"},
+	}, skipped)
+
+	_, _, err = Parse(FormatKea, strings.NewReader(`{"Dhcp4": `))
+	assert.ErrorContains(t, err, "invalid JSON")
+}
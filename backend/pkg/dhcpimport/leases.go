@@ -0,0 +1,326 @@
+package dhcpimport
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LeaseFormat identifies the lease database of another DHCP server
+type LeaseFormat string
+
+const (
+	LeaseFormatISC     LeaseFormat = "isc"     // dhcpd.leases
+	LeaseFormatKea     LeaseFormat = "kea"     // kea-leases4.csv, i.e. the memfile lease database
+	LeaseFormatDnsmasq LeaseFormat = "dnsmasq" // dnsmasq.leases
+)
+
+// Lease is a DHCP lease found in the lease database of another DHCP server
+type Lease struct {
+	// Location tells where the lease is defined, e.g. "line 12"
+	Location string
+
+	Mac net.HardwareAddr
+	IP  netip.Addr
+
+	// Hostname is the hostname sent by the DHCP client; maybe empty
+	Hostname string
+
+	// Expires is zero for the leases that never expire
+	Expires time.Time
+}
+
+var (
+	// an ISC dhcpd lease declaration
+	iscLeaseRegex = regexp.MustCompile(`(?m)^\s*lease\s+[0-9.]+\s*\{`)
+
+	// a line of a dnsmasq lease file: expiry time, MAC address, IP address
+	dnsmasqLeaseRegex = regexp.MustCompile(`^[0-9]+\s+[0-9A-Fa-f:-]+\s+[0-9.]+(\s|$)`)
+)
+
+// Kea writes the leases with an infinite valid lifetime using this value
+const keaInfiniteLifetime = 0xffffffff
+
+// DetectLeaseFormat guesses the format of a lease database from its content
+func DetectLeaseFormat(data []byte) (LeaseFormat, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("address,hwaddr,")) {
+		return LeaseFormatKea, nil
+	}
+	if iscLeaseRegex.Match(data) {
+		return LeaseFormatISC, nil
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "duid ") {
+			continue
+		}
+		if dnsmasqLeaseRegex.MatchString(line) {
+			return LeaseFormatDnsmasq, nil
+		}
+		break
+	}
+	return "", errors.New("unknown lease database format: only ISC dhcpd, Kea memfile and dnsmasq lease files are supported")
+}
+
+// ParseLeases reads the given lease database, whose format is detected automatically, and returns the
+// leases of IPv4 addresses currently bound to a client, including the expired ones. When the database contains
+// more leases for the same IP address, only the last one is returned, since the databases are append-only.
+func ParseLeases(r io.Reader) ([]Lease, []Skipped, LeaseFormat, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	format, err := DetectLeaseFormat(data)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	var leases []Lease
+	var skipped []Skipped
+	switch format {
+	case LeaseFormatISC:
+		leases, skipped, err = parseISCLeases(string(data))
+	case LeaseFormatKea:
+		leases, skipped, err = parseKeaLeases(data)
+	case LeaseFormatDnsmasq:
+		leases, skipped = parseDnsmasqLeases(string(data))
+	}
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return lastLeasePerIP(leases), skipped, format, nil
+}
+
+// lastLeasePerIP drops the leases superseded by a later lease of the same IP address
+func lastLeasePerIP(leases []Lease) []Lease {
+	last := make(map[netip.Addr]int, len(leases))
+	for i, l := range leases {
+		last[l.IP] = i
+	}
+	result := make([]Lease, 0, len(last))
+	for i, l := range leases {
+		if last[l.IP] == i {
+			result = append(result, l)
+		}
+	}
+	return result
+}
+
+// parseISCLeases reads an ISC dhcpd lease database, e.g.
+//
+//	lease 192.168.1.10 {
+//	  starts 4 2024/01/04 10:00:00;
+//	  ends 4 2024/01/04 22:00:00;
+//	  binding state active;
+//	  hardware ethernet aa:bb:cc:dd:ee:ff;
+//	  client-hostname "laptop";
+//	}
+//
+// Only the leases in the "active" binding state are returned.
+func parseISCLeases(data string) ([]Lease, []Skipped, error) {
+	tokens, err := tokenizeISC(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var leases []Lease
+	var skipped []Skipped
+	for i := 0; i+2 < len(tokens); i++ {
+		if !tokens[i].is("lease") || !tokens[i+2].is("{") {
+			continue
+		}
+		location := lineLocation(tokens[i].line)
+		address := tokens[i+1].text
+
+		// collect the statements of the declaration
+		var statements [][]iscToken
+		var statement []iscToken
+		j := i + 3
+		for ; j < len(tokens) && !tokens[j].is("}"); j++ {
+			if tokens[j].is(";") {
+				statements = append(statements, statement)
+				statement = nil
+			} else {
+				statement = append(statement, tokens[j])
+			}
+		}
+		if j == len(tokens) {
+			return nil, nil, fmt.Errorf("%s: unterminated lease declaration", location)
+		}
+		i = j
+
+		l := Lease{Location: location}
+		active := true // old versions of dhcpd do not write the binding state
+		var reason string
+		if l.IP, err = parseIPv4(address); err != nil {
+			reason = err.Error()
+		}
+		for _, s := range statements {
+			switch {
+			case len(s) >= 3 && s[0].is("binding") && s[1].is("state"):
+				active = s[2].is("active")
+			case len(s) >= 3 && s[0].is("hardware") && s[1].is("ethernet"):
+				if l.Mac, err = parseMAC(s[2].text); err != nil {
+					reason = err.Error()
+				}
+			case len(s) >= 2 && s[0].is("client-hostname"):
+				l.Hostname = s[1].text
+			case len(s) >= 2 && s[0].is("ends"):
+				if l.Expires, err = parseISCTime(s[1:]); err != nil {
+					reason = err.Error()
+				}
+			}
+		}
+		if !active {
+			continue
+		}
+		if reason == "" && l.Mac == nil {
+			reason = "lease without a hardware ethernet address"
+		}
+		if reason != "" {
+			skipped = append(skipped, Skipped{Location: location, Reason: reason})
+			continue
+		}
+		leases = append(leases, l)
+	}
+	return leases, skipped, nil
+}
+
+// parseISCTime parses the date of an ISC dhcpd lease, e.g. "4 2024/01/04 22:00:00" (UTC),
+// "epoch 1704405600" or "never"
+func parseISCTime(tokens []iscToken) (time.Time, error) {
+	switch {
+	case tokens[0].is("never"):
+		return time.Time{}, nil
+	case tokens[0].is("epoch") && len(tokens) >= 2:
+		epoch, err := strconv.ParseInt(tokens[1].text, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid lease time %q", tokens[1].text)
+		}
+		return time.Unix(epoch, 0), nil
+	case len(tokens) >= 3:
+		t, err := time.Parse("2006/01/02 15:04:05", tokens[1].text+" "+tokens[2].text)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid lease time %q", tokens[1].text+" "+tokens[2].text)
+		}
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid lease time %q", tokens[0].text)
+}
+
+// parseKeaLeases reads a Kea memfile lease database, i.e. a CSV file with a header like
+//
+//	address,hwaddr,client_id,valid_lifetime,expire,subnet_id,fqdn_fwd,fqdn_rev,hostname,state,user_context
+//
+// Only the leases in the default state (0) are returned.
+func parseKeaLeases(data []byte) ([]Lease, []Skipped, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1 // the number of columns changed across Kea versions
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range records[0] {
+		columns[name] = i
+	}
+	for _, name := range []string{"address", "hwaddr", "valid_lifetime", "expire", "hostname", "state"} {
+		if _, ok := columns[name]; !ok {
+			return nil, nil, fmt.Errorf("missing column %q", name)
+		}
+	}
+
+	var leases []Lease
+	var skipped []Skipped
+	for i, record := range records[1:] {
+		location := lineLocation(i + 2)
+		field := func(name string) string {
+			if columns[name] < len(record) {
+				return record[columns[name]]
+			}
+			return ""
+		}
+		if field("state") != "0" {
+			// declined, expired-reclaimed or released leases
+			continue
+		}
+
+		l := Lease{Location: location, Hostname: strings.ReplaceAll(field("hostname"), "&#x2c", ",")}
+		var err error
+		if l.IP, err = parseIPv4(field("address")); err != nil {
+			skipped = append(skipped, Skipped{Location: location, Reason: err.Error()})
+			continue
+		}
+		if l.Mac, err = parseMAC(field("hwaddr")); err != nil {
+			skipped = append(skipped, Skipped{Location: location, Reason: err.Error()})
+			continue
+		}
+		if field("valid_lifetime") != strconv.Itoa(keaInfiniteLifetime) {
+			expire, err := strconv.ParseInt(field("expire"), 10, 64)
+			if err != nil {
+				skipped = append(skipped, Skipped{Location: location, Reason: fmt.Sprintf("invalid expire time %q", field("expire"))})
+				continue
+			}
+			l.Expires = time.Unix(expire, 0)
+		}
+		leases = append(leases, l)
+	}
+	return leases, skipped, nil
+}
+
+// parseDnsmasqLeases reads a dnsmasq lease file, whose lines look like
+//
+//	1704405600 aa:bb:cc:dd:ee:ff 192.168.1.10 laptop 01:aa:bb:cc:dd:ee:ff
+//
+// The IPv6 leases are ignored.
+func parseDnsmasqLeases(data string) ([]Lease, []Skipped) {
+	var leases []Lease
+	var skipped []Skipped
+	for i, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] == "duid" {
+			continue
+		}
+		location := lineLocation(i + 1)
+		if len(fields) < 3 {
+			skipped = append(skipped, Skipped{Location: location, Reason: "invalid lease"})
+			continue
+		}
+		if strings.Contains(fields[2], ":") {
+			// IPv6 lease
+			continue
+		}
+
+		l := Lease{Location: location}
+		expiry, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			skipped = append(skipped, Skipped{Location: location, Reason: fmt.Sprintf("invalid expiry time %q", fields[0])})
+			continue
+		}
+		if expiry != 0 {
+			l.Expires = time.Unix(expiry, 0)
+		}
+		if l.Mac, err = parseMAC(fields[1]); err != nil {
+			skipped = append(skipped, Skipped{Location: location, Reason: err.Error()})
+			continue
+		}
+		if l.IP, err = parseIPv4(fields[2]); err != nil {
+			skipped = append(skipped, Skipped{Location: location, Reason: err.Error()})
+			continue
+		}
+		if len(fields) >= 4 && fields[3] != "*" {
+			l.Hostname = fields[3]
+		}
+		leases = append(leases, l)
+	}
+	return leases, skipped
+}
@@ -0,0 +1,118 @@
+package dhcpimport
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectLeaseFormat(t *testing.T) {
+	for data, expected := range map[string]LeaseFormat{
+		"# The format of this file is documented in the dhcpd.leases(5) manual page.\nlease 192.168.1.10 {\n}\n": LeaseFormatISC,
+		"address,hwaddr,client_id,valid_lifetime,expire,subnet_id,fqdn_fwd,fqdn_rev,hostname,state\n":            LeaseFormatKea,
+		"1704405600 aa:bb:cc:dd:ee:ff 192.168.1.10 laptop *\n":                                                   LeaseFormatDnsmasq,
+		"duid 00:01:00:01:2d:aa:bb:cc\n0 aa:bb:cc:dd:ee:ff 192.168.1.10 *\n":                                     LeaseFormatDnsmasq,
+	} {
+		format, err := DetectLeaseFormat([]byte(data))
+		require.NoError(t, err, data)
+		assert.Equal(t, expected, format, data)
+	}
+
+	_, err := DetectLeaseFormat([]byte(`{"Dhcp4": {}}`))
+	assert.Error(t, err)
+	_, err = DetectLeaseFormat(nil)
+	assert.Error(t, err)
+}
+
+func TestParseISCLeases(t *testing.T) {
+	leases := `# The format of this file is documented in the dhcpd.leases(5) manual page.
+authoring-byte-order little-endian;
+
+lease 192.168.1.10 {
+  starts 4 2024/01/04 10:00:00;
+  ends 4 2024/01/04 22:00:00;
+  binding state active;
+  next binding state free;
+  hardware ethernet aa:bb:cc:dd:ee:01;
+  client-hostname "laptop";
+}
+lease 192.168.1.11 {
+  ends never;
+  binding state active;
+  hardware ethernet aa:bb:cc:dd:ee:02;
+}
+lease 192.168.1.12 {
+  ends epoch 1704405600; # Thu Jan 04 22:00:00 2024
+  binding state free;
+  hardware ethernet aa:bb:cc:dd:ee:03;
+}
+lease 192.168.1.13 {
+  binding state active;
+}
+lease 192.168.1.10 {
+  ends epoch 1704405600;
+  binding state active;
+  hardware ethernet aa:bb:cc:dd:ee:04;
+}
+`
+	result, skipped, format, err := ParseLeases(strings.NewReader(leases))
+	require.NoError(t, err)
+	assert.Equal(t, LeaseFormatISC, format)
+	assert.Equal(t, []Lease{
+		{Location: "line 12", Mac: mustParseMAC("aa:bb:cc:dd:ee:02"), IP: netip.MustParseAddr("192.168.1.11")},
+		{Location: "line 25", Mac: mustParseMAC("aa:bb:cc:dd:ee:04"), IP: netip.MustParseAddr("192.168.1.10"), Expires: time.Unix(1704405600, 0)},
+	}, result)
+	assert.Equal(t, []Skipped{{Location: "line 22", Reason: "lease without a hardware ethernet address"}}, skipped)
+
+	result, _, _, err = ParseLeases(strings.NewReader(leases[:strings.Index(leases, "lease 192.168.1.11")]))
+	require.NoError(t, err)
+	require.Len(t, result, 1)
+	assert.Equal(t, "laptop", result[0].Hostname)
+	assert.Equal(t, time.Date(2024, 1, 4, 22, 0, 0, 0, time.UTC), result[0].Expires)
+
+	_, _, _, err = ParseLeases(strings.NewReader("lease 192.168.1.10 {\n  binding state active;\n"))
+	assert.ErrorContains(t, err, "line 1: unterminated lease declaration")
+}
+
+func TestParseKeaLeases(t *testing.T) {
+	leases := `address,hwaddr,client_id,valid_lifetime,expire,subnet_id,fqdn_fwd,fqdn_rev,hostname,state,user_context
+192.168.1.10,aa:bb:cc:dd:ee:01,01:aa:bb:cc:dd:ee:01,3600,1704405600,1,0,0,laptop,0,
+192.168.1.11,aa:bb:cc:dd:ee:02,,4294967295,5999405600,1,0,0,,0,
+192.168.1.12,aa:bb:cc:dd:ee:03,,3600,1704405600,1,0,0,declined,1,
+192.168.1.13,,,3600,1704405600,1,0,0,no-mac,0,
+192.168.1.10,aa:bb:cc:dd:ee:01,01:aa:bb:cc:dd:ee:01,3600,1704409200,1,0,0,laptop&#x2cwork,0,
+`
+	result, skipped, format, err := ParseLeases(strings.NewReader(leases))
+	require.NoError(t, err)
+	assert.Equal(t, LeaseFormatKea, format)
+	assert.Equal(t, []Lease{
+		{Location: "line 3", Mac: mustParseMAC("aa:bb:cc:dd:ee:02"), IP: netip.MustParseAddr("192.168.1.11")},
+		{Location: "line 6", Mac: mustParseMAC("aa:bb:cc:dd:ee:01"), IP: netip.MustParseAddr("192.168.1.10"), Hostname: "laptop,work", Expires: time.Unix(1704409200, 0)},
+	}, result)
+	require.Len(t, skipped, 1)
+	assert.Equal(t, "line 5", skipped[0].Location)
+
+	_, _, _, err = ParseLeases(strings.NewReader("address,hwaddr,expire\n"))
+	assert.ErrorContains(t, err, "missing column")
+}
+
+func TestParseDnsmasqLeases(t *testing.T) {
+	leases := `1704405600 aa:bb:cc:dd:ee:01 192.168.1.10 laptop 01:aa:bb:cc:dd:ee:01
+0 aa:bb:cc:dd:ee:02 192.168.1.11 * *
+duid 00:01:00:01:2d:aa:bb:cc:dd:ee:ff:00:11
+1704405600 1234 fd00::10 laptop 00:01:00:01
+1704405600 aa:bb:cc:dd:ee:03 192.168.1 broken *
+`
+	result, skipped, format, err := ParseLeases(strings.NewReader(leases))
+	require.NoError(t, err)
+	assert.Equal(t, LeaseFormatDnsmasq, format)
+	assert.Equal(t, []Lease{
+		{Location: "line 1", Mac: mustParseMAC("aa:bb:cc:dd:ee:01"), IP: netip.MustParseAddr("192.168.1.10"), Hostname: "laptop", Expires: time.Unix(1704405600, 0)},
+		{Location: "line 2", Mac: mustParseMAC("aa:bb:cc:dd:ee:02"), IP: netip.MustParseAddr("192.168.1.11")},
+	}, result)
+	assert.Equal(t, []Skipped{{Location: "line 5", Reason: `invalid IP address "192.168.1"`}}, skipped)
+}
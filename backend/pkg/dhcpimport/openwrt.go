@@ -0,0 +1,127 @@
+package dhcpimport
+
+import (
+	"net/netip"
+	"strings"
+	"unicode"
+)
+
+// uciSection is a "config" section of an OpenWrt UCI file, e.g. /etc/config/dhcp
+type uciSection struct {
+	line    int
+	typ     string
+	options map[string][]string // both "option" and "list" values
+}
+
+// splitUCIWords splits a line of a UCI file into words, removing quotes and comments
+func splitUCIWords(line string) []string {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	for _, c := range line {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				word.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inWord = true
+		case c == '#' && !inWord:
+			return words
+		case unicode.IsSpace(c):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words
+}
+
+// parseUCISections returns all the sections of a UCI file
+func parseUCISections(data string) []uciSection {
+	var sections []uciSection
+	for i, line := range strings.Split(data, "\n") {
+		words := splitUCIWords(line)
+		if len(words) < 2 {
+			continue
+		}
+		switch words[0] {
+		case "config":
+			sections = append(sections, uciSection{line: i + 1, typ: words[1], options: map[string][]string{}})
+		case "option", "list":
+			if len(sections) == 0 || len(words) < 3 {
+				continue
+			}
+			s := sections[len(sections)-1]
+			s.options[words[1]] = append(s.options[words[1]], words[2])
+		}
+	}
+	return sections
+}
+
+// parseOpenWrt reads the "host" sections of the OpenWrt /etc/config/dhcp file, e.g.
+//
+//	config host
+//		option name 'laptop'
+//		option mac 'aa:bb:cc:dd:ee:ff'
+//		option ip '192.168.1.10'
+//
+// A host with more MAC addresses (either space-separated or in a "list mac") produces a Host for each of them.
+func parseOpenWrt(data string) ([]Host, []Skipped) {
+	var hosts []Host
+	var skipped []Skipped
+	for _, s := range parseUCISections(data) {
+		if s.typ != "host" {
+			continue
+		}
+		location := lineLocation(s.line)
+
+		var macs []string
+		for _, value := range s.options["mac"] {
+			macs = append(macs, strings.Fields(value)...)
+		}
+		if len(macs) == 0 {
+			skipped = append(skipped, Skipped{Location: location, Reason: "host without a MAC address, e.g. identified by DUID"})
+			continue
+		}
+
+		var name string
+		if len(s.options["name"]) > 0 {
+			name = s.options["name"][0]
+		}
+		var ip netip.Addr
+		if len(s.options["ip"]) > 0 {
+			var err error
+			if ip, err = parseIPv4(s.options["ip"][0]); err != nil {
+				skipped = append(skipped, Skipped{Location: location, Reason: err.Error()})
+				continue
+			}
+		}
+		if !ip.IsValid() && name == "" {
+			skipped = append(skipped, Skipped{Location: location, Reason: "host without IP address and name"})
+			continue
+		}
+
+		for _, m := range macs {
+			mac, err := parseMAC(m)
+			if err != nil {
+				skipped = append(skipped, Skipped{Location: location, Reason: err.Error()})
+				continue
+			}
+			hosts = append(hosts, Host{Location: location, Mac: mac, IP: ip, Name: name})
+		}
+	}
+	return hosts, skipped
+}
@@ -0,0 +1,71 @@
+package dhcpimport
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustParseMAC(s string) net.HardwareAddr {
+	mac, err := net.ParseMAC(s)
+	if err != nil {
+		panic(err)
+	}
+	return mac
+}
+
+func TestParseOpenWrt(t *testing.T) {
+	config := `
+config dnsmasq
+	option domainneeded '1'
+	option local '/lan/'
+
+# a comment
+config host
+	option name 'laptop'
+	option dns '1'
+	option mac 'AA:BB:CC:DD:EE:01'
+	option ip '192.168.1.10'
+
+config host 'tv'
+	option name "Living room TV"
+	list mac 'aa:bb:cc:dd:ee:02'
+	list mac 'aa:bb:cc:dd:ee:03'
+	option ip '192.168.1.11'
+
+config host
+	option name 'phone'
+	option mac 'aa:bb:cc:dd:ee:04 aa:bb:cc:dd:ee:05'
+
+config host
+	option name 'ipv6-only'
+	option duid '000100012d5f4a1b'
+	option hostid '10'
+
+config host
+	option mac 'aa:bb:cc:dd:ee:06'
+	option ip '192.168.1'
+`
+	hosts, skipped, err := Parse(FormatOpenWrt, strings.NewReader(config))
+	require.NoError(t, err)
+	assert.Equal(t, []Host{
+		{Location: "line 7", Mac: mustParseMAC("aa:bb:cc:dd:ee:01"), IP: netip.MustParseAddr("192.168.1.10"), Name: "laptop"},
+		{Location: "line 13", Mac: mustParseMAC("aa:bb:cc:dd:ee:02"), IP: netip.MustParseAddr("192.168.1.11"), Name: "Living room TV"},
+		{Location: "line 13", Mac: mustParseMAC("aa:bb:cc:dd:ee:03"), IP: netip.MustParseAddr("192.168.1.11"), Name: "Living room TV"},
+		{Location: "line 19", Mac: mustParseMAC("aa:bb:cc:dd:ee:04"), Name: "phone"},
+		{Location: "line 19", Mac: mustParseMAC("aa:bb:cc:dd:ee:05"), Name: "phone"},
+	}, hosts)
+	require.Len(t, skipped, 2)
+	assert.Equal(t, "line 23", skipped[0].Location)
+	assert.Equal(t, `line 28: invalid IP address "192.168.1"`, skipped[1].String())
+}
+
+func TestSplitUCIWords(t *testing.T) {
+	assert.Equal(t, []string{"option", "name", "my laptop"}, splitUCIWords(`	option name 'my laptop' # comment`))
+	assert.Equal(t, []string{"option", "name", "it's"}, splitUCIWords(`option name "it's"`))
+	assert.Empty(t, splitUCIWords("# only a comment"))
+}
@@ -0,0 +1,75 @@
+package dhcpimport
+
+import (
+	"net"
+	"net/netip"
+	"regexp"
+	"strings"
+)
+
+// a lease time, as accepted by dnsmasq
+var leaseTimeRegex = regexp.MustCompile(`^([0-9]+[smhdw]?|infinite)$`)
+
+// parseDhcpHostOptions reads the dnsmasq dhcp-host options found in the given configuration, e.g.
+// the /etc/dnsmasq.d/04-pihole-static-dhcp.conf file written by Pi-hole:
+//
+//	dhcp-host=AA:BB:CC:DD:EE:FF,192.168.1.10,laptop
+//
+// Any other dnsmasq option is ignored. A dhcp-host option with more MAC addresses produces a Host for each of them.
+func parseDhcpHostOptions(data string) ([]Host, []Skipped) {
+	var hosts []Host
+	var skipped []Skipped
+	for i, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		value, found := strings.CutPrefix(line, "dhcp-host=")
+		if !found {
+			continue
+		}
+		location := lineLocation(i + 1)
+
+		var macs []net.HardwareAddr
+		var ip netip.Addr
+		var name, reason string
+		for _, field := range strings.Split(value, ",") {
+			field = strings.TrimSpace(field)
+			switch {
+			case field == "":
+			case field == "ignore":
+				reason = "the host is ignored by dnsmasq"
+			case strings.HasPrefix(field, "id:"):
+				reason = "host identified by DHCP client ID"
+			case strings.HasPrefix(field, "set:"), strings.HasPrefix(field, "tag:"), strings.HasPrefix(field, "["):
+				// tags and IPv6 addresses are not supported by the addon
+			case leaseTimeRegex.MatchString(field):
+			default:
+				if mac, err := parseMAC(field); err == nil {
+					macs = append(macs, mac)
+				} else if addr, err := netip.ParseAddr(field); err == nil {
+					if ip, err = parseIPv4(addr.String()); err != nil {
+						reason = err.Error()
+					}
+				} else if strings.Contains(field, ":") {
+					// e.g. MAC addresses with wildcards or with the hardware type
+					reason = "unsupported MAC address " + field
+				} else if name == "" {
+					name = field
+				}
+			}
+		}
+		if reason == "" && len(macs) == 0 {
+			reason = "dhcp-host without a MAC address"
+		}
+		if reason == "" && !ip.IsValid() && name == "" {
+			reason = "dhcp-host without IP address and name"
+		}
+		if reason != "" {
+			skipped = append(skipped, Skipped{Location: location, Reason: reason})
+			continue
+		}
+
+		for _, mac := range macs {
+			hosts = append(hosts, Host{Location: location, Mac: mac, IP: ip, Name: name})
+		}
+	}
+	return hosts, skipped
+}
@@ -0,0 +1,37 @@
+package dhcpimport
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDhcpHostOptions(t *testing.T) {
+	config := `# written by Pi-hole
+dhcp-host=AA:BB:CC:DD:EE:01,192.168.1.10,laptop
+dhcp-host=aa:bb:cc:dd:ee:02,192.168.1.11
+dhcp-host=aa:bb:cc:dd:ee:03,aa:bb:cc:dd:ee:04,set:iot,printer,infinite
+dhcp-host=id:01:aa:bb:cc:dd:ee:05,192.168.1.12
+dhcp-host=aa:bb:cc:dd:ee:06,ignore
+dhcp-host=aa:bb:cc:dd:ee:*,192.168.1.13
+dhcp-host=aa:bb:cc:dd:ee:07,[::10],192.168.1.14,12h
+dhcp-range=192.168.1.50,192.168.1.100,24h
+`
+	hosts, skipped, err := Parse(FormatPihole, strings.NewReader(config))
+	require.NoError(t, err)
+	assert.Equal(t, []Host{
+		{Location: "line 2", Mac: mustParseMAC("aa:bb:cc:dd:ee:01"), IP: netip.MustParseAddr("192.168.1.10"), Name: "laptop"},
+		{Location: "line 3", Mac: mustParseMAC("aa:bb:cc:dd:ee:02"), IP: netip.MustParseAddr("192.168.1.11")},
+		{Location: "line 4", Mac: mustParseMAC("aa:bb:cc:dd:ee:03"), Name: "printer"},
+		{Location: "line 4", Mac: mustParseMAC("aa:bb:cc:dd:ee:04"), Name: "printer"},
+		{Location: "line 8", Mac: mustParseMAC("aa:bb:cc:dd:ee:07"), IP: netip.MustParseAddr("192.168.1.14")},
+	}, hosts)
+	assert.Equal(t, []Skipped{
+		{Location: "line 5", Reason: "host identified by DHCP client ID"},
+		{Location: "line 6", Reason: "the host is ignored by dnsmasq"},
+		{Location: "line 7", Reason: "unsupported MAC address aa:bb:cc:dd:ee:*"},
+	}, skipped)
+}
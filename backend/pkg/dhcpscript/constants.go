@@ -0,0 +1,22 @@
+package dhcpscript
+
+import "time"
+
+// location for our small DB tracking DHCP clients; must match the one used by the uibackend package
+var defaultDhcpClientTrackerDB = "/data/trackerdb.sqlite3"
+
+// location of the epoch at which dnsmasq was started, written by the dnsmasq-init script
+var defaultStartEpoch = "/data/startepoch"
+
+// location of the epoch at which the uibackend last sent a SIGHUP to dnsmasq; must match the one
+// used by the uibackend package
+var defaultReloadEpoch = "/run/dnsmasq.reloadepoch"
+
+// Unix socket served by the log-helper s6 service
+var logSocket = "/tmp/dnsmasq-script-log-socket"
+
+// "old" events received within this time from the dnsmasq start or reload are ignored
+var startTimeThreshold = 3 * time.Second
+
+// environment variable used by dnsmasq to pass the MAC address of DHCPv6 clients, when known
+var dnsmasqMacEnvVar = "DNSMASQ_MAC"
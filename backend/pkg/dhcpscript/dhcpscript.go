@@ -0,0 +1,264 @@
+package dhcpscript
+
+import (
+	"dnsmasq-dhcp-backend/pkg/duid"
+	"dnsmasq-dhcp-backend/pkg/logger"
+	"dnsmasq-dhcp-backend/pkg/trackerdb"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Mode is the action reported by dnsmasq as first argument of the DHCP script
+type Mode string
+
+const (
+	// ModeAdd is used when a lease is created
+	ModeAdd Mode = "add"
+	// ModeOld is used when a lease is renewed, and for all existing leases at dnsmasq startup or on SIGHUP
+	ModeOld Mode = "old"
+	// ModeDel is used when a lease is destroyed
+	ModeDel Mode = "del"
+)
+
+// Event represents a single invocation of the DHCP script by dnsmasq
+type Event struct {
+	Mode Mode
+
+	// MacAddr is nil for DHCPv6 clients whose MAC address is unknown
+	MacAddr  net.HardwareAddr
+	IPAddr   netip.Addr
+	Hostname string
+
+	// DUID is set only for DHCPv6 clients
+	DUID duid.DUID
+}
+
+func (e Event) String() string {
+	if e.DUID != nil {
+		return fmt.Sprintf("mode=%s, mac=%s, duid=%s, ip=%s, hostname=%s", e.Mode, e.MacAddr, e.DUID, e.IPAddr, e.Hostname)
+	}
+	return fmt.Sprintf("mode=%s, mac=%s, ip=%s, hostname=%s", e.Mode, e.MacAddr, e.IPAddr, e.Hostname)
+}
+
+// ParseArgs parses the command line arguments used by dnsmasq to invoke the DHCP script:
+//
+//	<mode> <MAC address> <IPv4 address> [hostname]
+//	<mode> <DUID> <IPv6 address> [hostname]
+//
+// For DHCPv6 clients the MAC address is taken from the DUID, when possible.
+// Modes other than "add", "old" and "del" (e.g. "tftp", "arp-add") use different arguments:
+// for them only the Mode field is populated.
+func ParseArgs(args []string) (Event, error) {
+	if len(args) == 0 {
+		return Event{}, errors.New("missing mode argument")
+	}
+
+	ev := Event{Mode: Mode(args[0])}
+	if ev.Mode != ModeAdd && ev.Mode != ModeOld && ev.Mode != ModeDel {
+		return ev, nil
+	}
+
+	if len(args) < 3 {
+		return ev, fmt.Errorf("expecting at least 3 arguments for mode %q, got %d", ev.Mode, len(args))
+	}
+
+	var err error
+	ev.IPAddr, err = netip.ParseAddr(args[2])
+	if err != nil {
+		return ev, fmt.Errorf("invalid IP address %q: %w", args[2], err)
+	}
+	if ev.IPAddr.Is6() {
+		ev.DUID, err = duid.Parse(args[1])
+		if err != nil {
+			return ev, err
+		}
+		ev.MacAddr = ev.DUID.HardwareAddr()
+	} else {
+		ev.MacAddr, err = net.ParseMAC(args[1])
+		if err != nil {
+			return ev, fmt.Errorf("invalid MAC address %q: %w", args[1], err)
+		}
+	}
+	if len(args) > 3 {
+		ev.Hostname = args[3]
+	}
+	return ev, nil
+}
+
+// Handler processes the DHCP script events, updating the tracker DB
+type Handler struct {
+	logger     *logger.CustomLogger
+	db         *trackerdb.DhcpClientTrackerDB
+	startEpoch int64
+
+	// reloadEpoch is the epoch of the last SIGHUP sent by the uibackend to dnsmasq, if any
+	reloadEpoch int64
+
+	// now is a hook for unit tests
+	now func() time.Time
+}
+
+// NewHandler creates a Handler storing DHCP clients in the given DB;
+// startEpoch identifies the running dnsmasq instance
+func NewHandler(logger *logger.CustomLogger, db *trackerdb.DhcpClientTrackerDB, startEpoch int64) *Handler {
+	return &Handler{
+		logger:     logger,
+		db:         db,
+		startEpoch: startEpoch,
+		now:        time.Now,
+	}
+}
+
+// SetReloadEpoch informs the Handler about the epoch of the last SIGHUP sent to dnsmasq
+func (h *Handler) SetReloadEpoch(reloadEpoch int64) {
+	h.reloadEpoch = reloadEpoch
+}
+
+// dnsmasqJustStarted returns true if the dnsmasq instance has been started very recently
+func (h *Handler) dnsmasqJustStarted() bool {
+	return h.now().Unix()-h.startEpoch < int64(startTimeThreshold.Seconds())
+}
+
+// dnsmasqJustReloaded returns true if the dnsmasq instance has received a SIGHUP very recently
+func (h *Handler) dnsmasqJustReloaded() bool {
+	return h.reloadEpoch > 0 && h.now().Unix()-h.reloadEpoch < int64(startTimeThreshold.Seconds())
+}
+
+// Handle processes a single event.
+// It returns true if the tracker DB has been updated.
+//
+// IMPORTANT:
+// We do something only when MODE==add, which means a new DHCP lease was given, which means the
+// DHCP client was talking with the DHCP server, or when MODE==old, which means the DHCP client
+// renewed its lease.
+// We purposely exclude events produced at the start of dnsmasq, and after the SIGHUP sent by the
+// uibackend whenever the IP address reservations created from the web UI change, since they do
+// not indicate the DHCP client is really alive.
+// According to docs:
+//
+//	"""
+//	 At dnsmasq startup, the script will be invoked for all existing leases as they are read from
+//	 the lease file. Expired leases will be called with "del" and others with "old".
+//	 When dnsmasq receives a HUP signal, the script will be invoked for existing leases with an "old" event.
+//	"""
+func (h *Handler) Handle(ev Event) (bool, error) {
+	switch ev.Mode {
+	case ModeAdd:
+		// always process
+
+	case ModeOld:
+		// at dnsmasq startup we get a bunch of these 'old' updates -- we need to filter them out
+		if h.dnsmasqJustStarted() {
+			// reduce logging at startup: do not log anything
+			return false, nil
+		}
+		// the same happens every time the uibackend asks dnsmasq to read again the hostsfile
+		if h.dnsmasqJustReloaded() {
+			return false, nil
+		}
+
+	default:
+		h.logger.Infof("*** Triggered with %s ***", ev.String())
+		h.logger.Infof("Ignoring this trigger")
+		return false, nil
+	}
+
+	h.logger.Infof("*** Triggered with %s ***", ev.String())
+	if ev.MacAddr == nil {
+		// the tracker DB identifies the DHCP clients by their MAC address
+		h.logger.Infof("Ignoring DHCPv6 client with unknown MAC address")
+		return false, nil
+	}
+
+	client := trackerdb.DhcpClient{
+		MacAddr:              ev.MacAddr,
+		Hostname:             ev.Hostname,
+		LastSeen:             h.now(),
+		DhcpServerStartEpoch: int(h.startEpoch),
+		LastIP:               ev.IPAddr,
+	}
+	if err := h.db.TrackNewDhcpClient(client); err != nil {
+		return false, fmt.Errorf("failed to add/update client %s: %w", client.String(), err)
+	}
+
+	h.logger.Infof("Stored in trackerDB updated information for client mac=%s, hostname=%s: last_seen=%s, dhcp_server_start_epoch=%d",
+		client.MacAddr, client.Hostname, client.LastSeen.UTC().Format(time.RFC3339), client.DhcpServerStartEpoch)
+	return true, nil
+}
+
+// readEpoch reads an epoch from the given file, e.g. the one at which dnsmasq was started, as written
+// by the dnsmasq-init script
+func readEpoch(filename string) (int64, error) {
+	content, err := os.ReadFile(filename) //nolint:gosec
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(content)), 10, 64)
+}
+
+// newLogWriter returns the io.Writer used for logging.
+// Unfortunately logging to stdout does not produce any output, since dnsmasq ignores the
+// output of the DHCP script. Logging to a file implies also handling its rotation/cleanup...
+// so instead we log to a Unix socket and we have a basic 'socat' server that acts as log proxy;
+// see the /etc/s6-overlay/s6-rc.d/log-helper for more details.
+func newLogWriter() (io.Writer, func()) {
+	conn, err := net.Dial("unix", logSocket)
+	if err != nil {
+		// the log-helper is not running, e.g. because we're being launched manually
+		return os.Stderr, func() {}
+	}
+	return conn, func() { _ = conn.Close() }
+}
+
+// Run is the entrypoint of the "dhcp-script" mode of the backend binary, invoked by dnsmasq
+// with the arguments described in ParseArgs. It returns the process exit code.
+func Run(args []string) int {
+	w, closeLog := newLogWriter()
+	defer closeLog()
+	logger := logger.NewCustomLoggerWithWriter("dnsmasq-script", w)
+
+	ev, err := ParseArgs(args)
+	if err != nil {
+		logger.Warnf("invalid arguments %v: %s", args, err.Error())
+		return 1
+	}
+	if ev.MacAddr == nil && ev.DUID != nil {
+		// dnsmasq provides the MAC address of DHCPv6 clients when it's known, e.g. from the neighbor cache
+		ev.MacAddr, _ = net.ParseMAC(os.Getenv(dnsmasqMacEnvVar))
+	}
+
+	startEpoch, err := readEpoch(defaultStartEpoch)
+	if err != nil {
+		// this is a sign something's wrong...
+		logger.Warnf("failed to read the start epoch from %s: %s", defaultStartEpoch, err.Error())
+		startEpoch = 1
+	}
+
+	db, err := trackerdb.NewDhcpClientTrackerDB(defaultDhcpClientTrackerDB)
+	if err != nil {
+		logger.Warnf("failed to open tracker DB %s: %s", defaultDhcpClientTrackerDB, err.Error())
+		return 1
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	h := NewHandler(logger, db, startEpoch)
+	// a missing reload epoch is fine: dnsmasq has never been reloaded by the uibackend
+	if reloadEpoch, err := readEpoch(defaultReloadEpoch); err == nil {
+		h.SetReloadEpoch(reloadEpoch)
+	}
+
+	if _, err := h.Handle(ev); err != nil {
+		logger.Warnf("%s. Expect inconsistencies.", err.Error())
+		return 1
+	}
+	return 0
+}
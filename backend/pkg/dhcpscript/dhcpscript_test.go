@@ -0,0 +1,247 @@
+package dhcpscript
+
+import (
+	"bytes"
+	"dnsmasq-dhcp-backend/pkg/duid"
+	"dnsmasq-dhcp-backend/pkg/logger"
+	"dnsmasq-dhcp-backend/pkg/trackerdb"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// MustParseMAC acts like ParseMAC but panics if in case of an error
+func MustParseMAC(s string) net.HardwareAddr {
+	mac, err := net.ParseMAC(s)
+	if err != nil {
+		panic(err)
+	}
+	return mac
+}
+
+func newTestHandler(now time.Time, startEpoch int64) (*Handler, *trackerdb.DhcpClientTrackerDB, *bytes.Buffer) {
+	var logs bytes.Buffer
+	db := trackerdb.NewTestDB()
+	h := NewHandler(logger.NewCustomLoggerWithWriter("unit tests", &logs), &db, startEpoch)
+	h.now = func() time.Time { return now }
+	return h, &db, &logs
+}
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		expected    Event
+		expectError bool
+	}{
+		{
+			name: "add with hostname",
+			args: []string{"add", "aa:bb:cc:dd:ee:ff", "192.168.1.10", "my-host"},
+			expected: Event{
+				Mode: ModeAdd, MacAddr: MustParseMAC("aa:bb:cc:dd:ee:ff"),
+				IPAddr: netip.MustParseAddr("192.168.1.10"), Hostname: "my-host",
+			},
+		},
+		{
+			name: "old without hostname",
+			args: []string{"old", "aa:bb:cc:dd:ee:ff", "192.168.1.10"},
+			expected: Event{
+				Mode: ModeOld, MacAddr: MustParseMAC("aa:bb:cc:dd:ee:ff"),
+				IPAddr: netip.MustParseAddr("192.168.1.10"),
+			},
+		},
+		{
+			name: "DHCPv6 with MAC address in the DUID",
+			args: []string{"add", "00:01:00:01:2d:aa:bb:cc:aa:bb:cc:dd:ee:ff", "fd00::10", "my-host"},
+			expected: Event{
+				Mode: ModeAdd, MacAddr: MustParseMAC("aa:bb:cc:dd:ee:ff"),
+				IPAddr: netip.MustParseAddr("fd00::10"), Hostname: "my-host",
+				DUID: duid.DUID{0, 1, 0, 1, 0x2d, 0xaa, 0xbb, 0xcc, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff},
+			},
+		},
+		{
+			name: "DHCPv6 without MAC address in the DUID",
+			args: []string{"old", "00:02:00:00:ab:11:e1:6a", "fd00::10"},
+			expected: Event{
+				Mode: ModeOld, IPAddr: netip.MustParseAddr("fd00::10"),
+				DUID: duid.DUID{0, 2, 0, 0, 0xab, 0x11, 0xe1, 0x6a},
+			},
+		},
+		{
+			name:        "invalid DUID",
+			args:        []string{"add", "aa:bb:cc:dd:ee:ff:zz", "fd00::10"},
+			expectError: true,
+		},
+		{
+			name:     "other modes are not parsed",
+			args:     []string{"tftp", "1234", "192.168.1.10", "/some/file"},
+			expected: Event{Mode: "tftp"},
+		},
+		{
+			name:        "no args",
+			args:        []string{},
+			expectError: true,
+		},
+		{
+			name:        "missing IP",
+			args:        []string{"add", "aa:bb:cc:dd:ee:ff"},
+			expectError: true,
+		},
+		{
+			name:        "invalid MAC",
+			args:        []string{"add", "not-a-mac", "192.168.1.10"},
+			expectError: true,
+		},
+		{
+			name:        "invalid IP",
+			args:        []string{"add", "aa:bb:cc:dd:ee:ff", "192.168.1"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ev, err := ParseArgs(tt.args)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, ev)
+		})
+	}
+}
+
+func TestHandle(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	startEpoch := now.Add(-time.Hour).Unix()
+	mac := MustParseMAC("aa:bb:cc:dd:ee:ff")
+
+	tests := []struct {
+		name          string
+		event         Event
+		expectStored  bool
+		expectedEpoch int64
+	}{
+		{
+			name:         "add is stored",
+			event:        Event{Mode: ModeAdd, MacAddr: mac, IPAddr: netip.MustParseAddr("192.168.1.10"), Hostname: "host"},
+			expectStored: true,
+		},
+		{
+			name:         "old is stored when dnsmasq is running since a while",
+			event:        Event{Mode: ModeOld, MacAddr: mac, IPAddr: netip.MustParseAddr("192.168.1.10"), Hostname: "host"},
+			expectStored: true,
+		},
+		{
+			name:         "DHCPv6 client with unknown MAC address is ignored",
+			event:        Event{Mode: ModeAdd, IPAddr: netip.MustParseAddr("fd00::10"), DUID: duid.DUID{0, 2, 0, 0, 0xab, 0x11}},
+			expectStored: false,
+		},
+		{
+			name:         "del is ignored",
+			event:        Event{Mode: ModeDel, MacAddr: mac, IPAddr: netip.MustParseAddr("192.168.1.10"), Hostname: "host"},
+			expectStored: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, db, _ := newTestHandler(now, startEpoch)
+
+			stored, err := h.Handle(tt.event)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectStored, stored)
+
+			client, err := db.GetDhcpClient(mac)
+			if !tt.expectStored {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "host", client.Hostname)
+			assert.True(t, client.LastSeen.Equal(now))
+
+			dead, err := db.GetDeadDhcpClients(nil)
+			require.NoError(t, err)
+			require.Len(t, dead, 1)
+			assert.Equal(t, int(startEpoch), dead[0].DhcpServerStartEpoch)
+		})
+	}
+}
+
+func TestHandle_OldEventsAtStartupAreIgnored(t *testing.T) {
+	now := time.Now()
+	h, db, logs := newTestHandler(now, now.Add(-time.Second).Unix())
+
+	stored, err := h.Handle(Event{Mode: ModeOld, MacAddr: MustParseMAC("aa:bb:cc:dd:ee:ff"), IPAddr: netip.MustParseAddr("192.168.1.10")})
+	require.NoError(t, err)
+	assert.False(t, stored)
+	assert.Empty(t, logs.String())
+
+	_, err = db.GetDhcpClient(MustParseMAC("aa:bb:cc:dd:ee:ff"))
+	assert.Error(t, err)
+}
+
+func TestHandle_OldEventsAfterReloadAreIgnored(t *testing.T) {
+	now := time.Now()
+	mac := MustParseMAC("aa:bb:cc:dd:ee:ff")
+	h, db, logs := newTestHandler(now, now.Add(-time.Hour).Unix())
+	h.SetReloadEpoch(now.Add(-time.Second).Unix())
+
+	stored, err := h.Handle(Event{Mode: ModeOld, MacAddr: mac, IPAddr: netip.MustParseAddr("192.168.1.10")})
+	require.NoError(t, err)
+	assert.False(t, stored)
+	assert.Empty(t, logs.String())
+
+	// a lease created right after the reload is still tracked
+	stored, err = h.Handle(Event{Mode: ModeAdd, MacAddr: mac, IPAddr: netip.MustParseAddr("192.168.1.10")})
+	require.NoError(t, err)
+	assert.True(t, stored)
+
+	// renewals happening long after the reload are tracked as well
+	h.SetReloadEpoch(now.Add(-time.Minute).Unix())
+	stored, err = h.Handle(Event{Mode: ModeOld, MacAddr: mac, IPAddr: netip.MustParseAddr("192.168.1.10")})
+	require.NoError(t, err)
+	assert.True(t, stored)
+
+	_, err = db.GetDhcpClient(mac)
+	assert.NoError(t, err)
+}
+
+func TestHandle_UntrustedHostname(t *testing.T) {
+	h, db, _ := newTestHandler(time.Now(), 1)
+
+	// this would have broken the SQL query built by the former shell script
+	hostname := `evil'); DROP TABLE dhcp_clients; --`
+	mac := MustParseMAC("aa:bb:cc:dd:ee:ff")
+	stored, err := h.Handle(Event{Mode: ModeAdd, MacAddr: mac, IPAddr: netip.MustParseAddr("192.168.1.10"), Hostname: hostname})
+	require.NoError(t, err)
+	assert.True(t, stored)
+
+	client, err := db.GetDhcpClient(mac)
+	require.NoError(t, err)
+	assert.Equal(t, hostname, client.Hostname)
+}
+
+func TestHandle_UpdatesExistingClient(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	h, db, _ := newTestHandler(now.Add(-time.Hour), 1)
+	mac := MustParseMAC("aa:bb:cc:dd:ee:ff")
+
+	_, err := h.Handle(Event{Mode: ModeAdd, MacAddr: mac, IPAddr: netip.MustParseAddr("192.168.1.10"), Hostname: "old-name"})
+	require.NoError(t, err)
+
+	h.now = func() time.Time { return now }
+	_, err = h.Handle(Event{Mode: ModeOld, MacAddr: mac, IPAddr: netip.MustParseAddr("192.168.1.10"), Hostname: "new-name"})
+	require.NoError(t, err)
+
+	client, err := db.GetDhcpClient(mac)
+	require.NoError(t, err)
+	assert.Equal(t, "new-name", client.Hostname)
+	assert.True(t, client.LastSeen.Equal(now))
+}
@@ -0,0 +1,12 @@
+/*
+Package dhcpscript implements the "dhcp-script" mode of the backend binary.
+
+dnsmasq is configured (see the --dhcp-script option in the dnsmasq man page) to run
+/opt/bin/dnsmasq-dhcp-script, a symlink to the backend binary, every time a DHCP lease
+is created, renewed or destroyed. This package takes care of storing such information in the
+"tracker DB", see the trackerdb package for more details.
+
+All SQL queries go through prepared statements since the hostname is provided by the DHCP client
+and cannot be trusted.
+*/
+package dhcpscript
@@ -0,0 +1,66 @@
+package dnsmasqctl
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Controller sends commands to the running dnsmasq instance
+type Controller interface {
+	// ReloadHostsFile asks dnsmasq to read again its --dhcp-hostsfile
+	ReloadHostsFile() error
+}
+
+// PidFileController controls the dnsmasq process whose PID is written in the dnsmasq --pid-file
+type PidFileController struct {
+	pidFile string
+
+	// reloadEpochFile receives the epoch of the last SIGHUP, so that the --dhcp-script can
+	// tell apart the "old" events triggered by the reload from real lease renewals
+	reloadEpochFile string
+}
+
+// NewPidFileController creates a Controller for the dnsmasq process writing its PID in the given file;
+// the epoch of each reload is written in reloadEpochFile before signalling dnsmasq
+func NewPidFileController(pidFile, reloadEpochFile string) *PidFileController {
+	return &PidFileController{pidFile: pidFile, reloadEpochFile: reloadEpochFile}
+}
+
+// pid returns the PID of the dnsmasq process
+func (c *PidFileController) pid() (int, error) {
+	data, err := os.ReadFile(c.pidFile) //nolint:gosec
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the dnsmasq PID file: %w", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("invalid content in the dnsmasq PID file %s", c.pidFile)
+	}
+	return pid, nil
+}
+
+// ReloadHostsFile sends a SIGHUP to dnsmasq. Note that, besides reading again the --dhcp-hostsfile,
+// dnsmasq also clears its DNS cache and runs the --dhcp-script for all existing DHCP leases:
+// the reload epoch file is written first, so that the script can ignore such "old" events.
+func (c *PidFileController) ReloadHostsFile() error {
+	pid, err := c.pid()
+	if err != nil {
+		return err
+	}
+	epoch := strconv.FormatInt(time.Now().Unix(), 10) + "\n"
+	if err := os.WriteFile(c.reloadEpochFile, []byte(epoch), 0o644); err != nil { //nolint:gosec
+		return fmt.Errorf("failed to write the dnsmasq reload epoch: %w", err)
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	if err := process.Signal(syscall.SIGHUP); err != nil {
+		return fmt.Errorf("failed to send SIGHUP to dnsmasq (PID %d): %w", pid, err)
+	}
+	return nil
+}
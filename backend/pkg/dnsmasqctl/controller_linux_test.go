@@ -0,0 +1,49 @@
+//go:build linux
+
+package dnsmasqctl
+
+import (
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPidFileController(t *testing.T) {
+	dir := t.TempDir()
+	pidFile := dir + "/dnsmasq.pid"
+	reloadEpochFile := dir + "/reloadepoch"
+
+	c := NewPidFileController(pidFile, reloadEpochFile)
+	assert.Error(t, c.ReloadHostsFile(), "missing PID file")
+
+	require.NoError(t, os.WriteFile(pidFile, []byte("not a PID\n"), 0o600))
+	assert.Error(t, c.ReloadHostsFile(), "invalid PID file")
+
+	// use this process in place of dnsmasq
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	require.NoError(t, os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o600))
+	before := time.Now().Unix()
+	require.NoError(t, c.ReloadHostsFile())
+	select {
+	case <-hup:
+	case <-time.After(5 * time.Second):
+		t.Fatal("SIGHUP not received")
+	}
+
+	// the reload epoch must be available to the --dhcp-script before dnsmasq runs it
+	data, err := os.ReadFile(reloadEpochFile) //nolint:gosec
+	require.NoError(t, err)
+	epoch, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, epoch, before)
+}
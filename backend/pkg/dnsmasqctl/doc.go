@@ -0,0 +1,13 @@
+/*
+Package dnsmasqctl manages the IP address reservations created at runtime, i.e. without restarting
+the addon, and the interaction with the running dnsmasq instance needed to apply them.
+
+The runtime reservations are stored in a file owned by the backend, which dnsmasq reads through
+its --dhcp-hostsfile option. Each line of that file uses the same syntax of a --dhcp-host option;
+dnsmasq reads the file again every time it receives a SIGHUP (see the dnsmasq man page).
+
+Sending commands to dnsmasq is abstracted by the Controller interface: the real implementation
+signals the dnsmasq process whose PID is found in the dnsmasq --pid-file; unit tests instead use
+the in-process FakeController.
+*/
+package dnsmasqctl
@@ -0,0 +1,35 @@
+package dnsmasqctl
+
+import "sync"
+
+// FakeController is an in-process Controller for unit tests: it just counts the commands received
+type FakeController struct {
+	lock    sync.Mutex
+	reloads int
+
+	// Err, if set, is returned by all commands
+	Err error
+}
+
+// NewFakeController creates a FakeController which never fails
+func NewFakeController() *FakeController {
+	return &FakeController{}
+}
+
+// ReloadHostsFile records the request to read again the hosts file
+func (c *FakeController) ReloadHostsFile() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.Err != nil {
+		return c.Err
+	}
+	c.reloads++
+	return nil
+}
+
+// Reloads returns the number of successful calls to ReloadHostsFile
+func (c *FakeController) Reloads() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.reloads
+}
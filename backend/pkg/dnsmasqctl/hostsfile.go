@@ -0,0 +1,170 @@
+package dnsmasqctl
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// HostsFileEntry is a single line of a dnsmasq --dhcp-hostsfile, i.e. a static IP address reservation
+type HostsFileEntry struct {
+	Mac net.HardwareAddr
+	IP  netip.Addr
+
+	// Name is the hostname assigned to the DHCP client; maybe empty
+	Name string
+
+	// LeaseTime uses the dnsmasq syntax, e.g. "12h" or "infinite"; maybe empty
+	LeaseTime string
+}
+
+var (
+	// a lease time, as accepted by dnsmasq
+	leaseTimeRegex = regexp.MustCompile(`^([0-9]+[smhdw]?|infinite)$`)
+
+	// a single DNS label: dnsmasq refuses hostnames containing other characters
+	hostnameRegex = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?$`)
+)
+
+// the header written at the top of the hosts file
+const hostsFileHeader = "# This file is managed by the dnsmasq-DHCP addon backend: DO NOT EDIT.\n" +
+	"# Each line is an IP address reservation created from the web UI, using the --dhcp-host syntax.\n"
+
+// IsValidHostname checks if the given name can be used as hostname in a HostsFileEntry
+func IsValidHostname(name string) bool {
+	// a name looking like a lease time would be mistaken for one by dnsmasq
+	return hostnameRegex.MatchString(name) && !leaseTimeRegex.MatchString(name)
+}
+
+// String returns the entry formatted as a line of the hosts file, e.g. "aa:bb:cc:dd:ee:ff,laptop,192.168.1.10,12h";
+// IPv6 addresses are enclosed in brackets, as required by dnsmasq, e.g. "aa:bb:cc:dd:ee:ff,laptop,[fd00::10]"
+func (e HostsFileEntry) String() string {
+	fields := []string{e.Mac.String()}
+	if e.Name != "" {
+		fields = append(fields, e.Name)
+	}
+	if e.IP.Is6() {
+		fields = append(fields, "["+e.IP.String()+"]")
+	} else {
+		fields = append(fields, e.IP.String())
+	}
+	if e.LeaseTime != "" {
+		fields = append(fields, e.LeaseTime)
+	}
+	return strings.Join(fields, ",")
+}
+
+// ParseHostsFileEntry parses a single line of the hosts file; only the subset of the --dhcp-host
+// syntax produced by HostsFileEntry.String() is supported
+func ParseHostsFileEntry(line string) (HostsFileEntry, error) {
+	var e HostsFileEntry
+	for _, field := range strings.Split(strings.TrimSpace(line), ",") {
+		field = strings.TrimSpace(field)
+		if mac, err := net.ParseMAC(field); err == nil && e.Mac == nil {
+			e.Mac = mac
+		} else if ip, err := parseHostsFileIP(field); err == nil && !e.IP.IsValid() {
+			e.IP = ip
+		} else if leaseTimeRegex.MatchString(field) && e.LeaseTime == "" {
+			e.LeaseTime = field
+		} else if IsValidHostname(field) && e.Name == "" {
+			e.Name = field
+		} else {
+			return e, fmt.Errorf("unexpected field %q", field)
+		}
+	}
+
+	if e.Mac == nil || !e.IP.IsValid() {
+		return e, errors.New("both the MAC address and the IP address are required")
+	}
+	return e, nil
+}
+
+// parseHostsFileIP parses an IPv4 address or a bracketed IPv6 address, e.g. "[fd00::10]"
+func parseHostsFileIP(field string) (netip.Addr, error) {
+	if inner, ok := strings.CutPrefix(field, "["); ok {
+		inner, ok = strings.CutSuffix(inner, "]")
+		if !ok {
+			return netip.Addr{}, fmt.Errorf("missing closing bracket in %q", field)
+		}
+		ip, err := netip.ParseAddr(inner)
+		if err != nil || !ip.Is6() {
+			return netip.Addr{}, fmt.Errorf("invalid IPv6 address %q", field)
+		}
+		return ip, nil
+	}
+	ip, err := netip.ParseAddr(field)
+	if err != nil || !ip.Is4() {
+		// unbracketed IPv6 addresses are ambiguous for dnsmasq
+		return netip.Addr{}, fmt.Errorf("invalid IPv4 address %q", field)
+	}
+	return ip, nil
+}
+
+// ReadHostsFile reads all the entries of the given hosts file; a missing file is equivalent to an empty file
+func ReadHostsFile(path string) ([]HostsFileEntry, error) {
+	data, err := os.ReadFile(path) //nolint:gosec
+	if errors.Is(err, os.ErrNotExist) {
+		return []HostsFileEntry{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	entries := make([]HostsFileEntry, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		e, err := ParseHostsFileEntry(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNum, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// WriteHostsFile replaces the content of the given hosts file with the given entries, sorted by IP address.
+// The file is replaced atomically, so that dnsmasq never reads a partially-written file.
+func WriteHostsFile(path string, entries []HostsFileEntry) error {
+	sorted := slices.Clone(entries)
+	slices.SortFunc(sorted, func(a, b HostsFileEntry) int {
+		return a.IP.Compare(b.IP)
+	})
+
+	var buf bytes.Buffer
+	buf.WriteString(hostsFileHeader)
+	for _, e := range sorted {
+		buf.WriteString(e.String() + "\n")
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// no-op once the rename succeeded
+		_ = os.Remove(tmp.Name())
+	}()
+
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil { //nolint:gosec
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
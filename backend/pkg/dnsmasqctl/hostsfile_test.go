@@ -0,0 +1,119 @@
+package dnsmasqctl
+
+import (
+	"net"
+	"net/netip"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustParseMAC(s string) net.HardwareAddr {
+	mac, err := net.ParseMAC(s)
+	if err != nil {
+		panic(err)
+	}
+	return mac
+}
+
+func TestParseHostsFileEntry(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected HostsFileEntry
+		wantErr  bool
+	}{
+		{
+			line:     "aa:bb:cc:dd:ee:ff,laptop,192.168.1.10,12h",
+			expected: HostsFileEntry{Mac: mustParseMAC("aa:bb:cc:dd:ee:ff"), IP: netip.MustParseAddr("192.168.1.10"), Name: "laptop", LeaseTime: "12h"},
+		},
+		{
+			// any order is accepted, like dnsmasq does
+			line:     " 192.168.1.11 , AA:BB:CC:DD:EE:00 ",
+			expected: HostsFileEntry{Mac: mustParseMAC("aa:bb:cc:dd:ee:00"), IP: netip.MustParseAddr("192.168.1.11")},
+		},
+		{
+			line:     "aa:bb:cc:dd:ee:ff,laptop,[fd00::10],infinite",
+			expected: HostsFileEntry{Mac: mustParseMAC("aa:bb:cc:dd:ee:ff"), IP: netip.MustParseAddr("fd00::10"), Name: "laptop", LeaseTime: "infinite"},
+		},
+		{line: "aa:bb:cc:dd:ee:ff,laptop", wantErr: true},
+		{line: "aa:bb:cc:dd:ee:ff,fd00::10", wantErr: true},
+		{line: "aa:bb:cc:dd:ee:ff,[fd00::10", wantErr: true},
+		{line: "aa:bb:cc:dd:ee:ff,[192.168.1.10]", wantErr: true},
+		{line: "192.168.1.10,laptop", wantErr: true},
+		{line: "aa:bb:cc:dd:ee:ff,192.168.1.10,set:tag", wantErr: true},
+		{line: "aa:bb:cc:dd:ee:ff,192.168.1.10,192.168.1.11", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			e, err := ParseHostsFileEntry(tt.line)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, e)
+		})
+	}
+}
+
+func TestHostsFileEntryString(t *testing.T) {
+	e := HostsFileEntry{Mac: mustParseMAC("aa:bb:cc:dd:ee:ff"), IP: netip.MustParseAddr("192.168.1.10"), Name: "laptop", LeaseTime: "12h"}
+	assert.Equal(t, "aa:bb:cc:dd:ee:ff,laptop,192.168.1.10,12h", e.String())
+
+	e = HostsFileEntry{Mac: mustParseMAC("aa:bb:cc:dd:ee:ff"), IP: netip.MustParseAddr("fd00::10")}
+	assert.Equal(t, "aa:bb:cc:dd:ee:ff,[fd00::10]", e.String())
+
+	parsed, err := ParseHostsFileEntry(e.String())
+	require.NoError(t, err)
+	assert.Equal(t, e, parsed)
+}
+
+func TestIsValidHostname(t *testing.T) {
+	assert.True(t, IsValidHostname("laptop"))
+	assert.True(t, IsValidHostname("living-room-tv2"))
+	assert.False(t, IsValidHostname(""))
+	assert.False(t, IsValidHostname("my laptop"))
+	assert.False(t, IsValidHostname("laptop.lan"))
+	assert.False(t, IsValidHostname("-laptop"))
+	assert.False(t, IsValidHostname("12h"))
+	assert.False(t, IsValidHostname("infinite"))
+}
+
+func TestReadWriteHostsFile(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/dnsmasq.hosts"
+
+	// a missing file contains no reservations
+	entries, err := ReadHostsFile(path)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	written := []HostsFileEntry{
+		{Mac: mustParseMAC("aa:bb:cc:dd:ee:02"), IP: netip.MustParseAddr("192.168.1.20"), LeaseTime: "infinite"},
+		{Mac: mustParseMAC("aa:bb:cc:dd:ee:01"), IP: netip.MustParseAddr("192.168.1.3"), Name: "printer", LeaseTime: "infinite"},
+	}
+	require.NoError(t, WriteHostsFile(path, written))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, hostsFileHeader+
+		"aa:bb:cc:dd:ee:01,printer,192.168.1.3,infinite\n"+
+		"aa:bb:cc:dd:ee:02,192.168.1.20,infinite\n", string(data))
+
+	entries, err = ReadHostsFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, []HostsFileEntry{written[1], written[0]}, entries)
+
+	// no temporary files are left behind
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	// errors report the line number
+	require.NoError(t, os.WriteFile(path, []byte("# comment\n\naa:bb:cc:dd:ee:01,not valid,192.168.1.3\n"), 0o600))
+	_, err = ReadHostsFile(path)
+	assert.ErrorContains(t, err, "dnsmasq.hosts:3")
+}
@@ -0,0 +1,11 @@
+/*
+Package duid handles the DHCP Unique Identifiers (DUIDs, RFC 8415) used by DHCPv6 clients to identify
+themselves, in place of the MAC address used by DHCPv4 clients.
+
+dnsmasq writes DUIDs as colon-separated hex bytes, both in the lease file and in the arguments of
+the DHCP script. The MAC address of the client can be recovered from the link-layer DUIDs (DUID-LLT
+and DUID-LL) of Ethernet interfaces; DHCPv4 clients following RFC 4361 (e.g. systemd-networkd) send
+their DUID inside the DHCPv4 client identifier, which allows matching the DHCPv4 and DHCPv6 leases of
+dual-stack clients.
+*/
+package duid
@@ -0,0 +1,77 @@
+package duid
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// DUID types defined in RFC 8415, section 11, carrying a link-layer address
+const (
+	typeLLT = 1 // link-layer address plus time
+	typeLL  = 3 // link-layer address
+)
+
+// hardwareTypeEthernet is the hardware type of Ethernet link-layer addresses, as assigned by IANA
+const hardwareTypeEthernet = 1
+
+// clientIDTypeRFC4361 is the first byte of the DHCPv4 client identifiers containing an IAID and a DUID
+const clientIDTypeRFC4361 = 0xff
+
+// DUID is a DHCP Unique Identifier
+type DUID []byte
+
+// Parse parses a DUID written as hex bytes, optionally separated by colons, like dnsmasq does
+func Parse(s string) (DUID, error) {
+	b, err := hex.DecodeString(strings.ReplaceAll(s, ":", ""))
+	if err != nil || len(b) < 2 {
+		return nil, fmt.Errorf("invalid DUID %q", s)
+	}
+	return DUID(b), nil
+}
+
+// String returns the DUID as colon-separated lowercase hex bytes
+func (d DUID) String() string {
+	var sb strings.Builder
+	for i, b := range d {
+		if i > 0 {
+			sb.WriteByte(':')
+		}
+		sb.WriteString(hex.EncodeToString([]byte{b}))
+	}
+	return sb.String()
+}
+
+// HardwareAddr returns the MAC address found inside DUID-LLT and DUID-LL identifiers of Ethernet
+// interfaces, or nil for the other DUIDs
+func (d DUID) HardwareAddr() net.HardwareAddr {
+	if len(d) < 4 || binary.BigEndian.Uint16(d[2:4]) != hardwareTypeEthernet {
+		return nil
+	}
+	var lladdr []byte
+	switch binary.BigEndian.Uint16(d[0:2]) {
+	case typeLLT:
+		if len(d) >= 8 {
+			lladdr = d[8:]
+		}
+	case typeLL:
+		lladdr = d[4:]
+	}
+	if len(lladdr) != 6 {
+		return nil
+	}
+	return net.HardwareAddr(append([]byte{}, lladdr...))
+}
+
+// FromClientID returns the DUID carried by a DHCPv4 client identifier following RFC 4361, i.e. the
+// byte 0xff followed by a 4-byte IAID and by the DUID, or nil for the other client identifiers.
+// The client identifier is written as colon-separated hex bytes, like in the dnsmasq lease file.
+func FromClientID(clientID string) DUID {
+	b, err := hex.DecodeString(strings.ReplaceAll(clientID, ":", ""))
+	if err != nil || len(b) < 1+4+2 || b[0] != clientIDTypeRFC4361 {
+		return nil
+	}
+	return DUID(b[5:])
+}
@@ -0,0 +1,49 @@
+package duid
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	d, err := Parse("00:01:00:01:2D:AA:BB:CC:aa:bb:cc:dd:ee:ff")
+	require.NoError(t, err)
+	assert.Equal(t, "00:01:00:01:2d:aa:bb:cc:aa:bb:cc:dd:ee:ff", d.String())
+
+	d, err = Parse("000300010011223344ff")
+	require.NoError(t, err)
+	assert.Equal(t, "00:03:00:01:00:11:22:33:44:ff", d.String())
+
+	for _, s := range []string{"", "00", "zz:01", "00:0"} {
+		_, err = Parse(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestHardwareAddr(t *testing.T) {
+	for s, expected := range map[string]string{
+		"00:01:00:01:2d:aa:bb:cc:aa:bb:cc:dd:ee:ff":                   "aa:bb:cc:dd:ee:ff", // DUID-LLT
+		"00:03:00:01:00:11:22:33:44:55":                               "00:11:22:33:44:55", // DUID-LL
+		"00:03:00:06:00:11:22:33:44:55":                               "",                  // not Ethernet
+		"00:02:00:00:ab:11:e1:6a:6b:b7:37:41:8e:2a:e8:31:65:7c:1b:5a": "",                  // DUID-EN
+		"00:04:7d:0c:38:55:3c:8e:46:47:9c:c4:43:d6:0b:ae:9a:a1":       "",                  // DUID-UUID
+		"00:01:00:01:2d:aa":                                           "",                  // truncated
+	} {
+		d, err := Parse(s)
+		require.NoError(t, err)
+		if expected == "" {
+			assert.Nil(t, d.HardwareAddr(), s)
+		} else {
+			assert.Equal(t, expected, d.HardwareAddr().String(), s)
+		}
+	}
+}
+
+func TestFromClientID(t *testing.T) {
+	assert.Equal(t, "00:03:00:01:00:11:22:33:44:55", FromClientID("ff:12:34:56:78:00:03:00:01:00:11:22:33:44:55").String())
+	assert.Nil(t, FromClientID("01:00:11:22:33:44:55"))
+	assert.Nil(t, FromClientID("ff:12:34"))
+	assert.Nil(t, FromClientID("*"))
+}
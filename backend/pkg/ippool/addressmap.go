@@ -0,0 +1,148 @@
+package ippool
+
+import (
+	"net/netip"
+)
+
+/* -------------------------------------------------------------------------- */
+/*                                 AddressMap                                 */
+/* -------------------------------------------------------------------------- */
+
+// AddressClass tells how an IP address of a network is being used
+type AddressClass string
+
+const (
+	// AddressNetwork is the network address or, for IPv4 networks, the broadcast address
+	AddressNetwork AddressClass = "network"
+	// AddressGateway is the gateway of the network
+	AddressGateway AddressClass = "gateway"
+	// AddressReserved is reserved for a DHCP client and lies outside the DHCP ranges
+	AddressReserved AddressClass = "reserved"
+	// AddressReservedInPool is reserved for a DHCP client and lies inside a DHCP range
+	AddressReservedInPool AddressClass = "reserved_in_pool"
+	// AddressLeased is dynamically leased to a DHCP client
+	AddressLeased AddressClass = "leased"
+	// AddressFree lies inside a DHCP range and is neither reserved nor leased
+	AddressFree AddressClass = "free"
+	// AddressSeen lies outside the DHCP ranges and has been used in the past by a DHCP client
+	AddressSeen AddressClass = "seen"
+	// AddressUnused lies outside the DHCP ranges and has never been used by a DHCP client
+	AddressUnused AddressClass = "unused"
+)
+
+// AddressClasses lists all the AddressClass values, in order of precedence: an IP address
+// matching several classes (e.g. a reserved IP address which is also leased) gets the first one
+var AddressClasses = []AddressClass{
+	AddressNetwork, AddressGateway, AddressReserved, AddressReservedInPool,
+	AddressLeased, AddressFree, AddressSeen, AddressUnused,
+}
+
+// NetworkAddresses describes the IP addresses of a network known to the DHCP server
+type NetworkAddresses struct {
+	Network netip.Prefix
+	Gateway netip.Addr
+
+	// Pool contains the DHCP ranges; ranges outside the network are ignored
+	Pool Pool
+
+	// Reserved are the IP addresses of the IP address reservations
+	Reserved []netip.Addr
+	// Leased are the IP addresses currently leased to DHCP clients
+	Leased []netip.Addr
+	// Seen are the IP addresses that were leased in the past to DHCP clients
+	Seen []netip.Addr
+}
+
+// ClassifiedAddress is an IP address together with its AddressClass
+type ClassifiedAddress struct {
+	Addr  netip.Addr
+	Class AddressClass
+}
+
+// AddressMap is the classification of (a part of) the IP addresses of a network
+type AddressMap struct {
+	Network netip.Prefix
+
+	// Addresses are consecutive IP addresses of the network, in ascending order
+	Addresses []ClassifiedAddress
+
+	// Counts is the number of Addresses for each AddressClass
+	Counts map[AddressClass]int64
+
+	// Next is the IP address following the last of Addresses, if the network has more IP addresses
+	// than the ones classified; it is invalid otherwise
+	Next netip.Addr
+}
+
+// addressSet converts a list of IP addresses into a set
+func addressSet(ips []netip.Addr) map[netip.Addr]struct{} {
+	ret := make(map[netip.Addr]struct{}, len(ips))
+	for _, ip := range ips {
+		ret[ip.Unmap()] = struct{}{}
+	}
+	return ret
+}
+
+// ClassifyNetwork classifies up to maxAddresses IP addresses of the network, starting from the IP address
+// "from" or from the first IP address of the network if "from" is invalid. Classifying the network in chunks
+// allows to walk through large networks, IPv6 ones in particular.
+func ClassifyNetwork(n NetworkAddresses, from netip.Addr, maxAddresses int) AddressMap {
+	network := n.Network.Masked()
+	ret := AddressMap{
+		Network:   network,
+		Addresses: []ClassifiedAddress{},
+		Counts:    make(map[AddressClass]int64),
+	}
+	if !network.IsValid() {
+		return ret
+	}
+
+	r := NewRangeFromPrefix(network)
+	networkAddr, broadcastAddr := specialAddrs(network)
+
+	reserved := addressSet(n.Reserved)
+	leased := addressSet(n.Leased)
+	seen := addressSet(n.Seen)
+	classify := func(ip netip.Addr) AddressClass {
+		_, isReserved := reserved[ip]
+		_, isLeased := leased[ip]
+		_, isSeen := seen[ip]
+		inPool := n.Pool.Contains(ip)
+		switch {
+		case ip == networkAddr || ip == broadcastAddr:
+			return AddressNetwork
+		case ip == n.Gateway.Unmap():
+			return AddressGateway
+		case isReserved && !inPool:
+			return AddressReserved
+		case isReserved:
+			return AddressReservedInPool
+		case isLeased:
+			return AddressLeased
+		case inPool:
+			return AddressFree
+		case isSeen:
+			return AddressSeen
+		default:
+			return AddressUnused
+		}
+	}
+
+	if from.IsValid() {
+		from = from.Unmap()
+		if !network.Contains(from) {
+			return ret
+		}
+		r.Start = from
+	}
+	for ip := range r.All() {
+		if len(ret.Addresses) == maxAddresses {
+			ret.Next = ip
+			break
+		}
+		class := classify(ip)
+		ret.Addresses = append(ret.Addresses, ClassifiedAddress{Addr: ip, Class: class})
+		ret.Counts[class]++
+	}
+	return ret
+}
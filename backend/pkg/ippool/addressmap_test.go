@@ -0,0 +1,95 @@
+package ippool
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyNetwork(t *testing.T) {
+	n := NetworkAddresses{
+		Network:  netip.MustParsePrefix("192.168.1.0/28"),
+		Gateway:  netip.MustParseAddr("192.168.1.1"),
+		Pool:     NewPoolFromString("192.168.1.8", "192.168.1.12"),
+		Reserved: parseAddrs("192.168.1.3", "192.168.1.9"),
+		Leased:   parseAddrs("192.168.1.9", "192.168.1.10", "::ffff:192.168.1.4", "192.168.2.10"),
+		Seen:     parseAddrs("192.168.1.5", "192.168.1.11"),
+	}
+
+	m := ClassifyNetwork(n, netip.Addr{}, 100)
+	assert.Equal(t, netip.MustParsePrefix("192.168.1.0/28"), m.Network)
+	assert.False(t, m.Next.IsValid())
+	expected := []AddressClass{
+		AddressNetwork,        // .0
+		AddressGateway,        // .1
+		AddressUnused,         // .2
+		AddressReserved,       // .3
+		AddressLeased,         // .4 leased outside the DHCP range
+		AddressSeen,           // .5
+		AddressUnused,         // .6
+		AddressUnused,         // .7
+		AddressFree,           // .8
+		AddressReservedInPool, // .9 both reserved and leased
+		AddressLeased,         // .10
+		AddressFree,           // .11 seen in the past but now free
+		AddressFree,           // .12
+		AddressUnused,         // .13
+		AddressUnused,         // .14
+		AddressNetwork,        // .15 broadcast
+	}
+	require.Len(t, m.Addresses, len(expected))
+	for i, a := range m.Addresses {
+		assert.Equal(t, netip.AddrFrom4([4]byte{192, 168, 1, byte(i)}), a.Addr)
+		assert.Equal(t, expected[i], a.Class, a.Addr.String())
+	}
+	assert.Equal(t, map[AddressClass]int64{
+		AddressNetwork: 2, AddressGateway: 1, AddressReserved: 1, AddressReservedInPool: 1,
+		AddressLeased: 2, AddressFree: 3, AddressSeen: 1, AddressUnused: 5,
+	}, m.Counts)
+
+	// the network can be classified in chunks
+	m = ClassifyNetwork(n, netip.MustParseAddr("192.168.1.4"), 3)
+	require.Len(t, m.Addresses, 3)
+	assert.Equal(t, "192.168.1.4", m.Addresses[0].Addr.String())
+	assert.Equal(t, "192.168.1.7", m.Next.String())
+	m = ClassifyNetwork(n, m.Next, 100)
+	assert.Len(t, m.Addresses, 9)
+	assert.False(t, m.Next.IsValid())
+
+	// starting outside the network produces an empty map
+	m = ClassifyNetwork(n, netip.MustParseAddr("192.168.2.1"), 100)
+	assert.Empty(t, m.Addresses)
+	m = ClassifyNetwork(NetworkAddresses{}, netip.Addr{}, 100)
+	assert.Empty(t, m.Addresses)
+}
+
+func TestClassifyNetwork_IPv6(t *testing.T) {
+	n := NetworkAddresses{
+		Network: netip.MustParsePrefix("fd00::/64"),
+		Gateway: netip.MustParseAddr("fe80::1"),
+		Pool:    NewPoolFromString("fd00::1000", "fd00::1fff"),
+		Leased:  parseAddrs("fd00::1001"),
+	}
+
+	m := ClassifyNetwork(n, netip.Addr{}, 2)
+	assert.Equal(t, []ClassifiedAddress{
+		{netip.MustParseAddr("fd00::"), AddressNetwork},
+		{netip.MustParseAddr("fd00::1"), AddressUnused},
+	}, m.Addresses)
+	assert.Equal(t, "fd00::2", m.Next.String())
+
+	m = ClassifyNetwork(n, netip.MustParseAddr("fd00::1000"), 2)
+	assert.Equal(t, []ClassifiedAddress{
+		{netip.MustParseAddr("fd00::1000"), AddressFree},
+		{netip.MustParseAddr("fd00::1001"), AddressLeased},
+	}, m.Addresses)
+
+	// IPv6 networks have no broadcast address
+	m = ClassifyNetwork(n, netip.MustParseAddr("fd00::ffff:ffff:ffff:ffff"), 2)
+	assert.Equal(t, []ClassifiedAddress{
+		{netip.MustParseAddr("fd00::ffff:ffff:ffff:ffff"), AddressUnused},
+	}, m.Addresses)
+	assert.False(t, m.Next.IsValid())
+}
@@ -0,0 +1,8 @@
+/*
+Package ippool implements the arithmetic on the IP address ranges served by the DHCP server.
+
+A Range is a contiguous interval of IPv4 or IPv6 addresses, based on netip.Addr; it can be created
+from its ends or from a network prefix, iterated, intersected with other ranges and measured, also when
+it is an IPv6 range too large for an int64. A Pool is the set of ranges configured in the addon.
+*/
+package ippool
@@ -0,0 +1,129 @@
+package ippool
+
+import (
+	"math"
+	"time"
+)
+
+/* -------------------------------------------------------------------------- */
+/*                                UsageHistory                                */
+/* -------------------------------------------------------------------------- */
+
+// minForecastSpan is the minimum time span of the samples used to compute a trend: over shorter
+// spans a handful of DHCP clients joining at once would forecast an imminent exhaustion
+const minForecastSpan = 5 * time.Minute
+
+// UsageSample is the number of busy (leased or reserved) IP addresses of a Range at some point in time
+type UsageSample struct {
+	Time time.Time
+	Busy int64
+}
+
+// UsageHistory keeps the usage samples of a Range over a sliding time window, to compute its trend
+// and forecast when the Range will run out of free IP addresses
+type UsageHistory struct {
+	window  time.Duration
+	samples []UsageSample
+}
+
+// UsageForecast is the outcome of UsageHistory.Forecast
+type UsageForecast struct {
+	// HasTrend is false when the samples span less than a few minutes
+	HasTrend bool
+
+	// TrendPerHour is the growth of the busy IP addresses per hour (negative if they are decreasing),
+	// computed with a linear regression over the samples of the time window
+	TrendPerHour float64
+
+	// Exhausts is true when the Range has no free IP addresses left or, according to the trend,
+	// it will run out of them after TimeToExhaustion
+	Exhausts         bool
+	TimeToExhaustion time.Duration
+}
+
+// NewUsageHistory creates an empty UsageHistory keeping the samples of the given time window
+func NewUsageHistory(window time.Duration) *UsageHistory {
+	return &UsageHistory{window: window}
+}
+
+// Add records the number of busy IP addresses at the given time; samples must be added in
+// chronological order. Only the samples changing the number of busy IP addresses are kept.
+func (h *UsageHistory) Add(t time.Time, busy int64) {
+	n := len(h.samples)
+	if n >= 2 && h.samples[n-1].Busy == busy && h.samples[n-2].Busy == busy {
+		// extend the flat segment: its first and last samples are enough for the regression
+		h.samples[n-1].Time = t
+	} else {
+		h.samples = append(h.samples, UsageSample{Time: t, Busy: busy})
+	}
+
+	// drop the samples outside the time window, but keep the last of them: it tells the number
+	// of busy IP addresses at the beginning of the time window
+	cutoff := t.Add(-h.window)
+	first := 0
+	for first+1 < len(h.samples) && !h.samples[first+1].Time.After(cutoff) {
+		first++
+	}
+	h.samples = h.samples[first:]
+}
+
+// Samples returns the samples currently kept
+func (h *UsageHistory) Samples() []UsageSample {
+	return h.samples
+}
+
+// Forecast computes the trend of the samples of the time window ending at the given time,
+// assuming the number of busy IP addresses did not change since the last sample, and uses
+// it to forecast when the Range with the given usage will run out of free IP addresses.
+func (h *UsageHistory) Forecast(now time.Time, u RangeUsage) UsageForecast {
+	var ret UsageForecast
+	if u.Size > 0 && u.Free == 0 {
+		ret.Exhausts = true
+	}
+	if len(h.samples) == 0 {
+		return ret
+	}
+
+	// least-squares regression of the busy IP addresses over the hours elapsed since the window start;
+	// the sample before the window start is moved to the window start
+	cutoff := now.Add(-h.window)
+	points := make([]UsageSample, 0, len(h.samples)+1)
+	for _, s := range h.samples {
+		if s.Time.Before(cutoff) {
+			s.Time = cutoff
+		}
+		points = append(points, s)
+	}
+	points = append(points, UsageSample{Time: now, Busy: h.samples[len(h.samples)-1].Busy})
+	if now.Sub(points[0].Time) < minForecastSpan {
+		return ret
+	}
+
+	var meanX, meanY float64
+	for _, p := range points {
+		meanX += p.Time.Sub(cutoff).Hours()
+		meanY += float64(p.Busy)
+	}
+	meanX /= float64(len(points))
+	meanY /= float64(len(points))
+	var covXY, varX float64
+	for _, p := range points {
+		dx := p.Time.Sub(cutoff).Hours() - meanX
+		covXY += dx * (float64(p.Busy) - meanY)
+		varX += dx * dx
+	}
+	if varX == 0 {
+		return ret
+	}
+	ret.HasTrend = true
+	ret.TrendPerHour = covXY / varX
+
+	if !ret.Exhausts && u.Size > 0 && ret.TrendPerHour > 0 {
+		hours := float64(u.Free) / ret.TrendPerHour
+		if hours < float64(math.MaxInt64)/float64(time.Hour) {
+			ret.Exhausts = true
+			ret.TimeToExhaustion = time.Duration(hours * float64(time.Hour))
+		}
+	}
+	return ret
+}
@@ -0,0 +1,72 @@
+package ippool
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsageHistory_Add(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	h := NewUsageHistory(time.Hour)
+
+	// flat segments are compressed to their first and last samples
+	for i, busy := range []int64{10, 10, 10, 10, 12, 12} {
+		h.Add(t0.Add(time.Duration(i)*time.Minute), busy)
+	}
+	assert.Equal(t, []UsageSample{
+		{t0, 10}, {t0.Add(3 * time.Minute), 10}, {t0.Add(4 * time.Minute), 12}, {t0.Add(5 * time.Minute), 12},
+	}, h.Samples())
+
+	// the samples older than the window are dropped, except the last one
+	h.Add(t0.Add(70*time.Minute), 15)
+	assert.Equal(t, []UsageSample{
+		{t0.Add(5 * time.Minute), 12}, {t0.Add(70 * time.Minute), 15},
+	}, h.Samples())
+}
+
+func TestUsageHistory_Forecast(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	usage := RangeUsage{Size: 100, Busy: 40, Free: 60}
+
+	// no samples, or samples over a too short time span: no trend
+	h := NewUsageHistory(24 * time.Hour)
+	assert.Equal(t, UsageForecast{}, h.Forecast(t0, usage))
+	h.Add(t0, 40)
+	assert.Equal(t, UsageForecast{}, h.Forecast(t0.Add(time.Minute), usage))
+
+	// 10 more busy IP addresses per hour: the remaining 60 will be gone in 6 hours
+	h = NewUsageHistory(24 * time.Hour)
+	for i := range 5 {
+		h.Add(t0.Add(time.Duration(i)*time.Hour), int64(i*10))
+	}
+	f := h.Forecast(t0.Add(4*time.Hour), usage)
+	require.True(t, f.HasTrend)
+	assert.InDelta(t, 10, f.TrendPerHour, 0.5)
+	assert.True(t, f.Exhausts)
+	assert.InDelta(t, 6*time.Hour, f.TimeToExhaustion, float64(15*time.Minute))
+
+	// once the growth stops, the trend slowly flattens
+	f = h.Forecast(t0.Add(20*time.Hour), usage)
+	assert.Less(t, f.TrendPerHour, 10.0)
+
+	// decreasing usage never exhausts
+	h = NewUsageHistory(24 * time.Hour)
+	h.Add(t0, 60)
+	h.Add(t0.Add(time.Hour), 40)
+	f = h.Forecast(t0.Add(time.Hour), usage)
+	assert.True(t, f.HasTrend)
+	assert.Negative(t, f.TrendPerHour)
+	assert.False(t, f.Exhausts)
+
+	// an exhausted range exhausts now, whatever the trend
+	f = h.Forecast(t0.Add(time.Hour), RangeUsage{Size: 100, Busy: 100, Free: 0})
+	assert.True(t, f.Exhausts)
+	assert.Zero(t, f.TimeToExhaustion)
+
+	// ranges too large to be counted are never forecast to run out of IP addresses
+	f = h.Forecast(t0.Add(time.Hour), RangeUsage{Size: -1, Busy: 40, Free: -1})
+	assert.False(t, f.Exhausts)
+}
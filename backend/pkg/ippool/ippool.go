@@ -1,6 +1,7 @@
 package ippool
 
 import (
+	"math/big"
 	"net/netip"
 )
 
@@ -44,3 +45,12 @@ func (p Pool) Size() int64 {
 	}
 	return size
 }
+
+// BigSize returns the number of IP addresses in all the ranges of the Pool
+func (p Pool) BigSize() *big.Int {
+	size := big.NewInt(0)
+	for _, r := range p.Ranges {
+		size.Add(size, r.BigSize())
+	}
+	return size
+}
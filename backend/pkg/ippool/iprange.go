@@ -1,9 +1,11 @@
 package ippool
 
 import (
-	"bytes"
+	"encoding/binary"
+	"iter"
+	"math"
 	"math/big"
-	"net"
+	"math/bits"
 	"net/netip"
 )
 
@@ -11,62 +13,143 @@ import (
 /*                                    Range                                   */
 /* -------------------------------------------------------------------------- */
 
+// Range is a contiguous interval of IP addresses, both ends included
 type Range struct {
-	Start net.IP
-	End   net.IP
+	Start netip.Addr
+	End   netip.Addr
 }
 
-func NewRange(start, end net.IP) Range {
+func NewRange(start, end netip.Addr) Range {
 	return Range{
-		Start: start,
-		End:   end,
+		Start: start.Unmap(),
+		End:   end.Unmap(),
 	}
 }
 
+// NewRangeFromString creates a Range from the string representation of its ends; the Range
+// is not valid if any of them cannot be parsed
 func NewRangeFromString(start, end string) Range {
-	return Range{
-		Start: net.ParseIP(start),
-		End:   net.ParseIP(end),
+	startAddr, _ := netip.ParseAddr(start)
+	endAddr, _ := netip.ParseAddr(end)
+	return NewRange(startAddr, endAddr)
+}
+
+// NewRangeFromPrefix creates the Range of all the IP addresses of the given network prefix
+func NewRangeFromPrefix(p netip.Prefix) Range {
+	p = p.Masked()
+	if !p.IsValid() {
+		return Range{}
+	}
+	return NewRange(p.Addr(), lastAddr(p))
+}
+
+// lastAddr returns the last IP address of the given (masked) network prefix
+func lastAddr(p netip.Prefix) netip.Addr {
+	a := p.Addr().As16()
+	hostBits := p.Addr().BitLen() - p.Bits()
+	for i := 15; i >= 0 && hostBits > 0; i-- {
+		n := min(hostBits, 8)
+		a[i] |= byte(1<<n - 1)
+		hostBits -= n
+	}
+	last := netip.AddrFrom16(a)
+	if p.Addr().Is4() {
+		return last.Unmap()
 	}
+	return last
 }
 
+// IsValid checks that both ends are IP addresses of the same family and that the end is bigger than start
 func (r Range) IsValid() bool {
-	if r.Start == nil || r.End == nil {
+	if !r.Start.IsValid() || !r.End.IsValid() || r.Start.Is4() != r.End.Is4() {
 		return false
 	}
 
-	endAsNum := *big.NewInt(0).SetBytes(r.End)
-	startAsNum := *big.NewInt(0).SetBytes(r.Start)
-
 	// check that the end is bigger than start
-	return endAsNum.Cmp(&startAsNum) > 0
+	return r.End.Compare(r.Start) > 0
 }
 
-// Contains checks if the IP address is within the Range
-func (r Range) Contains(ipOrig netip.Addr) bool {
-	// Ensure that all IP addresses are in a consistent IPv4 or IPv6 form
-	ip := net.IP(ipOrig.AsSlice()).To16()
-	dhcpStartIP := r.Start.To16()
-	dhcpEndIP := r.End.To16()
+// String returns the Range in the "start-end" form
+func (r Range) String() string {
+	return r.Start.String() + "-" + r.End.String()
+}
 
-	if ip == nil || dhcpStartIP == nil || dhcpEndIP == nil {
+// Contains checks if the IP address is within the Range
+func (r Range) Contains(ip netip.Addr) bool {
+	// IPv4-mapped IPv6 addresses are considered IPv4 addresses
+	ip = ip.Unmap()
+	if !ip.IsValid() || !r.Start.IsValid() || !r.End.IsValid() || ip.Is4() != r.Start.Is4() {
 		return false
 	}
 
-	// Check if the IP address is between dhcpStartIP and dhcpEndIP
-	return bytes.Compare(ip, dhcpStartIP) >= 0 && bytes.Compare(ip, dhcpEndIP) <= 0
+	// Check if the IP address is between start and end
+	return ip.Compare(r.Start) >= 0 && ip.Compare(r.End) <= 0
+}
+
+// distance returns the number of IP addresses in the range minus one, as a 128-bit number
+func (r Range) distance() (hi, lo uint64) {
+	start, end := r.Start.As16(), r.End.As16()
+	lo, borrow := bits.Sub64(binary.BigEndian.Uint64(end[8:]), binary.BigEndian.Uint64(start[8:]), 0)
+	hi, _ = bits.Sub64(binary.BigEndian.Uint64(end[:8]), binary.BigEndian.Uint64(start[:8]), borrow)
+	return hi, lo
 }
 
 // Size returns the number of IP addresses in the range or -1 if they are too many to fit an int64
 func (r Range) Size() int64 {
-	size := big.NewInt(0)
-	size.Add(size, big.NewInt(0).SetBytes(r.End))
-	size.Sub(size, big.NewInt(0).SetBytes(r.Start))
-	size.Add(size, big.NewInt(1))
-	if size.IsInt64() {
-		return size.Int64()
+	hi, lo := r.distance()
+	if hi != 0 || lo >= math.MaxInt64 {
+		// too many IPs in range... this can happen with IPv6
+		return -1
+	}
+	return int64(lo) + 1
+}
+
+// BigSize returns the number of IP addresses in the range, also for IPv6 ranges too large for Size()
+func (r Range) BigSize() *big.Int {
+	hi, lo := r.distance()
+	size := new(big.Int).SetUint64(hi)
+	size.Lsh(size, 64)
+	size.Add(size, new(big.Int).SetUint64(lo))
+	return size.Add(size, big.NewInt(1))
+}
+
+// Overlaps checks if the two ranges have at least one IP address in common
+func (r Range) Overlaps(other Range) bool {
+	_, ok := r.Intersect(other)
+	return ok
+}
+
+// Intersect returns the IP addresses the two ranges have in common, if any
+func (r Range) Intersect(other Range) (Range, bool) {
+	if !r.Start.IsValid() || !r.End.IsValid() || !other.Start.IsValid() || !other.End.IsValid() ||
+		r.Start.Is4() != other.Start.Is4() {
+		return Range{}, false
 	}
 
-	// too many IPs in range... this can happen with IPv6
-	return -1
+	ret := Range{Start: r.Start, End: r.End}
+	if other.Start.Compare(ret.Start) > 0 {
+		ret.Start = other.Start
+	}
+	if other.End.Compare(ret.End) < 0 {
+		ret.End = other.End
+	}
+	if ret.Start.Compare(ret.End) > 0 {
+		return Range{}, false
+	}
+	return ret, true
+}
+
+// All returns an iterator over all the IP addresses of the Range, in ascending order.
+// Keep in mind that IPv6 ranges can be huge: stop the iteration as soon as possible.
+func (r Range) All() iter.Seq[netip.Addr] {
+	return func(yield func(netip.Addr) bool) {
+		if !r.Start.IsValid() || !r.End.IsValid() {
+			return
+		}
+		for ip := r.Start; ip.IsValid() && ip.Compare(r.End) <= 0; ip = ip.Next() {
+			if !yield(ip) {
+				return
+			}
+		}
+	}
 }
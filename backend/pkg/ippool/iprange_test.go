@@ -85,3 +85,133 @@ func TestContains(t *testing.T) {
 		})
 	}
 }
+
+func TestOverlaps(t *testing.T) {
+	tests := []struct {
+		name     string
+		a        Range
+		b        Range
+		expected bool
+	}{
+		{"disjoint", NewRangeFromString("192.168.1.1", "192.168.1.100"), NewRangeFromString("192.168.1.101", "192.168.1.200"), false},
+		{"partial overlap", NewRangeFromString("192.168.1.1", "192.168.1.100"), NewRangeFromString("192.168.1.50", "192.168.1.150"), true},
+		{"contained", NewRangeFromString("192.168.1.1", "192.168.1.100"), NewRangeFromString("192.168.1.10", "192.168.1.20"), true},
+		{"touching at boundary", NewRangeFromString("192.168.1.1", "192.168.1.100"), NewRangeFromString("192.168.1.100", "192.168.1.200"), true},
+		{"IPv6 disjoint", NewRangeFromString("2001:db8::1", "2001:db8::10"), NewRangeFromString("2001:db8::11", "2001:db8::20"), false},
+		{"IPv6 overlap", NewRangeFromString("2001:db8::1", "2001:db8::10"), NewRangeFromString("2001:db8::5", "2001:db8::20"), true},
+		{"invalid range", NewRangeFromString("", ""), NewRangeFromString("192.168.1.1", "192.168.1.100"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.a.Overlaps(tt.b))
+			assert.Equal(t, tt.expected, tt.b.Overlaps(tt.a))
+		})
+	}
+}
+
+func TestBigSize(t *testing.T) {
+	assert.Equal(t, int64(100), NewRangeFromString("192.168.1.1", "192.168.1.100").BigSize().Int64())
+
+	huge := NewRangeFromString("fd00::", "fd00::ffff:ffff:ffff:ffff")
+	assert.Equal(t, int64(-1), huge.Size())
+	assert.Equal(t, "18446744073709551616", huge.BigSize().String())
+
+	p := NewPool([]Range{huge, NewRangeFromString("192.168.1.1", "192.168.1.100")})
+	assert.Equal(t, int64(-1), p.Size())
+	assert.Equal(t, "18446744073709551716", p.BigSize().String())
+}
+
+func TestIntersect(t *testing.T) {
+	tests := []struct {
+		name     string
+		a        Range
+		b        Range
+		expected string
+	}{
+		{"disjoint", NewRangeFromString("192.168.1.1", "192.168.1.100"), NewRangeFromString("192.168.1.101", "192.168.1.200"), ""},
+		{"partial overlap", NewRangeFromString("192.168.1.1", "192.168.1.100"), NewRangeFromString("192.168.1.50", "192.168.1.150"), "192.168.1.50-192.168.1.100"},
+		{"contained", NewRangeFromString("192.168.1.1", "192.168.1.100"), NewRangeFromString("192.168.1.10", "192.168.1.20"), "192.168.1.10-192.168.1.20"},
+		{"touching at boundary", NewRangeFromString("192.168.1.1", "192.168.1.100"), NewRangeFromString("192.168.1.100", "192.168.1.200"), "192.168.1.100-192.168.1.100"},
+		{"IPv6 overlap", NewRangeFromString("2001:db8::1", "2001:db8::10"), NewRangeFromString("2001:db8::5", "2001:db8::20"), "2001:db8::5-2001:db8::10"},
+		{"different families", NewRangeFromString("::ffff:192.168.1.1", "::ffff:192.168.1.100"), NewRangeFromString("2001:db8::5", "2001:db8::20"), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, pair := range [][2]Range{{tt.a, tt.b}, {tt.b, tt.a}} {
+				r, ok := pair[0].Intersect(pair[1])
+				assert.Equal(t, tt.expected != "", ok)
+				if ok {
+					assert.Equal(t, tt.expected, r.String())
+				}
+			}
+		})
+	}
+}
+
+func TestNewRangeFromPrefix(t *testing.T) {
+	tests := []struct {
+		prefix   string
+		expected string
+		size     int64
+	}{
+		{"192.168.10.0/24", "192.168.10.0-192.168.10.255", 256},
+		{"192.168.10.70/26", "192.168.10.64-192.168.10.127", 64},
+		{"10.0.0.0/8", "10.0.0.0-10.255.255.255", 1 << 24},
+		{"192.168.10.1/32", "192.168.10.1-192.168.10.1", 1},
+		{"fd00::/120", "fd00::-fd00::ff", 256},
+		{"fd00:1:2:3::/64", "fd00:1:2:3::-fd00:1:2:3:ffff:ffff:ffff:ffff", -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			r := NewRangeFromPrefix(netip.MustParsePrefix(tt.prefix))
+			assert.Equal(t, tt.expected, r.String())
+			assert.Equal(t, tt.size, r.Size())
+		})
+	}
+
+	assert.False(t, NewRangeFromPrefix(netip.Prefix{}).Start.IsValid())
+}
+
+func TestAll(t *testing.T) {
+	var ips []string
+	for ip := range NewRangeFromString("192.168.1.254", "192.168.2.1").All() {
+		ips = append(ips, ip.String())
+	}
+	assert.Equal(t, []string{"192.168.1.254", "192.168.1.255", "192.168.2.0", "192.168.2.1"}, ips)
+
+	// the iteration can be stopped early, also on huge IPv6 ranges
+	ips = nil
+	for ip := range NewRangeFromPrefix(netip.MustParsePrefix("fd00::/64")).All() {
+		if len(ips) == 3 {
+			break
+		}
+		ips = append(ips, ip.String())
+	}
+	assert.Equal(t, []string{"fd00::", "fd00::1", "fd00::2"}, ips)
+
+	// the iteration does not wrap around at the end of the address space
+	count := 0
+	for range NewRangeFromString("255.255.255.254", "255.255.255.255").All() {
+		count++
+	}
+	assert.Equal(t, 2, count)
+
+	for range NewRangeFromString("", "").All() {
+		assert.Fail(t, "invalid ranges have no IP addresses")
+	}
+}
+
+func TestSize(t *testing.T) {
+	assert.Equal(t, int64(100), NewRangeFromString("192.168.1.1", "192.168.1.100").Size())
+	assert.Equal(t, int64(1<<32), NewRangeFromString("0.0.0.0", "255.255.255.255").Size())
+	assert.Equal(t, int64(1<<62), NewRangeFromString("fd00::", "fd00::3fff:ffff:ffff:ffff").Size())
+
+	// IPv4-mapped IPv6 addresses are handled as IPv4 addresses
+	r := NewRangeFromString("::ffff:192.168.1.1", "::ffff:192.168.1.100")
+	assert.Equal(t, "192.168.1.1-192.168.1.100", r.String())
+	assert.True(t, r.Contains(netip.MustParseAddr("::ffff:192.168.1.50")))
+	assert.False(t, r.Contains(netip.MustParseAddr("::192.168.1.50")))
+}
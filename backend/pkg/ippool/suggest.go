@@ -0,0 +1,126 @@
+package ippool
+
+import (
+	"net/netip"
+	"slices"
+)
+
+/* -------------------------------------------------------------------------- */
+/*                            Free address finder                             */
+/* -------------------------------------------------------------------------- */
+
+// SuggestOptions tunes the search of SuggestFreeAddresses
+type SuggestOptions struct {
+	// Exclude are ranges of IP addresses that must never be suggested
+	Exclude []Range
+
+	// PreferOutsidePool suggests first the IP addresses outside the DHCP ranges, which
+	// dnsmasq will never hand out dynamically, and only then the ones inside the DHCP ranges
+	PreferOutsidePool bool
+}
+
+// Subtract returns the IP addresses of the Range which are not contained in any of the
+// given ranges, as a list of non-overlapping ranges in ascending order
+func (r Range) Subtract(others []Range) []Range {
+	if !r.Start.IsValid() || !r.End.IsValid() || r.Start.Compare(r.End) > 0 {
+		return nil
+	}
+	cuts := make([]Range, 0, len(others))
+	for _, o := range others {
+		if i, ok := r.Intersect(o); ok {
+			cuts = append(cuts, i)
+		}
+	}
+	slices.SortFunc(cuts, func(a, b Range) int { return a.Start.Compare(b.Start) })
+
+	var ret []Range
+	next := r.Start
+	for _, c := range cuts {
+		if c.End.Compare(next) < 0 {
+			// fully covered by a previous cut
+			continue
+		}
+		if c.Start.Compare(next) > 0 {
+			ret = append(ret, Range{Start: next, End: c.Start.Prev()})
+		}
+		next = c.End.Next()
+		if !next.IsValid() || next.Compare(r.End) > 0 {
+			// no IP address left after this cut
+			return ret
+		}
+	}
+	return append(ret, Range{Start: next, End: r.End})
+}
+
+// specialAddrs returns the network and broadcast addresses of the (masked) network, which
+// are invalid for networks having none, like point-to-point links (RFC 3021) and IPv6 networks
+func specialAddrs(network netip.Prefix) (networkAddr, broadcastAddr netip.Addr) {
+	if network.Addr().BitLen()-network.Bits() <= 1 {
+		return netip.Addr{}, netip.Addr{}
+	}
+	r := NewRangeFromPrefix(network)
+	if network.Addr().Is4() {
+		return r.Start, r.End
+	}
+	return r.Start, netip.Addr{}
+}
+
+// SuggestFreeAddresses returns up to count IP addresses of the network that can be used for new
+// IP address reservations: the network and broadcast addresses, the gateway and the IP addresses
+// which are reserved, leased or were used in the past are skipped, together with the ones in
+// opts.Exclude. IP addresses are returned in ascending order, or in ascending order first outside
+// and then inside the DHCP ranges if opts.PreferOutsidePool is set.
+func SuggestFreeAddresses(n NetworkAddresses, count int, opts SuggestOptions) []netip.Addr {
+	ret := []netip.Addr{}
+	network := n.Network.Masked()
+	if !network.IsValid() || count <= 0 {
+		return ret
+	}
+
+	// the IP addresses that can be assigned to hosts
+	networkAddr, broadcastAddr := specialAddrs(network)
+	var skip []Range
+	for _, ip := range []netip.Addr{networkAddr, broadcastAddr} {
+		if ip.IsValid() {
+			skip = append(skip, NewRange(ip, ip))
+		}
+	}
+	hosts := NewRangeFromPrefix(network).Subtract(skip)
+
+	// the search is split in several passes, each one walking through a list of ranges
+	var passes [][]Range
+	if opts.PreferOutsidePool {
+		var outside, inside []Range
+		for _, h := range hosts {
+			hostsOutside := h.Subtract(n.Pool.Ranges)
+			outside = append(outside, hostsOutside...)
+			inside = append(inside, h.Subtract(hostsOutside)...)
+		}
+		passes = [][]Range{outside, inside}
+	} else {
+		passes = [][]Range{hosts}
+	}
+
+	busy := addressSet(n.Reserved)
+	for _, ips := range [][]netip.Addr{n.Leased, n.Seen, {n.Gateway}} {
+		for ip := range addressSet(ips) {
+			busy[ip] = struct{}{}
+		}
+	}
+	for _, pass := range passes {
+		for _, candidates := range pass {
+			for _, r := range candidates.Subtract(opts.Exclude) {
+				for ip := range r.All() {
+					if _, isBusy := busy[ip]; isBusy {
+						continue
+					}
+					ret = append(ret, ip)
+					if len(ret) == count {
+						return ret
+					}
+				}
+			}
+		}
+	}
+	return ret
+}
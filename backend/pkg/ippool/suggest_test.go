@@ -0,0 +1,75 @@
+package ippool
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubtract(t *testing.T) {
+	r := NewRangeFromString("192.168.1.10", "192.168.1.20")
+	tests := []struct {
+		name     string
+		others   []Range
+		expected []Range
+	}{
+		{"nothing to subtract", nil, []Range{r}},
+		{"disjoint range", []Range{NewRangeFromString("192.168.2.10", "192.168.2.20")}, []Range{r}},
+		{"other family", []Range{NewRangeFromString("::", "::ffff")}, []Range{r}},
+		{"hole in the middle", []Range{NewRangeFromString("192.168.1.12", "192.168.1.15")}, []Range{
+			NewRangeFromString("192.168.1.10", "192.168.1.11"),
+			NewRangeFromString("192.168.1.16", "192.168.1.20"),
+		}},
+		{"unsorted overlapping holes", []Range{
+			NewRangeFromString("192.168.1.18", "192.168.1.30"),
+			NewRangeFromString("192.168.1.1", "192.168.1.10"),
+			NewRangeFromString("192.168.1.13", "192.168.1.15"),
+			NewRangeFromString("192.168.1.14", "192.168.1.14"),
+		}, []Range{
+			NewRangeFromString("192.168.1.11", "192.168.1.12"),
+			NewRangeFromString("192.168.1.16", "192.168.1.17"),
+		}},
+		{"everything subtracted", []Range{NewRangeFromString("192.168.1.0", "192.168.1.255")}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, r.Subtract(tt.others))
+		})
+	}
+
+	// the last IP address of the IPv4 space must not wrap around
+	last := NewRangeFromString("255.255.255.250", "255.255.255.255")
+	assert.Nil(t, last.Subtract([]Range{NewRangeFromString("255.255.255.200", "255.255.255.255")}))
+}
+
+func TestSuggestFreeAddresses(t *testing.T) {
+	n := NetworkAddresses{
+		Network:  netip.MustParsePrefix("192.168.1.0/28"),
+		Gateway:  netip.MustParseAddr("192.168.1.1"),
+		Pool:     NewPoolFromString("192.168.1.8", "192.168.1.12"),
+		Reserved: parseAddrs("192.168.1.3", "192.168.1.9"),
+		Leased:   parseAddrs("192.168.1.10", "::ffff:192.168.1.4"),
+		Seen:     parseAddrs("192.168.1.5", "192.168.1.11"),
+	}
+
+	assert.Equal(t, parseAddrs("192.168.1.2", "192.168.1.6", "192.168.1.7", "192.168.1.8"),
+		SuggestFreeAddresses(n, 4, SuggestOptions{}))
+	assert.Equal(t, parseAddrs("192.168.1.2", "192.168.1.6", "192.168.1.7", "192.168.1.13", "192.168.1.14", "192.168.1.8", "192.168.1.12"),
+		SuggestFreeAddresses(n, 100, SuggestOptions{PreferOutsidePool: true}))
+	assert.Equal(t, parseAddrs("192.168.1.2", "192.168.1.13", "192.168.1.14", "192.168.1.12"),
+		SuggestFreeAddresses(n, 100, SuggestOptions{
+			PreferOutsidePool: true,
+			Exclude:           []Range{NewRangeFromString("192.168.1.6", "192.168.1.8")},
+		}))
+	assert.Empty(t, SuggestFreeAddresses(n, 0, SuggestOptions{}))
+	assert.Empty(t, SuggestFreeAddresses(NetworkAddresses{}, 10, SuggestOptions{}))
+
+	// huge IPv6 networks fully covered by the DHCP range are handled quickly
+	n6 := NetworkAddresses{
+		Network: netip.MustParsePrefix("fd00::/64"),
+		Pool:    NewPoolFromString("fd00::", "fd00::ffff:ffff:ffff:ffff"),
+		Leased:  parseAddrs("fd00::1"),
+	}
+	assert.Equal(t, parseAddrs("fd00::2", "fd00::3"), SuggestFreeAddresses(n6, 2, SuggestOptions{PreferOutsidePool: true}))
+}
@@ -0,0 +1,98 @@
+package ippool
+
+import (
+	"math/big"
+	"net/netip"
+)
+
+/* -------------------------------------------------------------------------- */
+/*                                 RangeUsage                                 */
+/* -------------------------------------------------------------------------- */
+
+// RangeUsage describes how the IP addresses of a Range are being used
+type RangeUsage struct {
+	Range Range
+
+	// Size is the number of IP addresses in the range, or -1 if they are too many to fit an int64
+	Size int64
+
+	// Used is the number of leased IP addresses inside the range (including reserved ones)
+	Used int64
+
+	// Reserved is the number of reserved IP addresses inside the range (whether leased or not)
+	Reserved int64
+
+	// Free is the number of IP addresses inside the range which are neither leased nor reserved,
+	// or -1 if the range size is too large
+	Free int64
+
+	// Busy is the number of IP addresses inside the range which are either leased or reserved
+	Busy int64
+}
+
+// UsagePercent returns the percentage of IP addresses of the range which are either
+// leased or reserved, in the [0,100] interval
+func (u RangeUsage) UsagePercent() float64 {
+	if u.Size > 0 {
+		return 100 * float64(u.Size-u.Free) / float64(u.Size)
+	}
+	if u.Size == -1 && u.Range.IsValid() {
+		// huge IPv6 range: the result is tiny but still meaningful, e.g. for trends
+		percent, _ := new(big.Float).Quo(
+			new(big.Float).SetInt64(100*u.Busy),
+			new(big.Float).SetInt(u.Range.BigSize()),
+		).Float64()
+		return percent
+	}
+	return 0
+}
+
+// Usage computes the usage of the Range given the set of leased and reserved IP addresses.
+// Addresses outside the range are ignored; duplicated addresses are counted only once.
+func (r Range) Usage(leased, reserved []netip.Addr) RangeUsage {
+	leasedSet := r.filter(leased)
+	reservedSet := r.filter(reserved)
+
+	// an IP address which is both leased and reserved must be counted only once
+	// to compute the number of free IP addresses
+	busy := int64(len(leasedSet))
+	for ip := range reservedSet {
+		if _, isLeased := leasedSet[ip]; !isLeased {
+			busy++
+		}
+	}
+
+	usage := RangeUsage{
+		Range:    r,
+		Size:     r.Size(),
+		Used:     int64(len(leasedSet)),
+		Reserved: int64(len(reservedSet)),
+		Free:     -1,
+		Busy:     busy,
+	}
+	if usage.Size != -1 {
+		usage.Free = usage.Size - busy
+	}
+	return usage
+}
+
+// filter returns the set of unique IP addresses contained in the Range
+func (r Range) filter(ips []netip.Addr) map[netip.Addr]struct{} {
+	ret := make(map[netip.Addr]struct{})
+	for _, ip := range ips {
+		if r.Contains(ip) {
+			ret[ip.Unmap()] = struct{}{}
+		}
+	}
+	return ret
+}
+
+// Usage computes the usage of each Range of the Pool given the set of leased and reserved IP addresses.
+// The returned slice has the same order of the Pool ranges.
+func (p Pool) Usage(leased, reserved []netip.Addr) []RangeUsage {
+	ret := make([]RangeUsage, 0, len(p.Ranges))
+	for _, r := range p.Ranges {
+		ret = append(ret, r.Usage(leased, reserved))
+	}
+	return ret
+}
@@ -0,0 +1,104 @@
+package ippool
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func parseAddrs(ips ...string) []netip.Addr {
+	ret := make([]netip.Addr, 0, len(ips))
+	for _, ip := range ips {
+		ret = append(ret, netip.MustParseAddr(ip))
+	}
+	return ret
+}
+
+func TestRangeUsage(t *testing.T) {
+	tests := []struct {
+		name     string
+		startIP  string
+		endIP    string
+		leased   []netip.Addr
+		reserved []netip.Addr
+		expected RangeUsage
+	}{
+		{
+			name:     "empty range",
+			startIP:  "192.168.1.1",
+			endIP:    "192.168.1.100",
+			expected: RangeUsage{Size: 100, Used: 0, Reserved: 0, Free: 100, Busy: 0},
+		},
+		{
+			name:     "leases outside the range are ignored",
+			startIP:  "192.168.1.1",
+			endIP:    "192.168.1.100",
+			leased:   parseAddrs("192.168.1.10", "192.168.1.200", "10.0.0.1"),
+			expected: RangeUsage{Size: 100, Used: 1, Reserved: 0, Free: 99, Busy: 1},
+		},
+		{
+			name:     "duplicated leases are counted once",
+			startIP:  "192.168.1.1",
+			endIP:    "192.168.1.100",
+			leased:   parseAddrs("192.168.1.10", "192.168.1.10", "::ffff:192.168.1.10"),
+			expected: RangeUsage{Size: 100, Used: 1, Reserved: 0, Free: 99, Busy: 1},
+		},
+		{
+			name:     "leased reservations are not counted twice as busy",
+			startIP:  "192.168.1.1",
+			endIP:    "192.168.1.100",
+			leased:   parseAddrs("192.168.1.10", "192.168.1.11"),
+			reserved: parseAddrs("192.168.1.11", "192.168.1.12", "192.168.1.250"),
+			expected: RangeUsage{Size: 100, Used: 2, Reserved: 2, Free: 97, Busy: 3},
+		},
+		{
+			name:     "full range",
+			startIP:  "192.168.1.1",
+			endIP:    "192.168.1.2",
+			leased:   parseAddrs("192.168.1.1"),
+			reserved: parseAddrs("192.168.1.2"),
+			expected: RangeUsage{Size: 2, Used: 1, Reserved: 1, Free: 0, Busy: 2},
+		},
+		{
+			name:     "huge IPv6 range",
+			startIP:  "2001:db8::",
+			endIP:    "2001:db8:ffff:ffff:ffff:ffff:ffff:ffff",
+			leased:   parseAddrs("2001:db8::1"),
+			expected: RangeUsage{Size: -1, Used: 1, Reserved: 0, Free: -1, Busy: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRangeFromString(tt.startIP, tt.endIP)
+			tt.expected.Range = r
+			assert.Equal(t, tt.expected, r.Usage(tt.leased, tt.reserved))
+		})
+	}
+}
+
+func TestRangeUsagePercent(t *testing.T) {
+	assert.InDelta(t, 3.0, RangeUsage{Size: 100, Free: 97}.UsagePercent(), 0.001)
+	assert.InDelta(t, 100.0, RangeUsage{Size: 2, Free: 0}.UsagePercent(), 0.001)
+	assert.InDelta(t, 0.0, RangeUsage{Size: -1, Free: -1}.UsagePercent(), 0.001)
+
+	// a /64 worth of IPv6 addresses
+	huge := NewRangeFromString("fd00::", "fd00::ffff:ffff:ffff:ffff")
+	assert.InEpsilon(t, 100*4.0/(1<<64), RangeUsage{Range: huge, Size: -1, Free: -1, Busy: 4}.UsagePercent(), 1e-9)
+}
+
+func TestPoolUsage(t *testing.T) {
+	p := NewPool([]Range{
+		NewRangeFromString("192.168.1.1", "192.168.1.10"),
+		NewRangeFromString("10.0.0.100", "10.0.0.199"),
+	})
+
+	usage := p.Usage(parseAddrs("192.168.1.5", "10.0.0.150", "10.0.0.151"), parseAddrs("10.0.0.100"))
+	assert.Len(t, usage, 2)
+	assert.Equal(t, int64(1), usage[0].Used)
+	assert.Equal(t, int64(9), usage[0].Free)
+	assert.Equal(t, int64(2), usage[1].Used)
+	assert.Equal(t, int64(1), usage[1].Reserved)
+	assert.Equal(t, int64(97), usage[1].Free)
+}
@@ -0,0 +1,15 @@
+/*
+Package leasewatcher keeps track of the changes to the dnsmasq lease file, supervising an
+inotify-based watch of the file. The directory containing the lease file is watched, rather than
+the file itself, so that changes are still detected after the file is replaced, e.g. by renaming
+another file over it.
+
+The lease file contains both the DHCPv4 and the DHCPv6 leases: the DHCPv6 clients are identified
+by their DUID, from which the MAC address is recovered whenever possible.
+
+If the watch stops because of an error, the Watcher restarts it with an exponential backoff and
+re-reads the lease file, since changes might have been missed in the meantime. If inotify keeps
+failing (e.g. because the limit of inotify instances was reached), the Watcher falls back to
+polling the lease file periodically, trying inotify again from time to time.
+*/
+package leasewatcher
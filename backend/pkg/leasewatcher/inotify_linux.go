@@ -0,0 +1,84 @@
+//go:build linux
+
+package leasewatcher
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// the inotify events, on the parent directory, meaning that the watched file has changed: besides being
+// modified in place, the file may be replaced (e.g. renaming a temporary file over it) or re-created
+const fileChangedEvents = syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_CREATE | syscall.IN_ATTRIB
+
+// watchFileChanges sends a notification over the returned channel each time the given file is
+// modified or replaced, until the context is done; the channel is closed when the watch stops.
+// The parent directory is watched, rather than the file itself, so that the watch survives the
+// replacement of the file.
+func watchFileChanges(ctx context.Context, filePath string) (<-chan struct{}, error) {
+	// a non-blocking descriptor is handled by the Go runtime poller, so that closing it interrupts
+	// a pending read
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize inotify: %w", err)
+	}
+	dir, name := filepath.Split(filepath.Clean(filePath))
+	if dir == "" {
+		dir = "."
+	}
+	mask := uint32(fileChangedEvents | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF)
+	if _, err := syscall.InotifyAddWatch(fd, dir, mask); err != nil {
+		_ = syscall.Close(fd)
+		return nil, fmt.Errorf("failed to watch %s: %w", filePath, err)
+	}
+	inotify := os.NewFile(uintptr(fd), "inotify")
+
+	go func() {
+		<-ctx.Done()
+		_ = inotify.Close()
+	}()
+
+	changes := make(chan struct{}, 1)
+	go func() {
+		defer close(changes)
+		buf := make([]byte, 16*(syscall.SizeofInotifyEvent+syscall.PathMax))
+		for {
+			n, err := inotify.Read(buf)
+			if err != nil || ctx.Err() != nil {
+				return
+			}
+
+			changed := false
+			for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+				// see the layout of struct inotify_event in inotify(7)
+				eventMask := binary.NativeEndian.Uint32(buf[offset+4:])
+				nameLen := int(binary.NativeEndian.Uint32(buf[offset+12:]))
+				eventName := buf[offset+syscall.SizeofInotifyEvent : offset+syscall.SizeofInotifyEvent+nameLen]
+				offset += syscall.SizeofInotifyEvent + nameLen
+
+				if eventMask&(syscall.IN_DELETE_SELF|syscall.IN_MOVE_SELF|syscall.IN_IGNORED) != 0 {
+					// the parent directory is gone: the watch cannot continue
+					return
+				}
+				if eventMask&fileChangedEvents != 0 && string(bytes.TrimRight(eventName, "\x00")) == name {
+					changed = true
+				}
+			}
+			if !changed {
+				continue
+			}
+
+			// several modifications not yet processed are reported only once
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return changes, nil
+}
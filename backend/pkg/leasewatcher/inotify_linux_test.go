@@ -0,0 +1,82 @@
+//go:build linux
+
+package leasewatcher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchLeases(t *testing.T) {
+	leaseFile := filepath.Join(t.TempDir(), "dnsmasq.leases")
+	ctx, cancel := context.WithCancel(context.Background())
+	output := make(chan []*Lease)
+	errCh := make(chan error, 1)
+	ready := make(chan struct{})
+	go func() {
+		errCh <- WatchLeases(ctx, leaseFile, output, func() { close(ready) })
+	}()
+
+	// the lease file is created if missing: wait for the watch before modifying it
+	select {
+	case <-ready:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the watch did not start")
+	}
+	_, err := os.Stat(leaseFile)
+	require.NoError(t, err)
+	writeLeaseFile(t, leaseFile, leaseClient1+leaseClient2)
+	assert.Equal(t, []string{"client1", "client2"}, lastHostnames(t, output))
+
+	// the lease file is replaced, e.g. by renaming a temporary file over it: the watch must go on
+	// and the new content must be read
+	tmpFile := leaseFile + ".tmp"
+	writeLeaseFile(t, tmpFile, leaseClient2)
+	require.NoError(t, os.Rename(tmpFile, leaseFile))
+	assert.Equal(t, []string{"client2"}, lastHostnames(t, output))
+
+	writeLeaseFile(t, leaseFile, leaseClient1)
+	assert.Equal(t, []string{"client1"}, lastHostnames(t, output))
+
+	// other files in the same directory are ignored
+	writeLeaseFile(t, filepath.Join(filepath.Dir(leaseFile), "other"), leaseClient2)
+	select {
+	case leases := <-output:
+		t.Fatalf("unexpected leases %v", leases)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	cancel()
+	select {
+	case err := <-errCh:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the watch did not stop")
+	}
+	_, open := <-output
+	assert.False(t, open)
+}
+
+// lastHostnames returns the hostnames of the last list of leases sent by WatchLeases, since a single
+// change of the lease file may be notified more than once
+func lastHostnames(t *testing.T, output <-chan []*Lease) []string {
+	t.Helper()
+	hostnames := nextHostnames(t, output)
+	for {
+		select {
+		case leases := <-output:
+			hostnames = hostnames[:0]
+			for _, l := range leases {
+				hostnames = append(hostnames, l.Hostname)
+			}
+		case <-time.After(100 * time.Millisecond):
+			return hostnames
+		}
+	}
+}
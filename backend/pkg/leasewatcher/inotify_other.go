@@ -0,0 +1,14 @@
+//go:build !linux
+
+package leasewatcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// watchFileChanges is not implemented on platforms without inotify: the Watcher falls back to polling
+func watchFileChanges(_ context.Context, filePath string) (<-chan struct{}, error) {
+	return nil, fmt.Errorf("cannot watch %s: %w", filePath, errors.ErrUnsupported)
+}
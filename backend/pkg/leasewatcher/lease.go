@@ -0,0 +1,157 @@
+package leasewatcher
+
+import (
+	"bufio"
+	"context"
+	"dnsmasq-dhcp-backend/pkg/duid"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Lease is a DHCPv4 or DHCPv6 lease, as read from the dnsmasq lease file
+type Lease struct {
+	// Expires is zero for the leases that never expire
+	Expires time.Time
+
+	// MacAddr is the MAC address of the client; DHCPv6 clients are identified by their DUID, so their
+	// MAC address is known only if their DUID contains it, otherwise MacAddr is nil
+	MacAddr net.HardwareAddr
+
+	IPAddr netip.Addr
+
+	// Hostname is "*" when the client did not provide any hostname
+	Hostname string
+
+	// DUID identifies DHCPv6 clients; for DHCPv4 leases it's set only for clients sending their
+	// DUID inside the client identifier (RFC 4361), otherwise it's nil
+	DUID duid.DUID
+
+	// IAID is the Identity Association Identifier of DHCPv6 leases
+	IAID uint32
+}
+
+// IsDHCPv6 returns true for the leases of IPv6 addresses
+func (l Lease) IsDHCPv6() bool {
+	return l.IPAddr.Is6() && !l.IPAddr.Is4In6()
+}
+
+// ReadLeases reads the DHCP leases from the content of a dnsmasq lease file, whose lines look like:
+//
+//	<expiry> <MAC address> <IPv4 address> <hostname> <client ID>
+//	duid <server DUID>
+//	<expiry> <IAID> <IPv6 address> <hostname> <client DUID>
+//
+// All the DHCPv6 leases follow the "duid" line. Lines that cannot be parsed are skipped.
+func ReadLeases(reader io.Reader) ([]*Lease, error) {
+	leases := make([]*Lease, 0)
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		if l, ok := parseLease(scanner.Text()); ok {
+			leases = append(leases, l)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return leases, err
+	}
+	return leases, nil
+}
+
+// parseLease parses a single line of the dnsmasq lease file
+func parseLease(line string) (*Lease, bool) {
+	fields := strings.Fields(line)
+	if len(fields) != 5 {
+		return nil, false
+	}
+
+	l := &Lease{Hostname: fields[3]}
+	expiry, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	if expiry != 0 {
+		l.Expires = time.Unix(expiry, 0)
+	}
+	if l.IPAddr, err = netip.ParseAddr(fields[2]); err != nil {
+		return nil, false
+	}
+
+	if l.IPAddr.Is4() {
+		if l.MacAddr, err = net.ParseMAC(fields[1]); err != nil {
+			// e.g. the hardware type followed by an address which is not Ethernet, like "06-..."
+			return nil, false
+		}
+		l.DUID = duid.FromClientID(fields[4])
+		return l, true
+	}
+
+	// temporary addresses (IA_TA) have a "T" before the IAID
+	iaid, err := strconv.ParseUint(strings.TrimPrefix(fields[1], "T"), 10, 32)
+	if err != nil {
+		return nil, false
+	}
+	l.IAID = uint32(iaid)
+	if l.DUID, err = duid.Parse(fields[4]); err == nil {
+		l.MacAddr = l.DUID.HardwareAddr()
+	}
+	return l, true
+}
+
+// WatchLeases sends all the DHCP leases over output every time the lease file at filePath gets
+// updated, until the context is done; it calls ready once the inotify watch is established and
+// closes output when returning. This is the default WatchFunc.
+// The lease file is opened again at each change, since it might have been replaced meanwhile.
+func WatchLeases(ctx context.Context, filePath string, output chan<- []*Lease, ready func()) error {
+	defer close(output)
+
+	// make sure the lease file exists
+	leaseFile, err := os.OpenFile(filePath, os.O_RDONLY|os.O_CREATE, 0o644) //nolint:gosec
+	if err != nil {
+		return err
+	}
+	_ = leaseFile.Close()
+
+	changes, err := watchFileChanges(ctx, filePath)
+	if err != nil {
+		return err
+	}
+	ready()
+	for range changes {
+		leases, err := readLeaseFile(filePath)
+		if errors.Is(err, os.ErrNotExist) {
+			// the lease file is being replaced: its creation will be notified as well
+			continue
+		} else if err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case output <- leases:
+		}
+	}
+	return nil
+}
+
+// readLeaseFile reads all the DHCP leases from the lease file at filePath
+func readLeaseFile(filePath string) ([]*Lease, error) {
+	leaseFile, err := os.Open(filePath) //nolint:gosec
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = leaseFile.Close()
+	}()
+
+	leases, err := ReadLeases(leaseFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", filePath, err)
+	}
+	return leases, nil
+}
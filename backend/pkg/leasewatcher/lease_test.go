@@ -0,0 +1,48 @@
+package leasewatcher
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadLeases(t *testing.T) {
+	leases, err := ReadLeases(strings.NewReader(`1700000000 00:11:22:33:44:55 192.168.0.2 client1 01:00:11:22:33:44:55
+0 00:11:22:33:44:56 192.168.0.3 * ff:56:44:33:22:00:03:00:01:00:11:22:33:44:56
+1700000000 06-00:11:22:33:44:57 192.168.0.4 token-ring *
+duid 00:01:00:01:2d:aa:bb:cc:aa:bb:cc:dd:ee:ff
+1700000000 1446789 fd00::10 client2 00:03:00:01:00:11:22:33:44:56
+1700000000 T12 fd00::11 * 00:02:00:00:ab:11:e1:6a:6b:b7:37:41:8e:2a
+garbage
+`))
+	require.NoError(t, err)
+	mac := func(s string) net.HardwareAddr {
+		m, err := net.ParseMAC(s)
+		require.NoError(t, err)
+		return m
+	}
+	require.Len(t, leases, 4)
+
+	assert.Equal(t, Lease{Expires: time.Unix(1700000000, 0), MacAddr: mac("00:11:22:33:44:55"), IPAddr: netip.MustParseAddr("192.168.0.2"), Hostname: "client1"}, *leases[0])
+	assert.False(t, leases[0].IsDHCPv6())
+
+	// the client ID follows RFC 4361: the DUID matches the one of the DHCPv6 lease
+	assert.True(t, leases[1].Expires.IsZero())
+	assert.Equal(t, "00:03:00:01:00:11:22:33:44:56", leases[1].DUID.String())
+
+	assert.True(t, leases[2].IsDHCPv6())
+	assert.Equal(t, netip.MustParseAddr("fd00::10"), leases[2].IPAddr)
+	assert.Equal(t, uint32(1446789), leases[2].IAID)
+	assert.Equal(t, mac("00:11:22:33:44:56"), leases[2].MacAddr)
+	assert.Equal(t, leases[1].DUID, leases[2].DUID)
+
+	// temporary address of a client whose DUID has no MAC address
+	assert.Equal(t, uint32(12), leases[3].IAID)
+	assert.Nil(t, leases[3].MacAddr)
+	assert.Equal(t, "*", leases[3].Hostname)
+}
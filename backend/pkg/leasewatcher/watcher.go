@@ -0,0 +1,304 @@
+package leasewatcher
+
+import (
+	"context"
+	"dnsmasq-dhcp-backend/pkg/logger"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	defaultInitialBackoff     = time.Second
+	defaultMaxBackoff         = time.Minute
+	defaultMaxWatchFailures   = 5
+	defaultPollInterval       = 10 * time.Second
+	defaultWatchRetryInterval = 10 * time.Minute
+
+	// a watch running for longer than this is considered healthy, so its failure does not
+	// count towards the fallback to polling
+	defaultStableAfter = time.Minute
+)
+
+// State is the state of a Watcher
+type State string
+
+const (
+	// StateStarting is the state before the first watch is established
+	StateStarting State = "starting"
+
+	// StateWatching means that the lease file is watched through inotify
+	StateWatching State = "watching"
+
+	// StatePolling means that inotify failed repeatedly and the lease file is polled periodically
+	StatePolling State = "polling"
+
+	// StateBackoff means that the watch failed and the Watcher is waiting before restarting it
+	StateBackoff State = "backoff"
+
+	// StateStopped means that the Watcher is not running
+	StateStopped State = "stopped"
+)
+
+// WatchFunc watches the lease file and sends its content over output each time it changes, until the
+// context is cancelled; it must call ready once the watch is established, and close output when
+// returning. WatchLeases is the default.
+type WatchFunc func(ctx context.Context, filePath string, output chan<- []*Lease, ready func()) error
+
+// Status describes what the Watcher is doing
+type Status struct {
+	State State
+
+	// Since is when the Watcher entered the current state
+	Since time.Time
+
+	// Restarts counts how many times the watch failed
+	Restarts int
+
+	// LastError is the error that caused the last restart, if any
+	LastError string
+
+	// LastRead is when the lease file was last read
+	LastRead time.Time
+}
+
+// MarshalJSON customizes the JSON serialization for Status
+func (s Status) MarshalJSON() ([]byte, error) {
+	var lastRead int64
+	if !s.LastRead.IsZero() {
+		lastRead = s.LastRead.Unix()
+	}
+	return json.Marshal(&struct {
+		State     State  `json:"state"`
+		Since     int64  `json:"since"`
+		Restarts  int    `json:"restarts"`
+		LastError string `json:"last_error"`
+		LastRead  int64  `json:"last_read"`
+	}{
+		State:     s.State,
+		Since:     s.Since.Unix(),
+		Restarts:  s.Restarts,
+		LastError: s.LastError,
+		LastRead:  lastRead,
+	})
+}
+
+// IsHealthy returns true if changes to the lease file are currently being detected
+func (s Status) IsHealthy() bool {
+	return s.State == StateWatching || s.State == StatePolling
+}
+
+// Watcher sends the content of the lease file over a channel each time the file changes
+type Watcher struct {
+	logger   *logger.CustomLogger
+	filePath string
+	output   chan<- []*Lease
+	watch    WatchFunc
+
+	// InitialBackoff is the delay before restarting a failed watch; it doubles at each consecutive failure
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// MaxWatchFailures is the number of consecutive failures after which the Watcher falls back to polling
+	MaxWatchFailures int
+
+	// PollInterval is how often the lease file is checked for changes while polling
+	PollInterval time.Duration
+
+	// WatchRetryInterval is how long the Watcher keeps polling before trying inotify again
+	WatchRetryInterval time.Duration
+
+	// StableAfter is how long a watch must run to reset the count of consecutive failures
+	StableAfter time.Duration
+
+	lock   sync.Mutex
+	status Status
+}
+
+// NewWatcher creates a Watcher for the given lease file; the output channel is never closed
+func NewWatcher(logger *logger.CustomLogger, filePath string, output chan<- []*Lease) *Watcher {
+	return NewWatcherWithFunc(logger, filePath, output, WatchLeases)
+}
+
+// NewWatcherWithFunc creates a Watcher using the given WatchFunc; this is mostly useful for unit tests
+func NewWatcherWithFunc(logger *logger.CustomLogger, filePath string, output chan<- []*Lease, watch WatchFunc) *Watcher {
+	return &Watcher{
+		logger:             logger,
+		filePath:           filePath,
+		output:             output,
+		watch:              watch,
+		InitialBackoff:     defaultInitialBackoff,
+		MaxBackoff:         defaultMaxBackoff,
+		MaxWatchFailures:   defaultMaxWatchFailures,
+		PollInterval:       defaultPollInterval,
+		WatchRetryInterval: defaultWatchRetryInterval,
+		StableAfter:        defaultStableAfter,
+		status:             Status{State: StateStarting, Since: time.Now()},
+	}
+}
+
+// Status returns a snapshot of the current status of the Watcher
+func (w *Watcher) Status() Status {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.status
+}
+
+func (w *Watcher) setState(state State) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.status.State != state {
+		w.status.State = state
+		w.status.Since = time.Now()
+	}
+}
+
+func (w *Watcher) recordFailure(err error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.status.Restarts++
+	w.status.LastError = err.Error()
+}
+
+// Run watches the lease file until the context is cancelled
+func (w *Watcher) Run(ctx context.Context) {
+	defer w.setState(StateStopped)
+
+	failures := 0
+	backoff := w.InitialBackoff
+	recovering := false
+	for ctx.Err() == nil {
+		if failures >= w.MaxWatchFailures {
+			w.logger.Warnf("watching the DHCP lease file failed %d times in a row, polling it every %s\n", failures, w.PollInterval)
+			w.poll(ctx, w.WatchRetryInterval)
+
+			// give inotify another chance, but go back to polling at the first failure
+			failures = w.MaxWatchFailures - 1
+			recovering = true
+			continue
+		}
+
+		started := time.Now()
+		err := w.watchOnce(ctx, recovering)
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(started) >= w.StableAfter {
+			failures = 0
+			backoff = w.InitialBackoff
+		}
+		failures++
+		recovering = true
+		w.recordFailure(err)
+		if failures >= w.MaxWatchFailures {
+			continue
+		}
+
+		w.logger.Warnf("error while watching DHCP leases file: %s; restarting in %s\n", err.Error(), backoff)
+		w.setState(StateBackoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, w.MaxBackoff)
+	}
+}
+
+// watchOnce runs the WatchFunc until it fails or the context is cancelled; when recovering from a failure,
+// the lease file is read first, since changes might have been missed while the watch was not running.
+// The Watcher enters StateWatching only once the WatchFunc reports that the watch is established.
+func (w *Watcher) watchOnce(ctx context.Context, recovering bool) error {
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ch := make(chan []*Lease)
+	errCh := make(chan error, 1)
+	readyCh := make(chan struct{})
+	var readyOnce sync.Once
+	go func() {
+		errCh <- w.watch(watchCtx, w.filePath, ch, func() { readyOnce.Do(func() { close(readyCh) }) })
+	}()
+
+	if recovering {
+		if err := w.readAndSend(ctx); err != nil {
+			w.logger.Warnf("failed to read the DHCP lease file: %s\n", err.Error())
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			// the WatchFunc might be blocked reading from inotify: don't wait for it
+			return ctx.Err()
+		case <-readyCh:
+			w.setState(StateWatching)
+			readyCh = nil // a nil channel is never ready again
+		case leases, ok := <-ch:
+			if !ok {
+				if err := <-errCh; err != nil {
+					return err
+				}
+				return errors.New("the watch stopped unexpectedly")
+			}
+			w.send(ctx, leases)
+		}
+	}
+}
+
+// poll checks the lease file for changes every PollInterval, for the given duration or until the
+// context is cancelled; the lease file is always read at the beginning
+func (w *Watcher) poll(ctx context.Context, duration time.Duration) {
+	w.setState(StatePolling)
+
+	ticker := time.NewTicker(w.PollInterval)
+	defer ticker.Stop()
+	deadline := time.After(duration)
+
+	var lastModTime time.Time
+	lastSize := int64(-1)
+	for {
+		info, err := os.Stat(w.filePath)
+		if err != nil {
+			w.logger.Warnf("failed to check the DHCP lease file: %s\n", err.Error())
+		} else if !info.ModTime().Equal(lastModTime) || info.Size() != lastSize {
+			if err := w.readAndSend(ctx); err != nil {
+				w.logger.Warnf("failed to read the DHCP lease file: %s\n", err.Error())
+			} else {
+				lastModTime = info.ModTime()
+				lastSize = info.Size()
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-deadline:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *Watcher) readAndSend(ctx context.Context) error {
+	leases, err := readLeaseFile(w.filePath)
+	if err != nil {
+		return err
+	}
+	w.send(ctx, leases)
+	return nil
+}
+
+func (w *Watcher) send(ctx context.Context, leases []*Lease) {
+	select {
+	case <-ctx.Done():
+		return
+	case w.output <- leases:
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.status.LastRead = time.Now()
+}
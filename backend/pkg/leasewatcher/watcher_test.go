@@ -0,0 +1,181 @@
+package leasewatcher
+
+import (
+	"context"
+	"dnsmasq-dhcp-backend/pkg/logger"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	leaseClient1 = "1700000000 00:11:22:33:44:55 192.168.0.2 client1 01:00:11:22:33:44:55\n"
+	leaseClient2 = "1700000000 00:11:22:33:44:56 192.168.0.3 client2 01:00:11:22:33:44:56\n"
+)
+
+func writeLeaseFile(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+}
+
+// nextHostnames returns the hostnames of the next list of leases sent by the Watcher
+func nextHostnames(t *testing.T, output <-chan []*Lease) []string {
+	t.Helper()
+	select {
+	case leases := <-output:
+		hostnames := make([]string, 0, len(leases))
+		for _, l := range leases {
+			hostnames = append(hostnames, l.Hostname)
+		}
+		return hostnames
+	case <-time.After(5 * time.Second):
+		t.Fatal("no leases received")
+		return nil
+	}
+}
+
+func startWatcher(t *testing.T, w *Watcher) {
+	w.InitialBackoff = time.Millisecond
+	w.PollInterval = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func TestWatcherRestartsAndRereads(t *testing.T) {
+	leaseFile := filepath.Join(t.TempDir(), "dnsmasq.leases")
+	writeLeaseFile(t, leaseFile, leaseClient1)
+
+	var lock sync.Mutex
+	calls := 0
+	watch := func(ctx context.Context, filePath string, output chan<- []*Lease, ready func()) error {
+		defer close(output)
+		lock.Lock()
+		calls++
+		first := calls == 1
+		lock.Unlock()
+		if first {
+			return errors.New("inotify broke")
+		}
+		ready()
+		output <- []*Lease{{Hostname: "from-inotify"}}
+		<-ctx.Done()
+		return nil
+	}
+
+	output := make(chan []*Lease)
+	w := NewWatcherWithFunc(logger.NewCustomLogger("unit tests"), leaseFile, output, watch)
+	startWatcher(t, w)
+
+	// after the failure, the lease file is read again before waiting for inotify
+	assert.Equal(t, []string{"client1"}, nextHostnames(t, output))
+	assert.Equal(t, []string{"from-inotify"}, nextHostnames(t, output))
+
+	status := w.Status()
+	assert.Equal(t, StateWatching, status.State)
+	assert.True(t, status.IsHealthy())
+	assert.Equal(t, 1, status.Restarts)
+	assert.Equal(t, "inotify broke", status.LastError)
+	assert.False(t, status.LastRead.IsZero())
+}
+
+func TestWatcherFallsBackToPolling(t *testing.T) {
+	leaseFile := filepath.Join(t.TempDir(), "dnsmasq.leases")
+	writeLeaseFile(t, leaseFile, leaseClient1)
+
+	watch := func(ctx context.Context, filePath string, output chan<- []*Lease, ready func()) error {
+		close(output)
+		return errors.New("too many open files")
+	}
+
+	output := make(chan []*Lease, 10)
+	w := NewWatcherWithFunc(logger.NewCustomLogger("unit tests"), leaseFile, output, watch)
+	w.MaxWatchFailures = 2
+	startWatcher(t, w)
+
+	// the first re-read happens after the first failure, the second one when polling starts
+	assert.Equal(t, []string{"client1"}, nextHostnames(t, output))
+	assert.Equal(t, []string{"client1"}, nextHostnames(t, output))
+	assert.Equal(t, StatePolling, w.Status().State)
+
+	writeLeaseFile(t, leaseFile, leaseClient1+leaseClient2)
+	assert.Equal(t, []string{"client1", "client2"}, nextHostnames(t, output))
+	assert.Equal(t, 2, w.Status().Restarts)
+}
+
+func TestWatcherStops(t *testing.T) {
+	watch := func(ctx context.Context, filePath string, output chan<- []*Lease, ready func()) error {
+		defer close(output)
+		ready()
+		<-ctx.Done()
+		return nil
+	}
+
+	w := NewWatcherWithFunc(logger.NewCustomLogger("unit tests"), "/nonexistent", make(chan []*Lease), watch)
+	assert.Equal(t, StateStarting, w.Status().State)
+	assert.False(t, w.Status().IsHealthy())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx)
+		close(done)
+	}()
+	assert.Eventually(t, func() bool { return w.Status().State == StateWatching }, 5*time.Second, time.Millisecond)
+
+	cancel()
+	<-done
+	assert.Equal(t, StateStopped, w.Status().State)
+	assert.Equal(t, 0, w.Status().Restarts)
+}
+
+func TestWatcherNotWatchingUntilReady(t *testing.T) {
+	unblock := make(chan struct{})
+	watch := func(ctx context.Context, filePath string, output chan<- []*Lease, ready func()) error {
+		defer close(output)
+		// e.g. adding the inotify watch takes a while, then fails
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-unblock:
+		}
+		return errors.New("failed to add the watch")
+	}
+
+	w := NewWatcherWithFunc(logger.NewCustomLogger("unit tests"), "/nonexistent", make(chan []*Lease), watch)
+	w.InitialBackoff = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// the watch is not established yet: the Watcher must not report itself as healthy
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, StateStarting, w.Status().State)
+	assert.False(t, w.Status().IsHealthy())
+
+	close(unblock)
+	assert.Eventually(t, func() bool { return w.Status().State == StateBackoff }, 5*time.Second, time.Millisecond)
+	assert.False(t, w.Status().IsHealthy())
+	assert.Equal(t, 1, w.Status().Restarts)
+}
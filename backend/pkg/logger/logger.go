@@ -9,6 +9,7 @@ package logger
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"time"
@@ -29,8 +30,13 @@ type CustomLogger struct {
 }
 
 func NewCustomLogger(prefix string) *CustomLogger {
+	return NewCustomLoggerWithWriter(prefix, os.Stdout)
+}
+
+// NewCustomLoggerWithWriter creates a CustomLogger writing to the given io.Writer instead of stdout
+func NewCustomLoggerWithWriter(prefix string, w io.Writer) *CustomLogger {
 	pid := os.Getpid()
-	logger := log.New(os.Stdout, "", 0) // No flags here, we'll add timestamp manually
+	logger := log.New(w, "", 0) // No flags here, we'll add timestamp manually
 	return &CustomLogger{
 		logger: logger,
 		pid:    pid,
@@ -0,0 +1,85 @@
+package mqttpublisher
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	// defaultOperationTimeout bounds the time spent waiting for the broker to acknowledge
+	// a connection or a publish
+	defaultOperationTimeout = 10 * time.Second
+
+	// payloads published on the availability topic
+	availabilityOnline  = "online"
+	availabilityOffline = "offline"
+)
+
+// Client is the minimal set of MQTT operations required by the Publisher
+type Client interface {
+	// Connect establishes the connection with the broker
+	Connect() error
+
+	// Publish sends the payload on the given topic, with QoS 1
+	Publish(topic string, payload []byte, retained bool) error
+
+	// Disconnect closes the connection with the broker
+	Disconnect()
+}
+
+// pahoClient is the Client implementation based on the Eclipse Paho library
+type pahoClient struct {
+	client            mqtt.Client
+	availabilityTopic string
+}
+
+// NewPahoClient creates a Client for the broker described by the given Config.
+// The client registers a last will on the availability topic, so that the broker marks all entities
+// as unavailable if this process dies, and it reconnects automatically once connected the first time.
+func NewPahoClient(cfg Config) Client {
+	cfg = cfg.withDefaults()
+	opts := mqtt.NewClientOptions().
+		AddBroker(cfg.BrokerURL).
+		SetClientID(cfg.ClientID).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetCleanSession(true).
+		SetAutoReconnect(true).
+		SetConnectTimeout(defaultOperationTimeout).
+		SetWill(cfg.AvailabilityTopic(), availabilityOffline, 1, true).
+		SetOnConnectHandler(func(c mqtt.Client) {
+			// announce availability on every (re)connection, to override the last will
+			c.Publish(cfg.AvailabilityTopic(), 1, true, availabilityOnline)
+		})
+	return &pahoClient{client: mqtt.NewClient(opts), availabilityTopic: cfg.AvailabilityTopic()}
+}
+
+func waitToken(t mqtt.Token) error {
+	if !t.WaitTimeout(defaultOperationTimeout) {
+		return errors.New("timeout waiting for the MQTT broker")
+	}
+	return t.Error()
+}
+
+func (c *pahoClient) Connect() error {
+	if err := waitToken(c.client.Connect()); err != nil {
+		return fmt.Errorf("failed to connect to MQTT broker: %w", err)
+	}
+	return nil
+}
+
+func (c *pahoClient) Publish(topic string, payload []byte, retained bool) error {
+	if err := waitToken(c.client.Publish(topic, 1, retained, payload)); err != nil {
+		return fmt.Errorf("failed to publish on MQTT topic %s: %w", topic, err)
+	}
+	return nil
+}
+
+func (c *pahoClient) Disconnect() {
+	// the last will is not sent on a clean disconnection: mark the entities as unavailable explicitly
+	_ = waitToken(c.client.Publish(c.availabilityTopic, 1, true, availabilityOffline))
+	c.client.Disconnect(uint(defaultOperationTimeout.Milliseconds()))
+}
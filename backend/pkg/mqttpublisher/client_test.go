@@ -0,0 +1,60 @@
+package mqttpublisher
+
+import (
+	"dnsmasq-dhcp-backend/pkg/logger"
+	"os"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPahoClientWithBroker runs against a real MQTT broker, e.g. a local Mosquitto started with
+//
+//	docker run --rm -p 1883:1883 eclipse-mosquitto:2 mosquitto -c /mosquitto-no-auth.conf
+//
+// and is skipped unless the MQTT_TEST_BROKER environment variable contains the broker URL.
+func TestPahoClientWithBroker(t *testing.T) {
+	brokerURL := os.Getenv("MQTT_TEST_BROKER")
+	if brokerURL == "" {
+		t.Skip("MQTT_TEST_BROKER not set")
+	}
+
+	cfg := Config{
+		BrokerURL:   brokerURL,
+		ClientID:    "dnsmasq-dhcp-unit-tests",
+		TopicPrefix: "dnsmasq_dhcp_unit_tests",
+	}
+	p := NewPublisher(logger.NewCustomLogger("unit tests"), NewPahoClient(cfg), cfg)
+	require.NoError(t, p.Update([]TrackedClient{laptop}, []PoolStats{pool}, nil))
+
+	// a second client plays the role of Home Assistant: retained messages must be delivered to it
+	received := make(chan mqtt.Message, 100)
+	subscriber := mqtt.NewClient(mqtt.NewClientOptions().AddBroker(brokerURL).SetClientID("dnsmasq-dhcp-unit-tests-subscriber"))
+	require.NoError(t, waitToken(subscriber.Connect()))
+	defer subscriber.Disconnect(100)
+	require.NoError(t, waitToken(subscriber.Subscribe(cfg.TopicPrefix+"/#", 1, func(_ mqtt.Client, m mqtt.Message) {
+		received <- m
+	})))
+
+	messages := make(map[string]string)
+	timeout := time.After(5 * time.Second)
+	for len(messages) < 4 {
+		select {
+		case m := <-received:
+			messages[m.Topic()] = string(m.Payload())
+		case <-timeout:
+			t.Fatalf("received only %d messages: %v", len(messages), messages)
+		}
+	}
+	assert.Equal(t, availabilityOnline, messages[cfg.AvailabilityTopic()])
+	assert.Equal(t, StateHome, messages[cfg.TopicPrefix+"/client/001122334455/state"])
+	assert.Contains(t, messages, cfg.TopicPrefix+"/client/001122334455/attributes")
+	assert.Contains(t, messages, cfg.TopicPrefix+"/pool/eth0_192_168_1_50_192_168_1_150/state")
+
+	// cleanup the retained messages
+	require.NoError(t, p.Update(nil, nil, nil))
+	p.Close()
+}
@@ -0,0 +1,13 @@
+/*
+Package mqttpublisher exposes the DHCP clients and the DHCP pool/DNS statistics to Home Assistant
+through its MQTT integration, without the need of a custom integration.
+
+Each DHCP client becomes a device_tracker entity and each DHCP range/DNS statistic becomes a sensor
+entity: the Publisher announces them using the Home Assistant MQTT discovery protocol, see
+https://www.home-assistant.io/integrations/mqtt/#mqtt-discovery, and then keeps their state updated.
+All messages are retained, so that Home Assistant gets the last known state even after a restart.
+
+The connection to the MQTT broker is abstracted by the Client interface: the real implementation
+is based on the Eclipse Paho library while unit tests use the in-process FakeClient.
+*/
+package mqttpublisher
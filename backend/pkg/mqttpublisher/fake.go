@@ -0,0 +1,87 @@
+package mqttpublisher
+
+import "sync"
+
+// FakeMessage is a message published through FakeClient
+type FakeMessage struct {
+	Topic    string
+	Payload  string
+	Retained bool
+}
+
+// FakeClient is an in-process Client for unit tests: it records all published messages and
+// keeps the last retained payload of each topic, like a broker would do
+type FakeClient struct {
+	lock      sync.Mutex
+	connected bool
+	messages  []FakeMessage
+	retained  map[string]string
+
+	// ConnectErr, if set, is returned by Connect
+	ConnectErr error
+
+	// PublishErr, if set, is returned by Publish
+	PublishErr error
+}
+
+// NewFakeClient creates a disconnected FakeClient
+func NewFakeClient() *FakeClient {
+	return &FakeClient{retained: make(map[string]string)}
+}
+
+func (c *FakeClient) Connect() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.ConnectErr != nil {
+		return c.ConnectErr
+	}
+	c.connected = true
+	return nil
+}
+
+func (c *FakeClient) Publish(topic string, payload []byte, retained bool) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.PublishErr != nil {
+		return c.PublishErr
+	}
+	c.messages = append(c.messages, FakeMessage{Topic: topic, Payload: string(payload), Retained: retained})
+	if retained {
+		if len(payload) == 0 {
+			delete(c.retained, topic)
+		} else {
+			c.retained[topic] = string(payload)
+		}
+	}
+	return nil
+}
+
+func (c *FakeClient) Disconnect() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.connected = false
+}
+
+// IsConnected returns true between a successful Connect and Disconnect
+func (c *FakeClient) IsConnected() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.connected
+}
+
+// Messages returns all the messages published so far and forgets them
+func (c *FakeClient) Messages() []FakeMessage {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	messages := c.messages
+	c.messages = nil
+	return messages
+}
+
+// Retained returns the retained payload of the given topic, if any
+func (c *FakeClient) Retained(topic string) (string, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	payload, ok := c.retained[topic]
+	return payload, ok
+}
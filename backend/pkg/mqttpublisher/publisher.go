@@ -0,0 +1,423 @@
+package mqttpublisher
+
+import (
+	"dnsmasq-dhcp-backend/pkg/logger"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	// DefaultDiscoveryPrefix is the discovery prefix Home Assistant subscribes to by default
+	DefaultDiscoveryPrefix = "homeassistant"
+
+	// DefaultTopicPrefix is the prefix used for all state topics when not specified in the addon options
+	DefaultTopicPrefix = "dnsmasq_dhcp"
+
+	// states of the device_tracker entities
+	StateHome    = "home"
+	StateNotHome = "not_home"
+)
+
+// invalidIDChars matches the characters not allowed inside Home Assistant node IDs and object IDs
+var invalidIDChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+func sanitizeID(s string) string {
+	return invalidIDChars.ReplaceAllString(s, "_")
+}
+
+// Config contains the MQTT broker settings and the topic layout
+type Config struct {
+	// BrokerURL looks like "tcp://core-mosquitto:1883"
+	BrokerURL string
+	Username  string
+	Password  string
+	ClientID  string
+
+	// DiscoveryPrefix must match the discovery prefix configured in the Home Assistant MQTT integration
+	DiscoveryPrefix string
+
+	// TopicPrefix is the prefix of all state topics; it also identifies this addon instance
+	// inside the discovery topics and the unique IDs of the entities
+	TopicPrefix string
+}
+
+// withDefaults returns a copy of the Config where the empty settings are replaced by their default
+func (c Config) withDefaults() Config {
+	if c.DiscoveryPrefix == "" {
+		c.DiscoveryPrefix = DefaultDiscoveryPrefix
+	}
+	if c.TopicPrefix == "" {
+		c.TopicPrefix = DefaultTopicPrefix
+	}
+	if c.ClientID == "" {
+		c.ClientID = c.nodeID()
+	}
+	return c
+}
+
+// AvailabilityTopic is the topic where "online" or "offline" is published for all entities
+func (c Config) AvailabilityTopic() string {
+	return c.TopicPrefix + "/status"
+}
+
+func (c Config) nodeID() string {
+	return sanitizeID(c.TopicPrefix)
+}
+
+// TrackedClient is a DHCP client exposed as a device_tracker entity
+type TrackedClient struct {
+	MacAddr  net.HardwareAddr
+	IPAddr   netip.Addr // maybe invalid
+	Hostname string
+
+	// FriendlyName is used as name of the entity; when empty the hostname or the MAC address is used instead
+	FriendlyName string
+
+	// Home is true when the client has an active DHCP lease
+	Home bool
+}
+
+func (c TrackedClient) name() string {
+	if c.FriendlyName != "" {
+		return c.FriendlyName
+	}
+	if c.Hostname != "" {
+		return c.Hostname
+	}
+	return c.MacAddr.String()
+}
+
+func (c TrackedClient) state() string {
+	if c.Home {
+		return StateHome
+	}
+	return StateNotHome
+}
+
+// PoolStats is the usage of a DHCP range, exposed as a group of sensor entities
+type PoolStats struct {
+	Interface    string
+	Start        string
+	End          string
+	Size         int64
+	Used         int64
+	Reserved     int64
+	Free         int64
+	UsagePercent float64
+}
+
+func (s PoolStats) id() string {
+	return sanitizeID(fmt.Sprintf("%s_%s_%s", s.Interface, s.Start, s.End))
+}
+
+// DnsStats are the DNS cache metrics, exposed as a group of sensor entities
+type DnsStats struct {
+	CacheSize       int
+	CacheInsertions int
+	CacheEvictions  int
+	CacheMisses     int
+	CacheHits       int
+}
+
+// discoveryDevice is the "device" section of a discovery message
+type discoveryDevice struct {
+	Identifiers  []string    `json:"identifiers,omitempty"`
+	Connections  [][2]string `json:"connections,omitempty"`
+	Name         string      `json:"name"`
+	Manufacturer string      `json:"manufacturer,omitempty"`
+	Model        string      `json:"model,omitempty"`
+	ViaDevice    string      `json:"via_device,omitempty"`
+}
+
+// deviceTrackerConfig is the discovery message for a device_tracker entity
+type deviceTrackerConfig struct {
+	// Name is always null: the entity gets the name of its device
+	Name                *string         `json:"name"`
+	UniqueID            string          `json:"unique_id"`
+	StateTopic          string          `json:"state_topic"`
+	JSONAttributesTopic string          `json:"json_attributes_topic"`
+	PayloadHome         string          `json:"payload_home"`
+	PayloadNotHome      string          `json:"payload_not_home"`
+	SourceType          string          `json:"source_type"`
+	AvailabilityTopic   string          `json:"availability_topic"`
+	Device              discoveryDevice `json:"device"`
+}
+
+// sensorConfig is the discovery message for a sensor entity
+type sensorConfig struct {
+	Name              string          `json:"name"`
+	UniqueID          string          `json:"unique_id"`
+	StateTopic        string          `json:"state_topic"`
+	ValueTemplate     string          `json:"value_template"`
+	UnitOfMeasurement string          `json:"unit_of_measurement,omitempty"`
+	StateClass        string          `json:"state_class"`
+	Icon              string          `json:"icon,omitempty"`
+	AvailabilityTopic string          `json:"availability_topic"`
+	Device            discoveryDevice `json:"device"`
+}
+
+// sensorDef describes a sensor extracting one field from a JSON state message
+type sensorDef struct {
+	suffix     string
+	name       string
+	field      string
+	unit       string
+	stateClass string
+	icon       string
+}
+
+var poolSensors = []sensorDef{
+	{suffix: "usage", name: "usage", field: "usage_percent", unit: "%", stateClass: "measurement", icon: "mdi:chart-donut"},
+	{suffix: "used", name: "used IPs", field: "used", stateClass: "measurement", icon: "mdi:ip-network"},
+	{suffix: "free", name: "free IPs", field: "free", stateClass: "measurement", icon: "mdi:ip-network-outline"},
+}
+
+var dnsSensors = []sensorDef{
+	{suffix: "dns_cache_size", name: "DNS cache size", field: "cache_size", stateClass: "measurement", icon: "mdi:database"},
+	{suffix: "dns_cache_insertions", name: "DNS cache insertions", field: "cache_insertions", stateClass: "total_increasing", icon: "mdi:database-plus"},
+	{suffix: "dns_cache_evictions", name: "DNS cache evictions", field: "cache_evictions", stateClass: "total_increasing", icon: "mdi:database-minus"},
+	{suffix: "dns_cache_misses", name: "DNS cache misses", field: "cache_misses", stateClass: "total_increasing", icon: "mdi:database-remove"},
+	{suffix: "dns_cache_hits", name: "DNS cache hits", field: "cache_hits", stateClass: "total_increasing", icon: "mdi:database-check"},
+}
+
+// Publisher announces DHCP clients, DHCP ranges and DNS statistics to Home Assistant and keeps
+// their state updated. Messages whose payload did not change since the last update are not published again.
+type Publisher struct {
+	logger *logger.CustomLogger
+	client Client
+	cfg    Config
+
+	lock      sync.Mutex
+	connected bool
+
+	// lastPayloads contains the last payload published on each topic
+	lastPayloads map[string]string
+
+	// trackedClients contains the MAC addresses having a device_tracker entity
+	trackedClients map[string]TrackedClient
+}
+
+// NewPublisher creates a Publisher sending messages through the given Client
+func NewPublisher(logger *logger.CustomLogger, client Client, cfg Config) *Publisher {
+	return &Publisher{
+		logger:         logger,
+		client:         client,
+		cfg:            cfg.withDefaults(),
+		lastPayloads:   make(map[string]string),
+		trackedClients: make(map[string]TrackedClient),
+	}
+}
+
+// Update publishes the discovery messages and the state of all the given DHCP clients, DHCP ranges and
+// DNS statistics. The list of clients must be complete: clients tracked by a previous Update and
+// missing from the given list have their entity removed from Home Assistant.
+// The DNS statistics are not published when dns is nil.
+// Errors on a single message do not prevent the other messages from being published.
+func (p *Publisher) Update(clients []TrackedClient, pools []PoolStats, dns *DnsStats) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if !p.connected {
+		// once connected the first time, the client takes care of reconnecting
+		if err := p.client.Connect(); err != nil {
+			return err
+		}
+		p.connected = true
+		p.logger.Infof("Connected to MQTT broker %s", p.cfg.BrokerURL)
+	}
+
+	var errs []error
+	errs = append(errs, p.publishClients(clients)...)
+	errs = append(errs, p.publishPools(pools)...)
+	if dns != nil {
+		errs = append(errs, p.publishDnsStats(*dns)...)
+	}
+	return errors.Join(errs...)
+}
+
+// Close marks all entities as unavailable and disconnects from the broker
+func (p *Publisher) Close() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.connected {
+		p.client.Disconnect()
+		p.connected = false
+	}
+}
+
+// publish sends a retained message, unless the same payload was already published on the topic
+func (p *Publisher) publish(topic string, payload []byte) error {
+	if last, ok := p.lastPayloads[topic]; ok && last == string(payload) {
+		return nil
+	}
+	if err := p.client.Publish(topic, payload, true); err != nil {
+		return err
+	}
+	p.lastPayloads[topic] = string(payload)
+	return nil
+}
+
+// publishJSON marshals the given value and publishes it as retained message
+func (p *Publisher) publishJSON(topic string, v any) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal the MQTT message for topic %s: %w", topic, err)
+	}
+	return p.publish(topic, payload)
+}
+
+// remove deletes the retained message on the given topic
+func (p *Publisher) remove(topic string) error {
+	delete(p.lastPayloads, topic)
+	return p.client.Publish(topic, nil, true)
+}
+
+// serverDevice is the Home Assistant device grouping the sensors of this addon
+func (p *Publisher) serverDevice() discoveryDevice {
+	return discoveryDevice{
+		Identifiers:  []string{p.cfg.nodeID()},
+		Name:         "Dnsmasq-DHCP",
+		Manufacturer: "dnsmasq",
+		Model:        "DHCP server",
+	}
+}
+
+func (p *Publisher) discoveryTopic(component, objectID string) string {
+	return fmt.Sprintf("%s/%s/%s/%s/config", p.cfg.DiscoveryPrefix, component, p.cfg.nodeID(), objectID)
+}
+
+func (p *Publisher) clientTopic(c TrackedClient, leaf string) string {
+	return fmt.Sprintf("%s/client/%s/%s", p.cfg.TopicPrefix, clientObjectID(c.MacAddr), leaf)
+}
+
+func clientObjectID(mac net.HardwareAddr) string {
+	return strings.ReplaceAll(mac.String(), ":", "")
+}
+
+func (p *Publisher) publishClients(clients []TrackedClient) []error {
+	var errs []error
+	seen := make(map[string]bool, len(clients))
+	for _, c := range clients {
+		seen[c.MacAddr.String()] = true
+		p.trackedClients[c.MacAddr.String()] = c
+
+		objectID := clientObjectID(c.MacAddr)
+		config := deviceTrackerConfig{
+			UniqueID:            p.cfg.nodeID() + "_" + objectID,
+			StateTopic:          p.clientTopic(c, "state"),
+			JSONAttributesTopic: p.clientTopic(c, "attributes"),
+			PayloadHome:         StateHome,
+			PayloadNotHome:      StateNotHome,
+			SourceType:          "router",
+			AvailabilityTopic:   p.cfg.AvailabilityTopic(),
+			Device: discoveryDevice{
+				Connections: [][2]string{{"mac", c.MacAddr.String()}},
+				Name:        c.name(),
+				ViaDevice:   p.cfg.nodeID(),
+			},
+		}
+
+		// these attribute names are the ones recognized by Home Assistant for device trackers
+		attributes := map[string]string{
+			"mac":       c.MacAddr.String(),
+			"host_name": c.Hostname,
+		}
+		if c.IPAddr.IsValid() {
+			attributes["ip"] = c.IPAddr.String()
+		}
+
+		// the discovery message must be published before the state
+		if err := p.publishJSON(p.discoveryTopic("device_tracker", objectID), config); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := p.publishJSON(p.clientTopic(c, "attributes"), attributes); err != nil {
+			errs = append(errs, err)
+		}
+		if err := p.publish(p.clientTopic(c, "state"), []byte(c.state())); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for mac, c := range p.trackedClients {
+		if seen[mac] {
+			continue
+		}
+		// an empty discovery message removes the entity from Home Assistant
+		for _, topic := range []string{
+			p.discoveryTopic("device_tracker", clientObjectID(c.MacAddr)),
+			p.clientTopic(c, "attributes"),
+			p.clientTopic(c, "state"),
+		} {
+			if err := p.remove(topic); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		delete(p.trackedClients, mac)
+	}
+	return errs
+}
+
+// publishSensors publishes the discovery messages of a group of sensors sharing the same state topic,
+// followed by the state itself
+func (p *Publisher) publishSensors(defs []sensorDef, idPrefix, namePrefix, stateTopic string, state any) []error {
+	var errs []error
+	for _, d := range defs {
+		config := sensorConfig{
+			Name:              strings.TrimSpace(namePrefix + " " + d.name),
+			UniqueID:          p.cfg.nodeID() + "_" + idPrefix + d.suffix,
+			StateTopic:        stateTopic,
+			ValueTemplate:     fmt.Sprintf("{{ value_json.%s }}", d.field),
+			UnitOfMeasurement: d.unit,
+			StateClass:        d.stateClass,
+			Icon:              d.icon,
+			AvailabilityTopic: p.cfg.AvailabilityTopic(),
+			Device:            p.serverDevice(),
+		}
+		if err := p.publishJSON(p.discoveryTopic("sensor", idPrefix+d.suffix), config); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := p.publishJSON(stateTopic, state); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+func (p *Publisher) publishPools(pools []PoolStats) []error {
+	var errs []error
+	for _, s := range pools {
+		state := struct {
+			Size         int64   `json:"size"`
+			Used         int64   `json:"used"`
+			Reserved     int64   `json:"reserved"`
+			Free         int64   `json:"free"`
+			UsagePercent float64 `json:"usage_percent"`
+		}{s.Size, s.Used, s.Reserved, s.Free, s.UsagePercent}
+
+		errs = append(errs, p.publishSensors(poolSensors,
+			"pool_"+s.id()+"_",
+			fmt.Sprintf("DHCP pool %s %s-%s", s.Interface, s.Start, s.End),
+			fmt.Sprintf("%s/pool/%s/state", p.cfg.TopicPrefix, s.id()),
+			state)...)
+	}
+	return errs
+}
+
+func (p *Publisher) publishDnsStats(s DnsStats) []error {
+	state := struct {
+		CacheSize       int `json:"cache_size"`
+		CacheInsertions int `json:"cache_insertions"`
+		CacheEvictions  int `json:"cache_evictions"`
+		CacheMisses     int `json:"cache_misses"`
+		CacheHits       int `json:"cache_hits"`
+	}{s.CacheSize, s.CacheInsertions, s.CacheEvictions, s.CacheMisses, s.CacheHits}
+
+	return p.publishSensors(dnsSensors, "", "", p.cfg.TopicPrefix+"/dns/state", state)
+}
@@ -0,0 +1,184 @@
+package mqttpublisher
+
+import (
+	"dnsmasq-dhcp-backend/pkg/logger"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	laptop = TrackedClient{
+		MacAddr:      net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55},
+		IPAddr:       netip.MustParseAddr("192.168.1.50"),
+		Hostname:     "laptop",
+		FriendlyName: "My Laptop",
+		Home:         true,
+	}
+	phone = TrackedClient{
+		MacAddr:  net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff},
+		IPAddr:   netip.MustParseAddr("192.168.1.51"),
+		Hostname: "phone",
+		Home:     false,
+	}
+	pool = PoolStats{
+		Interface:    "eth0",
+		Start:        "192.168.1.50",
+		End:          "192.168.1.150",
+		Size:         101,
+		Used:         2,
+		Reserved:     1,
+		Free:         98,
+		UsagePercent: 2.97,
+	}
+)
+
+func newTestPublisher() (*Publisher, *FakeClient) {
+	client := NewFakeClient()
+	p := NewPublisher(logger.NewCustomLogger("unit tests"), client, Config{BrokerURL: "tcp://localhost:1883"})
+	return p, client
+}
+
+func retainedJSON(t *testing.T, client *FakeClient, topic string) map[string]any {
+	t.Helper()
+	payload, ok := client.Retained(topic)
+	require.True(t, ok, "no retained message on %s", topic)
+	var v map[string]any
+	require.NoError(t, json.Unmarshal([]byte(payload), &v))
+	return v
+}
+
+func TestPublisherDeviceTrackers(t *testing.T) {
+	p, client := newTestPublisher()
+
+	require.NoError(t, p.Update([]TrackedClient{laptop, phone}, nil, nil))
+	assert.True(t, client.IsConnected())
+
+	config := retainedJSON(t, client, "homeassistant/device_tracker/dnsmasq_dhcp/001122334455/config")
+	assert.Nil(t, config["name"])
+	assert.Equal(t, "dnsmasq_dhcp_001122334455", config["unique_id"])
+	assert.Equal(t, "dnsmasq_dhcp/client/001122334455/state", config["state_topic"])
+	assert.Equal(t, "dnsmasq_dhcp/status", config["availability_topic"])
+	assert.Equal(t, "router", config["source_type"])
+	device := config["device"].(map[string]any)
+	assert.Equal(t, "My Laptop", device["name"])
+	assert.Equal(t, []any{[]any{"mac", "00:11:22:33:44:55"}}, device["connections"])
+
+	// without a friendly name the hostname is used
+	config = retainedJSON(t, client, "homeassistant/device_tracker/dnsmasq_dhcp/aabbccddeeff/config")
+	assert.Equal(t, "phone", config["device"].(map[string]any)["name"])
+
+	state, _ := client.Retained("dnsmasq_dhcp/client/001122334455/state")
+	assert.Equal(t, StateHome, state)
+	state, _ = client.Retained("dnsmasq_dhcp/client/aabbccddeeff/state")
+	assert.Equal(t, StateNotHome, state)
+
+	attributes := retainedJSON(t, client, "dnsmasq_dhcp/client/001122334455/attributes")
+	assert.Equal(t, map[string]any{"ip": "192.168.1.50", "mac": "00:11:22:33:44:55", "host_name": "laptop"}, attributes)
+}
+
+func TestPublisherSkipsUnchangedMessages(t *testing.T) {
+	p, client := newTestPublisher()
+
+	require.NoError(t, p.Update([]TrackedClient{laptop}, nil, nil))
+	assert.Len(t, client.Messages(), 3) // discovery, attributes, state
+
+	require.NoError(t, p.Update([]TrackedClient{laptop}, nil, nil))
+	assert.Empty(t, client.Messages())
+
+	// the laptop lease is gone: only the state changes
+	laptopAway := laptop
+	laptopAway.Home = false
+	require.NoError(t, p.Update([]TrackedClient{laptopAway}, nil, nil))
+	assert.Equal(t, []FakeMessage{
+		{Topic: "dnsmasq_dhcp/client/001122334455/state", Payload: StateNotHome, Retained: true},
+	}, client.Messages())
+}
+
+func TestPublisherRemovesForgottenClients(t *testing.T) {
+	p, client := newTestPublisher()
+
+	require.NoError(t, p.Update([]TrackedClient{laptop, phone}, nil, nil))
+	_ = client.Messages()
+
+	require.NoError(t, p.Update([]TrackedClient{laptop}, nil, nil))
+	assert.ElementsMatch(t, []FakeMessage{
+		{Topic: "homeassistant/device_tracker/dnsmasq_dhcp/aabbccddeeff/config", Payload: "", Retained: true},
+		{Topic: "dnsmasq_dhcp/client/aabbccddeeff/attributes", Payload: "", Retained: true},
+		{Topic: "dnsmasq_dhcp/client/aabbccddeeff/state", Payload: "", Retained: true},
+	}, client.Messages())
+
+	_, ok := client.Retained("homeassistant/device_tracker/dnsmasq_dhcp/aabbccddeeff/config")
+	assert.False(t, ok)
+
+	// the client comes back: all its messages are published again
+	require.NoError(t, p.Update([]TrackedClient{laptop, phone}, nil, nil))
+	assert.Len(t, client.Messages(), 3)
+}
+
+func TestPublisherPoolAndDnsSensors(t *testing.T) {
+	p, client := newTestPublisher()
+
+	dns := DnsStats{CacheSize: 150, CacheInsertions: 10, CacheEvictions: 1, CacheMisses: 20, CacheHits: 30}
+	require.NoError(t, p.Update(nil, []PoolStats{pool}, &dns))
+
+	config := retainedJSON(t, client, "homeassistant/sensor/dnsmasq_dhcp/pool_eth0_192_168_1_50_192_168_1_150_usage/config")
+	assert.Equal(t, "DHCP pool eth0 192.168.1.50-192.168.1.150 usage", config["name"])
+	assert.Equal(t, "dnsmasq_dhcp/pool/eth0_192_168_1_50_192_168_1_150/state", config["state_topic"])
+	assert.Equal(t, "{{ value_json.usage_percent }}", config["value_template"])
+	assert.Equal(t, "%", config["unit_of_measurement"])
+	assert.Equal(t, []any{"dnsmasq_dhcp"}, config["device"].(map[string]any)["identifiers"])
+
+	state := retainedJSON(t, client, "dnsmasq_dhcp/pool/eth0_192_168_1_50_192_168_1_150/state")
+	assert.Equal(t, map[string]any{"size": 101.0, "used": 2.0, "reserved": 1.0, "free": 98.0, "usage_percent": 2.97}, state)
+
+	config = retainedJSON(t, client, "homeassistant/sensor/dnsmasq_dhcp/dns_cache_hits/config")
+	assert.Equal(t, "DNS cache hits", config["name"])
+	assert.Equal(t, "total_increasing", config["state_class"])
+	state = retainedJSON(t, client, "dnsmasq_dhcp/dns/state")
+	assert.InDelta(t, 30, state["cache_hits"], 0)
+
+	// without DNS stats the DNS sensors are left untouched
+	_ = client.Messages()
+	require.NoError(t, p.Update(nil, []PoolStats{pool}, nil))
+	assert.Empty(t, client.Messages())
+}
+
+func TestPublisherCustomPrefixes(t *testing.T) {
+	client := NewFakeClient()
+	p := NewPublisher(logger.NewCustomLogger("unit tests"), client, Config{
+		DiscoveryPrefix: "ha",
+		TopicPrefix:     "dhcp/home.lan",
+	})
+
+	require.NoError(t, p.Update([]TrackedClient{laptop}, nil, nil))
+
+	config := retainedJSON(t, client, "ha/device_tracker/dhcp_home_lan/001122334455/config")
+	assert.Equal(t, "dhcp/home.lan/client/001122334455/state", config["state_topic"])
+	assert.Equal(t, "dhcp/home.lan/status", config["availability_topic"])
+}
+
+func TestPublisherErrors(t *testing.T) {
+	p, client := newTestPublisher()
+
+	client.ConnectErr = errors.New("connection refused")
+	require.ErrorIs(t, p.Update([]TrackedClient{laptop}, nil, nil), client.ConnectErr)
+	assert.Empty(t, client.Messages())
+
+	// failed messages are published again at next update
+	client.ConnectErr = nil
+	client.PublishErr = errors.New("broker gone")
+	require.ErrorIs(t, p.Update([]TrackedClient{laptop}, nil, nil), client.PublishErr)
+
+	client.PublishErr = nil
+	require.NoError(t, p.Update([]TrackedClient{laptop}, nil, nil))
+	assert.Len(t, client.Messages(), 3)
+
+	p.Close()
+	assert.False(t, client.IsConnected())
+}
@@ -0,0 +1,153 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"dnsmasq-dhcp-backend/pkg/logger"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	// defaultMaxAttempts is how many times the delivery of a notification is attempted
+	defaultMaxAttempts = 5
+
+	// defaultInitialBackoff is the delay before the first retry; it doubles at each following retry
+	defaultInitialBackoff = 2 * time.Second
+
+	// maxBackoff is the maximum delay between two retries
+	maxBackoff = time.Minute
+
+	// requestTimeout bounds each HTTP request
+	requestTimeout = 10 * time.Second
+
+	// queueSize is how many notifications can be waiting for delivery before new ones get dropped
+	queueSize = 100
+)
+
+// deliveryQueue holds the events waiting to be delivered to a destination and delivers them one at a time,
+// retrying failed deliveries with an exponential backoff
+type deliveryQueue struct {
+	logger *logger.CustomLogger
+	name   string
+	queue  chan Event
+
+	// MaxAttempts and InitialBackoff control the retries in case of delivery failures
+	MaxAttempts    int
+	InitialBackoff time.Duration
+}
+
+func newDeliveryQueue(logger *logger.CustomLogger, name string) deliveryQueue {
+	return deliveryQueue{
+		logger:         logger,
+		name:           name,
+		queue:          make(chan Event, queueSize),
+		MaxAttempts:    defaultMaxAttempts,
+		InitialBackoff: defaultInitialBackoff,
+	}
+}
+
+// enqueue adds the event to the queue, or drops it if the queue is full
+func (q *deliveryQueue) enqueue(ev Event) {
+	select {
+	case q.queue <- ev:
+	default:
+		q.logger.Warnf("%s: too many pending notifications, dropping %s", q.name, ev.String())
+	}
+}
+
+// run delivers the queued events through the given function, until the context is cancelled.
+// Each call to send must do a single delivery attempt.
+func (q *deliveryQueue) run(ctx context.Context, send func(ctx context.Context, ev Event) error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-q.queue:
+			err := retryWithBackoff(ctx, q.MaxAttempts, q.InitialBackoff, func() error {
+				return send(ctx, ev)
+			})
+			if err != nil {
+				q.logger.Warnf("%s: failed to deliver %s: %s", q.name, ev.String(), err.Error())
+			}
+		}
+	}
+}
+
+// postJSON sends the JSON payload to the given URL, with the given extra headers
+func postJSON(ctx context.Context, client HTTPClient, url string, payload []byte, headers map[string]string) error {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return permanentError{err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	return checkHTTPResponse(resp)
+}
+
+// permanentError wraps errors that will not go away by retrying, e.g. a 404 HTTP status
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+// retryWithBackoff calls send until it succeeds, it returns a permanentError, maxAttempts are done or
+// the context is cancelled. The delay between attempts starts at initialBackoff and doubles every time.
+func retryWithBackoff(ctx context.Context, maxAttempts int, initialBackoff time.Duration, send func() error) error {
+	backoff := initialBackoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = send()
+		if err == nil {
+			return nil
+		}
+		var permanent permanentError
+		if errors.As(err, &permanent) || attempt >= maxAttempts {
+			return fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxBackoff)
+	}
+}
+
+// checkHTTPResponse converts the status of the response into an error, if any.
+// Client errors are permanent, except for 429 Too Many Requests.
+func checkHTTPResponse(resp *http.Response) error {
+	// drain the body, to allow the HTTP connection to be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	_ = resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	default:
+		return permanentError{fmt.Errorf("unexpected HTTP status %s", resp.Status)}
+	}
+}
@@ -0,0 +1,9 @@
+/*
+Package notifier delivers notifications about relevant DHCP events, e.g. a never-before-seen device
+joining the network, to systems outside this addon.
+
+The backend detects the events and hands them to one or more Notifier implementations, which
+deliver them asynchronously so that a slow or unreachable destination never blocks the processing
+of the dnsmasq lease file.
+*/
+package notifier
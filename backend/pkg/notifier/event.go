@@ -0,0 +1,192 @@
+package notifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// EventType identifies the kind of notification
+type EventType string
+
+const (
+	// EventNewClient is emitted when a MAC address never seen before obtains a DHCP lease
+	EventNewClient EventType = "new_client"
+
+	// EventClientLeft is emitted when a DHCP client releases its lease or lets it expire
+	EventClientLeft EventType = "client_left"
+
+	// EventReservationMismatch is emitted when a reserved IP address is leased to a MAC address
+	// other than the one it was reserved for
+	EventReservationMismatch EventType = "reservation_mismatch"
+
+	// EventPoolExhausted is emitted when a DHCP range runs out of free IP addresses
+	EventPoolExhausted EventType = "pool_exhausted"
+
+	// EventPoolAlert is emitted when the alert level of a DHCP range changes, e.g. because its usage
+	// crossed a threshold or it is forecast to run out of free IP addresses soon
+	EventPoolAlert EventType = "pool_alert"
+)
+
+// AllEventTypes lists all the event types, in the order they are documented
+var AllEventTypes = []EventType{EventNewClient, EventClientLeft, EventReservationMismatch, EventPoolExhausted, EventPoolAlert}
+
+// IsValidEventType returns true if the given string is one of AllEventTypes
+func IsValidEventType(s string) bool {
+	return slices.Contains(AllEventTypes, EventType(s))
+}
+
+// Event is a notification about a DHCP client or a DHCP range
+type Event struct {
+	Type      EventType
+	Timestamp time.Time
+
+	MacAddr      net.HardwareAddr
+	IPAddr       netip.Addr
+	Hostname     string
+	FriendlyName string
+
+	// ReservedMacAddr is populated only for EventReservationMismatch: it's the MAC address
+	// the IP address was reserved for
+	ReservedMacAddr net.HardwareAddr
+
+	// Pool is populated only for EventPoolExhausted and EventPoolAlert; the fields about the DHCP client
+	// are empty in that case
+	Pool *PoolUsage
+}
+
+// PoolUsage identifies a DHCP range and tells how many of its IP addresses are in use
+type PoolUsage struct {
+	Interface string `json:"interface"`
+	Start     string `json:"start"`
+	End       string `json:"end"`
+	Size      int64  `json:"size"`
+	Used      int64  `json:"used"`
+	Reserved  int64  `json:"reserved"`
+
+	// Alert is populated only for EventPoolAlert
+	Alert *PoolAlert `json:"alert,omitempty"`
+}
+
+// PoolAlert tells whether a DHCP range is running out of free IP addresses
+type PoolAlert struct {
+	// Level is one of "ok", "warning" or "critical"
+	Level   string   `json:"level"`
+	Reasons []string `json:"reasons"`
+
+	UsagePercent float64 `json:"usage_percent"`
+
+	// TimeToExhaustionSec is the number of seconds before the DHCP range is forecast to run out of
+	// free IP addresses, or -1 if it is not running out of them
+	TimeToExhaustionSec int64 `json:"time_to_exhaustion_sec"`
+}
+
+func (e Event) String() string {
+	switch {
+	case e.Pool != nil && e.Pool.Alert != nil:
+		return fmt.Sprintf("%s: %s-%s on %s is %s (%s)", e.Type, e.Pool.Start, e.Pool.End, e.Pool.Interface,
+			e.Pool.Alert.Level, strings.Join(e.Pool.Alert.Reasons, "; "))
+	case e.Pool != nil:
+		return fmt.Sprintf("%s: %s-%s on %s (%d/%d used, %d reserved)", e.Type, e.Pool.Start, e.Pool.End, e.Pool.Interface,
+			e.Pool.Used, e.Pool.Size, e.Pool.Reserved)
+	case e.Type == EventReservationMismatch:
+		return fmt.Sprintf("%s: %s leased to %s instead of %s", e.Type, e.IPAddr, e.MacAddr, e.ReservedMacAddr)
+	default:
+		return fmt.Sprintf("%s: %s (%s, %s)", e.Type, e.MacAddr, e.IPAddr, e.Hostname)
+	}
+}
+
+// eventJSON is the JSON representation of an Event
+type eventJSON struct {
+	Event           string     `json:"event"`
+	Timestamp       int64      `json:"timestamp"`
+	MacAddr         string     `json:"mac_addr"`
+	IPAddr          string     `json:"ip_addr"`
+	Hostname        string     `json:"hostname"`
+	FriendlyName    string     `json:"friendly_name"`
+	ReservedMacAddr string     `json:"reserved_mac_addr,omitempty"`
+	Pool            *PoolUsage `json:"pool,omitempty"`
+}
+
+func (e Event) toJSON() eventJSON {
+	ipAddr := ""
+	if e.IPAddr.IsValid() {
+		ipAddr = e.IPAddr.String()
+	}
+	reservedMacAddr := ""
+	if e.ReservedMacAddr != nil {
+		reservedMacAddr = e.ReservedMacAddr.String()
+	}
+	return eventJSON{
+		Event:           string(e.Type),
+		Timestamp:       e.Timestamp.Unix(),
+		MacAddr:         e.MacAddr.String(),
+		IPAddr:          ipAddr,
+		Hostname:        e.Hostname,
+		FriendlyName:    e.FriendlyName,
+		ReservedMacAddr: reservedMacAddr,
+		Pool:            e.Pool,
+	}
+}
+
+// MarshalJSON customizes the JSON serialization for Event
+func (e Event) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.toJSON())
+}
+
+// templateData returns the variables available inside payload templates
+func (e Event) templateData() map[string]string {
+	j := e.toJSON()
+	data := map[string]string{
+		"event":         j.Event,
+		"timestamp":     e.Timestamp.UTC().Format(time.RFC3339),
+		"mac":           j.MacAddr,
+		"ip":            j.IPAddr,
+		"hostname":      j.Hostname,
+		"friendly_name": j.FriendlyName,
+		"reserved_mac":  j.ReservedMacAddr,
+	}
+	if e.Pool != nil {
+		data["pool_interface"] = e.Pool.Interface
+		data["pool_start"] = e.Pool.Start
+		data["pool_end"] = e.Pool.End
+		data["pool_size"] = strconv.FormatInt(e.Pool.Size, 10)
+		if e.Pool.Alert != nil {
+			data["pool_alert_level"] = e.Pool.Alert.Level
+			data["pool_alert_reasons"] = strings.Join(e.Pool.Alert.Reasons, "; ")
+		}
+	}
+	return data
+}
+
+// templateFuncs are the functions available inside payload templates, in addition to the golang builtins
+var templateFuncs = texttemplate.FuncMap{
+	// json quotes and escapes a value so that it can be safely embedded in a JSON document
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// ParsePayloadTemplate parses a golang template used to customize the body of a notification
+func ParsePayloadTemplate(text string) (*texttemplate.Template, error) {
+	return texttemplate.New("payloadTemplate").Funcs(templateFuncs).Parse(text)
+}
+
+// Notifier delivers events to some external system
+type Notifier interface {
+	// Notify queues the event for delivery; it never blocks
+	Notify(ev Event)
+}
+
+// HTTPClient is the subset of http.Client used by the notifiers, so that tests can provide a stand-in
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
@@ -0,0 +1,24 @@
+package notifier
+
+import "sync"
+
+// Recorder is a Notifier for unit tests: it just records all events it's notified about
+type Recorder struct {
+	lock   sync.Mutex
+	events []Event
+}
+
+func (r *Recorder) Notify(ev Event) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.events = append(r.events, ev)
+}
+
+// Events returns the events notified so far and forgets them
+func (r *Recorder) Events() []Event {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	events := r.events
+	r.events = nil
+	return events
+}
@@ -0,0 +1,62 @@
+package notifier
+
+import (
+	"context"
+	"dnsmasq-dhcp-backend/pkg/logger"
+	"encoding/json"
+)
+
+const (
+	// DefaultSupervisorCoreAPI is the URL of the Home Assistant Core API, as proxied by the Supervisor
+	// to the addons having "homeassistant_api: true" in their config
+	DefaultSupervisorCoreAPI = "http://supervisor/core/api"
+
+	// homeAssistantEventPrefix is prepended to the EventType to form the Home Assistant event type
+	homeAssistantEventPrefix = "dnsmasq_dhcp_"
+)
+
+// HomeAssistantEventType returns the type of the Home Assistant event fired for the given EventType,
+// e.g. "dnsmasq_dhcp_new_client"
+func HomeAssistantEventType(t EventType) string {
+	return homeAssistantEventPrefix + string(t)
+}
+
+// SupervisorEvents is the Notifier firing Home Assistant events through the Supervisor API,
+// so that Home Assistant automations can be triggered by DHCP events
+type SupervisorEvents struct {
+	deliveryQueue
+	client  HTTPClient
+	baseURL string
+	token   string
+}
+
+// NewSupervisorEvents creates a SupervisorEvents posting to the given Core API URL, authenticating
+// with the given token (the SUPERVISOR_TOKEN for addons); events are fired only while Run is running
+func NewSupervisorEvents(logger *logger.CustomLogger, client HTTPClient, baseURL, token string) *SupervisorEvents {
+	return &SupervisorEvents{
+		deliveryQueue: newDeliveryQueue(logger, "Home Assistant events"),
+		client:        client,
+		baseURL:       baseURL,
+		token:         token,
+	}
+}
+
+// Notify queues the event
+func (s *SupervisorEvents) Notify(ev Event) {
+	s.enqueue(ev)
+}
+
+// Run fires the queued events one at a time, until the context is cancelled
+func (s *SupervisorEvents) Run(ctx context.Context) {
+	s.run(ctx, s.fire)
+}
+
+// fire posts the event data to /api/events/<event_type>
+func (s *SupervisorEvents) fire(ctx context.Context, ev Event) error {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return permanentError{err}
+	}
+	return postJSON(ctx, s.client, s.baseURL+"/events/"+HomeAssistantEventType(ev.Type), payload,
+		map[string]string{"Authorization": "Bearer " + s.token})
+}
@@ -0,0 +1,100 @@
+package notifier
+
+import (
+	"context"
+	"dnsmasq-dhcp-backend/pkg/logger"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type firedEvent struct {
+	path string
+	data map[string]any
+}
+
+// newFakeSupervisor is a stand-in for the Supervisor proxy of the Home Assistant Core API:
+// it accepts only requests carrying the given token
+func newFakeSupervisor(t *testing.T, token string) (*httptest.Server, chan firedEvent) {
+	fired := make(chan firedEvent, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer "+token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(req.Body)
+		var data map[string]any
+		if err := json.Unmarshal(body, &data); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fired <- firedEvent{path: req.URL.Path, data: data}
+		_, _ = w.Write([]byte(`{"message": "Event fired."}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, fired
+}
+
+func startSupervisorEvents(t *testing.T, baseURL, token string) *SupervisorEvents {
+	s := NewSupervisorEvents(logger.NewCustomLogger("unit tests"), http.DefaultClient, baseURL, token)
+	s.InitialBackoff = time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go s.Run(ctx)
+	return s
+}
+
+func nextFiredEvent(t *testing.T, fired chan firedEvent) firedEvent {
+	t.Helper()
+	select {
+	case ev := <-fired:
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event fired")
+		return firedEvent{}
+	}
+}
+
+func TestSupervisorEvents(t *testing.T) {
+	srv, fired := newFakeSupervisor(t, "secret")
+	s := startSupervisorEvents(t, srv.URL+"/core/api", "secret")
+
+	s.Notify(newClientEvent)
+	ev := nextFiredEvent(t, fired)
+	assert.Equal(t, "/core/api/events/dnsmasq_dhcp_new_client", ev.path)
+	assert.Equal(t, "00:11:22:33:44:55", ev.data["mac_addr"])
+	assert.Equal(t, "192.168.1.50", ev.data["ip_addr"])
+	assert.Equal(t, "shelly1-abcd", ev.data["hostname"])
+	assert.Equal(t, "Kitchen light", ev.data["friendly_name"])
+
+	s.Notify(Event{
+		Type:      EventPoolExhausted,
+		Timestamp: time.Unix(1700000000, 0),
+		Pool:      &PoolUsage{Interface: "eth0", Start: "192.168.1.50", End: "192.168.1.51", Size: 2, Used: 1, Reserved: 1},
+	})
+	ev = nextFiredEvent(t, fired)
+	assert.Equal(t, "/core/api/events/dnsmasq_dhcp_pool_exhausted", ev.path)
+	assert.Equal(t, map[string]any{
+		"interface": "eth0", "start": "192.168.1.50", "end": "192.168.1.51", "size": 2.0, "used": 1.0, "reserved": 1.0,
+	}, ev.data["pool"])
+}
+
+func TestSupervisorEventsWrongToken(t *testing.T) {
+	srv, fired := newFakeSupervisor(t, "secret")
+	s := NewSupervisorEvents(logger.NewCustomLogger("unit tests"), http.DefaultClient, srv.URL, "wrong")
+
+	// authentication errors are not retried
+	err := retryWithBackoff(context.Background(), 3, time.Millisecond, func() error {
+		return s.fire(context.Background(), newClientEvent)
+	})
+	require.ErrorContains(t, err, "giving up after 1 attempts")
+	require.ErrorContains(t, err, "401 Unauthorized")
+	assert.Empty(t, fired)
+}
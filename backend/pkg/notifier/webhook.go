@@ -0,0 +1,72 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"dnsmasq-dhcp-backend/pkg/logger"
+	"encoding/json"
+	"fmt"
+	"slices"
+	texttemplate "text/template"
+)
+
+// WebhookTarget is an HTTP endpoint receiving a POST for each event
+type WebhookTarget struct {
+	Name string
+	URL  string
+
+	// Events lists the event types sent to this target; all event types are sent when empty
+	Events []EventType
+
+	// Payload renders the body of the POST; when nil, the JSON serialization of the Event is sent
+	Payload *texttemplate.Template
+}
+
+// Webhook is the Notifier delivering events to a WebhookTarget
+type Webhook struct {
+	deliveryQueue
+	target WebhookTarget
+	client HTTPClient
+}
+
+// NewWebhook creates a Webhook for the given target; events are delivered only while Run is running
+func NewWebhook(logger *logger.CustomLogger, target WebhookTarget, client HTTPClient) *Webhook {
+	return &Webhook{
+		deliveryQueue: newDeliveryQueue(logger, "webhook "+target.Name),
+		target:        target,
+		client:        client,
+	}
+}
+
+// Notify queues the event, if the target is interested in its type
+func (w *Webhook) Notify(ev Event) {
+	if len(w.target.Events) > 0 && !slices.Contains(w.target.Events, ev.Type) {
+		return
+	}
+	w.enqueue(ev)
+}
+
+// Run delivers the queued events one at a time, until the context is cancelled
+func (w *Webhook) Run(ctx context.Context) {
+	w.run(ctx, w.send)
+}
+
+// payload renders the body of the POST for the given event
+func (w *Webhook) payload(ev Event) ([]byte, error) {
+	if w.target.Payload == nil {
+		return json.Marshal(ev)
+	}
+	var buf bytes.Buffer
+	if err := w.target.Payload.Execute(&buf, ev.templateData()); err != nil {
+		return nil, fmt.Errorf("failed to render the payload template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (w *Webhook) send(ctx context.Context, ev Event) error {
+	payload, err := w.payload(ev)
+	if err != nil {
+		return permanentError{err}
+	}
+	return postJSON(ctx, w.client, w.target.URL, payload, nil)
+}
@@ -0,0 +1,176 @@
+package notifier
+
+import (
+	"context"
+	"dnsmasq-dhcp-backend/pkg/logger"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var newClientEvent = Event{
+	Type:         EventNewClient,
+	Timestamp:    time.Unix(1700000000, 0),
+	MacAddr:      net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55},
+	IPAddr:       netip.MustParseAddr("192.168.1.50"),
+	Hostname:     "shelly1-abcd",
+	FriendlyName: "Kitchen light",
+}
+
+// webhookReceiver is an HTTP server recording the bodies of the POSTs it receives; the first
+// failures requests get an HTTP 500 answer
+type webhookReceiver struct {
+	*httptest.Server
+	lock     sync.Mutex
+	failures int
+	attempts int
+	bodies   chan string
+}
+
+func newWebhookReceiver(t *testing.T, failures int) *webhookReceiver {
+	r := &webhookReceiver{failures: failures, bodies: make(chan string, 10)}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, http.MethodPost, req.Method)
+		assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		r.attempts++
+		if r.attempts <= r.failures {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body, _ := io.ReadAll(req.Body)
+		r.bodies <- string(body)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *webhookReceiver) nextBody(t *testing.T) string {
+	t.Helper()
+	select {
+	case body := <-r.bodies:
+		return body
+	case <-time.After(5 * time.Second):
+		t.Fatal("no webhook received")
+		return ""
+	}
+}
+
+func startWebhook(t *testing.T, target WebhookTarget) *Webhook {
+	w := NewWebhook(logger.NewCustomLogger("unit tests"), target, http.DefaultClient)
+	w.InitialBackoff = time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go w.Run(ctx)
+	return w
+}
+
+func TestWebhookDefaultPayload(t *testing.T) {
+	receiver := newWebhookReceiver(t, 0)
+	w := startWebhook(t, WebhookTarget{Name: "test", URL: receiver.URL})
+
+	w.Notify(newClientEvent)
+	assert.JSONEq(t, `{
+		"event": "new_client",
+		"timestamp": 1700000000,
+		"mac_addr": "00:11:22:33:44:55",
+		"ip_addr": "192.168.1.50",
+		"hostname": "shelly1-abcd",
+		"friendly_name": "Kitchen light"
+	}`, receiver.nextBody(t))
+}
+
+func TestWebhookPayloadTemplate(t *testing.T) {
+	tmpl, err := ParsePayloadTemplate(`{"text": {{ json (printf "%s joined with IP %s" .friendly_name .ip) }}, "at": "{{ .timestamp }}"}`)
+	require.NoError(t, err)
+
+	receiver := newWebhookReceiver(t, 0)
+	w := startWebhook(t, WebhookTarget{Name: "slack", URL: receiver.URL, Payload: tmpl})
+
+	ev := newClientEvent
+	ev.FriendlyName = `The "big" TV`
+	w.Notify(ev)
+	assert.JSONEq(t, `{"text": "The \"big\" TV joined with IP 192.168.1.50", "at": "2023-11-14T22:13:20Z"}`, receiver.nextBody(t))
+}
+
+func TestWebhookPoolAlertPayload(t *testing.T) {
+	tmpl, err := ParsePayloadTemplate(`{"text": {{ json (printf "%s-%s is %s: %s" .pool_start .pool_end .pool_alert_level .pool_alert_reasons) }}}`)
+	require.NoError(t, err)
+
+	receiver := newWebhookReceiver(t, 0)
+	w := startWebhook(t, WebhookTarget{Name: "ntfy", URL: receiver.URL, Payload: tmpl})
+
+	w.Notify(Event{
+		Type:      EventPoolAlert,
+		Timestamp: time.Unix(1700000000, 0),
+		Pool: &PoolUsage{
+			Interface: "eth0", Start: "192.168.1.50", End: "192.168.1.59", Size: 10, Used: 9,
+			Alert: &PoolAlert{Level: "critical", Reasons: []string{"usage is at 90%", "no IP address left in 2 hours"}, UsagePercent: 90, TimeToExhaustionSec: 7200},
+		},
+	})
+	assert.JSONEq(t, `{"text": "192.168.1.50-192.168.1.59 is critical: usage is at 90%; no IP address left in 2 hours"}`, receiver.nextBody(t))
+}
+
+func TestWebhookEventFilter(t *testing.T) {
+	receiver := newWebhookReceiver(t, 0)
+	w := startWebhook(t, WebhookTarget{Name: "test", URL: receiver.URL, Events: []EventType{EventClientLeft}})
+
+	w.Notify(newClientEvent)
+	left := newClientEvent
+	left.Type = EventClientLeft
+	w.Notify(left)
+
+	assert.Contains(t, receiver.nextBody(t), `"event":"client_left"`)
+	select {
+	case body := <-receiver.bodies:
+		t.Fatalf("unexpected webhook: %s", body)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	receiver := newWebhookReceiver(t, 2)
+	w := startWebhook(t, WebhookTarget{Name: "test", URL: receiver.URL})
+
+	w.Notify(newClientEvent)
+	assert.Contains(t, receiver.nextBody(t), `"event":"new_client"`)
+	receiver.lock.Lock()
+	assert.Equal(t, 3, receiver.attempts)
+	receiver.lock.Unlock()
+}
+
+func TestRetryWithBackoff(t *testing.T) {
+	attempts := 0
+	err := retryWithBackoff(context.Background(), 3, time.Millisecond, func() error {
+		attempts++
+		return io.ErrUnexpectedEOF
+	})
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.Equal(t, 3, attempts)
+
+	// permanent errors are not retried
+	attempts = 0
+	err = retryWithBackoff(context.Background(), 3, time.Millisecond, func() error {
+		attempts++
+		return checkHTTPResponse(&http.Response{StatusCode: http.StatusNotFound, Status: "404 Not Found", Body: http.NoBody})
+	})
+	require.ErrorContains(t, err, "404 Not Found")
+	assert.Equal(t, 1, attempts)
+
+	// cancelling the context stops the retries
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = retryWithBackoff(ctx, 3, time.Hour, func() error { return io.ErrUnexpectedEOF })
+	require.ErrorIs(t, err, context.Canceled)
+}
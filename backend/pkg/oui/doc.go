@@ -0,0 +1,13 @@
+/*
+Package oui maps MAC addresses to the name of the vendor of the network card, using a copy of
+the IEEE "MA-L" registry (the list of Organizationally Unique Identifiers) embedded in the binary,
+so that no network access is required at runtime.
+
+The embedded oui.csv has the same format of https://standards-oui.ieee.org/oui/oui.csv and can be
+refreshed with "make update-oui".
+
+The package also detects locally-administered MAC addresses: modern phones and laptops use them as
+"private" or "randomized" addresses, picking a different one for each Wi-Fi network (or even
+periodically), so they carry no vendor information.
+*/
+package oui
@@ -0,0 +1,81 @@
+package oui
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+)
+
+//go:embed oui.csv
+var ouiCSV []byte
+
+// registry maps the 24-bit OUI to the vendor name; it's parsed on first use
+var registry = sync.OnceValue(func() map[[3]byte]string {
+	r, err := parseRegistry(bytes.NewReader(ouiCSV))
+	if err != nil {
+		// the embedded file is checked by unit tests, so this should never happen
+		panic(err)
+	}
+	return r
+})
+
+// parseRegistry parses a CSV file in the IEEE format, i.e. with the columns
+// "Registry,Assignment,Organization Name,Organization Address"
+func parseRegistry(in io.Reader) (map[[3]byte]string, error) {
+	reader := csv.NewReader(in)
+	reader.FieldsPerRecord = -1
+	// tolerate quotes inside unquoted organization names, rather than refusing the whole registry
+	reader.LazyQuotes = true
+
+	// skip the header
+	if _, err := reader.Read(); err != nil {
+		return nil, fmt.Errorf("failed to read the OUI registry header: %w", err)
+	}
+
+	r := make(map[[3]byte]string)
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the OUI registry: %w", err)
+		}
+		if len(record) < 3 {
+			return nil, fmt.Errorf("invalid OUI registry entry %v: expecting at least 3 columns", record)
+		}
+
+		assignment, err := hex.DecodeString(record[1])
+		if err != nil || len(assignment) != 3 {
+			return nil, fmt.Errorf("invalid OUI registry assignment %q", record[1])
+		}
+		r[[3]byte(assignment)] = strings.TrimSpace(record[2])
+	}
+	return r, nil
+}
+
+// IsRandomized returns true if the MAC address is a unicast, locally-administered address,
+// i.e. an address that was not assigned by the manufacturer of the network card. In practice
+// these are the "private" (randomized) addresses used by phones and laptops to prevent tracking.
+func IsRandomized(mac net.HardwareAddr) bool {
+	if len(mac) == 0 {
+		return false
+	}
+	return mac[0]&0x02 != 0 && mac[0]&0x01 == 0
+}
+
+// Lookup returns the name of the vendor owning the OUI of the given MAC address, or an empty
+// string if the OUI is unknown or the address is locally-administered
+func Lookup(mac net.HardwareAddr) string {
+	if len(mac) < 3 || IsRandomized(mac) {
+		return ""
+	}
+	return registry()[[3]byte(mac[:3])]
+}
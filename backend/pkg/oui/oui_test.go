@@ -0,0 +1,76 @@
+package oui
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbeddedRegistry(t *testing.T) {
+	r, err := parseRegistry(strings.NewReader(string(ouiCSV)))
+	require.NoError(t, err)
+
+	// the embedded file must be the whole IEEE MA-L registry, as downloaded by "make update-oui"
+	assert.Greater(t, len(r), 30000)
+	for oui, vendor := range map[[3]byte]string{
+		{0x00, 0x00, 0x0c}: "Cisco Systems, Inc",
+		{0x00, 0x03, 0x93}: "Apple, Inc.",
+		{0x24, 0x0a, 0xc4}: "Espressif Inc.",
+		{0xb8, 0x27, 0xeb}: "Raspberry Pi Foundation",
+		{0xdc, 0xa6, 0x32}: "Raspberry Pi Trading Ltd",
+		{0xf4, 0xf5, 0xd8}: "Google, Inc.",
+	} {
+		assert.Equal(t, vendor, r[oui])
+	}
+}
+
+func TestParseRegistry(t *testing.T) {
+	r, err := parseRegistry(strings.NewReader(`Registry,Assignment,Organization Name,Organization Address
+MA-L,B827EB,Raspberry Pi Foundation,Mitchell Wood House Caldecote Cambridgeshire GB CB23 7NU 
+MA-L,00000C,"Cisco Systems, Inc",170 WEST TASMAN DRIVE SAN JOSE CA US 95134-1706 
+`))
+	require.NoError(t, err)
+	assert.Equal(t, map[[3]byte]string{
+		{0xb8, 0x27, 0xeb}: "Raspberry Pi Foundation",
+		{0x00, 0x00, 0x0c}: "Cisco Systems, Inc",
+	}, r)
+
+	_, err = parseRegistry(strings.NewReader("Registry,Assignment,Organization Name,Organization Address\nMA-L,B827,Foo,Bar\n"))
+	require.ErrorContains(t, err, `invalid OUI registry assignment "B827"`)
+
+	// stray quotes inside an unquoted organization name
+	r, err = parseRegistry(strings.NewReader(`Registry,Assignment,Organization Name,Organization Address
+MA-L,001122,Foo "Bar" Ltd,Somewhere
+`))
+	require.NoError(t, err)
+	assert.Equal(t, map[[3]byte]string{{0x00, 0x11, 0x22}: `Foo "Bar" Ltd`}, r)
+}
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		mac        string
+		vendor     string
+		randomized bool
+	}{
+		{"b8:27:eb:12:34:56", "Raspberry Pi Foundation", false},
+		{"B8-27-EB-12-34-56", "Raspberry Pi Foundation", false},
+		{"24:0a:c4:00:00:01", "Espressif Inc.", false},
+		{"ba:27:eb:12:34:56", "", true}, // same as the Raspberry Pi with the locally-administered bit set
+		{"da:a1:19:00:00:01", "", true},
+		{"01:00:5e:00:00:01", "", false}, // multicast
+	}
+	for _, tt := range tests {
+		t.Run(tt.mac, func(t *testing.T) {
+			mac, err := net.ParseMAC(tt.mac)
+			require.NoError(t, err)
+			assert.Equal(t, tt.vendor, Lookup(mac))
+			assert.Equal(t, tt.randomized, IsRandomized(mac))
+		})
+	}
+
+	assert.Empty(t, Lookup(nil))
+	assert.False(t, IsRandomized(nil))
+}
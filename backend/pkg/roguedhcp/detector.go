@@ -0,0 +1,245 @@
+package roguedhcp
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"dnsmasq-dhcp-backend/pkg/logger"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultProbeTimeout is how long the Detector waits for DHCPOFFERs after each DHCPDISCOVER
+	defaultProbeTimeout = 3 * time.Second
+
+	// rogueServerRetention is how long a rogue server is reported after it was last seen
+	rogueServerRetention = 24 * time.Hour
+)
+
+// RogueServer is a DHCP server, other than the one running on this host, detected on a network interface
+type RogueServer struct {
+	Interface string
+	ServerIP  netip.Addr
+
+	// ServerMAC is the source MAC address of the DHCPOFFER; it might be the MAC address of a
+	// DHCP relay rather than the DHCP server itself
+	ServerMAC net.HardwareAddr
+
+	// OfferedIP is the IP address offered by the rogue server in its last DHCPOFFER
+	OfferedIP netip.Addr
+
+	FirstSeen   time.Time
+	LastSeen    time.Time
+	OffersCount int
+}
+
+// MarshalJSON customizes the JSON serialization for RogueServer
+func (s RogueServer) MarshalJSON() ([]byte, error) {
+	offeredIP := ""
+	if s.OfferedIP.IsValid() {
+		offeredIP = s.OfferedIP.String()
+	}
+
+	return json.Marshal(&struct {
+		Interface   string `json:"interface"`
+		ServerIP    string `json:"server_ip"`
+		ServerMAC   string `json:"server_mac"`
+		OfferedIP   string `json:"offered_ip"`
+		FirstSeen   int64  `json:"first_seen"`
+		LastSeen    int64  `json:"last_seen"`
+		OffersCount int    `json:"offers_count"`
+	}{
+		Interface:   s.Interface,
+		ServerIP:    s.ServerIP.String(),
+		ServerMAC:   s.ServerMAC.String(),
+		OfferedIP:   offeredIP,
+		FirstSeen:   s.FirstSeen.Unix(),
+		LastSeen:    s.LastSeen.Unix(),
+		OffersCount: s.OffersCount,
+	})
+}
+
+func (s RogueServer) String() string {
+	return fmt.Sprintf("interface=%s, server_ip=%s, server_mac=%s, offered_ip=%s", s.Interface, s.ServerIP, s.ServerMAC, s.OfferedIP)
+}
+
+// Detector periodically probes the network interfaces looking for rogue DHCP servers
+type Detector struct {
+	logger     *logger.CustomLogger
+	transport  Transport
+	interfaces []string
+
+	// ProbeTimeout is how long to wait for DHCPOFFERs on each interface
+	ProbeTimeout time.Duration
+
+	lock    sync.Mutex
+	servers map[string]*RogueServer // indexed by interface, server IP and server MAC
+
+	// now is a hook for unit tests
+	now func() time.Time
+}
+
+// NewDetector creates a Detector probing the given network interfaces through the given Transport
+func NewDetector(logger *logger.CustomLogger, transport Transport, interfaces []string) *Detector {
+	return &Detector{
+		logger:       logger,
+		transport:    transport,
+		interfaces:   interfaces,
+		ProbeTimeout: defaultProbeTimeout,
+		servers:      make(map[string]*RogueServer),
+		now:          time.Now,
+	}
+}
+
+// Run probes all network interfaces every interval, until the context is cancelled
+func (d *Detector) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.Probe(ctx); err != nil {
+			d.logger.Warnf("rogue DHCP server detection failed: %s", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Probe sends a DHCPDISCOVER on each network interface and records the rogue servers that answered.
+// Errors on an interface do not prevent the other interfaces from being probed.
+func (d *Detector) Probe(ctx context.Context) error {
+	var errs []error
+	for _, iface := range d.interfaces {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := d.probeInterface(iface); err != nil {
+			errs = append(errs, fmt.Errorf("interface %s: %w", iface, err))
+		}
+	}
+
+	d.forgetOldServers()
+	return errors.Join(errs...)
+}
+
+func newTransactionID() (uint32, error) {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(b[:]), nil
+}
+
+func (d *Detector) probeInterface(iface string) error {
+	conn, err := d.transport.Open(iface)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	localAddrs, err := conn.LocalAddrs()
+	if err != nil {
+		return fmt.Errorf("failed to get the IP addresses: %w", err)
+	}
+
+	xid, err := newTransactionID()
+	if err != nil {
+		return err
+	}
+	discover, err := NewDiscover(xid, conn.HardwareAddr()).Marshal()
+	if err != nil {
+		return err
+	}
+	if err := conn.Broadcast(discover); err != nil {
+		return fmt.Errorf("failed to send DHCPDISCOVER: %w", err)
+	}
+
+	deadline := time.Now().Add(d.ProbeTimeout)
+	for {
+		pkt, err := conn.Receive(deadline)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to receive DHCPOFFER: %w", err)
+		}
+
+		msg, err := ParseMessage(pkt.Payload)
+		if err != nil || msg.Op != opBootReply || msg.XID != xid || msg.MessageType() != MessageTypeOffer {
+			continue // not an answer to our DHCPDISCOVER
+		}
+
+		serverIP, ok := msg.ServerIdentifier()
+		if !ok {
+			serverIP = pkt.SrcIP
+		}
+		if slices.Contains(localAddrs, serverIP) || slices.Contains(localAddrs, pkt.SrcIP) {
+			continue // this is our own dnsmasq
+		}
+
+		d.recordOffer(iface, serverIP, pkt.SrcMAC, msg.YourIP)
+	}
+}
+
+func (d *Detector) recordOffer(iface string, serverIP netip.Addr, serverMAC net.HardwareAddr, offeredIP netip.Addr) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	now := d.now()
+	key := fmt.Sprintf("%s/%s/%s", iface, serverIP, serverMAC)
+	s, ok := d.servers[key]
+	if !ok {
+		s = &RogueServer{Interface: iface, ServerIP: serverIP, ServerMAC: serverMAC, FirstSeen: now}
+		d.servers[key] = s
+		d.logger.Warnf("detected rogue DHCP server: %s", s.String())
+	}
+	s.OfferedIP = offeredIP
+	s.LastSeen = now
+	s.OffersCount++
+}
+
+func (d *Detector) forgetOldServers() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	for key, s := range d.servers {
+		if d.now().Sub(s.LastSeen) > rogueServerRetention {
+			d.logger.Infof("rogue DHCP server not seen anymore: %s", s.String())
+			delete(d.servers, key)
+		}
+	}
+}
+
+// RogueServers returns the rogue DHCP servers detected so far, sorted by interface and server IP
+func (d *Detector) RogueServers() []RogueServer {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	servers := make([]RogueServer, 0, len(d.servers))
+	for _, s := range d.servers {
+		servers = append(servers, *s)
+	}
+	slices.SortFunc(servers, func(a, b RogueServer) int {
+		return cmp.Or(
+			cmp.Compare(a.Interface, b.Interface),
+			a.ServerIP.Compare(b.ServerIP),
+			cmp.Compare(a.ServerMAC.String(), b.ServerMAC.String()),
+		)
+	})
+	return servers
+}
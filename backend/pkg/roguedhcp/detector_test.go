@@ -0,0 +1,139 @@
+package roguedhcp
+
+import (
+	"context"
+	"dnsmasq-dhcp-backend/pkg/logger"
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	ourServer = FakeServer{
+		IP:        netip.MustParseAddr("192.168.1.254"),
+		MAC:       net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01},
+		OfferedIP: netip.MustParseAddr("192.168.1.50"),
+	}
+	rogueServer = FakeServer{
+		IP:        netip.MustParseAddr("192.168.1.1"),
+		MAC:       net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff},
+		OfferedIP: netip.MustParseAddr("192.168.1.100"),
+	}
+)
+
+func newTestDetector(interfaces ...string) (*Detector, *FakeTransport) {
+	transport := NewFakeTransport()
+	transport.SetLocalAddrs("eth0", ourServer.IP)
+	transport.AddServer("eth0", ourServer)
+	transport.SetLocalAddrs("eth1", netip.MustParseAddr("10.0.0.254"))
+
+	d := NewDetector(logger.NewCustomLogger("unit tests"), transport, interfaces)
+	return d, transport
+}
+
+func TestDetectorIgnoresOwnServer(t *testing.T) {
+	d, transport := newTestDetector("eth0", "eth1")
+
+	require.NoError(t, d.Probe(context.Background()))
+	assert.Equal(t, 2, transport.Discovers)
+	assert.Empty(t, d.RogueServers())
+}
+
+func TestDetectorFindsRogueServers(t *testing.T) {
+	d, transport := newTestDetector("eth0", "eth1")
+	transport.AddServer("eth0", rogueServer)
+	transport.AddServer("eth1", FakeServer{
+		IP:                   netip.MustParseAddr("10.0.0.1"),
+		MAC:                  net.HardwareAddr{0x11, 0x22, 0x33, 0x44, 0x55, 0x66},
+		OfferedIP:            netip.MustParseAddr("10.0.0.10"),
+		OmitServerIdentifier: true,
+	})
+
+	firstProbe := time.Unix(1700000000, 0)
+	d.now = func() time.Time { return firstProbe }
+	require.NoError(t, d.Probe(context.Background()))
+
+	secondProbe := firstProbe.Add(time.Minute)
+	d.now = func() time.Time { return secondProbe }
+	require.NoError(t, d.Probe(context.Background()))
+
+	assert.Equal(t, []RogueServer{
+		{
+			Interface:   "eth0",
+			ServerIP:    rogueServer.IP,
+			ServerMAC:   rogueServer.MAC,
+			OfferedIP:   rogueServer.OfferedIP,
+			FirstSeen:   firstProbe,
+			LastSeen:    secondProbe,
+			OffersCount: 2,
+		},
+		{
+			// without the server identifier option, the source IP is used
+			Interface:   "eth1",
+			ServerIP:    netip.MustParseAddr("10.0.0.1"),
+			ServerMAC:   net.HardwareAddr{0x11, 0x22, 0x33, 0x44, 0x55, 0x66},
+			OfferedIP:   netip.MustParseAddr("10.0.0.10"),
+			FirstSeen:   firstProbe,
+			LastSeen:    secondProbe,
+			OffersCount: 2,
+		},
+	}, d.RogueServers())
+}
+
+func TestDetectorForgetsOldServers(t *testing.T) {
+	d, transport := newTestDetector("eth0")
+	transport.AddServer("eth0", rogueServer)
+
+	now := time.Unix(1700000000, 0)
+	d.now = func() time.Time { return now }
+	require.NoError(t, d.Probe(context.Background()))
+	require.Len(t, d.RogueServers(), 1)
+
+	// the rogue server is turned off
+	transport.RemoveServers("eth0")
+	now = now.Add(time.Hour)
+	require.NoError(t, d.Probe(context.Background()))
+	require.Len(t, d.RogueServers(), 1, "rogue servers are reported for some time after they were last seen")
+
+	now = now.Add(rogueServerRetention)
+	require.NoError(t, d.Probe(context.Background()))
+	assert.Empty(t, d.RogueServers())
+}
+
+func TestDetectorErrors(t *testing.T) {
+	d, transport := newTestDetector("missing0", "eth0")
+	transport.AddServer("eth0", rogueServer)
+
+	// a failure on an interface does not prevent probing the others
+	err := d.Probe(context.Background())
+	assert.ErrorContains(t, err, "interface missing0")
+	assert.Len(t, d.RogueServers(), 1)
+
+	transport.OpenErr = errors.New("permission denied")
+	assert.ErrorContains(t, d.Probe(context.Background()), "permission denied")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, d.Probe(ctx), context.Canceled)
+}
+
+func TestDetectorRun(t *testing.T) {
+	d, transport := newTestDetector("eth0")
+	transport.AddServer("eth0", rogueServer)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		d.Run(ctx, time.Millisecond)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool { return len(d.RogueServers()) == 1 }, time.Second, time.Millisecond)
+	cancel()
+	<-done
+}
@@ -0,0 +1,200 @@
+package roguedhcp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+)
+
+// Only the small subset of RFC 2131 / RFC 2132 required to send a DHCPDISCOVER and to decode
+// the DHCPOFFER messages is implemented here.
+
+const (
+	opBootRequest uint8 = 1
+	opBootReply   uint8 = 2
+
+	htypeEthernet uint8 = 1
+
+	// flagBroadcast asks the DHCP servers to broadcast their answers, since the probe has no IP address
+	flagBroadcast uint16 = 0x8000
+
+	// headerLen is the size of the fixed part of a DHCP message, before the magic cookie
+	headerLen = 236
+
+	// minMessageLen is the size of the shortest valid DHCP message: the header plus the magic cookie
+	minMessageLen = headerLen + 4
+)
+
+var magicCookie = [4]byte{99, 130, 83, 99}
+
+// DHCP option codes, see RFC 2132
+const (
+	OptionPad                  uint8 = 0
+	OptionSubnetMask           uint8 = 1
+	OptionRouter               uint8 = 3
+	OptionDomainNameServer     uint8 = 6
+	OptionIPAddressLeaseTime   uint8 = 51
+	OptionMessageType          uint8 = 53
+	OptionServerIdentifier     uint8 = 54
+	OptionParameterRequestList uint8 = 55
+	OptionEnd                  uint8 = 255
+)
+
+// MessageType is the value of the DHCP message type option
+type MessageType uint8
+
+const (
+	MessageTypeDiscover MessageType = 1
+	MessageTypeOffer    MessageType = 2
+)
+
+// Option is a single DHCP option
+type Option struct {
+	Code uint8
+	Data []byte
+}
+
+// Message is a DHCPv4 message
+type Message struct {
+	Op           uint8
+	XID          uint32
+	Flags        uint16
+	ClientIP     netip.Addr // ciaddr
+	YourIP       netip.Addr // yiaddr, i.e. the IP address offered to the client
+	ServerIP     netip.Addr // siaddr
+	GatewayIP    netip.Addr // giaddr
+	ClientHWAddr net.HardwareAddr
+	Options      []Option
+}
+
+// NewDiscover creates a DHCPDISCOVER message for the given client MAC address
+func NewDiscover(xid uint32, clientHWAddr net.HardwareAddr) *Message {
+	return &Message{
+		Op:           opBootRequest,
+		XID:          xid,
+		Flags:        flagBroadcast,
+		ClientHWAddr: clientHWAddr,
+		Options: []Option{
+			{Code: OptionMessageType, Data: []byte{byte(MessageTypeDiscover)}},
+			{Code: OptionParameterRequestList, Data: []byte{OptionSubnetMask, OptionRouter, OptionDomainNameServer, OptionIPAddressLeaseTime}},
+		},
+	}
+}
+
+// Option returns the data of the first option with the given code
+func (m *Message) Option(code uint8) ([]byte, bool) {
+	for _, o := range m.Options {
+		if o.Code == code {
+			return o.Data, true
+		}
+	}
+	return nil, false
+}
+
+// MessageType returns the value of the DHCP message type option, or zero if it's missing
+func (m *Message) MessageType() MessageType {
+	data, ok := m.Option(OptionMessageType)
+	if !ok || len(data) != 1 {
+		return 0
+	}
+	return MessageType(data[0])
+}
+
+// ServerIdentifier returns the value of the server identifier option, which is the IP address
+// of the DHCP server that sent the message
+func (m *Message) ServerIdentifier() (netip.Addr, bool) {
+	data, ok := m.Option(OptionServerIdentifier)
+	if !ok {
+		return netip.Addr{}, false
+	}
+	return netip.AddrFromSlice(data)
+}
+
+func putAddr(b []byte, a netip.Addr) {
+	if a.Is4() {
+		ip := a.As4()
+		copy(b, ip[:])
+	}
+}
+
+func getAddr(b []byte) netip.Addr {
+	return netip.AddrFrom4([4]byte(b[:4]))
+}
+
+// Marshal encodes the message in its wire format
+func (m *Message) Marshal() ([]byte, error) {
+	if len(m.ClientHWAddr) > 16 {
+		return nil, fmt.Errorf("invalid hardware address length %d", len(m.ClientHWAddr))
+	}
+
+	b := make([]byte, headerLen, minMessageLen+64)
+	b[0] = m.Op
+	b[1] = htypeEthernet
+	b[2] = byte(len(m.ClientHWAddr))
+	binary.BigEndian.PutUint32(b[4:8], m.XID)
+	binary.BigEndian.PutUint16(b[10:12], m.Flags)
+	putAddr(b[12:16], m.ClientIP)
+	putAddr(b[16:20], m.YourIP)
+	putAddr(b[20:24], m.ServerIP)
+	putAddr(b[24:28], m.GatewayIP)
+	copy(b[28:44], m.ClientHWAddr)
+
+	b = append(b, magicCookie[:]...)
+	for _, o := range m.Options {
+		if len(o.Data) > 255 {
+			return nil, fmt.Errorf("option %d is too long: %d bytes", o.Code, len(o.Data))
+		}
+		b = append(b, o.Code, byte(len(o.Data)))
+		b = append(b, o.Data...)
+	}
+	b = append(b, OptionEnd)
+	return b, nil
+}
+
+// ParseMessage decodes a DHCP message from its wire format
+func ParseMessage(b []byte) (*Message, error) {
+	if len(b) < minMessageLen {
+		return nil, fmt.Errorf("DHCP message too short: %d bytes", len(b))
+	}
+	if [4]byte(b[headerLen:minMessageLen]) != magicCookie {
+		return nil, errors.New("invalid DHCP magic cookie")
+	}
+
+	hlen := int(b[2])
+	if hlen > 16 {
+		return nil, fmt.Errorf("invalid hardware address length %d", hlen)
+	}
+
+	m := &Message{
+		Op:           b[0],
+		XID:          binary.BigEndian.Uint32(b[4:8]),
+		Flags:        binary.BigEndian.Uint16(b[10:12]),
+		ClientIP:     getAddr(b[12:16]),
+		YourIP:       getAddr(b[16:20]),
+		ServerIP:     getAddr(b[20:24]),
+		GatewayIP:    getAddr(b[24:28]),
+		ClientHWAddr: net.HardwareAddr(append([]byte(nil), b[28:28+hlen]...)),
+	}
+
+	opts := b[minMessageLen:]
+	for len(opts) > 0 {
+		code := opts[0]
+		if code == OptionEnd {
+			break
+		}
+		if code == OptionPad {
+			opts = opts[1:]
+			continue
+		}
+		if len(opts) < 2 || len(opts) < 2+int(opts[1]) {
+			return nil, fmt.Errorf("truncated DHCP option %d", code)
+		}
+		length := int(opts[1])
+		m.Options = append(m.Options, Option{Code: code, Data: append([]byte(nil), opts[2:2+length]...)})
+		opts = opts[2+length:]
+	}
+
+	return m, nil
+}
@@ -0,0 +1,71 @@
+package roguedhcp
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageRoundTrip(t *testing.T) {
+	mac, _ := net.ParseMAC("aa:bb:cc:dd:ee:ff")
+	discover := NewDiscover(0x12345678, mac)
+
+	b, err := discover.Marshal()
+	require.NoError(t, err)
+	assert.Equal(t, []byte{1, 1, 6, 0, 0x12, 0x34, 0x56, 0x78}, b[:8])
+	assert.Equal(t, magicCookie[:], b[headerLen:minMessageLen])
+	assert.Equal(t, OptionEnd, b[len(b)-1])
+
+	parsed, err := ParseMessage(b)
+	require.NoError(t, err)
+	assert.Equal(t, opBootRequest, parsed.Op)
+	assert.Equal(t, uint32(0x12345678), parsed.XID)
+	assert.Equal(t, flagBroadcast, parsed.Flags)
+	assert.Equal(t, mac, parsed.ClientHWAddr)
+	assert.Equal(t, MessageTypeDiscover, parsed.MessageType())
+	assert.Equal(t, discover.Options, parsed.Options)
+	_, ok := parsed.ServerIdentifier()
+	assert.False(t, ok)
+}
+
+func TestParseOffer(t *testing.T) {
+	server := FakeServer{
+		IP:        netip.MustParseAddr("192.168.1.1"),
+		OfferedIP: netip.MustParseAddr("192.168.1.77"),
+	}
+	pkt := server.offer(NewDiscover(42, net.HardwareAddr{1, 2, 3, 4, 5, 6}))
+
+	// add some padding before the options end
+	payload := append(pkt.Payload[:len(pkt.Payload)-1], OptionPad, OptionPad, OptionEnd)
+
+	offer, err := ParseMessage(payload)
+	require.NoError(t, err)
+	assert.Equal(t, opBootReply, offer.Op)
+	assert.Equal(t, uint32(42), offer.XID)
+	assert.Equal(t, MessageTypeOffer, offer.MessageType())
+	assert.Equal(t, netip.MustParseAddr("192.168.1.77"), offer.YourIP)
+	serverID, ok := offer.ServerIdentifier()
+	assert.True(t, ok)
+	assert.Equal(t, netip.MustParseAddr("192.168.1.1"), serverID)
+}
+
+func TestParseMessageErrors(t *testing.T) {
+	valid, err := NewDiscover(1, net.HardwareAddr{1, 2, 3, 4, 5, 6}).Marshal()
+	require.NoError(t, err)
+
+	_, err = ParseMessage(valid[:100])
+	assert.Error(t, err, "too short")
+
+	badCookie := append([]byte(nil), valid...)
+	badCookie[headerLen] = 0
+	_, err = ParseMessage(badCookie)
+	assert.Error(t, err, "invalid magic cookie")
+
+	truncated := append([]byte(nil), valid[:minMessageLen]...)
+	truncated = append(truncated, OptionMessageType, 5, 1)
+	_, err = ParseMessage(truncated)
+	assert.Error(t, err, "truncated option")
+}
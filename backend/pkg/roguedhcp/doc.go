@@ -0,0 +1,13 @@
+/*
+Package roguedhcp implements a detector for rogue DHCP servers, i.e. DHCP servers other than the
+dnsmasq instance of this addon that are answering DHCP requests on the same network (a typical
+example is a consumer router which turned its own DHCP server back on).
+
+The detector periodically broadcasts a DHCPDISCOVER on each network interface and collects the
+DHCPOFFER messages coming from any server whose IP address does not belong to the interface itself.
+
+The packet layer is abstracted by the Transport interface: on Linux the real implementation sends
+the DHCPDISCOVER through a UDP socket and receives the answers through a packet socket, so that the
+MAC address of the offering server is known; unit tests instead use the in-process FakeTransport.
+*/
+package roguedhcp
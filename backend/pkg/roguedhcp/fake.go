@@ -0,0 +1,146 @@
+package roguedhcp
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+)
+
+// FakeServer is a DHCP server simulated by FakeTransport
+type FakeServer struct {
+	IP        netip.Addr
+	MAC       net.HardwareAddr
+	OfferedIP netip.Addr
+
+	// OmitServerIdentifier simulates servers that do not send the server identifier option
+	OmitServerIdentifier bool
+}
+
+// offer builds the DHCPOFFER sent by this server in answer to the given DHCPDISCOVER
+func (s FakeServer) offer(discover *Message) Packet {
+	offer := Message{
+		Op:           opBootReply,
+		XID:          discover.XID,
+		Flags:        discover.Flags,
+		YourIP:       s.OfferedIP,
+		ClientHWAddr: discover.ClientHWAddr,
+		Options: []Option{
+			{Code: OptionMessageType, Data: []byte{byte(MessageTypeOffer)}},
+		},
+	}
+	if !s.OmitServerIdentifier {
+		serverID := s.IP.As4()
+		offer.Options = append(offer.Options, Option{Code: OptionServerIdentifier, Data: serverID[:]})
+	}
+
+	payload, _ := offer.Marshal()
+	return Packet{Payload: payload, SrcIP: s.IP, SrcMAC: s.MAC}
+}
+
+// FakeTransport is an in-process Transport for unit tests: each DHCPDISCOVER broadcast on a network
+// interface is answered by all the FakeServers attached to that interface
+type FakeTransport struct {
+	lock       sync.Mutex
+	hwAddr     net.HardwareAddr
+	localAddrs map[string][]netip.Addr
+	servers    map[string][]FakeServer
+
+	// OpenErr, if set, is returned by Open
+	OpenErr error
+
+	// Discovers counts the DHCPDISCOVER messages received by the fake servers
+	Discovers int
+}
+
+// NewFakeTransport creates a FakeTransport without any network interface
+func NewFakeTransport() *FakeTransport {
+	return &FakeTransport{
+		hwAddr:     net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01},
+		localAddrs: make(map[string][]netip.Addr),
+		servers:    make(map[string][]FakeServer),
+	}
+}
+
+// SetLocalAddrs sets the IP addresses of the given network interface
+func (t *FakeTransport) SetLocalAddrs(iface string, addrs ...netip.Addr) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.localAddrs[iface] = addrs
+}
+
+// AddServer attaches a DHCP server to the given network interface
+func (t *FakeTransport) AddServer(iface string, server FakeServer) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.servers[iface] = append(t.servers[iface], server)
+}
+
+// RemoveServers detaches all DHCP servers from the given network interface
+func (t *FakeTransport) RemoveServers(iface string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.servers, iface)
+}
+
+func (t *FakeTransport) Open(iface string) (Conn, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.OpenErr != nil {
+		return nil, t.OpenErr
+	}
+	if _, ok := t.localAddrs[iface]; !ok {
+		return nil, fmt.Errorf("no such network interface: %s", iface)
+	}
+	return &fakeConn{transport: t, iface: iface}, nil
+}
+
+type fakeConn struct {
+	transport *FakeTransport
+	iface     string
+	received  []Packet
+}
+
+func (c *fakeConn) HardwareAddr() net.HardwareAddr {
+	return c.transport.hwAddr
+}
+
+func (c *fakeConn) LocalAddrs() ([]netip.Addr, error) {
+	c.transport.lock.Lock()
+	defer c.transport.lock.Unlock()
+	return c.transport.localAddrs[c.iface], nil
+}
+
+func (c *fakeConn) Broadcast(payload []byte) error {
+	discover, err := ParseMessage(payload)
+	if err != nil {
+		return err
+	}
+	if discover.MessageType() != MessageTypeDiscover {
+		return nil
+	}
+
+	c.transport.lock.Lock()
+	defer c.transport.lock.Unlock()
+	c.transport.Discovers++
+	for _, s := range c.transport.servers[c.iface] {
+		c.received = append(c.received, s.offer(discover))
+	}
+	return nil
+}
+
+func (c *fakeConn) Receive(deadline time.Time) (Packet, error) {
+	// the fake servers answer immediately: no need to wait for the deadline
+	if len(c.received) == 0 {
+		return Packet{}, fmt.Errorf("no DHCP message received: %w", os.ErrDeadlineExceeded)
+	}
+	pkt := c.received[0]
+	c.received = c.received[1:]
+	return pkt, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
@@ -0,0 +1,58 @@
+package roguedhcp
+
+import (
+	"net"
+	"net/netip"
+	"time"
+)
+
+// Packet is a DHCP message received by a Conn, together with its network-level source addresses
+type Packet struct {
+	Payload []byte
+	SrcIP   netip.Addr
+	SrcMAC  net.HardwareAddr
+}
+
+// Conn is the packet layer used by the Detector on a single network interface
+type Conn interface {
+	// HardwareAddr returns the MAC address of the network interface
+	HardwareAddr() net.HardwareAddr
+
+	// LocalAddrs returns the IP addresses of the network interface; DHCP servers using one of these
+	// addresses are running on this host and thus are not considered rogue servers
+	LocalAddrs() ([]netip.Addr, error)
+
+	// Broadcast sends the given DHCP message to the broadcast address, on the DHCP server port
+	Broadcast(payload []byte) error
+
+	// Receive returns the next DHCP message sent to the DHCP client port; it returns an error
+	// wrapping os.ErrDeadlineExceeded if nothing is received before the deadline
+	Receive(deadline time.Time) (Packet, error)
+
+	Close() error
+}
+
+// Transport opens a Conn on a network interface
+type Transport interface {
+	Open(iface string) (Conn, error)
+}
+
+// interfaceAddrs returns the IP addresses configured on the given network interface
+func interfaceAddrs(ifi *net.Interface) ([]netip.Addr, error) {
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []netip.Addr
+	for _, a := range addrs {
+		ipNet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if addr, ok := netip.AddrFromSlice(ipNet.IP); ok {
+			result = append(result, addr.Unmap())
+		}
+	}
+	return result, nil
+}
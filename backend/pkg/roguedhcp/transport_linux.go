@@ -0,0 +1,160 @@
+//go:build linux
+
+package roguedhcp
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"syscall"
+	"time"
+)
+
+const (
+	dhcpServerPort = 67
+	dhcpClientPort = 68
+
+	ipProtocolUDP = 17
+	udpHeaderLen  = 8
+)
+
+// linuxTransport sends DHCP messages through a UDP socket bound to the DHCP client port
+// and receives them through an AF_PACKET socket, which provides the source MAC address
+type linuxTransport struct{}
+
+// NewTransport returns the Transport using real network interfaces
+func NewTransport() Transport {
+	return linuxTransport{}
+}
+
+type linuxConn struct {
+	ifi      *net.Interface
+	udpConn  net.PacketConn
+	packetFd int
+}
+
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}
+
+func (linuxTransport) Open(iface string) (Conn, error) {
+	ifi, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, err
+	}
+
+	lc := net.ListenConfig{
+		Control: func(network, address string, c syscall.RawConn) error {
+			var sockErr error
+			err := c.Control(func(fd uintptr) {
+				// another DHCP client might be bound to the same port
+				if sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1); sockErr != nil {
+					return
+				}
+				if sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_BROADCAST, 1); sockErr != nil {
+					return
+				}
+				sockErr = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, iface)
+			})
+			if err != nil {
+				return err
+			}
+			return sockErr
+		},
+	}
+	udpConn, err := lc.ListenPacket(context.Background(), "udp4", fmt.Sprintf(":%d", dhcpClientPort))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open UDP socket on %s: %w", iface, err)
+	}
+
+	packetFd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_DGRAM, int(htons(syscall.ETH_P_IP)))
+	if err != nil {
+		_ = udpConn.Close()
+		return nil, fmt.Errorf("failed to open packet socket on %s: %w", iface, err)
+	}
+	err = syscall.Bind(packetFd, &syscall.SockaddrLinklayer{Protocol: htons(syscall.ETH_P_IP), Ifindex: ifi.Index})
+	if err != nil {
+		_ = syscall.Close(packetFd)
+		_ = udpConn.Close()
+		return nil, fmt.Errorf("failed to bind packet socket to %s: %w", iface, err)
+	}
+
+	return &linuxConn{ifi: ifi, udpConn: udpConn, packetFd: packetFd}, nil
+}
+
+func (c *linuxConn) HardwareAddr() net.HardwareAddr {
+	return c.ifi.HardwareAddr
+}
+
+func (c *linuxConn) LocalAddrs() ([]netip.Addr, error) {
+	return interfaceAddrs(c.ifi)
+}
+
+func (c *linuxConn) Broadcast(payload []byte) error {
+	_, err := c.udpConn.WriteTo(payload, &net.UDPAddr{IP: net.IPv4bcast, Port: dhcpServerPort})
+	return err
+}
+
+func (c *linuxConn) Receive(deadline time.Time) (Packet, error) {
+	buf := make([]byte, 1500)
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return Packet{}, fmt.Errorf("no DHCP message received: %w", os.ErrDeadlineExceeded)
+		}
+		tv := syscall.NsecToTimeval(max(remaining.Nanoseconds(), time.Microsecond.Nanoseconds()))
+		if err := syscall.SetsockoptTimeval(c.packetFd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+			return Packet{}, err
+		}
+
+		n, from, err := syscall.Recvfrom(c.packetFd, buf, 0)
+		if err != nil {
+			if errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EINTR) {
+				continue
+			}
+			return Packet{}, err
+		}
+
+		pkt, ok := parseIPv4UDPPacket(buf[:n])
+		if !ok {
+			continue // not a DHCP message for clients: keep waiting
+		}
+		if ll, ok := from.(*syscall.SockaddrLinklayer); ok && ll.Halen <= uint8(len(ll.Addr)) {
+			pkt.SrcMAC = net.HardwareAddr(append([]byte(nil), ll.Addr[:ll.Halen]...))
+		}
+		return pkt, nil
+	}
+}
+
+// parseIPv4UDPPacket extracts the UDP payload from an IPv4 packet, if it's addressed to the DHCP client port
+func parseIPv4UDPPacket(b []byte) (Packet, bool) {
+	if len(b) < 20 || b[0]>>4 != 4 {
+		return Packet{}, false
+	}
+	ihl := int(b[0]&0x0f) * 4
+	if ihl < 20 || len(b) < ihl+udpHeaderLen || b[9] != ipProtocolUDP {
+		return Packet{}, false
+	}
+
+	udp := b[ihl:]
+	if binary.BigEndian.Uint16(udp[2:4]) != dhcpClientPort {
+		return Packet{}, false
+	}
+	udpLen := int(binary.BigEndian.Uint16(udp[4:6]))
+	if udpLen < udpHeaderLen || udpLen > len(udp) {
+		return Packet{}, false
+	}
+
+	return Packet{
+		Payload: append([]byte(nil), udp[udpHeaderLen:udpLen]...),
+		SrcIP:   netip.AddrFrom4([4]byte(b[12:16])),
+	}, true
+}
+
+func (c *linuxConn) Close() error {
+	return errors.Join(syscall.Close(c.packetFd), c.udpConn.Close())
+}
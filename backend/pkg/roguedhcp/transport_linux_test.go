@@ -0,0 +1,44 @@
+//go:build linux
+
+package roguedhcp
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseIPv4UDPPacket(t *testing.T) {
+	payload := []byte{1, 2, 3, 4}
+	ipHeader := []byte{
+		0x45, 0, 0, 32, // version, IHL, TOS, total length
+		0, 0, 0, 0, // identification, flags
+		64, ipProtocolUDP, 0, 0, // TTL, protocol, checksum
+		192, 168, 1, 1, // source
+		255, 255, 255, 255, // destination
+	}
+	udpHeader := []byte{0, 67, 0, 68, 0, 12, 0, 0} // src port, dst port, length, checksum
+	packet := append(append(append([]byte(nil), ipHeader...), udpHeader...), payload...)
+
+	pkt, ok := parseIPv4UDPPacket(packet)
+	assert.True(t, ok)
+	assert.Equal(t, payload, pkt.Payload)
+	assert.Equal(t, netip.MustParseAddr("192.168.1.1"), pkt.SrcIP)
+
+	// not for the DHCP client port
+	otherPort := append([]byte(nil), packet...)
+	otherPort[20+3] = 53
+	_, ok = parseIPv4UDPPacket(otherPort)
+	assert.False(t, ok)
+
+	// not UDP
+	tcp := append([]byte(nil), packet...)
+	tcp[9] = 6
+	_, ok = parseIPv4UDPPacket(tcp)
+	assert.False(t, ok)
+
+	// truncated
+	_, ok = parseIPv4UDPPacket(packet[:24])
+	assert.False(t, ok)
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+
+package roguedhcp
+
+import (
+	"errors"
+	"fmt"
+)
+
+// unsupportedTransport is used on platforms where the raw sockets required to detect
+// rogue DHCP servers are not implemented
+type unsupportedTransport struct{}
+
+// NewTransport returns the Transport using real network interfaces
+func NewTransport() Transport {
+	return unsupportedTransport{}
+}
+
+func (unsupportedTransport) Open(iface string) (Conn, error) {
+	return nil, fmt.Errorf("cannot probe %s for rogue DHCP servers: %w", iface, errors.ErrUnsupported)
+}
@@ -0,0 +1,7 @@
+package trackerdb
+
+import "time"
+
+// busyTimeout is how long a query waits for a lock held by another process (e.g. the backend
+// and the dnsmasq DHCP script writing at the same time) before failing with "database is locked"
+var busyTimeout = 5 * time.Second
@@ -1,10 +1,10 @@
 /*
 Package trackerdb implements methods to query an sqlite3 Database which
-is populated by the dnsmasq DHCP script.
+is populated by the dnsmasq DHCP script (see the dhcpscript package).
 
 For more info about the dnsmasq DHCP script please check
   - dnsmasq man page and --dhcp-script option
-  - the /opt/bin/dnsmasq-dhcp-script.sh script part of this repository which is
+  - the dhcpscript package, i.e. the "dhcp-script" mode of the backend binary, which is
     where the "tracker DB" gets populated
 
 Q: Why do we need to have such "tracker DB" and we can't just rely on dnsmasq lease file/database?
@@ -23,8 +23,26 @@ A: To implement the "Past DHCP clients" feature of the addon web UI.
 Such feature allows to list any DHCP client that was present in the past but that did not contact
 the dnsmasq server since its last restart.
 
+Q: What is the "dhcp_events" table?
+A: Every time the dnsmasq lease file changes, the backend compares the new list of leases against the previous one
+and records what happened (a client joined, renewed its lease, changed IP or hostname, its lease expired or
+was removed) in the "dhcp_events" table. This provides a per-device history, on top of the single "last_seen"
+information of the "dhcp_clients" table. This table is created and populated only by the golang code.
+
+Q: What is the "dhcp_client_metadata" table?
+A: It stores the friendly name, the free-text note and the link template that the user edits from the web UI
+for a DHCP client. Differently from the "dhcp_clients" table, its entries are not purged automatically, since
+they contain user data; the settings in the addon options take precedence over them.
+This table is created and populated only by the golang code.
+
+Q: How is the DB schema created and upgraded?
+A: The schema is versioned: its version is stored in the sqlite "user_version" pragma and every time the DB is opened,
+all the migrations in migrations.go with a higher version are applied, each one in its own transaction.
+This allows users upgrading the addon to keep their history.
+
 Q: Where is the SQL insert/update that adds entries to the tracker DB?
-A: The SQL insert/update is done by the dnsmasq-dhcp-script.sh script.
+A: The SQL insert/update is done by the dhcpscript package, invoked by dnsmasq as DHCP script, through
+the TrackNewDhcpClient() method of this package.
 
 Q: Where is the SQL delete that removes entries from the tracker DB?
 A: The SQL delete is done in golang code, in this package.
@@ -0,0 +1,264 @@
+package trackerdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+)
+
+// DhcpEventType identifies what happened to a DHCP client between two snapshots of the dnsmasq lease file
+type DhcpEventType string
+
+const (
+	// DhcpEventJoined is emitted when a new MAC address appears in the lease file
+	DhcpEventJoined DhcpEventType = "joined"
+
+	// DhcpEventRenewed is emitted when the lease expiration time of a client changes, without changes to its IP
+	DhcpEventRenewed DhcpEventType = "renewed"
+
+	// DhcpEventIPChanged is emitted when a client obtains a different IP address
+	DhcpEventIPChanged DhcpEventType = "ip_changed"
+
+	// DhcpEventHostnameChanged is emitted when a client advertises a different hostname
+	DhcpEventHostnameChanged DhcpEventType = "hostname_changed"
+
+	// DhcpEventExpired is emitted when a client disappears from the lease file after its lease expired
+	DhcpEventExpired DhcpEventType = "expired"
+
+	// DhcpEventRemoved is emitted when a client disappears from the lease file before its lease expired,
+	// e.g. because the client released its lease
+	DhcpEventRemoved DhcpEventType = "removed"
+)
+
+// DhcpEvent represents a change in the state of a DHCP client, detected by the backend
+type DhcpEvent struct {
+	Timestamp time.Time
+	Type      DhcpEventType
+	MacAddr   net.HardwareAddr
+
+	// IPAddr and Hostname are the values after the event
+	IPAddr   netip.Addr
+	Hostname string
+
+	// PreviousIPAddr and PreviousHostname are populated only for DhcpEventIPChanged and
+	// DhcpEventHostnameChanged events respectively
+	PreviousIPAddr   netip.Addr
+	PreviousHostname string
+
+	// LeaseExpires is the lease expiration time after the event; zero for leases that never expire
+	LeaseExpires time.Time
+
+	// DhcpServerStartEpoch identifies the dnsmasq instance that was running when the event happened
+	DhcpServerStartEpoch int
+}
+
+// MarshalJSON customizes the JSON serialization for DhcpEvent
+func (e DhcpEvent) MarshalJSON() ([]byte, error) {
+	addrToString := func(a netip.Addr) string {
+		if !a.IsValid() {
+			return ""
+		}
+		return a.String()
+	}
+	leaseExpires := int64(0)
+	if !e.LeaseExpires.IsZero() {
+		leaseExpires = e.LeaseExpires.Unix()
+	}
+
+	return json.Marshal(&struct {
+		Timestamp            int64  `json:"timestamp"`
+		Type                 string `json:"type"`
+		MacAddr              string `json:"mac_addr"`
+		IPAddr               string `json:"ip_addr"`
+		Hostname             string `json:"hostname"`
+		PreviousIPAddr       string `json:"previous_ip_addr,omitempty"`
+		PreviousHostname     string `json:"previous_hostname,omitempty"`
+		LeaseExpires         int64  `json:"lease_expires"`
+		DhcpServerStartEpoch int    `json:"dhcp_server_start_epoch"`
+	}{
+		Timestamp:            e.Timestamp.Unix(),
+		Type:                 string(e.Type),
+		MacAddr:              e.MacAddr.String(),
+		IPAddr:               addrToString(e.IPAddr),
+		Hostname:             e.Hostname,
+		PreviousIPAddr:       addrToString(e.PreviousIPAddr),
+		PreviousHostname:     e.PreviousHostname,
+		LeaseExpires:         leaseExpires,
+		DhcpServerStartEpoch: e.DhcpServerStartEpoch,
+	})
+}
+
+func (e DhcpEvent) String() string {
+	switch e.Type {
+	case DhcpEventIPChanged:
+		return fmt.Sprintf("%s %s: %s -> %s", e.MacAddr, e.Type, e.PreviousIPAddr, e.IPAddr)
+	case DhcpEventHostnameChanged:
+		return fmt.Sprintf("%s %s: %s -> %s", e.MacAddr, e.Type, e.PreviousHostname, e.Hostname)
+	default:
+		return fmt.Sprintf("%s %s (%s, %s)", e.MacAddr, e.Type, e.IPAddr, e.Hostname)
+	}
+}
+
+// AddDhcpEvents stores the given events in the database, in a single transaction.
+// Consecutive DhcpEventRenewed events of the same client are collapsed: if the most recent event
+// stored for the client is a renewal, it's updated in place instead of adding a new row, so that
+// clients with short leases do not flood the table.
+func (d *DhcpClientTrackerDB) AddDhcpEvents(events []DhcpEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback() // no-op if the transaction has been committed
+	}()
+
+	insertQuery := `
+	INSERT INTO dhcp_events (timestamp, event_type, mac_addr, ip_addr, hostname, previous_ip_addr, previous_hostname, lease_expires, dhcp_server_start_epoch)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);
+	`
+	stmt, err := tx.Prepare(insertQuery)
+	if err != nil {
+		return fmt.Errorf("failed to prepare insert into dhcp_events: %w", err)
+	}
+	defer func() {
+		_ = stmt.Close()
+	}()
+
+	updateRenewalQuery := `
+	UPDATE dhcp_events SET timestamp = ?, ip_addr = ?, hostname = ?, lease_expires = ?, dhcp_server_start_epoch = ?
+	WHERE event_type = ? AND id = (SELECT id FROM dhcp_events WHERE mac_addr = ? ORDER BY timestamp DESC, id DESC LIMIT 1);
+	`
+	updateRenewalStmt, err := tx.Prepare(updateRenewalQuery)
+	if err != nil {
+		return fmt.Errorf("failed to prepare update of dhcp_events: %w", err)
+	}
+	defer func() {
+		_ = updateRenewalStmt.Close()
+	}()
+
+	for _, e := range events {
+		var ip, prevIP string
+		if e.IPAddr.IsValid() {
+			ip = e.IPAddr.String()
+		}
+		if e.PreviousIPAddr.IsValid() {
+			prevIP = e.PreviousIPAddr.String()
+		}
+		leaseExpires := int64(0)
+		if !e.LeaseExpires.IsZero() {
+			leaseExpires = e.LeaseExpires.Unix()
+		}
+
+		if e.Type == DhcpEventRenewed {
+			res, err := updateRenewalStmt.Exec(e.Timestamp.Unix(), ip, e.Hostname, leaseExpires, e.DhcpServerStartEpoch,
+				string(DhcpEventRenewed), e.MacAddr.String())
+			if err != nil {
+				return fmt.Errorf("failed to update event %s: %w", e.String(), err)
+			}
+			if n, err := res.RowsAffected(); err == nil && n > 0 {
+				continue
+			}
+		}
+
+		_, err := stmt.Exec(e.Timestamp.Unix(), string(e.Type), e.MacAddr.String(),
+			ip, e.Hostname, prevIP, e.PreviousHostname, leaseExpires, e.DhcpServerStartEpoch)
+		if err != nil {
+			return fmt.Errorf("failed to insert event %s: %w", e.String(), err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetDhcpClientTimeline returns the events recorded for the given MAC address, most recent first.
+// If limit is positive, at most limit events are returned.
+func (d *DhcpClientTrackerDB) GetDhcpClientTimeline(macAddr net.HardwareAddr, limit int) ([]DhcpEvent, error) {
+	query := `
+	SELECT timestamp, event_type, mac_addr, ip_addr, hostname, previous_ip_addr, previous_hostname, lease_expires, dhcp_server_start_epoch
+	FROM dhcp_events WHERE mac_addr = ? ORDER BY timestamp DESC, id DESC LIMIT ?`
+	if limit <= 0 {
+		limit = -1 // no limit in sqlite
+	}
+
+	rows, err := d.DB.Query(query, macAddr.String(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query dhcp_events: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	events := make([]DhcpEvent, 0) // in case of errors, or zero results return an empty slice, not nil
+	for rows.Next() {
+		var e DhcpEvent
+		var timestamp, leaseExpires int64
+		var eventType, mac, ip, prevIP string
+
+		err := rows.Scan(&timestamp, &eventType, &mac, &ip, &e.Hostname, &prevIP, &e.PreviousHostname,
+			&leaseExpires, &e.DhcpServerStartEpoch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		e.Timestamp = time.Unix(timestamp, 0)
+		e.Type = DhcpEventType(eventType)
+		if leaseExpires != 0 {
+			e.LeaseExpires = time.Unix(leaseExpires, 0)
+		}
+		e.MacAddr, err = net.ParseMAC(mac)
+		if err != nil {
+			return nil, err
+		}
+		if ip != "" {
+			if e.IPAddr, err = netip.ParseAddr(ip); err != nil {
+				return nil, fmt.Errorf("failed to parse ip_addr: %w", err)
+			}
+		}
+		if prevIP != "" {
+			if e.PreviousIPAddr, err = netip.ParseAddr(prevIP); err != nil {
+				return nil, fmt.Errorf("failed to parse previous_ip_addr: %w", err)
+			}
+		}
+
+		events = append(events, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// PurgeOldDhcpEvents removes the events older than the specified duration.
+// It returns the number of events that were purged.
+func (d *DhcpClientTrackerDB) PurgeOldDhcpEvents(purgeThreshold time.Duration) (int64, error) {
+	thresholdTime := time.Now().Add(-purgeThreshold)
+
+	res, err := d.DB.Exec(`DELETE FROM dhcp_events WHERE timestamp < ?`, thresholdTime.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete old events: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// PurgeExcessDhcpEvents keeps only the most recent maxPerClient events of each client, removing the others.
+// It returns the number of events that were purged.
+func (d *DhcpClientTrackerDB) PurgeExcessDhcpEvents(maxPerClient int) (int64, error) {
+	res, err := d.DB.Exec(`
+	DELETE FROM dhcp_events WHERE id IN (
+		SELECT id FROM (
+			SELECT id, ROW_NUMBER() OVER (PARTITION BY mac_addr ORDER BY timestamp DESC, id DESC) AS n FROM dhcp_events
+		) WHERE n > ?
+	)`, maxPerClient)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete excess events: %w", err)
+	}
+	return res.RowsAffected()
+}
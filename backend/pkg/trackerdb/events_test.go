@@ -0,0 +1,162 @@
+package trackerdb
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDhcpEvents(t *testing.T) {
+	db := NewTestDB()
+
+	now := time.Now().Truncate(time.Second)
+	mac := MustParseMAC("aa:bb:cc:dd:ee:ff")
+	otherMac := MustParseMAC("00:11:22:33:44:55")
+	events := []DhcpEvent{
+		{
+			Timestamp: now.Add(-3 * time.Hour), Type: DhcpEventJoined, MacAddr: mac,
+			IPAddr: netip.MustParseAddr("192.168.1.10"), Hostname: "laptop",
+			LeaseExpires: now.Add(-2 * time.Hour), DhcpServerStartEpoch: 1,
+		},
+		{
+			Timestamp: now.Add(-2 * time.Hour), Type: DhcpEventIPChanged, MacAddr: mac,
+			IPAddr: netip.MustParseAddr("192.168.1.20"), PreviousIPAddr: netip.MustParseAddr("192.168.1.10"),
+			Hostname: "laptop", LeaseExpires: now.Add(time.Hour), DhcpServerStartEpoch: 2,
+		},
+		{
+			Timestamp: now.Add(-time.Hour), Type: DhcpEventHostnameChanged, MacAddr: mac,
+			IPAddr: netip.MustParseAddr("192.168.1.20"), Hostname: "new-laptop", PreviousHostname: "laptop",
+			LeaseExpires: now.Add(time.Hour), DhcpServerStartEpoch: 2,
+		},
+		{
+			Timestamp: now, Type: DhcpEventJoined, MacAddr: otherMac,
+			IPAddr: netip.MustParseAddr("192.168.1.30"), Hostname: "phone", DhcpServerStartEpoch: 2,
+		},
+	}
+	require.NoError(t, db.AddDhcpEvents(events))
+
+	timeline, err := db.GetDhcpClientTimeline(mac, 0)
+	require.NoError(t, err)
+	require.Len(t, timeline, 3)
+
+	// most recent first
+	assert.Equal(t, DhcpEventHostnameChanged, timeline[0].Type)
+	assert.Equal(t, "laptop", timeline[0].PreviousHostname)
+	assert.Equal(t, "new-laptop", timeline[0].Hostname)
+	assert.Equal(t, DhcpEventIPChanged, timeline[1].Type)
+	assert.Equal(t, netip.MustParseAddr("192.168.1.10"), timeline[1].PreviousIPAddr)
+	assert.Equal(t, netip.MustParseAddr("192.168.1.20"), timeline[1].IPAddr)
+	assert.Equal(t, 2, timeline[1].DhcpServerStartEpoch)
+	assert.Equal(t, DhcpEventJoined, timeline[2].Type)
+	assert.True(t, timeline[2].Timestamp.Equal(now.Add(-3*time.Hour)))
+	assert.False(t, timeline[2].PreviousIPAddr.IsValid())
+
+	// limit
+	timeline, err = db.GetDhcpClientTimeline(mac, 1)
+	require.NoError(t, err)
+	require.Len(t, timeline, 1)
+	assert.Equal(t, DhcpEventHostnameChanged, timeline[0].Type)
+
+	// a lease that never expires
+	timeline, err = db.GetDhcpClientTimeline(otherMac, 0)
+	require.NoError(t, err)
+	require.Len(t, timeline, 1)
+	assert.True(t, timeline[0].LeaseExpires.IsZero())
+
+	// unknown MAC
+	timeline, err = db.GetDhcpClientTimeline(MustParseMAC("de:ad:be:ef:00:00"), 0)
+	require.NoError(t, err)
+	assert.Empty(t, timeline)
+
+	// purge
+	numPurged, err := db.PurgeOldDhcpEvents(90 * time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), numPurged)
+	timeline, err = db.GetDhcpClientTimeline(mac, 0)
+	require.NoError(t, err)
+	assert.Len(t, timeline, 1)
+}
+
+func TestDhcpEvents_RenewalsAreCollapsed(t *testing.T) {
+	db := NewTestDB()
+
+	now := time.Now().Truncate(time.Second)
+	mac := MustParseMAC("aa:bb:cc:dd:ee:ff")
+	ip := netip.MustParseAddr("192.168.1.10")
+	renewal := func(ts time.Time) DhcpEvent {
+		return DhcpEvent{Timestamp: ts, Type: DhcpEventRenewed, MacAddr: mac, IPAddr: ip, LeaseExpires: ts.Add(time.Hour)}
+	}
+
+	require.NoError(t, db.AddDhcpEvents([]DhcpEvent{
+		{Timestamp: now.Add(-4 * time.Hour), Type: DhcpEventJoined, MacAddr: mac, IPAddr: ip},
+		renewal(now.Add(-3 * time.Hour)),
+	}))
+	require.NoError(t, db.AddDhcpEvents([]DhcpEvent{renewal(now.Add(-2 * time.Hour))}))
+	require.NoError(t, db.AddDhcpEvents([]DhcpEvent{renewal(now.Add(-time.Hour))}))
+
+	timeline, err := db.GetDhcpClientTimeline(mac, 0)
+	require.NoError(t, err)
+	require.Len(t, timeline, 2)
+	assert.Equal(t, DhcpEventRenewed, timeline[0].Type)
+	assert.True(t, timeline[0].Timestamp.Equal(now.Add(-time.Hour)), "the last renewal is kept")
+	assert.True(t, timeline[0].LeaseExpires.Equal(now))
+	assert.Equal(t, DhcpEventJoined, timeline[1].Type)
+
+	// a renewal following another event is recorded again
+	require.NoError(t, db.AddDhcpEvents([]DhcpEvent{
+		{Timestamp: now.Add(-30 * time.Minute), Type: DhcpEventHostnameChanged, MacAddr: mac, IPAddr: ip, Hostname: "laptop"},
+		renewal(now),
+	}))
+	timeline, err = db.GetDhcpClientTimeline(mac, 0)
+	require.NoError(t, err)
+	require.Len(t, timeline, 4)
+	assert.Equal(t, DhcpEventRenewed, timeline[0].Type)
+	assert.Equal(t, DhcpEventHostnameChanged, timeline[1].Type)
+}
+
+func TestPurgeExcessDhcpEvents(t *testing.T) {
+	db := NewTestDB()
+
+	now := time.Now().Truncate(time.Second)
+	mac := MustParseMAC("aa:bb:cc:dd:ee:ff")
+	otherMac := MustParseMAC("00:11:22:33:44:55")
+	var events []DhcpEvent
+	for i := range 5 {
+		events = append(events,
+			DhcpEvent{Timestamp: now.Add(time.Duration(i) * time.Minute), Type: DhcpEventJoined, MacAddr: mac},
+			DhcpEvent{Timestamp: now.Add(time.Duration(i)*time.Minute + time.Second), Type: DhcpEventExpired, MacAddr: mac})
+	}
+	events = append(events, DhcpEvent{Timestamp: now, Type: DhcpEventJoined, MacAddr: otherMac})
+	require.NoError(t, db.AddDhcpEvents(events))
+
+	numPurged, err := db.PurgeExcessDhcpEvents(3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), numPurged)
+
+	timeline, err := db.GetDhcpClientTimeline(mac, 0)
+	require.NoError(t, err)
+	require.Len(t, timeline, 3)
+	assert.True(t, timeline[0].Timestamp.Equal(now.Add(4*time.Minute+time.Second)), "the most recent events are kept")
+
+	timeline, err = db.GetDhcpClientTimeline(otherMac, 0)
+	require.NoError(t, err)
+	assert.Len(t, timeline, 1)
+}
+
+func TestDhcpEventMarshalJSON(t *testing.T) {
+	e := DhcpEvent{
+		Timestamp: time.Unix(1700000000, 0), Type: DhcpEventIPChanged, MacAddr: MustParseMAC("aa:bb:cc:dd:ee:ff"),
+		IPAddr: netip.MustParseAddr("192.168.1.20"), PreviousIPAddr: netip.MustParseAddr("192.168.1.10"),
+		Hostname: "laptop", DhcpServerStartEpoch: 2,
+	}
+	data, err := e.MarshalJSON()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"timestamp": 1700000000, "type": "ip_changed", "mac_addr": "aa:bb:cc:dd:ee:ff",
+		"ip_addr": "192.168.1.20", "hostname": "laptop", "previous_ip_addr": "192.168.1.10",
+		"lease_expires": 0, "dhcp_server_start_epoch": 2
+	}`, string(data))
+}
@@ -0,0 +1,121 @@
+package trackerdb
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// DhcpClientMetadata holds the information about a DHCP client that the user edited from the web UI
+type DhcpClientMetadata struct {
+	MacAddr      net.HardwareAddr
+	FriendlyName string
+	Note         string
+
+	// Link is a golang template producing the link shown for the DHCP client; the caller is
+	// responsible for validating it
+	Link string
+
+	// UpdatedAt is the last time the metadata was changed
+	UpdatedAt time.Time
+}
+
+// IsEmpty returns true when no information is set, apart from the MAC address
+func (m DhcpClientMetadata) IsEmpty() bool {
+	return m.FriendlyName == "" && m.Note == "" && m.Link == ""
+}
+
+// dhcpClientMetadataColumns is the list of columns scanned by scanDhcpClientMetadata
+const dhcpClientMetadataColumns = "mac_addr, friendly_name, note, link, updated_at"
+
+// scanDhcpClientMetadata converts a row containing the dhcpClientMetadataColumns into a DhcpClientMetadata
+func scanDhcpClientMetadata(row rowScanner) (DhcpClientMetadata, error) {
+	var m DhcpClientMetadata
+	var mac string
+	var updatedAt int64
+
+	if err := row.Scan(&mac, &m.FriendlyName, &m.Note, &m.Link, &updatedAt); err != nil {
+		return m, err
+	}
+
+	var err error
+	m.MacAddr, err = net.ParseMAC(mac)
+	if err != nil {
+		return m, err
+	}
+	m.UpdatedAt = time.Unix(updatedAt, 0)
+	return m, nil
+}
+
+// SetDhcpClientMetadata inserts or replaces the metadata of a DHCP client.
+// Empty metadata are deleted from the database.
+func (d *DhcpClientTrackerDB) SetDhcpClientMetadata(m DhcpClientMetadata) error {
+	if m.IsEmpty() {
+		return d.DeleteDhcpClientMetadata(m.MacAddr)
+	}
+
+	insertQuery := `
+	INSERT INTO dhcp_client_metadata (` + dhcpClientMetadataColumns + `)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT(mac_addr) DO UPDATE SET
+		friendly_name=excluded.friendly_name,
+		note=excluded.note,
+		link=excluded.link,
+		updated_at=excluded.updated_at;
+	`
+
+	// all values are provided by the user: always go through bound parameters
+	_, err := d.DB.Exec(insertQuery, m.MacAddr.String(), m.FriendlyName, m.Note, m.Link, m.UpdatedAt.Unix())
+	if err != nil {
+		return fmt.Errorf("failed to store metadata of %s: %w", m.MacAddr, err)
+	}
+	return nil
+}
+
+// DeleteDhcpClientMetadata removes the metadata of a DHCP client; it's not an error if there are none
+func (d *DhcpClientTrackerDB) DeleteDhcpClientMetadata(macAddr net.HardwareAddr) error {
+	if _, err := d.DB.Exec(`DELETE FROM dhcp_client_metadata WHERE mac_addr = ?`, macAddr.String()); err != nil {
+		return fmt.Errorf("failed to delete metadata of %s: %w", macAddr, err)
+	}
+	return nil
+}
+
+// GetDhcpClientMetadata retrieves the metadata of a DHCP client by its MAC address.
+func (d *DhcpClientTrackerDB) GetDhcpClientMetadata(macAddr net.HardwareAddr) (*DhcpClientMetadata, error) {
+	query := `SELECT ` + dhcpClientMetadataColumns + ` FROM dhcp_client_metadata WHERE mac_addr = ?`
+	m, err := scanDhcpClientMetadata(d.DB.QueryRow(query, macAddr.String()))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("metadata of %s: %w", macAddr, ErrDhcpClientNotFound)
+		}
+		return nil, err
+	}
+	return &m, nil
+}
+
+// GetAllDhcpClientMetadata returns the metadata of all DHCP clients, sorted by MAC address
+func (d *DhcpClientTrackerDB) GetAllDhcpClientMetadata() ([]DhcpClientMetadata, error) {
+	rows, err := d.DB.Query(`SELECT ` + dhcpClientMetadataColumns + ` FROM dhcp_client_metadata ORDER BY mac_addr`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query dhcp_client_metadata: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	all := make([]DhcpClientMetadata, 0) // in case of errors, or zero results return an empty slice, not nil
+	for rows.Next() {
+		m, err := scanDhcpClientMetadata(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		all = append(all, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return all, nil
+}
@@ -0,0 +1,58 @@
+package trackerdb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDhcpClientMetadata(t *testing.T) {
+	db := NewTestDB()
+	mac := MustParseMAC("aa:bb:cc:dd:ee:ff")
+	otherMac := MustParseMAC("00:11:22:33:44:55")
+	now := time.Now().Truncate(time.Second)
+
+	// unknown MAC
+	_, err := db.GetDhcpClientMetadata(mac)
+	require.ErrorIs(t, err, ErrDhcpClientNotFound)
+
+	// insert
+	require.NoError(t, db.SetDhcpClientMetadata(DhcpClientMetadata{
+		MacAddr: mac, FriendlyName: "laptop", Note: "Bob's 'work' laptop", Link: "http://{{ .ip }}", UpdatedAt: now,
+	}))
+	m, err := db.GetDhcpClientMetadata(mac)
+	require.NoError(t, err)
+	assert.Equal(t, "laptop", m.FriendlyName)
+	assert.Equal(t, "Bob's 'work' laptop", m.Note)
+	assert.Equal(t, "http://{{ .ip }}", m.Link)
+	assert.True(t, m.UpdatedAt.Equal(now))
+
+	// update
+	require.NoError(t, db.SetDhcpClientMetadata(DhcpClientMetadata{MacAddr: mac, FriendlyName: "old laptop", UpdatedAt: now.Add(time.Hour)}))
+	require.NoError(t, db.SetDhcpClientMetadata(DhcpClientMetadata{MacAddr: otherMac, Note: "printer", UpdatedAt: now}))
+	all, err := db.GetAllDhcpClientMetadata()
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	assert.Equal(t, otherMac, all[0].MacAddr)
+	assert.Equal(t, "printer", all[0].Note)
+	assert.Equal(t, mac, all[1].MacAddr)
+	assert.Equal(t, "old laptop", all[1].FriendlyName)
+	assert.Empty(t, all[1].Note)
+	assert.Empty(t, all[1].Link)
+
+	// metadata are not purged together with the past DHCP clients
+	_, err = db.PurgeOldDeadClients(0)
+	require.NoError(t, err)
+
+	// empty metadata are deleted
+	require.NoError(t, db.SetDhcpClientMetadata(DhcpClientMetadata{MacAddr: mac, UpdatedAt: now}))
+	_, err = db.GetDhcpClientMetadata(mac)
+	require.ErrorIs(t, err, ErrDhcpClientNotFound)
+
+	require.NoError(t, db.DeleteDhcpClientMetadata(otherMac))
+	all, err = db.GetAllDhcpClientMetadata()
+	require.NoError(t, err)
+	assert.Empty(t, all)
+}
@@ -0,0 +1,183 @@
+package trackerdb
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// migration describes a single step to upgrade the DB schema from version-1 to version
+type migration struct {
+	version     int
+	description string
+	statements  []string
+}
+
+// migrations is the list of all schema changes applied to the tracker DB, in order.
+// The schema version of a DB is stored in the sqlite "user_version" pragma; a freshly-created DB
+// has version 0.
+// IMPORTANT: never modify a migration that has been released; always append a new one.
+var migrations = []migration{
+	{
+		version:     1,
+		description: "initial schema, as created by the legacy dnsmasq-dhcp-script.sh",
+		statements: []string{
+			// NOTE: the 'dhcp_server_start_counter' column actually contains Epochs
+			`CREATE TABLE IF NOT EXISTS dhcp_clients (
+				mac_addr TEXT PRIMARY KEY,
+				hostname TEXT,
+				last_seen TEXT,
+				dhcp_server_start_counter INT
+			);`,
+		},
+	},
+	{
+		version:     2,
+		description: "add the dhcp_events table",
+		statements: []string{
+			`CREATE TABLE IF NOT EXISTS dhcp_events (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				timestamp INTEGER NOT NULL,
+				event_type TEXT NOT NULL,
+				mac_addr TEXT NOT NULL,
+				ip_addr TEXT,
+				hostname TEXT,
+				previous_ip_addr TEXT,
+				previous_hostname TEXT,
+				lease_expires INTEGER,
+				dhcp_server_start_epoch INTEGER
+			);`,
+			`CREATE INDEX IF NOT EXISTS dhcp_events_by_mac ON dhcp_events (mac_addr, timestamp);`,
+		},
+	},
+	{
+		version:     3,
+		description: "store last_seen as Unix timestamp, rename dhcp_server_start_counter, index last_seen",
+		statements: []string{
+			`CREATE TABLE dhcp_clients_v2 (
+				mac_addr TEXT PRIMARY KEY,
+				hostname TEXT NOT NULL DEFAULT '',
+				last_seen INTEGER NOT NULL,
+				dhcp_server_start_epoch INTEGER NOT NULL DEFAULT 0
+			);`,
+			// strftime('%s') understands the RFC3339 format, including the trailing 'Z' and any UTC offset;
+			// unparsable timestamps become 0 so that they get purged at the next check
+			`INSERT INTO dhcp_clients_v2 (mac_addr, hostname, last_seen, dhcp_server_start_epoch)
+				SELECT mac_addr,
+					COALESCE(hostname, ''),
+					COALESCE(CAST(strftime('%s', last_seen) AS INTEGER), 0),
+					COALESCE(dhcp_server_start_counter, 0)
+				FROM dhcp_clients;`,
+			`DROP TABLE dhcp_clients;`,
+			`ALTER TABLE dhcp_clients_v2 RENAME TO dhcp_clients;`,
+			`CREATE INDEX dhcp_clients_by_last_seen ON dhcp_clients (last_seen);`,
+		},
+	},
+	{
+		version:     4,
+		description: "add last_ip and first_seen columns",
+		statements: []string{
+			`ALTER TABLE dhcp_clients ADD COLUMN last_ip TEXT NOT NULL DEFAULT '';`,
+			`ALTER TABLE dhcp_clients ADD COLUMN first_seen INTEGER NOT NULL DEFAULT 0;`,
+			// the best approximation for the first time a client was seen is the oldest recorded event, if any
+			`UPDATE dhcp_clients SET first_seen = MIN(last_seen, COALESCE(
+				(SELECT MIN(e.timestamp) FROM dhcp_events e WHERE e.mac_addr = dhcp_clients.mac_addr),
+				last_seen));`,
+			`UPDATE dhcp_clients SET last_ip = COALESCE(
+				(SELECT e.ip_addr FROM dhcp_events e WHERE e.mac_addr = dhcp_clients.mac_addr
+					ORDER BY e.timestamp DESC, e.id DESC LIMIT 1),
+				'');`,
+		},
+	},
+	{
+		version:     5,
+		description: "add the dhcp_client_metadata table",
+		statements: []string{
+			`CREATE TABLE dhcp_client_metadata (
+				mac_addr TEXT PRIMARY KEY,
+				friendly_name TEXT NOT NULL DEFAULT '',
+				note TEXT NOT NULL DEFAULT '',
+				link TEXT NOT NULL DEFAULT '',
+				updated_at INTEGER NOT NULL DEFAULT 0
+			);`,
+		},
+	},
+}
+
+// latestSchemaVersion is the schema version produced by applying all migrations
+func latestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// SchemaVersion returns the current schema version of the DB
+func (d *DhcpClientTrackerDB) SchemaVersion() (int, error) {
+	return schemaVersion(d.DB)
+}
+
+type queryRower interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func schemaVersion(q queryRower) (int, error) {
+	var version int
+	if err := q.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// migrate upgrades the DB schema up to the given version.
+// Each migration runs in its own transaction together with the update of the schema version,
+// so that a failure leaves the DB at the last successfully-applied version.
+// Since both the backend and the dnsmasq DHCP script open the DB, the schema version is checked
+// again inside each transaction, which holds the write lock (see the _txlock DSN parameter).
+func (d *DhcpClientTrackerDB) migrate(targetVersion int) error {
+	currentVersion, err := d.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if currentVersion > latestSchemaVersion() {
+		return fmt.Errorf("tracker DB schema version %d is newer than the latest supported version %d", currentVersion, latestSchemaVersion())
+	}
+
+	for _, m := range migrations {
+		if m.version <= currentVersion || m.version > targetVersion {
+			continue
+		}
+		if err := d.applyMigration(m); err != nil {
+			return fmt.Errorf("failed to migrate tracker DB to schema version %d (%s): %w", m.version, m.description, err)
+		}
+	}
+	return nil
+}
+
+func (d *DhcpClientTrackerDB) applyMigration(m migration) error {
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback() // no-op if the transaction has been committed
+	}()
+
+	// another process might have applied this migration in the meanwhile
+	version, err := schemaVersion(tx)
+	if err != nil {
+		return err
+	}
+	if version >= m.version {
+		return nil
+	}
+
+	for _, stmt := range m.statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	// PRAGMA statements do not support bound parameters
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", m.version)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
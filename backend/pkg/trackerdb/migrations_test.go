@@ -0,0 +1,262 @@
+package trackerdb
+
+import (
+	"database/sql"
+	"net/netip"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newUnmigratedTestDB returns an in-memory DB at schema version 0, i.e. without any table
+func newUnmigratedTestDB(t *testing.T) *DhcpClientTrackerDB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+	return &DhcpClientTrackerDB{DB: db}
+}
+
+// newTestDBAtVersion returns an in-memory DB with all migrations applied up to the given version
+func newTestDBAtVersion(t *testing.T, version int) *DhcpClientTrackerDB {
+	t.Helper()
+	db := newUnmigratedTestDB(t)
+	require.NoError(t, db.migrate(version))
+	requireSchemaVersion(t, db, version)
+	return db
+}
+
+func requireSchemaVersion(t *testing.T, db *DhcpClientTrackerDB, expected int) {
+	t.Helper()
+	version, err := db.SchemaVersion()
+	require.NoError(t, err)
+	require.Equal(t, expected, version)
+}
+
+func tableColumns(t *testing.T, db *DhcpClientTrackerDB, table string) map[string]string {
+	t.Helper()
+	rows, err := db.DB.Query("SELECT name, type FROM pragma_table_info(?)", table)
+	require.NoError(t, err)
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	columns := make(map[string]string)
+	for rows.Next() {
+		var name, colType string
+		require.NoError(t, rows.Scan(&name, &colType))
+		columns[name] = colType
+	}
+	require.NoError(t, rows.Err())
+	return columns
+}
+
+func TestMigrationVersionsAreSequential(t *testing.T) {
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.version, "migration %q", m.description)
+		assert.NotEmpty(t, m.statements)
+	}
+}
+
+// TestMigration1 checks the initial schema gets created on an empty DB
+func TestMigration1(t *testing.T) {
+	db := newUnmigratedTestDB(t)
+	requireSchemaVersion(t, db, 0)
+
+	require.NoError(t, db.migrate(1))
+	requireSchemaVersion(t, db, 1)
+
+	assert.Equal(t, map[string]string{
+		"mac_addr":                  "TEXT",
+		"hostname":                  "TEXT",
+		"last_seen":                 "TEXT",
+		"dhcp_server_start_counter": "INT",
+	}, tableColumns(t, db, "dhcp_clients"))
+	assert.Empty(t, tableColumns(t, db, "dhcp_events"), "the legacy schema has no dhcp_events table")
+}
+
+// TestMigration1_ExistingLegacyDB checks that a DB created by the legacy shell script is adopted as-is
+func TestMigration1_ExistingLegacyDB(t *testing.T) {
+	db := newUnmigratedTestDB(t)
+	_, err := db.DB.Exec(`
+		CREATE TABLE dhcp_clients (mac_addr TEXT PRIMARY KEY, hostname TEXT, last_seen TEXT, dhcp_server_start_counter INT);
+		INSERT INTO dhcp_clients VALUES ('aa:bb:cc:dd:ee:ff', 'legacy-host', '2025-01-02T03:04:05Z', 1735786000);
+	`)
+	require.NoError(t, err)
+
+	require.NoError(t, db.migrate(1))
+	requireSchemaVersion(t, db, 1)
+
+	var hostname string
+	require.NoError(t, db.DB.QueryRow("SELECT hostname FROM dhcp_clients").Scan(&hostname))
+	assert.Equal(t, "legacy-host", hostname)
+}
+
+// TestMigration2 checks the dhcp_events table gets created
+func TestMigration2(t *testing.T) {
+	db := newTestDBAtVersion(t, 1)
+
+	require.NoError(t, db.migrate(2))
+	requireSchemaVersion(t, db, 2)
+
+	columns := tableColumns(t, db, "dhcp_events")
+	assert.Equal(t, "INTEGER", columns["timestamp"])
+	assert.Contains(t, columns, "mac_addr")
+	assert.Contains(t, columns, "previous_ip_addr")
+}
+
+// TestMigration3 checks the conversion of RFC3339 timestamps to Unix timestamps
+func TestMigration3(t *testing.T) {
+	db := newTestDBAtVersion(t, 2)
+	_, err := db.DB.Exec(`
+		INSERT INTO dhcp_clients VALUES ('aa:bb:cc:dd:ee:01', 'utc-host', '2025-01-02T03:04:05Z', 1735786000);
+		INSERT INTO dhcp_clients VALUES ('aa:bb:cc:dd:ee:02', 'offset-host', '2025-01-02T05:04:05+02:00', 1735786001);
+		INSERT INTO dhcp_clients VALUES ('aa:bb:cc:dd:ee:03', NULL, 'garbage', NULL);
+	`)
+	require.NoError(t, err)
+
+	require.NoError(t, db.migrate(3))
+	requireSchemaVersion(t, db, 3)
+
+	columns := tableColumns(t, db, "dhcp_clients")
+	assert.Equal(t, "INTEGER", columns["last_seen"])
+	assert.Contains(t, columns, "dhcp_server_start_epoch")
+	assert.NotContains(t, columns, "dhcp_server_start_counter")
+
+	var indexName string
+	require.NoError(t, db.DB.QueryRow(
+		"SELECT name FROM sqlite_master WHERE type='index' AND tbl_name='dhcp_clients' AND sql LIKE '%last_seen%'").Scan(&indexName))
+	assert.NotEmpty(t, indexName)
+
+	expected := map[string]struct {
+		hostname   string
+		lastSeen   int64
+		startEpoch int
+	}{
+		"aa:bb:cc:dd:ee:01": {"utc-host", time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC).Unix(), 1735786000},
+		"aa:bb:cc:dd:ee:02": {"offset-host", time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC).Unix(), 1735786001},
+		"aa:bb:cc:dd:ee:03": {"", 0, 0},
+	}
+	rows, err := db.DB.Query("SELECT mac_addr, hostname, last_seen, dhcp_server_start_epoch FROM dhcp_clients")
+	require.NoError(t, err)
+	defer func() {
+		_ = rows.Close()
+	}()
+	numRows := 0
+	for rows.Next() {
+		var mac, hostname string
+		var lastSeen int64
+		var startEpoch int
+		require.NoError(t, rows.Scan(&mac, &hostname, &lastSeen, &startEpoch))
+		assert.Equal(t, expected[mac].hostname, hostname, mac)
+		assert.Equal(t, expected[mac].lastSeen, lastSeen, mac)
+		assert.Equal(t, expected[mac].startEpoch, startEpoch, mac)
+		numRows++
+	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, len(expected), numRows)
+}
+
+// TestMigration4 checks the new last_ip and first_seen columns get backfilled
+func TestMigration4(t *testing.T) {
+	db := newTestDBAtVersion(t, 3)
+	_, err := db.DB.Exec(`
+		INSERT INTO dhcp_clients VALUES ('aa:bb:cc:dd:ee:01', 'with-events', 2000, 1);
+		INSERT INTO dhcp_clients VALUES ('aa:bb:cc:dd:ee:02', 'without-events', 3000, 1);
+		INSERT INTO dhcp_events (timestamp, event_type, mac_addr, ip_addr) VALUES (1000, 'joined', 'aa:bb:cc:dd:ee:01', '192.168.1.10');
+		INSERT INTO dhcp_events (timestamp, event_type, mac_addr, ip_addr) VALUES (1500, 'ip_changed', 'aa:bb:cc:dd:ee:01', '192.168.1.20');
+	`)
+	require.NoError(t, err)
+
+	require.NoError(t, db.migrate(4))
+	requireSchemaVersion(t, db, 4)
+
+	client, err := db.GetDhcpClient(MustParseMAC("aa:bb:cc:dd:ee:01"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1000), client.FirstSeen.Unix())
+	assert.Equal(t, int64(2000), client.LastSeen.Unix())
+	assert.Equal(t, netip.MustParseAddr("192.168.1.20"), client.LastIP)
+
+	client, err = db.GetDhcpClient(MustParseMAC("aa:bb:cc:dd:ee:02"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(3000), client.FirstSeen.Unix())
+	assert.False(t, client.LastIP.IsValid())
+}
+
+// TestMigration5 checks the dhcp_client_metadata table gets created
+func TestMigration5(t *testing.T) {
+	db := newTestDBAtVersion(t, 4)
+	assert.Empty(t, tableColumns(t, db, "dhcp_client_metadata"))
+
+	require.NoError(t, db.migrate(5))
+	requireSchemaVersion(t, db, 5)
+
+	assert.Equal(t, map[string]string{
+		"mac_addr":      "TEXT",
+		"friendly_name": "TEXT",
+		"note":          "TEXT",
+		"link":          "TEXT",
+		"updated_at":    "INTEGER",
+	}, tableColumns(t, db, "dhcp_client_metadata"))
+}
+
+// TestMigrateLegacyFileDB checks the upgrade of a DB file created by the legacy shell script,
+// going through NewDhcpClientTrackerDB like the addon does
+func TestMigrateLegacyFileDB(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "trackerdb.sqlite3")
+
+	legacyDB, err := sql.Open("sqlite3", dbPath)
+	require.NoError(t, err)
+	_, err = legacyDB.Exec(`
+		CREATE TABLE dhcp_clients (mac_addr TEXT PRIMARY KEY, hostname TEXT, last_seen TEXT, dhcp_server_start_counter INT);
+		INSERT INTO dhcp_clients VALUES ('aa:bb:cc:dd:ee:ff', 'legacy-host', '2025-01-02T03:04:05Z', 1735786000);
+	`)
+	require.NoError(t, err)
+	require.NoError(t, legacyDB.Close())
+
+	db, err := NewDhcpClientTrackerDB(dbPath)
+	require.NoError(t, err)
+	requireSchemaVersion(t, db, latestSchemaVersion())
+
+	client, err := db.GetDhcpClient(MustParseMAC("aa:bb:cc:dd:ee:ff"))
+	require.NoError(t, err)
+	assert.Equal(t, "legacy-host", client.Hostname)
+	assert.Equal(t, 1735786000, client.DhcpServerStartEpoch)
+	assert.True(t, client.LastSeen.Equal(time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)))
+	assert.True(t, client.FirstSeen.Equal(client.LastSeen))
+	require.NoError(t, db.Close())
+
+	// reopening an up-to-date DB is a no-op
+	db, err = NewDhcpClientTrackerDB(dbPath)
+	require.NoError(t, err)
+	requireSchemaVersion(t, db, latestSchemaVersion())
+	require.NoError(t, db.Close())
+}
+
+func TestMigrateNewerSchemaFails(t *testing.T) {
+	db := newTestDBAtVersion(t, latestSchemaVersion())
+	_, err := db.DB.Exec("PRAGMA user_version = 999")
+	require.NoError(t, err)
+
+	assert.Error(t, db.migrate(latestSchemaVersion()))
+}
+
+func TestTrackNewDhcpClientKeepsFirstSeen(t *testing.T) {
+	db := NewTestDB()
+	mac := MustParseMAC("aa:bb:cc:dd:ee:ff")
+	firstTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	secondTime := time.Now().Truncate(time.Second)
+
+	require.NoError(t, db.TrackNewDhcpClient(DhcpClient{MacAddr: mac, Hostname: "host", LastSeen: firstTime, LastIP: netip.MustParseAddr("192.168.1.10")}))
+	require.NoError(t, db.TrackNewDhcpClient(DhcpClient{MacAddr: mac, Hostname: "host", LastSeen: secondTime, LastIP: netip.MustParseAddr("192.168.1.20")}))
+
+	client, err := db.GetDhcpClient(mac)
+	require.NoError(t, err)
+	assert.True(t, client.FirstSeen.Equal(firstTime))
+	assert.True(t, client.LastSeen.Equal(secondTime))
+	assert.Equal(t, netip.MustParseAddr("192.168.1.20"), client.LastIP)
+}
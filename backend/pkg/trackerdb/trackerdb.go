@@ -1,32 +1,68 @@
 package trackerdb
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"log"
 	"net"
+	"net/netip"
 	"time"
 
 	// import sqlite3 driver, so that database/sql package will know how to deal with "sqlite3" type
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// ErrDhcpClientNotFound is returned when the requested DHCP client is not tracked in the database
+var ErrDhcpClientNotFound = errors.New("DHCP client not found")
+
 // DhcpClientTrackerDB manages the database operations for DHCP clients.
 type DhcpClientTrackerDB struct {
 	DB *sql.DB
 }
 
-// NewDhcpClientTrackerDB initializes the database.
+// NewDhcpClientTrackerDB initializes the database, creating or upgrading its schema if needed.
+// The same database file is accessed concurrently by the backend and by the dnsmasq DHCP script,
+// so the WAL journal mode is used together with a busy timeout, to avoid "database is locked" errors.
 func NewDhcpClientTrackerDB(dbPath string) (*DhcpClientTrackerDB, error) {
-	db, err := sql.Open("sqlite3", dbPath)
+	dsn := dbPath
+	if dbPath != ":memory:" {
+		// _txlock=immediate makes transactions take the write lock immediately: this is required
+		// to make concurrent schema migrations safe
+		dsn = fmt.Sprintf("file:%s?_journal_mode=WAL&_busy_timeout=%d&_txlock=immediate", dbPath, busyTimeout.Milliseconds())
+	}
+
+	db, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		return nil, err
 	}
+	if dbPath == ":memory:" {
+		// each connection to an in-memory DB gets its own, empty, database: use a single connection
+		db.SetMaxOpenConns(1)
+	}
 
-	// the table should be already there as it's created by the dnsmasq helper script
+	trackerDB := &DhcpClientTrackerDB{DB: db}
+	if err := trackerDB.migrate(latestSchemaVersion()); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
 
-	return &DhcpClientTrackerDB{DB: db}, nil
+	return trackerDB, nil
+}
+
+// Close releases the database
+func (d *DhcpClientTrackerDB) Close() error {
+	return d.DB.Close()
+}
+
+// Ping checks that the database is reachable and its schema is readable
+func (d *DhcpClientTrackerDB) Ping(ctx context.Context) error {
+	var count int
+	if err := d.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM dhcp_clients").Scan(&count); err != nil {
+		return fmt.Errorf("failed to query dhcp_clients: %w", err)
+	}
+	return nil
 }
 
 // NewTestDB returns a mock DB for testing
@@ -37,21 +73,6 @@ func NewTestDB() DhcpClientTrackerDB {
 		log.Fatal("Failed to initialize test database")
 	}
 
-	// Create table
-	// NOTE: the 'dhcp_server_start_counter' column actually contains Epochs and is named like that for backward compat
-	createTableQuery := `
-	CREATE TABLE IF NOT EXISTS dhcp_clients (
-		mac_addr TEXT PRIMARY KEY,
-		hostname TEXT,
-		last_seen TEXT,
-		dhcp_server_start_counter INT
-	);
-	`
-	_, err = db.DB.Exec(createTableQuery)
-	if err != nil {
-		log.Fatal("Failed to initialize test database")
-	}
-
 	return *db
 }
 
@@ -69,19 +90,46 @@ func NewTestDBWithData(clientsInDB []DhcpClient) DhcpClientTrackerDB {
 	return db
 }
 
-// TrackNewDhcpClient inserts a new DHCP client into the database.
-// This is used only during unit testing...
-func (d *DhcpClientTrackerDB) TrackNewDhcpClient(client DhcpClient) error {
-	insertQuery := `
-	INSERT INTO dhcp_clients (mac_addr, hostname, last_seen, dhcp_server_start_counter)
-	VALUES (?, ?, ?, ?)
+// trackDhcpClientQuery inserts a new DHCP client or updates an existing one, keeping its first_seen
+const trackDhcpClientQuery = `
+	INSERT INTO dhcp_clients (mac_addr, hostname, last_seen, dhcp_server_start_epoch, last_ip, first_seen)
+	VALUES (?, ?, ?, ?, ?, ?)
 	ON CONFLICT(mac_addr) DO UPDATE SET 
 		hostname=excluded.hostname, 
 		last_seen=excluded.last_seen,
-		dhcp_server_start_counter=excluded.dhcp_server_start_counter;
+		dhcp_server_start_epoch=excluded.dhcp_server_start_epoch,
+		last_ip=excluded.last_ip;
 	`
 
-	_, err := d.DB.Exec(insertQuery, client.MacAddr.String(), client.Hostname, client.LastSeen.Format(time.RFC3339), 0)
+// trackDhcpClientArgs returns the arguments of trackDhcpClientQuery for the given client
+func trackDhcpClientArgs(client DhcpClient) []any {
+	firstSeen := client.FirstSeen
+	if firstSeen.IsZero() {
+		firstSeen = client.LastSeen
+	}
+	lastIP := ""
+	if client.LastIP.IsValid() {
+		lastIP = client.LastIP.String()
+	}
+	return []any{client.MacAddr.String(), client.Hostname, client.LastSeen.Unix(), client.DhcpServerStartEpoch,
+		lastIP, firstSeen.Unix()}
+}
+
+// TrackNewDhcpClient inserts a new DHCP client into the database or updates an existing one.
+// This is used by the dnsmasq DHCP script, every time a DHCP client gets a lease.
+// The FirstSeen field is used only when inserting a new client; if it's zero, LastSeen is used instead.
+func (d *DhcpClientTrackerDB) TrackNewDhcpClient(client DhcpClient) error {
+	// the hostname is provided by the DHCP client, so it cannot be trusted:
+	// always go through a prepared statement
+	stmt, err := d.DB.Prepare(trackDhcpClientQuery)
+	if err != nil {
+		return fmt.Errorf("failed to prepare insert into dhcp_clients: %w", err)
+	}
+	defer func() {
+		_ = stmt.Close()
+	}()
+
+	_, err = stmt.Exec(trackDhcpClientArgs(client)...)
 	if err != nil {
 		return err
 	}
@@ -89,30 +137,86 @@ func (d *DhcpClientTrackerDB) TrackNewDhcpClient(client DhcpClient) error {
 	return nil
 }
 
-// GetDhcpClient retrieves a DHCP client by its MAC address.
-func (d *DhcpClientTrackerDB) GetDhcpClient(macAddr net.HardwareAddr) (*DhcpClient, error) {
-	query := `SELECT mac_addr, hostname, last_seen FROM dhcp_clients WHERE mac_addr = ?`
-	row := d.DB.QueryRow(query, macAddr.String())
+// TrackNewDhcpClients is like TrackNewDhcpClient, but stores all the given clients in a single
+// transaction: either all of them are stored, or none is.
+func (d *DhcpClientTrackerDB) TrackNewDhcpClients(clients []DhcpClient) error {
+	if len(clients) == 0 {
+		return nil
+	}
 
-	var client DhcpClient
-	var lastSeen string
-	var mac string
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback() // no-op if the transaction has been committed
+	}()
 
-	err := row.Scan(&mac, &client.Hostname, &lastSeen)
+	stmt, err := tx.Prepare(trackDhcpClientQuery)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, fmt.Errorf("client with mac_addr %s not found", macAddr)
+		return fmt.Errorf("failed to prepare insert into dhcp_clients: %w", err)
+	}
+	defer func() {
+		_ = stmt.Close()
+	}()
+
+	for _, client := range clients {
+		if _, err := stmt.Exec(trackDhcpClientArgs(client)...); err != nil {
+			return fmt.Errorf("failed to track the DHCP client %s: %w", client.MacAddr, err)
 		}
-		return nil, err
 	}
 
+	return tx.Commit()
+}
+
+// dhcpClientColumns is the list of columns scanned by scanDhcpClient
+const dhcpClientColumns = "mac_addr, hostname, last_seen, dhcp_server_start_epoch, last_ip, first_seen"
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanDhcpClient converts a row containing the dhcpClientColumns into a DhcpClient
+func scanDhcpClient(row rowScanner) (DhcpClient, error) {
+	var client DhcpClient
+	var mac, lastIP string
+	var lastSeen, firstSeen int64
+
+	err := row.Scan(&mac, &client.Hostname, &lastSeen, &client.DhcpServerStartEpoch, &lastIP, &firstSeen)
+	if err != nil {
+		return client, err
+	}
+
+	// Convert string -> net.HardwareAddr
 	client.MacAddr, err = net.ParseMAC(mac)
 	if err != nil {
-		return nil, err
+		return client, err
+	}
+
+	if lastIP != "" {
+		client.LastIP, err = netip.ParseAddr(lastIP)
+		if err != nil {
+			return client, fmt.Errorf("failed to parse LastIP: %w", err)
+		}
 	}
 
-	client.LastSeen, err = time.Parse(time.RFC3339, lastSeen)
+	// Convert Unix timestamps -> time.Time
+	client.LastSeen = time.Unix(lastSeen, 0)
+	client.FirstSeen = time.Unix(firstSeen, 0)
+
+	return client, nil
+}
+
+// GetDhcpClient retrieves a DHCP client by its MAC address.
+func (d *DhcpClientTrackerDB) GetDhcpClient(macAddr net.HardwareAddr) (*DhcpClient, error) {
+	query := `SELECT ` + dhcpClientColumns + ` FROM dhcp_clients WHERE mac_addr = ?`
+	row := d.DB.QueryRow(query, macAddr.String())
+
+	client, err := scanDhcpClient(row)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("client with mac_addr %s: %w", macAddr, ErrDhcpClientNotFound)
+		}
 		return nil, err
 	}
 
@@ -123,7 +227,7 @@ func (d *DhcpClientTrackerDB) GetDhcpClient(macAddr net.HardwareAddr) (*DhcpClie
 // which identifies the currently-alive DHCP clients.
 func (d *DhcpClientTrackerDB) GetDeadDhcpClients(aliveClients []net.HardwareAddr) ([]DhcpClient, error) {
 	// Step 1: Get all DHCP clients from the database
-	rows, err := d.DB.Query("SELECT mac_addr, hostname, last_seen, dhcp_server_start_counter FROM dhcp_clients")
+	rows, err := d.DB.Query("SELECT " + dhcpClientColumns + " FROM dhcp_clients")
 	if err != nil {
 		return nil, fmt.Errorf("failed to query dhcp_clients: %w", err)
 	}
@@ -140,28 +244,11 @@ func (d *DhcpClientTrackerDB) GetDeadDhcpClients(aliveClients []net.HardwareAddr
 	// Step 2: Collect all clients from the database
 	deadClients := make([]DhcpClient, 0) // in case of errors, or zero results return an empty slice, not nil
 	for rows.Next() {
-		var client DhcpClient
-		var lastSeenStr string
-		var mac string
-
-		// Scan the row data into the DhcpClient struct
-		err := rows.Scan(&mac, &client.Hostname, &lastSeenStr, &client.DhcpServerStartEpoch)
+		client, err := scanDhcpClient(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
 
-		// Convert string -> net.HardwareAddr
-		client.MacAddr, err = net.ParseMAC(mac)
-		if err != nil {
-			return nil, err
-		}
-
-		// Convert string -> time.Time
-		client.LastSeen, err = parseTime(lastSeenStr)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse LastSeen: %w", err)
-		}
-
 		// Step 3: Check if the client MAC address exists in the aliveClients list
 		if _, exists := macAddrMap[client.MacAddr.String()]; !exists {
 			// If the MAC address is not in the slice, then the client is a "dead" one...
@@ -176,11 +263,6 @@ func (d *DhcpClientTrackerDB) GetDeadDhcpClients(aliveClients []net.HardwareAddr
 	return deadClients, nil
 }
 
-// Helper function to parse a time string (assuming stored as ISO 8601 or RFC3339 format)
-func parseTime(timeStr string) (time.Time, error) {
-	return time.Parse(time.RFC3339, timeStr)
-}
-
 // PurgeOldDeadClients removes DHCP clients from the database that have not been seen for a specified duration.
 // It returns the list of clients that were purged.
 func (d *DhcpClientTrackerDB) PurgeOldDeadClients(purgeThreshold time.Duration) ([]DhcpClient, error) {
@@ -188,11 +270,11 @@ func (d *DhcpClientTrackerDB) PurgeOldDeadClients(purgeThreshold time.Duration)
 	currentTime := time.Now()
 
 	// Step 2: Calculate the threshold time
-	thresholdTime := currentTime.Add(-purgeThreshold)
+	thresholdTime := currentTime.Add(-purgeThreshold).Unix()
 
-	// Step 3: Query to find clients that are older than the threshold
-	query := `SELECT mac_addr, hostname, last_seen FROM dhcp_clients WHERE last_seen < ?`
-	rows, err := d.DB.Query(query, thresholdTime.Format(time.RFC3339))
+	// Step 3: Query to find clients that are older than the threshold (this uses the last_seen index)
+	query := `SELECT ` + dhcpClientColumns + ` FROM dhcp_clients WHERE last_seen < ?`
+	rows, err := d.DB.Query(query, thresholdTime)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query dhcp_clients: %w", err)
 	}
@@ -203,25 +285,11 @@ func (d *DhcpClientTrackerDB) PurgeOldDeadClients(purgeThreshold time.Duration)
 	// Step 4: Collect the clients to be purged
 	purgedClients := make([]DhcpClient, 0) // in case of errors, or zero results return an empty slice, not nil
 	for rows.Next() {
-		var client DhcpClient
-		var lastSeenStr string
-		var mac string
-
-		err := rows.Scan(&mac, &client.Hostname, &lastSeenStr)
+		client, err := scanDhcpClient(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
 
-		client.MacAddr, err = net.ParseMAC(mac)
-		if err != nil {
-			return nil, err
-		}
-
-		client.LastSeen, err = parseTime(lastSeenStr)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse LastSeen: %w", err)
-		}
-
 		purgedClients = append(purgedClients, client)
 	}
 
@@ -235,7 +303,7 @@ func (d *DhcpClientTrackerDB) PurgeOldDeadClients(purgeThreshold time.Duration)
 
 	// Step 5: Delete the old clients from the database
 	deleteQuery := `DELETE FROM dhcp_clients WHERE last_seen < ?`
-	if _, err := d.DB.Exec(deleteQuery, thresholdTime.Format(time.RFC3339)); err != nil {
+	if _, err := d.DB.Exec(deleteQuery, thresholdTime); err != nil {
 		return nil, fmt.Errorf("failed to delete old clients: %w", err)
 	}
 
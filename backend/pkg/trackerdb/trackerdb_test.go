@@ -1,12 +1,14 @@
 package trackerdb
 
 import (
+	"context"
 	"net"
 	"testing"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // MustParseMAC acts like ParseMAC but panics if in case of an error
@@ -95,7 +97,7 @@ func TestGetDhcpClient(t *testing.T) {
 
 	// Test retrieving a non-existent client
 	_, err = db.GetDhcpClient(MustParseMAC("FF:EE:DD:CC:BB:AA"))
-	assert.Error(t, err, "Expected error when retrieving non-existent client, but got nil")
+	assert.ErrorIs(t, err, ErrDhcpClientNotFound, "Expected error when retrieving non-existent client")
 }
 
 // TestGetDeadDhcpClients tests the GetDeadDhcpClients method.
@@ -174,3 +176,38 @@ func TestGetDeadDhcpClients(t *testing.T) {
 	assert.NoError(t, err, "Unexpected error while getting clients not in data")
 	assert.Equal(t, CompareDhcpClientSlices(expectedMissingClients, missingClients), true, "Mismatch in missing clients when none are in the provided data")
 }
+
+func TestPing(t *testing.T) {
+	db, err := NewDhcpClientTrackerDB(":memory:")
+	assert.NoError(t, err)
+	assert.NoError(t, db.Ping(context.Background()))
+
+	assert.NoError(t, db.Close())
+	assert.Error(t, db.Ping(context.Background()))
+}
+
+func TestTrackNewDhcpClients(t *testing.T) {
+	db := NewTestDB()
+	clients := []DhcpClient{
+		{MacAddr: MustParseMAC("AA:BB:CC:DD:EE:01"), Hostname: "host1", LastSeen: time.Now()},
+		{MacAddr: MustParseMAC("AA:BB:CC:DD:EE:02"), Hostname: "host2", LastSeen: time.Now()},
+	}
+
+	// a failure on the second client leaves the first one out too
+	_, err := db.DB.Exec(`CREATE TRIGGER fail_insert BEFORE INSERT ON dhcp_clients
+		WHEN NEW.mac_addr = 'aa:bb:cc:dd:ee:02' BEGIN SELECT RAISE(ABORT, 'injected failure'); END;`)
+	require.NoError(t, err)
+	assert.ErrorContains(t, db.TrackNewDhcpClients(clients), "injected failure")
+	_, err = db.GetDhcpClient(clients[0].MacAddr)
+	assert.ErrorIs(t, err, ErrDhcpClientNotFound)
+
+	_, err = db.DB.Exec(`DROP TRIGGER fail_insert;`)
+	require.NoError(t, err)
+	require.NoError(t, db.TrackNewDhcpClients(clients))
+	for _, c := range clients {
+		retrievedClient, err := db.GetDhcpClient(c.MacAddr)
+		require.NoError(t, err)
+		assert.Equal(t, c.Hostname, retrievedClient.Hostname)
+	}
+	assert.NoError(t, db.TrackNewDhcpClients(nil))
+}
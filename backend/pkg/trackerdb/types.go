@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"net/netip"
 	"time"
 
 	// import sqlite3 driver, so that database/sql package will know how to deal with "sqlite3" type
@@ -18,20 +19,35 @@ type DhcpClient struct {
 	Hostname             string
 	LastSeen             time.Time
 	DhcpServerStartEpoch int
+
+	// LastIP is the IP address assigned to the client the last time it was seen;
+	// it may be invalid for clients tracked before this information was recorded
+	LastIP netip.Addr
+
+	// FirstSeen is the first time the client has been tracked
+	FirstSeen time.Time
 }
 
 // MarshalJSON customizes the JSON serialization for DhcpClientData
 func (d DhcpClient) MarshalJSON() ([]byte, error) {
+	lastIP := ""
+	if d.LastIP.IsValid() {
+		lastIP = d.LastIP.String()
+	}
 	return json.Marshal(&struct {
 		MacAddr              string `json:"mac_addr"`
 		Hostname             string `json:"hostname"`
 		LastSeen             int64  `json:"last_seen"`
 		DhcpServerStartEpoch int    `json:"dhcp_server_start_epoch"`
+		LastIP               string `json:"last_ip"`
+		FirstSeen            int64  `json:"first_seen"`
 	}{
 		MacAddr:              d.MacAddr.String(),
 		Hostname:             d.Hostname,
 		LastSeen:             d.LastSeen.Unix(),
 		DhcpServerStartEpoch: d.DhcpServerStartEpoch,
+		LastIP:               lastIP,
+		FirstSeen:            d.FirstSeen.Unix(),
 	})
 }
 
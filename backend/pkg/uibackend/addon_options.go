@@ -2,6 +2,8 @@ package uibackend
 
 import (
 	"dnsmasq-dhcp-backend/pkg/ippool"
+	"dnsmasq-dhcp-backend/pkg/mqttpublisher"
+	"dnsmasq-dhcp-backend/pkg/notifier"
 	"encoding/json"
 	"fmt"
 	"net"
@@ -45,6 +47,30 @@ type AddonOptions struct {
 	dnsEnable bool
 	dnsDomain string
 	dnsPort   int
+
+	// Rogue DHCP server detection
+	rogueDhcpDetectorEnable bool
+	rogueDhcpProbeInterval  time.Duration
+
+	// MQTT publishing of DHCP clients and statistics to Home Assistant
+	mqttEnable          bool
+	mqttConfig          mqttpublisher.Config
+	mqttPublishInterval time.Duration
+
+	// HTTP endpoints notified about DHCP events
+	webhooks []notifier.WebhookTarget
+
+	// Fire Home Assistant events on DHCP events?
+	homeAssistantEventsEnable bool
+
+	// Lease database of another DHCP server, imported when the addon starts
+	leaseImportFile string
+
+	// DHCP range usage alerts; a zero poolAlertHorizon disables the alerts based on the forecast
+	poolAlertWarningPercent  int
+	poolAlertCriticalPercent int
+	poolAlertHorizon         time.Duration
+	poolAlertTrendWindow     time.Duration
 }
 
 // ParseDuration parses a duration string.
@@ -99,93 +125,126 @@ func parseDuration(s string) (time.Duration, error) {
 	return sumDur, nil
 }
 
+// addonOptionsJSON is the JSON structure of the addon options file.
+// This must be updated every time the config.yaml of the addon is changed;
+// however this structure contains only fields that are relevant to the
+// UI backend behavior. In other words the addon config.yaml might contain
+// more settings than those listed here.
+type addonOptionsJSON struct {
+	DhcpIpAddressReservations []struct {
+		Name string `json:"name"`
+		Mac  string `json:"mac"`
+		IP   string `json:"ip"`
+		Link string `json:"link"`
+	} `json:"dhcp_ip_address_reservations"`
+
+	DhcpClientsFriendlyNames []struct {
+		Name string `json:"name"`
+		Mac  string `json:"mac"`
+		Link string `json:"link"`
+	} `json:"dhcp_clients_friendly_names"`
+
+	DhcpServer struct {
+		LogDHCP                 bool   `json:"log_requests"`
+		DefaultLease            string `json:"default_lease"`
+		AddressReservationLease string `json:"address_reservation_lease"`
+		ForgetPastClientsAfter  string `json:"forget_past_clients_after"`
+	} `json:"dhcp_server"`
+
+	DhcpPool []dhcpPoolJSON `json:"dhcp_pools"`
+
+	DnsServer struct {
+		Enable    bool   `json:"enable"`
+		DnsDomain string `json:"dns_domain"`
+		Port      int    `json:"port"`
+	} `json:"dns_server"`
+
+	WebUI struct {
+		Log                bool `json:"log_activity"`
+		Port               int  `json:"port"`
+		RefreshIntervalSec int  `json:"refresh_interval_sec"`
+	} `json:"web_ui"`
+
+	RogueDhcpDetector struct {
+		Enable           bool `json:"enable"`
+		ProbeIntervalSec int  `json:"probe_interval_sec"`
+	} `json:"rogue_dhcp_detector"`
+
+	Mqtt struct {
+		Enable             bool   `json:"enable"`
+		Broker             string `json:"broker"`
+		Username           string `json:"username"`
+		Password           string `json:"password"`
+		DiscoveryPrefix    string `json:"discovery_prefix"`
+		TopicPrefix        string `json:"topic_prefix"`
+		PublishIntervalSec int    `json:"publish_interval_sec"`
+	} `json:"mqtt"`
+
+	Webhooks []struct {
+		Name    string   `json:"name"`
+		URL     string   `json:"url"`
+		Events  []string `json:"events"`
+		Payload string   `json:"payload"`
+	} `json:"webhooks"`
+
+	HomeAssistantEvents struct {
+		Enable bool `json:"enable"`
+	} `json:"homeassistant_events"`
+
+	LeaseImport struct {
+		File string `json:"file"`
+	} `json:"lease_import"`
+
+	PoolAlerts struct {
+		WarningPercent  int    `json:"warning_percent"`
+		CriticalPercent int    `json:"critical_percent"`
+		Horizon         string `json:"exhaustion_horizon"`
+		TrendWindow     string `json:"trend_window"`
+	} `json:"pool_alerts"`
+}
+
+// newAddonOptions returns empty AddonOptions, ready to be filled by UnmarshalJSON
+func newAddonOptions() *AddonOptions {
+	return &AddonOptions{
+		ipAddressReservationsByIP:  make(map[netip.Addr]IpAddressReservation),
+		ipAddressReservationsByMAC: make(map[string]IpAddressReservation),
+		friendlyNames:              make(map[string]DhcpClientFriendlyName),
+	}
+}
+
+// parseAddonOptions converts the content of the addon options file into a fresh AddonOptions instance
+func parseAddonOptions(data []byte) (*AddonOptions, error) {
+	o := newAddonOptions()
+	if err := json.Unmarshal(data, o); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// parseLinkTemplate parses the golang template used to produce the link shown for a DHCP client
+func parseLinkTemplate(text string) (*texttemplate.Template, error) {
+	return texttemplate.New("linkTemplate").Parse(text)
+}
+
 // UnmarshalJSON reads the configuration of this Home Assistant addon and converts it
 // into maps and slices that get stored into the UIBackend instance
 func (o *AddonOptions) UnmarshalJSON(data []byte) error {
-	// JSON structure.
-	// This must be updated every time the config.yaml of the addon is changed;
-	// however this structure contains only fields that are relevant to the
-	// UI backend behavior. In other words the addon config.yaml might contain
-	// more settings than those listed here.
-	var cfg struct {
-		DhcpIpAddressReservations []struct {
-			Name string `json:"name"`
-			Mac  string `json:"mac"`
-			IP   string `json:"ip"`
-			Link string `json:"link"`
-		} `json:"dhcp_ip_address_reservations"`
-
-		DhcpClientsFriendlyNames []struct {
-			Name string `json:"name"`
-			Mac  string `json:"mac"`
-			Link string `json:"link"`
-		} `json:"dhcp_clients_friendly_names"`
-
-		DhcpServer struct {
-			LogDHCP                 bool   `json:"log_requests"`
-			DefaultLease            string `json:"default_lease"`
-			AddressReservationLease string `json:"address_reservation_lease"`
-			ForgetPastClientsAfter  string `json:"forget_past_clients_after"`
-		} `json:"dhcp_server"`
-
-		DhcpPool []struct {
-			Interface string `json:"interface"`
-			Start     string `json:"start"`
-			End       string `json:"end"`
-			Gateway   string `json:"gateway"`
-			Netmask   string `json:"netmask"`
-		} `json:"dhcp_pools"`
-
-		DnsServer struct {
-			Enable    bool   `json:"enable"`
-			DnsDomain string `json:"dns_domain"`
-			Port      int    `json:"port"`
-		} `json:"dns_server"`
-
-		WebUI struct {
-			Log                bool `json:"log_activity"`
-			Port               int  `json:"port"`
-			RefreshIntervalSec int  `json:"refresh_interval_sec"`
-		} `json:"web_ui"`
-	}
+	var cfg addonOptionsJSON
 	err := json.Unmarshal(data, &cfg)
 	if err != nil {
 		return err
 	}
 
 	// convert DHCP IP addresses (strings) to iprange.Pool == []iprange.Range
-	for _, r := range cfg.DhcpPool {
-		dhcpR := ippool.NewRangeFromString(r.Start, r.End)
-		if !dhcpR.IsValid() {
-			return fmt.Errorf("invalid DHCP range %s-%s found in addon config file", r.Start, r.End)
-		}
-
-		// create also the IpNetworkInfo obj associated:
-		ipNetInfo := IpNetworkInfo{
-			Interface: r.Interface,
-			Start:     dhcpR.Start,
-			End:       dhcpR.End,
-			Gateway:   net.ParseIP(r.Gateway),
-		}
-
-		m := net.ParseIP(r.Netmask)
-		if m.To4() != nil {
-			ipNetInfo.Netmask = net.IPMask(m.To4())
-		} else {
-			ipNetInfo.Netmask = net.IPMask(m.To16())
-		}
-
-		// check network definition
-		if !ipNetInfo.HasValidIPs() {
-			// RFC 1918 (IPv4 addresses) and RFC 4193 (IPv6 addresses).
-			return fmt.Errorf("invalid DHCP network/range [%s] found in addon config file: the IP addresses should define a coherent network: a) they should be private IPs only according to RFC 1918 and RFC 4193; b) their start and end IPs must be within the same network", ipNetInfo.String())
-		}
-		if !ipNetInfo.HasValidGateway() {
-			return fmt.Errorf("invalid DHCP network/range [%s] found in addon config file: the gateway must be an IP address within the network defined by the startIP/endIP/netmask parameters", ipNetInfo.String())
+	for i, r := range cfg.DhcpPool {
+		// create also the IpNetworkInfo obj associated, checking the network definition
+		ipNetInfo, errs := resolveDhcpPool(r)
+		if len(errs) > 0 {
+			return fmt.Errorf("invalid DHCP pool dhcp_pools[%d] found in addon config file: %w", i, errs[0])
 		}
 
 		// all good: store the info
-		o.dhcpPool.Ranges = append(o.dhcpPool.Ranges, dhcpR)
+		o.dhcpPool.Ranges = append(o.dhcpPool.Ranges, ipNetInfo.Range())
 		o.dhcpRanges = append(o.dhcpRanges, ipNetInfo)
 	}
 
@@ -207,7 +266,7 @@ func (o *AddonOptions) UnmarshalJSON(data []byte) error {
 
 		var linkTemplate *texttemplate.Template
 		if r.Link != "" {
-			linkTemplate, err = texttemplate.New("linkTemplate").Parse(r.Link)
+			linkTemplate, err = parseLinkTemplate(r.Link)
 			if err != nil {
 				return fmt.Errorf("invalid golang template found inside 'link': %s", r.Link)
 			}
@@ -237,7 +296,7 @@ func (o *AddonOptions) UnmarshalJSON(data []byte) error {
 
 		var linkTemplate *texttemplate.Template
 		if client.Link != "" {
-			linkTemplate, err = texttemplate.New("linkTemplate").Parse(client.Link)
+			linkTemplate, err = parseLinkTemplate(client.Link)
 			if err != nil {
 				return fmt.Errorf("invalid golang template found inside 'link': %s", client.Link)
 			}
@@ -268,5 +327,79 @@ func (o *AddonOptions) UnmarshalJSON(data []byte) error {
 	o.dnsDomain = cfg.DnsServer.DnsDomain
 	o.dnsPort = cfg.DnsServer.Port
 
+	o.rogueDhcpDetectorEnable = cfg.RogueDhcpDetector.Enable
+	o.rogueDhcpProbeInterval = time.Duration(cfg.RogueDhcpDetector.ProbeIntervalSec) * time.Second
+	if o.rogueDhcpProbeInterval <= 0 {
+		o.rogueDhcpProbeInterval = defaultRogueDhcpProbeInterval
+	}
+
+	o.mqttEnable = cfg.Mqtt.Enable
+	if o.mqttEnable && cfg.Mqtt.Broker == "" {
+		return fmt.Errorf("MQTT is enabled but no broker is specified inside 'mqtt.broker'")
+	}
+	o.mqttConfig = mqttpublisher.Config{
+		BrokerURL:       cfg.Mqtt.Broker,
+		Username:        cfg.Mqtt.Username,
+		Password:        cfg.Mqtt.Password,
+		DiscoveryPrefix: cfg.Mqtt.DiscoveryPrefix,
+		TopicPrefix:     cfg.Mqtt.TopicPrefix,
+	}
+	o.mqttPublishInterval = time.Duration(cfg.Mqtt.PublishIntervalSec) * time.Second
+	if o.mqttPublishInterval <= 0 {
+		o.mqttPublishInterval = defaultMqttPublishInterval
+	}
+
+	// convert webhooks, validating their URL, event types and payload template
+	for _, w := range cfg.Webhooks {
+		if !isValidWebhookURL(w.URL) {
+			return fmt.Errorf("invalid URL found inside 'webhooks': %s", w.URL)
+		}
+
+		target := notifier.WebhookTarget{Name: w.Name, URL: w.URL}
+		for _, ev := range w.Events {
+			if !notifier.IsValidEventType(ev) {
+				return fmt.Errorf("invalid event type found inside 'webhooks': %s", ev)
+			}
+			target.Events = append(target.Events, notifier.EventType(ev))
+		}
+		if w.Payload != "" {
+			target.Payload, err = notifier.ParsePayloadTemplate(w.Payload)
+			if err != nil {
+				return fmt.Errorf("invalid golang template found inside 'payload': %s", w.Payload)
+			}
+		}
+		o.webhooks = append(o.webhooks, target)
+	}
+
+	o.homeAssistantEventsEnable = cfg.HomeAssistantEvents.Enable
+	o.leaseImportFile = cfg.LeaseImport.File
+
+	o.poolAlertWarningPercent = cfg.PoolAlerts.WarningPercent
+	if o.poolAlertWarningPercent <= 0 {
+		o.poolAlertWarningPercent = defaultPoolAlertWarningPercent
+	}
+	o.poolAlertCriticalPercent = cfg.PoolAlerts.CriticalPercent
+	if o.poolAlertCriticalPercent <= 0 {
+		o.poolAlertCriticalPercent = defaultPoolAlertCriticalPercent
+	}
+	if o.poolAlertWarningPercent > o.poolAlertCriticalPercent {
+		return fmt.Errorf("the warning threshold inside 'pool_alerts.warning_percent' (%d) must not exceed the critical one (%d)",
+			o.poolAlertWarningPercent, o.poolAlertCriticalPercent)
+	}
+	o.poolAlertHorizon = defaultPoolAlertHorizon
+	if cfg.PoolAlerts.Horizon != "" {
+		o.poolAlertHorizon, err = parseDuration(cfg.PoolAlerts.Horizon)
+		if err != nil || o.poolAlertHorizon < 0 {
+			return fmt.Errorf("invalid time duration found inside 'pool_alerts.exhaustion_horizon': %s", cfg.PoolAlerts.Horizon)
+		}
+	}
+	o.poolAlertTrendWindow = defaultPoolAlertTrendWindow
+	if cfg.PoolAlerts.TrendWindow != "" {
+		o.poolAlertTrendWindow, err = parseDuration(cfg.PoolAlerts.TrendWindow)
+		if err != nil || o.poolAlertTrendWindow <= 0 {
+			return fmt.Errorf("invalid time duration found inside 'pool_alerts.trend_window': %s", cfg.PoolAlerts.TrendWindow)
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,247 @@
+package uibackend
+
+import (
+	"context"
+	"dnsmasq-dhcp-backend/pkg/leasewatcher"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"reflect"
+	"slices"
+	"time"
+)
+
+// OptionsChanges lists the addon options that changed since the addon was started,
+// using the same JSON path notation of ConfigFinding
+type OptionsChanges struct {
+	// Live are the changes already in use by this backend
+	Live []string `json:"live"`
+
+	// RestartRequired are the changes that will be applied only when the addon is restarted;
+	// they mostly affect the dnsmasq configuration, which is generated at startup
+	RestartRequired []string `json:"restart_required"`
+}
+
+// liveOptionPaths lists the addon options that can be changed without restarting the addon.
+// Any setting not listed here is considered to require a restart.
+var liveOptionPaths = []string{
+	"dhcp_clients_friendly_names",
+	"dhcp_server.forget_past_clients_after",
+	"web_ui.log_activity",
+	"web_ui.refresh_interval_sec",
+}
+
+// the message associated to each ConfigFinding about a change that requires a restart
+const restartRequiredMessage = "this setting changed since the addon was started: restart the addon to apply the change"
+
+// diffAddonOptions compares 2 versions of the addon options file and classifies the settings
+// that differ between them
+func diffAddonOptions(oldData, newData []byte) (OptionsChanges, error) {
+	var oldCfg, newCfg map[string]any
+	if err := json.Unmarshal(oldData, &oldCfg); err != nil {
+		return OptionsChanges{}, err
+	}
+	if err := json.Unmarshal(newData, &newCfg); err != nil {
+		return OptionsChanges{}, err
+	}
+
+	changes := OptionsChanges{Live: []string{}, RestartRequired: []string{}}
+	addChange := func(path string) {
+		if slices.Contains(liveOptionPaths, path) {
+			changes.Live = append(changes.Live, path)
+		} else {
+			changes.RestartRequired = append(changes.RestartRequired, path)
+		}
+	}
+
+	for _, key := range sortedUnionOfKeys(oldCfg, newCfg) {
+		oldValue, newValue := oldCfg[key], newCfg[key]
+		if reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+
+		switch key {
+		case "dhcp_server", "web_ui":
+			// only some of the nested settings can be changed live
+			oldObj, _ := oldValue.(map[string]any)
+			newObj, _ := newValue.(map[string]any)
+			for _, subkey := range sortedUnionOfKeys(oldObj, newObj) {
+				if !reflect.DeepEqual(oldObj[subkey], newObj[subkey]) {
+					addChange(key + "." + subkey)
+				}
+			}
+
+		case "dhcp_ip_address_reservations":
+			// the links are used only by the web UI, everything else is passed to dnsmasq
+			oldList, _ := oldValue.([]any)
+			newList, _ := newValue.([]any)
+			if len(oldList) != len(newList) {
+				addChange(key)
+				continue
+			}
+			linksOnly := true
+			var linkPaths []string
+			for i := range oldList {
+				oldEntry, _ := oldList[i].(map[string]any)
+				newEntry, _ := newList[i].(map[string]any)
+				if reflect.DeepEqual(oldEntry, newEntry) {
+					continue
+				}
+				if !reflect.DeepEqual(withoutKey(oldEntry, "link"), withoutKey(newEntry, "link")) {
+					linksOnly = false
+					break
+				}
+				linkPaths = append(linkPaths, fmt.Sprintf("%s[%d].link", key, i))
+			}
+			if linksOnly {
+				changes.Live = append(changes.Live, linkPaths...)
+			} else {
+				addChange(key)
+			}
+
+		default:
+			addChange(key)
+		}
+	}
+	return changes, nil
+}
+
+// sortedUnionOfKeys returns the keys present in at least one of the 2 maps, sorted alphabetically
+func sortedUnionOfKeys(a, b map[string]any) []string {
+	keys := slices.Collect(maps.Keys(a))
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// withoutKey returns a copy of the given map without the given key
+func withoutKey(m map[string]any, key string) map[string]any {
+	c := maps.Clone(m)
+	delete(c, key)
+	return c
+}
+
+// withLiveSettings returns a copy of the current addon options where all settings that
+// can be changed without restarting the addon are taken from the new addon options
+func withLiveSettings(current, next *AddonOptions, changes OptionsChanges) *AddonOptions {
+	merged := *current
+	merged.friendlyNames = next.friendlyNames
+	merged.forgetPastClientsAfter = next.forgetPastClientsAfter
+	merged.logWebUI = next.logWebUI
+	merged.webUIRefreshInterval = next.webUIRefreshInterval
+	if !slices.Contains(changes.RestartRequired, "dhcp_ip_address_reservations") {
+		// at most the links of the IP address reservations have changed
+		merged.ipAddressReservationsByIP = next.ipAddressReservationsByIP
+		merged.ipAddressReservationsByMAC = next.ipAddressReservationsByMAC
+	}
+	return &merged
+}
+
+// reloadAddonOptions reads again the addon options file and puts in use the settings that
+// can be changed without restarting the addon. The settings requiring a restart keep the value
+// they had at startup and are reported as warnings in the web UI.
+func (b *UIBackend) reloadAddonOptions() (OptionsChanges, error) {
+	b.optionsLock.Lock()
+	defer b.optionsLock.Unlock()
+
+	data, err := os.ReadFile(defaultHomeAssistantOptionsFile)
+	if err != nil {
+		return OptionsChanges{}, err
+	}
+	next, err := parseAddonOptions(data)
+	if err != nil {
+		return OptionsChanges{}, fmt.Errorf("invalid addon options, keeping the current ones: %w", err)
+	}
+	changes, err := diffAddonOptions(b.startupOptionsData, data)
+	if err != nil {
+		return OptionsChanges{}, err
+	}
+
+	b.options.Store(withRuntimeReservations(withLiveSettings(b.startupOptions, next, changes), b.runtimeReservations))
+
+	findings := LintAddonOptions(data)
+	for _, path := range changes.RestartRequired {
+		findings = append(findings, ConfigFinding{Path: path, Severity: ConfigFindingWarning, Message: restartRequiredMessage})
+	}
+	b.configFindings = findings
+	b.optionsChanges = changes
+
+	b.logger.Infof("Reloaded addon options: %d changes applied live %v, %d changes requiring an addon restart %v\n",
+		len(changes.Live), changes.Live, len(changes.RestartRequired), changes.RestartRequired)
+	return changes, nil
+}
+
+// getConfigFindings returns the issues found in the addon options, including the changes requiring a restart
+func (b *UIBackend) getConfigFindings() []ConfigFinding {
+	b.optionsLock.Lock()
+	defer b.optionsLock.Unlock()
+	return b.configFindings
+}
+
+// getOptionsChanges returns the changes to the addon options since the addon was started
+func (b *UIBackend) getOptionsChanges() OptionsChanges {
+	b.optionsLock.Lock()
+	defer b.optionsLock.Unlock()
+	return b.optionsChanges
+}
+
+// TriggerOptionsReload requests the addon options file to be read again; it never blocks.
+// The reload is performed by the goroutine processing the DHCP lease updates, so that the
+// current DHCP clients get re-evaluated with the new options.
+func (b *UIBackend) TriggerOptionsReload() {
+	select {
+	case b.reloadOptionsCh <- struct{}{}:
+	default:
+		// a reload is already pending
+	}
+}
+
+// getCurrentLeases returns the DHCP leases of the current DHCP clients
+func (b *UIBackend) getCurrentLeases() []*leasewatcher.Lease {
+	b.dhcpClientDataLock.Lock()
+	defer b.dhcpClientDataLock.Unlock()
+
+	leases := make([]*leasewatcher.Lease, 0, len(b.dhcpClientData))
+	for _, d := range b.dhcpClientData {
+		lease := d.Lease
+		leases = append(leases, &lease)
+		for _, l := range d.IPv6Leases {
+			leases = append(leases, &l)
+		}
+	}
+	return leases
+}
+
+// watchAddonOptions requests a reload of the addon options every time the addon options file
+// is modified, until the context is cancelled
+func (b *UIBackend) watchAddonOptions(ctx context.Context) {
+	ticker := time.NewTicker(optionsCheckInterval)
+	defer ticker.Stop()
+
+	last, _ := os.Stat(defaultHomeAssistantOptionsFile)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		fi, err := os.Stat(defaultHomeAssistantOptionsFile)
+		if err != nil {
+			// the file might be in the middle of being rewritten; try again later
+			continue
+		}
+		if last != nil && fi.ModTime().Equal(last.ModTime()) && fi.Size() == last.Size() {
+			continue
+		}
+		last = fi
+
+		b.logger.Infof("Detected a change to the addon options file '%s'\n", defaultHomeAssistantOptionsFile)
+		b.TriggerOptionsReload()
+	}
+}
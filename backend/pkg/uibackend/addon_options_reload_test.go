@@ -0,0 +1,140 @@
+package uibackend
+
+import (
+	"context"
+	"dnsmasq-dhcp-backend/pkg/logger"
+	"dnsmasq-dhcp-backend/pkg/trackerdb"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffAddonOptions(t *testing.T) {
+	base := `{
+		"dhcp_ip_address_reservations": [ { "mac": "aa:bb:cc:dd:ee:00", "name": "host", "ip": "192.168.1.15", "link": "https://{{ .ip }}" } ],
+		"dhcp_clients_friendly_names": [ { "mac": "aa:bb:cc:dd:ee:01", "name": "laptop" } ],
+		"dhcp_server": { "default_lease": "12h", "forget_past_clients_after": "1w" },
+		"dhcp_pools": [ { "interface": "eth0", "start": "192.168.1.50", "end": "192.168.1.100" } ],
+		"web_ui": { "port": 8976, "refresh_interval_sec": 5 }
+	}`
+
+	tests := []struct {
+		name     string
+		replace  []string // pairs of old/new substrings of the base options
+		expected OptionsChanges
+	}{
+		{
+			name:     "no changes",
+			expected: OptionsChanges{Live: []string{}, RestartRequired: []string{}},
+		},
+		{
+			name:    "live changes",
+			replace: []string{`"laptop"`, `"work laptop"`, `"refresh_interval_sec": 5`, `"refresh_interval_sec": 10`, `"1w"`, `"2w"`},
+			expected: OptionsChanges{
+				Live:            []string{"dhcp_clients_friendly_names", "dhcp_server.forget_past_clients_after", "web_ui.refresh_interval_sec"},
+				RestartRequired: []string{},
+			},
+		},
+		{
+			name:    "only the link of a reservation",
+			replace: []string{`"https://{{ .ip }}"`, `"http://{{ .ip }}:8080"`},
+			expected: OptionsChanges{
+				Live:            []string{"dhcp_ip_address_reservations[0].link"},
+				RestartRequired: []string{},
+			},
+		},
+		{
+			name:    "restart required",
+			replace: []string{`"192.168.1.15"`, `"192.168.1.16"`, `"192.168.1.100"`, `"192.168.1.120"`, `"12h"`, `"1d"`, `"port": 8976`, `"port": 8977`},
+			expected: OptionsChanges{
+				Live:            []string{},
+				RestartRequired: []string{"dhcp_ip_address_reservations", "dhcp_pools", "dhcp_server.default_lease", "web_ui.port"},
+			},
+		},
+		{
+			name:    "new setting",
+			replace: []string{`"dhcp_pools"`, `"mqtt": { "enable": true }, "dhcp_pools"`},
+			expected: OptionsChanges{
+				Live:            []string{},
+				RestartRequired: []string{"mqtt"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modified := strings.NewReplacer(tt.replace...).Replace(base)
+			changes, err := diffAddonOptions([]byte(base), []byte(modified))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, changes)
+		})
+	}
+}
+
+func TestDiffAddonOptions_InvalidJSON(t *testing.T) {
+	_, err := diffAddonOptions([]byte(`{}`), []byte(`{`))
+	assert.Error(t, err)
+}
+
+func TestReloadAddonOptions(t *testing.T) {
+	original, err := os.ReadFile("../../../test-options.json")
+	require.NoError(t, err)
+
+	optionsFile := t.TempDir() + "/options.json"
+	require.NoError(t, os.WriteFile(optionsFile, original, 0o600))
+	leaseFile := t.TempDir() + "/dnsmasq.leases"
+	require.NoError(t, os.WriteFile(leaseFile, []byte("0 4c:50:77:cf:3c:35 192.168.1.60 laptop *\n"), 0o600))
+
+	savedVars := []string{defaultHomeAssistantOptionsFile, defaultDnsmasqLeasesFile}
+	defaultHomeAssistantOptionsFile = optionsFile
+	defaultDnsmasqLeasesFile = leaseFile
+	t.Cleanup(func() {
+		defaultHomeAssistantOptionsFile, defaultDnsmasqLeasesFile = savedVars[0], savedVars[1]
+	})
+
+	backend := newUIBackend(logger.NewCustomLogger("unit tests"), trackerdb.NewTestDB(), 1)
+	require.NoError(t, backend.readAddonOptions())
+	require.NoError(t, backend.readCurrentLeaseFile())
+	require.Equal(t, "a human-friendly name for a DHCP client with dynamic IP", backend.getCurrentClients()[0].FriendlyName)
+
+	// change a friendly name, which is applied live, and a DHCP range, which requires a restart
+	modified := strings.NewReplacer(
+		"a human-friendly name for a DHCP client with dynamic IP", "laptop",
+		`"refresh_interval_sec": 5`, `"refresh_interval_sec": 30`,
+		`"end": "192.168.1.100"`, `"end": "192.168.1.200"`,
+	).Replace(string(original))
+	require.NoError(t, os.WriteFile(optionsFile, []byte(modified), 0o600))
+
+	// the reload is performed by the goroutine processing the DHCP lease updates, which then
+	// notifies the WebSocket clients
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go backend.processLeaseUpdates(ctx)
+	backend.TriggerOptionsReload()
+	select {
+	case <-backend.broadcastCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the reload of the addon options did not trigger a broadcast")
+	}
+
+	assert.Equal(t, "laptop", backend.getCurrentClients()[0].FriendlyName)
+	assert.Equal(t, 30*time.Second, backend.opts().webUIRefreshInterval)
+	assert.Equal(t, "192.168.1.100", backend.opts().dhcpRanges[0].End.String(), "the DHCP ranges must not change until a restart")
+
+	assert.Equal(t, OptionsChanges{
+		Live:            []string{"dhcp_clients_friendly_names", "web_ui.refresh_interval_sec"},
+		RestartRequired: []string{"dhcp_pools"},
+	}, backend.getOptionsChanges())
+	assert.Contains(t, backend.getConfigFindings(),
+		ConfigFinding{Path: "dhcp_pools", Severity: ConfigFindingWarning, Message: restartRequiredMessage})
+
+	// invalid options are ignored
+	require.NoError(t, os.WriteFile(optionsFile, []byte(`{"web_ui": {"port": 0}}`), 0o600))
+	_, err = backend.reloadAddonOptions()
+	assert.Error(t, err)
+	assert.Equal(t, "laptop", backend.getCurrentClients()[0].FriendlyName)
+}
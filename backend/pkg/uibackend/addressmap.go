@@ -0,0 +1,66 @@
+package uibackend
+
+import (
+	"dnsmasq-dhcp-backend/pkg/ippool"
+	"net"
+	"net/netip"
+	"time"
+)
+
+// addressOwner is the DHCP client using, or entitled to use, an IP address of the address map
+type addressOwner struct {
+	mac  net.HardwareAddr
+	name string
+}
+
+// networkAddresses collects the IP addresses of the given network known to the DHCP server: the DHCP ranges,
+// the IP address reservations, the current DHCP clients and the past DHCP clients recorded in the tracker DB
+// which were last seen after seenSince (all of them if seenSince is zero).
+// It also returns the owner of each IP address which is reserved, leased or was used in the past.
+func (b *UIBackend) networkAddresses(nw IpNetworkInfo, currentClients []DhcpClientData, seenSince time.Time) (ippool.NetworkAddresses, map[netip.Addr]addressOwner) {
+	opts := b.opts()
+	n := ippool.NetworkAddresses{
+		Network: nw.Network,
+		Gateway: nw.Gateway,
+		Pool:    opts.dhcpPool,
+	}
+	owners := make(map[netip.Addr]addressOwner)
+
+	// the past DHCP clients have the lowest precedence, the IP address reservations the highest one
+	for _, c := range b.getPastClients(currentClients) {
+		if c.PastInfo.LastSeen.Before(seenSince) {
+			continue
+		}
+		if ip := c.PastInfo.LastIP.Unmap(); nw.ContainsInNetwork(ip) {
+			n.Seen = append(n.Seen, ip)
+			name := c.FriendlyName
+			if name == "N/A" {
+				// placeholder used by getPastClients for the web UI
+				name = ""
+			}
+			owners[ip] = addressOwner{mac: c.PastInfo.MacAddr, name: name}
+		}
+	}
+	for _, c := range currentClients {
+		for _, ip := range c.IPAddrs() {
+			if nw.ContainsInNetwork(ip) {
+				n.Leased = append(n.Leased, ip)
+				owners[ip.Unmap()] = addressOwner{mac: c.Lease.MacAddr, name: c.FriendlyName}
+			}
+		}
+	}
+	for ip, r := range opts.ipAddressReservationsByIP {
+		if nw.ContainsInNetwork(ip) {
+			n.Reserved = append(n.Reserved, ip)
+			owners[ip] = addressOwner{mac: r.Mac, name: r.Name}
+		}
+	}
+	return n, owners
+}
+
+// getAddressMap classifies up to maxAddresses IP addresses of the given network, starting from the IP
+// address "from" (or from the first IP address of the network if invalid); see networkAddresses.
+func (b *UIBackend) getAddressMap(nw IpNetworkInfo, currentClients []DhcpClientData, from netip.Addr, maxAddresses int) (ippool.AddressMap, map[netip.Addr]addressOwner) {
+	n, owners := b.networkAddresses(nw, currentClients, time.Time{})
+	return ippool.ClassifyNetwork(n, from, maxAddresses), owners
+}
@@ -0,0 +1,1111 @@
+package uibackend
+
+import (
+	"bytes"
+	"dnsmasq-dhcp-backend/pkg/dhcpimport"
+	"dnsmasq-dhcp-backend/pkg/ippool"
+	"dnsmasq-dhcp-backend/pkg/roguedhcp"
+	"dnsmasq-dhcp-backend/pkg/trackerdb"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The OpenAPI document describing the REST API served under apiV1Prefix.
+// It is written in YAML since that's much easier to maintain by hand; a JSON
+// rendering of the same document is provided too.
+//
+//go:embed openapi.yaml
+var openAPIDocYAML []byte
+
+// ApiErrorResponse is the body returned by the REST API for any non-2xx answer
+type ApiErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// ApiPage wraps a (possibly filtered and sorted) page of results returned by the REST API
+type ApiPage[T any] struct {
+	// Total is the number of items matching the filters, before pagination is applied
+	Total  int `json:"total"`
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+	Items  []T `json:"items"`
+}
+
+// ApiClientTimeline is returned by the /clients/timeline/{mac} endpoint
+type ApiClientTimeline struct {
+	MacAddr string                `json:"mac_addr"`
+	Events  []trackerdb.DhcpEvent `json:"events"`
+}
+
+// ApiPoolInfo describes a single DHCP range, as configured in the "dhcp_pools" option
+type ApiPoolInfo struct {
+	Index     int    `json:"index"`
+	Interface string `json:"interface"`
+	Start     string `json:"start"`
+	End       string `json:"end"`
+	Gateway   string `json:"gateway"`
+	Netmask   string `json:"netmask"`
+	Size      int64  `json:"size"`
+
+	// utilization counters computed on the current DHCP clients and IP address reservations
+	Used         int64   `json:"used"`
+	Reserved     int64   `json:"reserved"`
+	Free         int64   `json:"free"`
+	UsagePercent float64 `json:"usage_percent"`
+
+	// Alert tells whether the DHCP range is running out of free IP addresses
+	Alert DhcpRangeAlert `json:"alert"`
+}
+
+// ApiPoolsSummary is returned by the /pools endpoint
+type ApiPoolsSummary struct {
+	Pools []ApiPoolInfo `json:"pools"`
+
+	// TotalSize is the number of IP addresses in all DHCP ranges, or -1 if too large to be represented
+	TotalSize int64 `json:"total_size"`
+
+	DefaultLease            string `json:"default_lease"`
+	AddressReservationLease string `json:"address_reservation_lease"`
+
+	// counters computed on the current DHCP clients
+	CurrentClients         int `json:"current_clients"`
+	CurrentClientsInPool   int `json:"current_clients_in_pool"`
+	CurrentClientsStaticIP int `json:"current_clients_with_static_ip"`
+}
+
+// ApiAddressInfo is a single IP address of an ApiAddressMap
+type ApiAddressInfo struct {
+	IPAddr string              `json:"ip_addr"`
+	Class  ippool.AddressClass `json:"class"`
+
+	// the DHCP client the IP address is reserved for, leased to or was used by in the past, if any
+	MacAddr string `json:"mac_addr,omitempty"`
+	Name    string `json:"name,omitempty"`
+}
+
+// ApiAddressMap is returned by the /pools/{index}/addresses endpoint: it classifies the consecutive
+// IP addresses of the network of a DHCP range, e.g. to draw them as a heat-map grid
+type ApiAddressMap struct {
+	Index     int    `json:"index"`
+	Interface string `json:"interface"`
+	Network   string `json:"network"`
+	Gateway   string `json:"gateway"`
+
+	// Counts is the number of Addresses for each class
+	Counts    map[ippool.AddressClass]int64 `json:"counts"`
+	Addresses []ApiAddressInfo              `json:"addresses"`
+
+	// Next is the value of the "from" parameter returning the following IP addresses of the network,
+	// or empty if the network has no more IP addresses
+	Next string `json:"next,omitempty"`
+}
+
+// ApiAddressSuggestions is returned by the /pools/{index}/suggestions endpoint: the free IP addresses
+// of the network of a DHCP range that can be used for new IP address reservations
+type ApiAddressSuggestions struct {
+	Index     int      `json:"index"`
+	Interface string   `json:"interface"`
+	Network   string   `json:"network"`
+	Addresses []string `json:"addresses"`
+}
+
+// ApiDnsSummary is returned by the /dns endpoint
+type ApiDnsSummary struct {
+	Enabled bool   `json:"enabled"`
+	Domain  string `json:"domain"`
+	Port    int    `json:"port"`
+
+	// StatsAvailable is false when dnsmasq could not be queried for its metrics
+	StatsAvailable bool           `json:"stats_available"`
+	Stats          DnsServerStats `json:"stats"`
+}
+
+// ApiRogueServersSummary is returned by the /rogue-servers endpoint
+type ApiRogueServersSummary struct {
+	Enabled          bool                    `json:"enabled"`
+	ProbeIntervalSec int                     `json:"probe_interval_sec"`
+	Servers          []roguedhcp.RogueServer `json:"servers"`
+}
+
+// ApiClientMetadata is the friendly name, note and link of a DHCP client edited from the web UI;
+// it's returned by the /clients/metadata endpoints
+type ApiClientMetadata struct {
+	MacAddr      string `json:"mac_addr"`
+	FriendlyName string `json:"friendly_name"`
+	Note         string `json:"note"`
+	Link         string `json:"link"`
+	UpdatedAt    int64  `json:"updated_at"`
+
+	// OverriddenByOptions lists the fields that are ignored because the addon options provide
+	// the same information, which takes precedence
+	OverriddenByOptions []string `json:"overridden_by_options"`
+}
+
+// apiClientMetadataUpdate is the body accepted by the PUT /clients/metadata/{mac} endpoint
+type apiClientMetadataUpdate struct {
+	FriendlyName string `json:"friendly_name"`
+	Note         string `json:"note"`
+	Link         string `json:"link"`
+}
+
+// ApiReservation is an IP address reservation; it's returned by the /reservations endpoints
+type ApiReservation struct {
+	MacAddr string `json:"mac_addr"`
+	IPAddr  string `json:"ip_addr"`
+	Name    string `json:"name"`
+
+	// Source is "options" for the reservations of the addon options, which can be changed only by
+	// editing the addon configuration, and "runtime" for the ones created from the web UI
+	Source string `json:"source"`
+}
+
+// apiImportRequest is the body accepted by the POST /import endpoint
+type apiImportRequest struct {
+	Config string `json:"config"`
+}
+
+// apiReservationUpdate is the body accepted by the PUT /reservations/{mac} endpoint
+type apiReservationUpdate struct {
+	IPAddr string `json:"ip_addr"`
+	Name   string `json:"name"`
+}
+
+// apiReservationCreate is the body accepted by the POST /reservations endpoint
+type apiReservationCreate struct {
+	MacAddr string `json:"mac_addr"`
+	apiReservationUpdate
+}
+
+// ApiOptionsStatus is returned by the /options endpoint
+type ApiOptionsStatus struct {
+	// Findings are the issues found in the addon options, including the changes that require a restart
+	Findings []ConfigFinding `json:"findings"`
+	Changes  OptionsChanges  `json:"changes"`
+}
+
+// ApiImportedHost is an IP address reservation or a friendly name imported from another DHCP server
+type ApiImportedHost struct {
+	MacAddr string `json:"mac_addr"`
+	IPAddr  string `json:"ip_addr,omitempty"`
+	Name    string `json:"name"`
+}
+
+// ApiImportPreview is returned by the /import endpoint
+type ApiImportPreview struct {
+	Reservations  []ApiImportedHost `json:"reservations"`
+	FriendlyNames []ApiImportedHost `json:"friendly_names"`
+
+	// Findings are the issues found in the imported configuration; their path is the location
+	// inside the imported configuration, e.g. "line 12"
+	Findings []ConfigFinding `json:"findings"`
+
+	// YAML has the imported reservations and friendly names, ready to be pasted in the addon configuration
+	YAML string `json:"yaml"`
+}
+
+// apiClientFilter holds all the filtering/sorting/pagination parameters accepted by the
+// endpoints listing DHCP clients
+type apiClientFilter struct {
+	pool      *IpNetworkInfo // filter on the DHCP range
+	iface     string         // filter on the network interface
+	static    *bool          // filter on static/dynamic clients
+	random    *bool          // filter on clients using a randomized MAC address
+	hostname  string         // case-insensitive substring of the hostname
+	sortField string
+	sortDesc  bool
+	offset    int
+	limit     int
+}
+
+// writeJSON serializes the given value as the body of the HTTP response
+func (b *UIBackend) writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		b.logger.Warnf("failed to write JSON response: %s", err.Error())
+	}
+}
+
+// writeAPIError emits an ApiErrorResponse with the given HTTP status
+func (b *UIBackend) writeAPIError(w http.ResponseWriter, status int, format string, v ...any) {
+	b.writeJSON(w, status, ApiErrorResponse{Error: fmt.Sprintf(format, v...)})
+}
+
+// parseClientFilter parses the query string of the client-listing endpoints;
+// sortFields is the list of allowed values for the "sort" parameter
+func (b *UIBackend) parseClientFilter(r *http.Request, sortFields []string) (apiClientFilter, error) {
+	q := r.URL.Query()
+	f := apiClientFilter{
+		hostname:  strings.ToLower(q.Get("hostname")),
+		iface:     q.Get("interface"),
+		sortField: sortFields[0],
+		limit:     apiDefaultPageLimit,
+	}
+
+	if poolStr := q.Get("pool"); poolStr != "" {
+		idx, err := strconv.Atoi(poolStr)
+		if err != nil || idx < 0 || idx >= len(b.opts().dhcpRanges) {
+			return f, fmt.Errorf("invalid 'pool' parameter %q: expecting an index between 0 and %d", poolStr, len(b.opts().dhcpRanges)-1)
+		}
+		f.pool = &b.opts().dhcpRanges[idx]
+	}
+
+	if staticStr := q.Get("static"); staticStr != "" {
+		static, err := strconv.ParseBool(staticStr)
+		if err != nil {
+			return f, fmt.Errorf("invalid 'static' parameter %q: expecting true or false", staticStr)
+		}
+		f.static = &static
+	}
+
+	if randomStr := q.Get("randomized"); randomStr != "" {
+		random, err := strconv.ParseBool(randomStr)
+		if err != nil {
+			return f, fmt.Errorf("invalid 'randomized' parameter %q: expecting true or false", randomStr)
+		}
+		f.random = &random
+	}
+
+	if sortStr := q.Get("sort"); sortStr != "" {
+		f.sortDesc = strings.HasPrefix(sortStr, "-")
+		f.sortField = strings.TrimPrefix(sortStr, "-")
+		if !slices.Contains(sortFields, f.sortField) {
+			return f, fmt.Errorf("invalid 'sort' parameter %q: allowed fields are %s", sortStr, strings.Join(sortFields, ", "))
+		}
+	}
+
+	var err error
+	if offsetStr := q.Get("offset"); offsetStr != "" {
+		f.offset, err = strconv.Atoi(offsetStr)
+		if err != nil || f.offset < 0 {
+			return f, fmt.Errorf("invalid 'offset' parameter %q", offsetStr)
+		}
+	}
+	if limitStr := q.Get("limit"); limitStr != "" {
+		f.limit, err = strconv.Atoi(limitStr)
+		if err != nil || f.limit <= 0 || f.limit > apiMaxPageLimit {
+			return f, fmt.Errorf("invalid 'limit' parameter %q: expecting a value between 1 and %d", limitStr, apiMaxPageLimit)
+		}
+	}
+
+	return f, nil
+}
+
+// matchesNetwork checks the "pool" and "interface" filters against the given IP
+func (b *UIBackend) matchesNetwork(f apiClientFilter, ip netip.Addr) bool {
+	if f.pool != nil && !f.pool.ContainsInRange(ip) {
+		return false
+	}
+	if f.iface != "" {
+		for _, n := range b.opts().dhcpRanges {
+			if n.Interface == f.iface && n.ContainsInNetwork(ip) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// paginate applies the offset/limit parameters of the filter to the given slice
+func paginate[T any](f apiClientFilter, items []T) ApiPage[T] {
+	page := ApiPage[T]{
+		Total:  len(items),
+		Offset: f.offset,
+		Limit:  f.limit,
+		Items:  []T{}, // never return a null list
+	}
+	if f.offset < len(items) {
+		end := min(f.offset+f.limit, len(items))
+		page.Items = items[f.offset:end]
+	}
+	return page
+}
+
+// sortWithDirection sorts the slice in ascending or descending order based on the filter
+func sortWithDirection[T any](f apiClientFilter, items []T, cmpFunc func(a, b T) int) {
+	slices.SortStableFunc(items, func(a, b T) int {
+		if f.sortDesc {
+			return cmpFunc(b, a)
+		}
+		return cmpFunc(a, b)
+	})
+}
+
+// handleApiCurrentClients lists current DHCP clients
+func (b *UIBackend) handleApiCurrentClients(w http.ResponseWriter, r *http.Request) {
+	f, err := b.parseClientFilter(r, []string{"ip", "mac", "hostname", "friendly_name", "vendor", "expires"})
+	if err != nil {
+		b.writeAPIError(w, http.StatusBadRequest, "%s", err.Error())
+		return
+	}
+
+	filtered := make([]DhcpClientData, 0)
+	for _, c := range b.getCurrentClients() {
+		if !slices.ContainsFunc(c.IPAddrs(), func(ip netip.Addr) bool { return b.matchesNetwork(f, ip) }) {
+			continue
+		}
+		if f.static != nil && *f.static != c.HasStaticIP {
+			continue
+		}
+		if f.random != nil && *f.random != c.IsRandomizedMac {
+			continue
+		}
+		if f.hostname != "" && !strings.Contains(strings.ToLower(c.Lease.Hostname), f.hostname) {
+			continue
+		}
+		filtered = append(filtered, c)
+	}
+
+	sortWithDirection(f, filtered, func(a, b DhcpClientData) int {
+		switch f.sortField {
+		case "mac":
+			return strings.Compare(a.Lease.MacAddr.String(), b.Lease.MacAddr.String())
+		case "hostname":
+			return strings.Compare(a.Lease.Hostname, b.Lease.Hostname)
+		case "friendly_name":
+			return strings.Compare(a.FriendlyName, b.FriendlyName)
+		case "vendor":
+			return strings.Compare(a.Vendor, b.Vendor)
+		case "expires":
+			return a.Lease.Expires.Compare(b.Lease.Expires)
+		default:
+			return a.Lease.IPAddr.Compare(b.Lease.IPAddr)
+		}
+	})
+
+	b.writeJSON(w, http.StatusOK, paginate(f, filtered))
+}
+
+// handleApiPastClients lists past DHCP clients, i.e. those tracked in the tracker DB that
+// are not currently holding a lease
+func (b *UIBackend) handleApiPastClients(w http.ResponseWriter, r *http.Request) {
+	f, err := b.parseClientFilter(r, []string{"last_seen", "mac", "hostname", "friendly_name", "vendor"})
+	if err != nil {
+		b.writeAPIError(w, http.StatusBadRequest, "%s", err.Error())
+		return
+	}
+	if f.pool != nil || f.iface != "" {
+		// the tracker DB does not store the IP address of past clients
+		b.writeAPIError(w, http.StatusBadRequest, "the 'pool' and 'interface' filters are not supported for past clients")
+		return
+	}
+
+	filtered := make([]PastDhcpClientData, 0)
+	for _, c := range b.getPastClients(b.getCurrentClients()) {
+		if f.static != nil && *f.static != c.HasStaticIP {
+			continue
+		}
+		if f.random != nil && *f.random != c.IsRandomizedMac {
+			continue
+		}
+		if f.hostname != "" && !strings.Contains(strings.ToLower(c.PastInfo.Hostname), f.hostname) {
+			continue
+		}
+		filtered = append(filtered, c)
+	}
+
+	sortWithDirection(f, filtered, func(a, b PastDhcpClientData) int {
+		switch f.sortField {
+		case "mac":
+			return strings.Compare(a.PastInfo.MacAddr.String(), b.PastInfo.MacAddr.String())
+		case "hostname":
+			return strings.Compare(a.PastInfo.Hostname, b.PastInfo.Hostname)
+		case "friendly_name":
+			return strings.Compare(a.FriendlyName, b.FriendlyName)
+		case "vendor":
+			return strings.Compare(a.Vendor, b.Vendor)
+		default:
+			return a.PastInfo.LastSeen.Compare(b.PastInfo.LastSeen)
+		}
+	})
+
+	b.writeJSON(w, http.StatusOK, paginate(f, filtered))
+}
+
+// handleApiCurrentClient returns a single current DHCP client, identified by MAC or IP address
+func (b *UIBackend) handleApiCurrentClient(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	mac, errMac := net.ParseMAC(id)
+	ip, errIP := netip.ParseAddr(id)
+	if errMac != nil && errIP != nil {
+		b.writeAPIError(w, http.StatusBadRequest, "%q is neither a valid MAC address nor a valid IP address", id)
+		return
+	}
+
+	for _, c := range b.getCurrentClients() {
+		if (errMac == nil && c.Lease.MacAddr.String() == mac.String()) ||
+			(errIP == nil && slices.Contains(c.IPAddrs(), ip)) {
+			b.writeJSON(w, http.StatusOK, c)
+			return
+		}
+	}
+
+	b.writeAPIError(w, http.StatusNotFound, "no current DHCP client matches %q", id)
+}
+
+// handleApiPastClient returns a single past DHCP client, identified by MAC address
+func (b *UIBackend) handleApiPastClient(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("mac")
+
+	mac, err := net.ParseMAC(id)
+	if err != nil {
+		b.writeAPIError(w, http.StatusBadRequest, "%q is not a valid MAC address", id)
+		return
+	}
+
+	for _, c := range b.getPastClients(b.getCurrentClients()) {
+		if c.PastInfo.MacAddr.String() == mac.String() {
+			b.writeJSON(w, http.StatusOK, c)
+			return
+		}
+	}
+
+	b.writeAPIError(w, http.StatusNotFound, "no past DHCP client matches %q", id)
+}
+
+// handleApiClientTimeline returns the history of events recorded for a DHCP client, most recent first
+func (b *UIBackend) handleApiClientTimeline(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("mac")
+
+	mac, err := net.ParseMAC(id)
+	if err != nil {
+		b.writeAPIError(w, http.StatusBadRequest, "%q is not a valid MAC address", id)
+		return
+	}
+
+	limit := apiDefaultPageLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 || limit > apiMaxPageLimit {
+			b.writeAPIError(w, http.StatusBadRequest, "invalid 'limit' parameter %q: expecting a value between 1 and %d", limitStr, apiMaxPageLimit)
+			return
+		}
+	}
+
+	events, err := b.trackerDB.GetDhcpClientTimeline(mac, limit)
+	if err != nil {
+		b.writeAPIError(w, http.StatusInternalServerError, "failed to query the tracker DB: %s", err.Error())
+		return
+	}
+
+	b.writeJSON(w, http.StatusOK, ApiClientTimeline{
+		MacAddr: mac.String(),
+		Events:  events,
+	})
+}
+
+// toApiClientMetadata converts the metadata of a DHCP client to its REST API representation
+func (b *UIBackend) toApiClientMetadata(m trackerdb.DhcpClientMetadata) ApiClientMetadata {
+	updatedAt := int64(0)
+	if !m.UpdatedAt.IsZero() {
+		updatedAt = m.UpdatedAt.Unix()
+	}
+	return ApiClientMetadata{
+		MacAddr:             m.MacAddr.String(),
+		FriendlyName:        m.FriendlyName,
+		Note:                m.Note,
+		Link:                m.Link,
+		UpdatedAt:           updatedAt,
+		OverriddenByOptions: b.overriddenMetadataFields(m.MacAddr),
+	}
+}
+
+// handleApiAllClientMetadata returns the metadata of all DHCP clients edited from the web UI
+func (b *UIBackend) handleApiAllClientMetadata(w http.ResponseWriter, r *http.Request) {
+	all, err := b.trackerDB.GetAllDhcpClientMetadata()
+	if err != nil {
+		b.writeAPIError(w, http.StatusInternalServerError, "failed to query the tracker DB: %s", err.Error())
+		return
+	}
+
+	items := make([]ApiClientMetadata, 0, len(all))
+	for _, m := range all {
+		items = append(items, b.toApiClientMetadata(m))
+	}
+	b.writeJSON(w, http.StatusOK, items)
+}
+
+// handleApiClientMetadata returns the metadata of a DHCP client edited from the web UI; they are
+// all empty if the DHCP client was never edited
+func (b *UIBackend) handleApiClientMetadata(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("mac")
+
+	mac, err := net.ParseMAC(id)
+	if err != nil {
+		b.writeAPIError(w, http.StatusBadRequest, "%q is not a valid MAC address", id)
+		return
+	}
+
+	m := trackerdb.DhcpClientMetadata{MacAddr: mac}
+	if stored, ok := b.getClientMetadata(mac); ok {
+		m = stored.DhcpClientMetadata
+	}
+	b.writeJSON(w, http.StatusOK, b.toApiClientMetadata(m))
+}
+
+// handleApiUpdateClientMetadata replaces the metadata of a DHCP client; setting all of them to
+// an empty string is equivalent to deleting them
+func (b *UIBackend) handleApiUpdateClientMetadata(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("mac")
+
+	mac, err := net.ParseMAC(id)
+	if err != nil {
+		b.writeAPIError(w, http.StatusBadRequest, "%q is not a valid MAC address", id)
+		return
+	}
+
+	var update apiClientMetadataUpdate
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, apiMaxRequestBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&update); err != nil {
+		b.writeAPIError(w, http.StatusBadRequest, "invalid request body: %s", err.Error())
+		return
+	}
+
+	c, err := newClientMetadata(trackerdb.DhcpClientMetadata{
+		MacAddr:      mac,
+		FriendlyName: strings.TrimSpace(update.FriendlyName),
+		Note:         strings.TrimSpace(update.Note),
+		Link:         strings.TrimSpace(update.Link),
+		UpdatedAt:    time.Now(),
+	})
+	if err != nil {
+		b.writeAPIError(w, http.StatusBadRequest, "%s", err.Error())
+		return
+	}
+	if err := b.storeClientMetadata(c); err != nil {
+		b.writeAPIError(w, http.StatusInternalServerError, "failed to update the tracker DB: %s", err.Error())
+		return
+	}
+
+	b.writeJSON(w, http.StatusOK, b.toApiClientMetadata(c.DhcpClientMetadata))
+}
+
+// handleApiDeleteClientMetadata removes the metadata of a DHCP client edited from the web UI
+func (b *UIBackend) handleApiDeleteClientMetadata(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("mac")
+
+	mac, err := net.ParseMAC(id)
+	if err != nil {
+		b.writeAPIError(w, http.StatusBadRequest, "%q is not a valid MAC address", id)
+		return
+	}
+
+	if err := b.storeClientMetadata(clientMetadata{DhcpClientMetadata: trackerdb.DhcpClientMetadata{MacAddr: mac}}); err != nil {
+		b.writeAPIError(w, http.StatusInternalServerError, "failed to update the tracker DB: %s", err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// toApiReservation converts an IP address reservation to its REST API representation
+func toApiReservation(r IpAddressReservation) ApiReservation {
+	source := "options"
+	if r.Runtime {
+		source = "runtime"
+	}
+	return ApiReservation{
+		MacAddr: r.Mac.String(),
+		IPAddr:  r.IP.String(),
+		Name:    r.Name,
+		Source:  source,
+	}
+}
+
+// writeReservationError maps the errors of the functions managing the runtime reservations to the HTTP status codes
+func (b *UIBackend) writeReservationError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, errInvalidReservation):
+		status = http.StatusBadRequest
+	case errors.Is(err, errReservationNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, errConflictingReservation):
+		status = http.StatusConflict
+	}
+	b.writeAPIError(w, status, "%s", err.Error())
+}
+
+// decodeReservationRequest parses the body of the requests creating or editing an IP address reservation
+func (b *UIBackend) decodeReservationRequest(w http.ResponseWriter, r *http.Request, v any) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, apiMaxRequestBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		b.writeAPIError(w, http.StatusBadRequest, "invalid request body: %s", err.Error())
+		return false
+	}
+	return true
+}
+
+// parseReservation validates the fields of the requests creating or editing an IP address reservation
+func (b *UIBackend) parseReservation(w http.ResponseWriter, mac net.HardwareAddr, update apiReservationUpdate) (IpAddressReservation, bool) {
+	ip, err := netip.ParseAddr(strings.TrimSpace(update.IPAddr))
+	if err != nil {
+		b.writeAPIError(w, http.StatusBadRequest, "%q is not a valid IP address", update.IPAddr)
+		return IpAddressReservation{}, false
+	}
+	return IpAddressReservation{
+		Mac:  mac,
+		IP:   ip.Unmap(),
+		Name: strings.TrimSpace(update.Name),
+	}, true
+}
+
+// handleApiReservations returns all IP address reservations, both from the addon options and created from the web UI
+func (b *UIBackend) handleApiReservations(w http.ResponseWriter, r *http.Request) {
+	all := b.getAllReservations()
+	items := make([]ApiReservation, 0, len(all))
+	for _, res := range all {
+		items = append(items, toApiReservation(res))
+	}
+	b.writeJSON(w, http.StatusOK, items)
+}
+
+// handleApiReservation returns the IP address reservation of a single MAC address
+func (b *UIBackend) handleApiReservation(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("mac")
+
+	mac, err := net.ParseMAC(id)
+	if err != nil {
+		b.writeAPIError(w, http.StatusBadRequest, "%q is not a valid MAC address", id)
+		return
+	}
+
+	res, ok := b.opts().ipAddressReservationsByMAC[mac.String()]
+	if !ok {
+		b.writeAPIError(w, http.StatusNotFound, "no IP address reservation for the MAC address %s", mac)
+		return
+	}
+	b.writeJSON(w, http.StatusOK, toApiReservation(res))
+}
+
+// handleApiCreateReservation creates an IP address reservation, which is applied without restarting dnsmasq
+func (b *UIBackend) handleApiCreateReservation(w http.ResponseWriter, r *http.Request) {
+	var create apiReservationCreate
+	if !b.decodeReservationRequest(w, r, &create) {
+		return
+	}
+	mac, err := net.ParseMAC(strings.TrimSpace(create.MacAddr))
+	if err != nil {
+		b.writeAPIError(w, http.StatusBadRequest, "%q is not a valid MAC address", create.MacAddr)
+		return
+	}
+	res, ok := b.parseReservation(w, mac, create.apiReservationUpdate)
+	if !ok {
+		return
+	}
+
+	if err := b.setRuntimeReservation(res, false); err != nil {
+		b.writeReservationError(w, err)
+		return
+	}
+	res.Runtime = true
+	b.writeJSON(w, http.StatusCreated, toApiReservation(res))
+}
+
+// handleApiUpdateReservation replaces an IP address reservation created from the web UI
+func (b *UIBackend) handleApiUpdateReservation(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("mac")
+
+	mac, err := net.ParseMAC(id)
+	if err != nil {
+		b.writeAPIError(w, http.StatusBadRequest, "%q is not a valid MAC address", id)
+		return
+	}
+
+	var update apiReservationUpdate
+	if !b.decodeReservationRequest(w, r, &update) {
+		return
+	}
+	res, ok := b.parseReservation(w, mac, update)
+	if !ok {
+		return
+	}
+
+	if err := b.setRuntimeReservation(res, true); err != nil {
+		b.writeReservationError(w, err)
+		return
+	}
+	res.Runtime = true
+	b.writeJSON(w, http.StatusOK, toApiReservation(res))
+}
+
+// handleApiDeleteReservation removes an IP address reservation created from the web UI
+func (b *UIBackend) handleApiDeleteReservation(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("mac")
+
+	mac, err := net.ParseMAC(id)
+	if err != nil {
+		b.writeAPIError(w, http.StatusBadRequest, "%q is not a valid MAC address", id)
+		return
+	}
+
+	if err := b.deleteRuntimeReservation(mac); err != nil {
+		b.writeReservationError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleApiPools returns the DHCP pool configuration together with some usage counters
+func (b *UIBackend) handleApiPools(w http.ResponseWriter, r *http.Request) {
+	summary := ApiPoolsSummary{
+		Pools:                   make([]ApiPoolInfo, 0, len(b.opts().dhcpRanges)),
+		TotalSize:               b.opts().dhcpPool.Size(),
+		DefaultLease:            b.opts().defaultLease,
+		AddressReservationLease: b.opts().addressReservationLease,
+	}
+
+	currentClients := b.getCurrentClients()
+	utilization := b.getDhcpRangesUtilization(currentClients)
+	alerts := b.getDhcpRangesAlerts()
+	for i, n := range IpPoolToHtmlTemplateRanges(b.opts().dhcpRanges) {
+		summary.Pools = append(summary.Pools, ApiPoolInfo{
+			Index:        i,
+			Interface:    n.Interface,
+			Start:        n.Start,
+			End:          n.End,
+			Gateway:      n.Gateway,
+			Netmask:      n.Netmask,
+			Size:         utilization[i].Size,
+			Used:         utilization[i].Used,
+			Reserved:     utilization[i].Reserved,
+			Free:         utilization[i].Free,
+			UsagePercent: utilization[i].UsagePercent,
+			Alert:        alerts[i],
+		})
+	}
+
+	for _, c := range currentClients {
+		summary.CurrentClients++
+		if c.IsInsideDHCPPool {
+			summary.CurrentClientsInPool++
+		}
+		if c.HasStaticIP {
+			summary.CurrentClientsStaticIP++
+		}
+	}
+
+	b.writeJSON(w, http.StatusOK, summary)
+}
+
+// handleApiAddressMap classifies the IP addresses of the network of a DHCP range
+func (b *UIBackend) handleApiAddressMap(w http.ResponseWriter, r *http.Request) {
+	indexStr := r.PathValue("index")
+	idx, err := strconv.Atoi(indexStr)
+	if err != nil || idx < 0 || idx >= len(b.opts().dhcpRanges) {
+		b.writeAPIError(w, http.StatusNotFound, "no DHCP range with index %q", indexStr)
+		return
+	}
+	nw := b.opts().dhcpRanges[idx]
+
+	q := r.URL.Query()
+	var from netip.Addr
+	if fromStr := q.Get("from"); fromStr != "" {
+		from, err = netip.ParseAddr(fromStr)
+		if err != nil || !nw.ContainsInNetwork(from) {
+			b.writeAPIError(w, http.StatusBadRequest, "invalid 'from' parameter %q: expecting an IP address of the network %s", fromStr, nw.Network)
+			return
+		}
+	}
+	limit := apiDefaultAddressMapLimit
+	if limitStr := q.Get("limit"); limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 || limit > apiMaxAddressMapLimit {
+			b.writeAPIError(w, http.StatusBadRequest, "invalid 'limit' parameter %q: expecting a value between 1 and %d", limitStr, apiMaxAddressMapLimit)
+			return
+		}
+	}
+
+	addrMap, owners := b.getAddressMap(nw, b.getCurrentClients(), from, limit)
+	resp := ApiAddressMap{
+		Index:     idx,
+		Interface: nw.Interface,
+		Network:   nw.Network.String(),
+		Gateway:   nw.Gateway.String(),
+		Counts:    addrMap.Counts,
+		Addresses: make([]ApiAddressInfo, 0, len(addrMap.Addresses)),
+	}
+	if addrMap.Next.IsValid() {
+		resp.Next = addrMap.Next.String()
+	}
+	for _, a := range addrMap.Addresses {
+		info := ApiAddressInfo{IPAddr: a.Addr.String(), Class: a.Class}
+		if owner, ok := owners[a.Addr]; ok && a.Class != ippool.AddressFree {
+			if owner.mac != nil {
+				info.MacAddr = owner.mac.String()
+			}
+			info.Name = owner.name
+		}
+		resp.Addresses = append(resp.Addresses, info)
+	}
+	b.writeJSON(w, http.StatusOK, resp)
+}
+
+// handleApiSuggestAddresses returns the free IP addresses of the network of a DHCP range
+func (b *UIBackend) handleApiSuggestAddresses(w http.ResponseWriter, r *http.Request) {
+	indexStr := r.PathValue("index")
+	idx, err := strconv.Atoi(indexStr)
+	if err != nil || idx < 0 || idx >= len(b.opts().dhcpRanges) {
+		b.writeAPIError(w, http.StatusNotFound, "no DHCP range with index %q", indexStr)
+		return
+	}
+	nw := b.opts().dhcpRanges[idx]
+
+	q := r.URL.Query()
+	preferOutsidePool := false
+	if preferStr := q.Get("prefer_outside_pool"); preferStr != "" {
+		preferOutsidePool, err = strconv.ParseBool(preferStr)
+		if err != nil {
+			b.writeAPIError(w, http.StatusBadRequest, "invalid 'prefer_outside_pool' parameter %q: expecting true or false", preferStr)
+			return
+		}
+	}
+	req, err := parseSuggestRequest(nw, q.Get("count"), q["exclude"], preferOutsidePool, q.Get("seen_within"))
+	if err != nil {
+		b.writeAPIError(w, http.StatusBadRequest, "%s", err.Error())
+		return
+	}
+
+	resp := ApiAddressSuggestions{
+		Index:     idx,
+		Interface: nw.Interface,
+		Network:   nw.Network.String(),
+		Addresses: []string{},
+	}
+	for _, ip := range b.suggestFreeAddresses(nw, b.getCurrentClients(), req) {
+		resp.Addresses = append(resp.Addresses, ip.String())
+	}
+	b.writeJSON(w, http.StatusOK, resp)
+}
+
+// handleApiDns returns the DNS server configuration and its live metrics
+func (b *UIBackend) handleApiDns(w http.ResponseWriter, r *http.Request) {
+	summary := ApiDnsSummary{
+		Enabled: b.opts().dnsEnable,
+		Domain:  b.opts().dnsDomain,
+		Port:    b.opts().dnsPort,
+	}
+
+	if b.opts().dnsEnable {
+		stats, err := b.getLocalDnsStats()
+		if err != nil {
+			b.logger.Warnf("failed to get updated DNS stats: %s", err.Error())
+		} else {
+			summary.StatsAvailable = true
+		}
+		summary.Stats = stats
+	}
+
+	b.writeJSON(w, http.StatusOK, summary)
+}
+
+// handleApiRogueServers returns the rogue DHCP servers detected so far
+func (b *UIBackend) handleApiRogueServers(w http.ResponseWriter, r *http.Request) {
+	b.writeJSON(w, http.StatusOK, ApiRogueServersSummary{
+		Enabled:          b.opts().rogueDhcpDetectorEnable,
+		ProbeIntervalSec: int(b.opts().rogueDhcpProbeInterval.Seconds()),
+		Servers:          b.getRogueDhcpServers(),
+	})
+}
+
+// handleApiOptions returns the issues found in the addon options and the changes made to them
+// since the addon was started
+func (b *UIBackend) handleApiOptions(w http.ResponseWriter, r *http.Request) {
+	b.writeJSON(w, http.StatusOK, ApiOptionsStatus{
+		Findings: b.getConfigFindings(),
+		Changes:  b.getOptionsChanges(),
+	})
+}
+
+// handleApiOptionsReload requests a reload of the addon options; the reload happens asynchronously
+func (b *UIBackend) handleApiOptionsReload(w http.ResponseWriter, r *http.Request) {
+	b.TriggerOptionsReload()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handleApiOpenAPI serves the OpenAPI document, either in its original YAML format or
+// converted to JSON
+func (b *UIBackend) handleApiOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, ".yaml") {
+		w.Header().Set("Content-Type", "application/yaml")
+		_, _ = w.Write(openAPIDocYAML)
+		return
+	}
+
+	var doc map[string]any
+	if err := yaml.Unmarshal(openAPIDocYAML, &doc); err != nil {
+		b.writeAPIError(w, http.StatusInternalServerError, "failed to parse the OpenAPI document: %s", err.Error())
+		return
+	}
+	b.writeJSON(w, http.StatusOK, doc)
+}
+
+// handleApiExport exports the current DHCP clients, the past DHCP clients or the IP address reservations
+func (b *UIBackend) handleApiExport(w http.ResponseWriter, r *http.Request) {
+	dataset, format, err := parseExportRequest(r.PathValue("dataset"), r.URL.Query().Get("format"))
+	if err != nil {
+		b.writeAPIError(w, http.StatusBadRequest, "%s", err.Error())
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := b.export(&buf, dataset, format); err != nil {
+		b.writeAPIError(w, http.StatusInternalServerError, "failed to export %s: %s", dataset, err.Error())
+		return
+	}
+
+	mediaType := exportFormatMediaTypes[format]
+	w.Header().Set("Content-Type", mediaType[0]+"; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="dhcp-%s.%s"`, dataset, mediaType[1]))
+	_, _ = w.Write(buf.Bytes())
+}
+
+// handleApiImport converts the configuration of another DHCP server, sent in the request body, into
+// IP address reservations and friendly names for the addon options; nothing is applied
+func (b *UIBackend) handleApiImport(w http.ResponseWriter, r *http.Request) {
+	format, err := parseImportFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		b.writeAPIError(w, http.StatusBadRequest, "%s", err.Error())
+		return
+	}
+	var req apiImportRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, apiMaxImportBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		b.writeAPIError(w, http.StatusBadRequest, "invalid request body: %s", err.Error())
+		return
+	}
+	hosts, skipped, err := dhcpimport.Parse(format, strings.NewReader(req.Config))
+	if err != nil {
+		b.writeAPIError(w, http.StatusBadRequest, "failed to parse the configuration: %s", err.Error())
+		return
+	}
+
+	optionsData, err := os.ReadFile(defaultHomeAssistantOptionsFile)
+	if err != nil {
+		b.writeAPIError(w, http.StatusInternalServerError, "failed to read the addon options: %s", err.Error())
+		return
+	}
+	res, err := importHosts(optionsData, hosts, skipped)
+	if err != nil {
+		b.writeAPIError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+	out, err := res.yaml()
+	if err != nil {
+		b.writeAPIError(w, http.StatusInternalServerError, "%s", err.Error())
+		return
+	}
+
+	preview := ApiImportPreview{
+		Reservations:  make([]ApiImportedHost, 0, len(res.reservations)),
+		FriendlyNames: make([]ApiImportedHost, 0, len(res.friendlyNames)),
+		Findings:      res.findings,
+		YAML:          out,
+	}
+	for _, r := range res.reservations {
+		preview.Reservations = append(preview.Reservations, ApiImportedHost{MacAddr: r.Mac.String(), IPAddr: r.IP.String(), Name: r.Name})
+	}
+	for _, f := range res.friendlyNames {
+		preview.FriendlyNames = append(preview.FriendlyNames, ApiImportedHost{MacAddr: f.MacAddress.String(), Name: f.FriendlyName})
+	}
+	b.writeJSON(w, http.StatusOK, preview)
+}
+
+// isIngressRequest returns true if the request came through the Home Assistant ingress, which
+// authenticates the user: it must carry the X-Ingress-Path header and be forwarded by the local nginx
+// reverse proxy, since the header alone can be set by anyone reaching the web UI port
+func (b *UIBackend) isIngressRequest(r *http.Request) bool {
+	if b.isTestingMode {
+		// local testing mode... there is no ingress at all
+		return true
+	}
+	if len(r.Header.Values("X-Ingress-Path")) == 0 {
+		return false
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	addr, err := netip.ParseAddr(host)
+	return err == nil && addr.Unmap().IsLoopback()
+}
+
+// ingressOnlyMiddleware guards the endpoints changing the addon state: they are served only to the
+// requests coming through the Home Assistant ingress, and the request body, if any, must be JSON
+func (b *UIBackend) ingressOnlyMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !b.isIngressRequest(r) {
+			b.logger.Warnf("refusing %s %s from %s: not coming through the Home Assistant ingress", r.Method, r.URL.Path, r.RemoteAddr)
+			b.writeAPIError(w, http.StatusForbidden, "%s %s is allowed only through the Home Assistant ingress", r.Method, r.URL.Path)
+			return
+		}
+		contentType := r.Header.Get("Content-Type")
+		if contentType != "" || r.ContentLength != 0 {
+			mediaType, _, err := mime.ParseMediaType(contentType)
+			if err != nil || mediaType != "application/json" {
+				b.writeAPIError(w, http.StatusUnsupportedMediaType, "unsupported Content-Type %q: the request body must be application/json", contentType)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// registerAPIHandlers adds all REST API endpoints to the given mux
+func (b *UIBackend) registerAPIHandlers(mux *http.ServeMux) {
+	handle := func(pattern string, h http.HandlerFunc) {
+		mux.Handle(pattern, b.logRequestMiddleware(h))
+	}
+	// the endpoints changing the addon state must not be reachable from the LAN
+	handleWrite := func(pattern string, h http.HandlerFunc) {
+		handle(pattern, b.ingressOnlyMiddleware(h))
+	}
+
+	handle("GET "+apiV1Prefix+"/openapi.json", b.handleApiOpenAPI)
+	handle("GET "+apiV1Prefix+"/openapi.yaml", b.handleApiOpenAPI)
+	handle("GET "+apiV1Prefix+"/clients/current", b.handleApiCurrentClients)
+	handle("GET "+apiV1Prefix+"/clients/current/{id}", b.handleApiCurrentClient)
+	handle("GET "+apiV1Prefix+"/clients/past", b.handleApiPastClients)
+	handle("GET "+apiV1Prefix+"/clients/past/{mac}", b.handleApiPastClient)
+	handle("GET "+apiV1Prefix+"/clients/timeline/{mac}", b.handleApiClientTimeline)
+	handle("GET "+apiV1Prefix+"/clients/metadata", b.handleApiAllClientMetadata)
+	handle("GET "+apiV1Prefix+"/clients/metadata/{mac}", b.handleApiClientMetadata)
+	handleWrite("PUT "+apiV1Prefix+"/clients/metadata/{mac}", b.handleApiUpdateClientMetadata)
+	handleWrite("DELETE "+apiV1Prefix+"/clients/metadata/{mac}", b.handleApiDeleteClientMetadata)
+	handle("GET "+apiV1Prefix+"/reservations", b.handleApiReservations)
+	handle("GET "+apiV1Prefix+"/reservations/{mac}", b.handleApiReservation)
+	handleWrite("POST "+apiV1Prefix+"/reservations", b.handleApiCreateReservation)
+	handleWrite("PUT "+apiV1Prefix+"/reservations/{mac}", b.handleApiUpdateReservation)
+	handleWrite("DELETE "+apiV1Prefix+"/reservations/{mac}", b.handleApiDeleteReservation)
+	handle("GET "+apiV1Prefix+"/export/{dataset}", b.handleApiExport)
+	handleWrite("POST "+apiV1Prefix+"/import", b.handleApiImport)
+	handle("GET "+apiV1Prefix+"/pools", b.handleApiPools)
+	handle("GET "+apiV1Prefix+"/pools/{index}/addresses", b.handleApiAddressMap)
+	handle("GET "+apiV1Prefix+"/pools/{index}/suggestions", b.handleApiSuggestAddresses)
+	handle("GET "+apiV1Prefix+"/dns", b.handleApiDns)
+	handle("GET "+apiV1Prefix+"/rogue-servers", b.handleApiRogueServers)
+	handle("GET "+apiV1Prefix+"/options", b.handleApiOptions)
+	handleWrite("POST "+apiV1Prefix+"/options/reload", b.handleApiOptionsReload)
+
+	// any other URL below the API prefix should produce a JSON error, not the HTML page
+	handle(apiV1Prefix+"/", func(w http.ResponseWriter, r *http.Request) {
+		b.writeAPIError(w, http.StatusNotFound, "unknown API endpoint %s %s", r.Method, r.URL.Path)
+	})
+}
@@ -0,0 +1,628 @@
+package uibackend
+
+import (
+	"context"
+	"dnsmasq-dhcp-backend/pkg/dnsmasqctl"
+	"dnsmasq-dhcp-backend/pkg/ippool"
+	"dnsmasq-dhcp-backend/pkg/roguedhcp"
+	"dnsmasq-dhcp-backend/pkg/trackerdb"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// apiGet runs a GET request against the REST API of the given backend and returns the recorded response
+func apiGet(t *testing.T, b *UIBackend, url string) *httptest.ResponseRecorder {
+	t.Helper()
+	return apiRequest(t, b, http.MethodGet, url, "")
+}
+
+// apiRequest runs a request with the given JSON body against the REST API of the given backend, as if it
+// came through the Home Assistant ingress, and returns the recorded response
+func apiRequest(t *testing.T, b *UIBackend, method, url, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	req.RemoteAddr = "127.0.0.1:40000"
+	req.Header.Set("X-Ingress-Path", "/api/hassio_ingress/abcdef")
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return apiServe(t, b, req)
+}
+
+// apiServe runs the given request against the REST API of the given backend and returns the recorded response
+func apiServe(t *testing.T, b *UIBackend, req *http.Request) *httptest.ResponseRecorder {
+	t.Helper()
+	mux := http.NewServeMux()
+	b.registerAPIHandlers(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+// apiGetCurrentClientsPage decodes the response of the /clients/current endpoint, returning the page
+// and the list of MAC addresses of the clients inside it
+func apiGetCurrentClientsPage(t *testing.T, b *UIBackend, url string) (ApiPage[json.RawMessage], []string) {
+	t.Helper()
+	rec := apiGet(t, b, url)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var page ApiPage[json.RawMessage]
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+
+	macs := make([]string, 0, len(page.Items))
+	for _, item := range page.Items {
+		var c struct {
+			Lease struct {
+				MacAddr string `json:"mac_addr"`
+			} `json:"lease"`
+		}
+		require.NoError(t, json.Unmarshal(item, &c))
+		macs = append(macs, c.Lease.MacAddr)
+	}
+	return page, macs
+}
+
+func TestApiCurrentClients(t *testing.T) {
+	backend := getMockUIBackend()
+	backend.processLeaseUpdatesFromArray(getMockLeases())
+
+	tests := []struct {
+		name          string
+		url           string
+		expectedTotal int
+		expectedMacs  []string
+	}{
+		{
+			name:          "no filters, default sorting by IP",
+			url:           "/api/v1/clients/current",
+			expectedTotal: 4,
+			expectedMacs:  []string{"00:11:22:33:44:55", "00:11:22:33:44:56", "aa:bb:cc:dd:ee:ff", "00:11:22:33:44:57"},
+		},
+		{
+			name:          "descending sort by hostname",
+			url:           "/api/v1/clients/current?sort=-hostname",
+			expectedTotal: 4,
+			expectedMacs:  []string{"aa:bb:cc:dd:ee:ff", "00:11:22:33:44:57", "00:11:22:33:44:56", "00:11:22:33:44:55"},
+		},
+		{
+			name:          "static clients only",
+			url:           "/api/v1/clients/current?static=true",
+			expectedTotal: 1,
+			expectedMacs:  []string{"00:11:22:33:44:56"},
+		},
+		{
+			name:          "pool filter excludes the client outside the DHCP range",
+			url:           "/api/v1/clients/current?pool=0&static=false",
+			expectedTotal: 2,
+			expectedMacs:  []string{"00:11:22:33:44:55", "aa:bb:cc:dd:ee:ff"},
+		},
+		{
+			name:          "interface filter includes the client outside the DHCP range",
+			url:           "/api/v1/clients/current?interface=eth0",
+			expectedTotal: 4,
+			expectedMacs:  []string{"00:11:22:33:44:55", "00:11:22:33:44:56", "aa:bb:cc:dd:ee:ff", "00:11:22:33:44:57"},
+		},
+		{
+			name:          "randomized MAC addresses only",
+			url:           "/api/v1/clients/current?randomized=true",
+			expectedTotal: 1,
+			expectedMacs:  []string{"aa:bb:cc:dd:ee:ff"},
+		},
+		{
+			name:          "hostname substring, case insensitive",
+			url:           "/api/v1/clients/current?hostname=CLIENT4",
+			expectedTotal: 1,
+			expectedMacs:  []string{"aa:bb:cc:dd:ee:ff"},
+		},
+		{
+			name:          "pagination",
+			url:           "/api/v1/clients/current?offset=1&limit=2",
+			expectedTotal: 4,
+			expectedMacs:  []string{"00:11:22:33:44:56", "aa:bb:cc:dd:ee:ff"},
+		},
+		{
+			name:          "offset past the end",
+			url:           "/api/v1/clients/current?offset=10",
+			expectedTotal: 4,
+			expectedMacs:  []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, macs := apiGetCurrentClientsPage(t, backend, tt.url)
+			assert.Equal(t, tt.expectedTotal, page.Total)
+			assert.Equal(t, tt.expectedMacs, macs)
+		})
+	}
+}
+
+func TestApiCurrentClients_InvalidParams(t *testing.T) {
+	backend := getMockUIBackend()
+
+	for _, url := range []string{
+		"/api/v1/clients/current?pool=1",
+		"/api/v1/clients/current?pool=abc",
+		"/api/v1/clients/current?static=maybe",
+		"/api/v1/clients/current?randomized=maybe",
+		"/api/v1/clients/current?sort=last_seen",
+		"/api/v1/clients/current?offset=-1",
+		"/api/v1/clients/current?limit=0",
+		"/api/v1/clients/past?pool=0",
+	} {
+		rec := apiGet(t, backend, url)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, url)
+		assert.Contains(t, rec.Body.String(), `"error"`, url)
+	}
+}
+
+func TestApiCurrentClient(t *testing.T) {
+	backend := getMockUIBackend()
+	backend.processLeaseUpdatesFromArray(getMockLeases())
+
+	// lookup by MAC, using a different case than the one in the lease file
+	rec := apiGet(t, backend, "/api/v1/clients/current/AA:BB:CC:DD:EE:FF")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"ip_addr":"192.168.0.66"`)
+
+	// lookup by IP
+	rec = apiGet(t, backend, "/api/v1/clients/current/192.168.0.3")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"mac_addr":"00:11:22:33:44:56"`)
+
+	rec = apiGet(t, backend, "/api/v1/clients/current/192.168.0.200")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = apiGet(t, backend, "/api/v1/clients/current/not-an-address")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestApiPastClients(t *testing.T) {
+	backend := getMockUIBackend()
+	backend.processLeaseUpdatesFromArray(getMockLeases())
+
+	now := time.Now()
+	backend.trackerDB = trackerdb.NewTestDBWithData([]trackerdb.DhcpClient{
+		{MacAddr: MustParseMAC("00:11:22:33:44:55"), Hostname: "client1", LastSeen: now}, // this is a current client
+		{MacAddr: MustParseMAC("de:ad:be:ef:00:01"), Hostname: "old-laptop", LastSeen: now.Add(-2 * time.Hour)},
+		{MacAddr: MustParseMAC("de:ad:be:ef:00:02"), Hostname: "old-phone", LastSeen: now.Add(-1 * time.Hour)},
+	})
+
+	rec := apiGet(t, backend, "/api/v1/clients/past?sort=-last_seen")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var page ApiPage[struct {
+		PastInfo struct {
+			Hostname string `json:"hostname"`
+		} `json:"past_info"`
+	}]
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &page))
+	require.Equal(t, 2, page.Total)
+	assert.Equal(t, "old-phone", page.Items[0].PastInfo.Hostname)
+	assert.Equal(t, "old-laptop", page.Items[1].PastInfo.Hostname)
+
+	rec = apiGet(t, backend, "/api/v1/clients/past?hostname=laptop")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"total":1`)
+
+	rec = apiGet(t, backend, "/api/v1/clients/past/de:ad:be:ef:00:02")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"hostname":"old-phone"`)
+
+	// a current client is not a past client
+	rec = apiGet(t, backend, "/api/v1/clients/past/00:11:22:33:44:55")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestApiPools(t *testing.T) {
+	backend := getMockUIBackend()
+	backend.processLeaseUpdatesFromArray(getMockLeases())
+
+	rec := apiGet(t, backend, "/api/v1/pools")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var summary ApiPoolsSummary
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &summary))
+	assert.Len(t, summary.Pools, 1)
+	assert.Equal(t, "eth0", summary.Pools[0].Interface)
+	assert.Equal(t, int64(100), summary.Pools[0].Size)
+	assert.Equal(t, int64(3), summary.Pools[0].Used)
+	assert.Equal(t, int64(1), summary.Pools[0].Reserved)
+	assert.Equal(t, int64(97), summary.Pools[0].Free)
+	assert.Equal(t, DhcpRangeAlertOK, summary.Pools[0].Alert.Level)
+	assert.Equal(t, int64(100), summary.TotalSize)
+	assert.Equal(t, 4, summary.CurrentClients)
+	assert.Equal(t, 3, summary.CurrentClientsInPool)
+	assert.Equal(t, 1, summary.CurrentClientsStaticIP)
+}
+
+func TestApiAddressMap(t *testing.T) {
+	backend := getMockUIBackend()
+	backend.trackerDB = trackerdb.NewTestDBWithData([]trackerdb.DhcpClient{
+		{MacAddr: MustParseMAC("de:ad:be:ef:00:01"), Hostname: "old-printer", LastIP: netip.MustParseAddr("192.168.0.150")},
+	})
+	backend.processLeaseUpdatesFromArray(getMockLeases())
+
+	rec := apiGet(t, backend, "/api/v1/pools/0/addresses")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var addrMap ApiAddressMap
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &addrMap))
+	assert.Equal(t, "192.168.0.0/24", addrMap.Network)
+	assert.Empty(t, addrMap.Next)
+	require.Len(t, addrMap.Addresses, 256)
+	assert.Equal(t, map[ippool.AddressClass]int64{
+		ippool.AddressNetwork: 2, ippool.AddressGateway: 1, ippool.AddressReservedInPool: 1,
+		ippool.AddressLeased: 3, ippool.AddressFree: 97, ippool.AddressSeen: 1, ippool.AddressUnused: 151,
+	}, addrMap.Counts)
+	assert.Equal(t, ApiAddressInfo{IPAddr: "192.168.0.3", Class: ippool.AddressReservedInPool, MacAddr: "00:11:22:33:44:56", Name: "test-friendly-name"}, addrMap.Addresses[3])
+	assert.Equal(t, ApiAddressInfo{IPAddr: "192.168.0.101", Class: ippool.AddressLeased, MacAddr: "00:11:22:33:44:57", Name: "client3"}, addrMap.Addresses[101])
+	assert.Equal(t, ApiAddressInfo{IPAddr: "192.168.0.150", Class: ippool.AddressSeen, MacAddr: "de:ad:be:ef:00:01", Name: "old-printer"}, addrMap.Addresses[150])
+	assert.Equal(t, ApiAddressInfo{IPAddr: "192.168.0.254", Class: ippool.AddressGateway}, addrMap.Addresses[254])
+
+	// walk through the network in chunks
+	rec = apiGet(t, backend, "/api/v1/pools/0/addresses?from=192.168.0.100&limit=2")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &addrMap))
+	require.Len(t, addrMap.Addresses, 2)
+	assert.Equal(t, ippool.AddressFree, addrMap.Addresses[0].Class)
+	assert.Equal(t, "192.168.0.102", addrMap.Next)
+
+	for _, url := range []string{
+		"/api/v1/pools/0/addresses?from=10.0.0.1",
+		"/api/v1/pools/0/addresses?limit=0",
+		"/api/v1/pools/0/addresses?limit=100000",
+	} {
+		assert.Equal(t, http.StatusBadRequest, apiGet(t, backend, url).Code, url)
+	}
+	assert.Equal(t, http.StatusNotFound, apiGet(t, backend, "/api/v1/pools/1/addresses").Code)
+}
+
+func TestApiSuggestAddresses(t *testing.T) {
+	backend := getMockUIBackend()
+	backend.trackerDB = trackerdb.NewTestDBWithData([]trackerdb.DhcpClient{
+		{MacAddr: MustParseMAC("de:ad:be:ef:00:01"), Hostname: "old-printer", LastIP: netip.MustParseAddr("192.168.0.150")},
+	})
+	backend.processLeaseUpdatesFromArray(getMockLeases())
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"count=3", []string{"192.168.0.1", "192.168.0.4", "192.168.0.5"}},
+		{"count=3&prefer_outside_pool=true", []string{"192.168.0.102", "192.168.0.103", "192.168.0.104"}},
+		{"count=2&prefer_outside_pool=true&exclude=.102-.149&exclude=.151-192.168.0.200", []string{"192.168.0.201", "192.168.0.202"}},
+		// the past DHCP client has not been seen recently: its IP address can be suggested
+		{"count=1&prefer_outside_pool=true&exclude=.102-.149&seen_within=24h", []string{"192.168.0.150"}},
+		{"count=2&exclude=192.168.0.0/25", []string{"192.168.0.128", "192.168.0.129"}},
+	}
+	for _, tt := range tests {
+		rec := apiGet(t, backend, "/api/v1/pools/0/suggestions?"+tt.query)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var resp ApiAddressSuggestions
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Equal(t, "192.168.0.0/24", resp.Network)
+		assert.Equal(t, tt.expected, resp.Addresses, tt.query)
+	}
+
+	for _, url := range []string{
+		"/api/v1/pools/0/suggestions?count=0",
+		"/api/v1/pools/0/suggestions?prefer_outside_pool=maybe",
+		"/api/v1/pools/0/suggestions?exclude=10.0.0.1-10.0.0.5",
+		"/api/v1/pools/0/suggestions?exclude=.300",
+		"/api/v1/pools/0/suggestions?seen_within=yesterday",
+	} {
+		assert.Equal(t, http.StatusBadRequest, apiGet(t, backend, url).Code, url)
+	}
+	assert.Equal(t, http.StatusNotFound, apiGet(t, backend, "/api/v1/pools/1/suggestions").Code)
+}
+
+func TestApiRogueServers(t *testing.T) {
+	backend := getMockUIBackend()
+
+	// detector disabled
+	rec := apiGet(t, backend, "/api/v1/rogue-servers")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"enabled": false, "probe_interval_sec": 0, "servers": []}`, rec.Body.String())
+
+	// detector enabled, with a rogue server answering on eth0
+	transport := roguedhcp.NewFakeTransport()
+	transport.SetLocalAddrs("eth0", netip.MustParseAddr("192.168.0.254"))
+	transport.AddServer("eth0", roguedhcp.FakeServer{
+		IP:        netip.MustParseAddr("192.168.0.253"),
+		MAC:       net.HardwareAddr{0xaa, 0xbb, 0xcc, 0x00, 0x00, 0x01},
+		OfferedIP: netip.MustParseAddr("192.168.0.200"),
+	})
+	backend.opts().rogueDhcpDetectorEnable = true
+	backend.opts().rogueDhcpProbeInterval = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	backend.startRogueDhcpDetector(ctx, transport)
+	require.Eventually(t, func() bool { return len(backend.getRogueDhcpServers()) == 1 }, time.Second, time.Millisecond)
+
+	rec = apiGet(t, backend, "/api/v1/rogue-servers")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var summary struct {
+		Enabled          bool `json:"enabled"`
+		ProbeIntervalSec int  `json:"probe_interval_sec"`
+		Servers          []struct {
+			Interface string `json:"interface"`
+			ServerIP  string `json:"server_ip"`
+			ServerMAC string `json:"server_mac"`
+			OfferedIP string `json:"offered_ip"`
+		} `json:"servers"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &summary))
+	assert.True(t, summary.Enabled)
+	assert.Equal(t, 3600, summary.ProbeIntervalSec)
+	require.Len(t, summary.Servers, 1)
+	assert.Equal(t, "eth0", summary.Servers[0].Interface)
+	assert.Equal(t, "192.168.0.253", summary.Servers[0].ServerIP)
+	assert.Equal(t, "aa:bb:cc:00:00:01", summary.Servers[0].ServerMAC)
+	assert.Equal(t, "192.168.0.200", summary.Servers[0].OfferedIP)
+}
+
+func TestApiClientMetadata(t *testing.T) {
+	backend := getMockUIBackend()
+	backend.processLeaseUpdatesFromArray(getMockLeases())
+
+	// a client never edited
+	rec := apiGet(t, backend, "/api/v1/clients/metadata/00:11:22:33:44:57")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"mac_addr": "00:11:22:33:44:57", "friendly_name": "", "note": "", "link": "", "updated_at": 0,
+		"overridden_by_options": []}`, rec.Body.String())
+
+	// validation errors
+	rec = apiRequest(t, backend, http.MethodPut, "/api/v1/clients/metadata/not-a-mac", `{"friendly_name": "x"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = apiRequest(t, backend, http.MethodPut, "/api/v1/clients/metadata/00:11:22:33:44:57", `{"friendly_name": 1}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = apiRequest(t, backend, http.MethodPut, "/api/v1/clients/metadata/00:11:22:33:44:57", `{"link": "http://{{ .ip "}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "invalid golang template")
+	for _, link := range []string{
+		"javascript://x/%0aalert(1)",
+		"javascript:alert(1)",
+		"{{ .hostname }}://x/",
+		`http://x/\"onmouseover=alert(1)//`,
+		"http://x/'onmouseover=alert(1)//",
+		"http://{{ .ip }}/\u003cscript\u003e",
+	} {
+		rec = apiRequest(t, backend, http.MethodPut, "/api/v1/clients/metadata/00:11:22:33:44:57", `{"link": "`+link+`"}`)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, link)
+		assert.Contains(t, rec.Body.String(), "must be an HTTP or HTTPS URL", link)
+	}
+
+	// edit a client without friendly name in the addon options
+	rec = apiRequest(t, backend, http.MethodPut, "/api/v1/clients/metadata/00:11:22:33:44:57",
+		`{"friendly_name": " Printer ", "note": "in the office", "link": "http://{{ .ip }}/{{ .friendly_name }}"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var m ApiClientMetadata
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &m))
+	assert.Equal(t, "Printer", m.FriendlyName)
+	assert.Equal(t, "in the office", m.Note)
+	assert.NotZero(t, m.UpdatedAt)
+	assert.Empty(t, m.OverriddenByOptions)
+
+	// edit a client having a friendly name and a link in the addon options
+	rec = apiRequest(t, backend, http.MethodPut, "/api/v1/clients/metadata/00:11:22:33:44:55",
+		`{"friendly_name": "ignored", "note": "shown", "link": "http://ignored"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &m))
+	assert.Equal(t, []string{"friendly_name", "link"}, m.OverriddenByOptions)
+
+	// the addon options take precedence
+	backend.processLeaseUpdatesFromArray(getMockLeases())
+	clients := map[string]DhcpClientData{}
+	for _, c := range backend.getCurrentClients() {
+		clients[c.Lease.MacAddr.String()] = c
+	}
+	assert.Equal(t, "Printer", clients["00:11:22:33:44:57"].FriendlyName)
+	assert.Equal(t, "in the office", clients["00:11:22:33:44:57"].UserNote)
+	assert.Equal(t, "http://192.168.0.101/Printer", clients["00:11:22:33:44:57"].EvaluatedLink)
+	assert.Equal(t, "FriendlyClient1", clients["00:11:22:33:44:55"].FriendlyName)
+	assert.Equal(t, "shown", clients["00:11:22:33:44:55"].UserNote)
+	assert.Equal(t, "https://192.168.0.2/client1-page", clients["00:11:22:33:44:55"].EvaluatedLink)
+
+	// list
+	rec = apiGet(t, backend, "/api/v1/clients/metadata")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var all []ApiClientMetadata
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &all))
+	require.Len(t, all, 2)
+	assert.Equal(t, "00:11:22:33:44:55", all[0].MacAddr)
+	assert.Equal(t, "00:11:22:33:44:57", all[1].MacAddr)
+
+	// delete
+	rec = apiRequest(t, backend, http.MethodDelete, "/api/v1/clients/metadata/00:11:22:33:44:57", "")
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	rec = apiGet(t, backend, "/api/v1/clients/metadata/00:11:22:33:44:57")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &m))
+	assert.Empty(t, m.FriendlyName)
+	_, err := backend.trackerDB.GetDhcpClientMetadata(MustParseMAC("00:11:22:33:44:57"))
+	assert.ErrorIs(t, err, trackerdb.ErrDhcpClientNotFound)
+}
+
+func TestApiReservations(t *testing.T) {
+	savedHostsFile := defaultDnsmasqHostsFile
+	defaultDnsmasqHostsFile = t.TempDir() + "/dnsmasq.hosts"
+	t.Cleanup(func() { defaultDnsmasqHostsFile = savedHostsFile })
+
+	backend := getMockUIBackend()
+	fake := dnsmasqctl.NewFakeController()
+	backend.dnsmasqCtl = fake
+	backend.processLeaseUpdatesFromArray(getMockLeases())
+
+	// validation errors
+	for body, expectedStatus := range map[string]int{
+		`{"mac_addr": "not-a-mac", "ip_addr": "192.168.0.50"}`:                        http.StatusBadRequest,
+		`{"mac_addr": "00:11:22:33:44:57", "ip_addr": "192.168.0"}`:                   http.StatusBadRequest,
+		`{"mac_addr": "00:11:22:33:44:57", "ip_addr": "192.168.0.50", "link": ""}`:    http.StatusBadRequest,
+		`{"mac_addr": "00:11:22:33:44:57", "ip_addr": "10.0.0.50"}`:                   http.StatusBadRequest,
+		`{"mac_addr": "00:11:22:33:44:57", "ip_addr": "192.168.0.254"}`:               http.StatusBadRequest,
+		`{"mac_addr": "00:11:22:33:44:57", "ip_addr": "192.168.0.255"}`:               http.StatusBadRequest,
+		`{"mac_addr": "00:11:22:33:44:57", "ip_addr": "192.168.0.50", "name": "a b"}`: http.StatusBadRequest,
+		`{"mac_addr": "00:11:22:33:44:57", "ip_addr": "192.168.0.3"}`:                 http.StatusConflict, // reserved in the addon options
+		`{"mac_addr": "00:11:22:33:44:57", "ip_addr": "192.168.0.2"}`:                 http.StatusConflict, // leased to client1
+	} {
+		rec := apiRequest(t, backend, http.MethodPost, "/api/v1/reservations", body)
+		assert.Equal(t, expectedStatus, rec.Code, body)
+	}
+	assert.Equal(t, 0, fake.Reloads())
+
+	// reserve the current IP of client3
+	rec := apiRequest(t, backend, http.MethodPost, "/api/v1/reservations",
+		`{"mac_addr": "00:11:22:33:44:57", "ip_addr": "192.168.0.101", "name": "printer"}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	assert.JSONEq(t, `{"mac_addr": "00:11:22:33:44:57", "ip_addr": "192.168.0.101", "name": "printer", "source": "runtime"}`, rec.Body.String())
+	assert.Equal(t, 1, fake.Reloads())
+	entries, err := dnsmasqctl.ReadHostsFile(defaultDnsmasqHostsFile)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "00:11:22:33:44:57,printer,192.168.0.101", entries[0].String())
+
+	backend.processLeaseUpdatesFromArray(getMockLeases())
+	clients := map[string]DhcpClientData{}
+	for _, c := range backend.getCurrentClients() {
+		clients[c.Lease.MacAddr.String()] = c
+	}
+	assert.True(t, clients["00:11:22:33:44:57"].HasStaticIP)
+	assert.True(t, clients["00:11:22:33:44:57"].HasRuntimeReservation)
+	assert.False(t, clients["00:11:22:33:44:56"].HasRuntimeReservation)
+
+	rec = apiRequest(t, backend, http.MethodPost, "/api/v1/reservations", `{"mac_addr": "00:11:22:33:44:57", "ip_addr": "192.168.0.102"}`)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	// list
+	rec = apiGet(t, backend, "/api/v1/reservations")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `[
+		{"mac_addr": "00:11:22:33:44:56", "ip_addr": "192.168.0.3", "name": "test-friendly-name", "source": "options"},
+		{"mac_addr": "00:11:22:33:44:57", "ip_addr": "192.168.0.101", "name": "printer", "source": "runtime"}
+	]`, rec.Body.String())
+
+	// edit: the client keeps its current lease until it gets renewed
+	rec = apiRequest(t, backend, http.MethodPut, "/api/v1/reservations/00:11:22:33:44:57", `{"ip_addr": "192.168.0.50"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	rec = apiGet(t, backend, "/api/v1/reservations/00:11:22:33:44:57")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"mac_addr": "00:11:22:33:44:57", "ip_addr": "192.168.0.50", "name": "", "source": "runtime"}`, rec.Body.String())
+	backend.processLeaseUpdatesFromArray(getMockLeases())
+	for _, c := range backend.getCurrentClients() {
+		if c.Lease.MacAddr.String() == "00:11:22:33:44:57" {
+			assert.False(t, c.HasStaticIP)
+			assert.True(t, c.HasRuntimeReservation)
+		}
+	}
+
+	rec = apiRequest(t, backend, http.MethodPut, "/api/v1/reservations/00:11:22:33:44:58", `{"ip_addr": "192.168.0.51"}`)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	// dnsmasq cannot be reloaded
+	fake.Err = errors.New("no dnsmasq")
+	rec = apiRequest(t, backend, http.MethodPut, "/api/v1/reservations/00:11:22:33:44:57", `{"ip_addr": "192.168.0.52"}`)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Contains(t, rec.Body.String(), "restart the addon")
+	fake.Err = nil
+
+	// delete
+	rec = apiRequest(t, backend, http.MethodDelete, "/api/v1/reservations/00:11:22:33:44:57", "")
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	rec = apiRequest(t, backend, http.MethodDelete, "/api/v1/reservations/00:11:22:33:44:57", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = apiGet(t, backend, "/api/v1/reservations/00:11:22:33:44:57")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	entries, err = dnsmasqctl.ReadHostsFile(defaultDnsmasqHostsFile)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+	assert.Equal(t, 3, fake.Reloads())
+}
+
+func TestApiWriteEndpointsIngressOnly(t *testing.T) {
+	savedHostsFile := defaultDnsmasqHostsFile
+	defaultDnsmasqHostsFile = t.TempDir() + "/dnsmasq.hosts"
+	t.Cleanup(func() { defaultDnsmasqHostsFile = savedHostsFile })
+
+	backend := getMockUIBackend()
+	fake := dnsmasqctl.NewFakeController()
+	backend.dnsmasqCtl = fake
+	body := `{"mac_addr": "00:11:22:33:44:57", "ip_addr": "192.168.0.50"}`
+
+	for _, tc := range []struct {
+		name           string
+		remoteAddr     string
+		ingressPath    string
+		contentType    string
+		expectedStatus int
+	}{
+		{"from the LAN", "192.168.0.10:40000", "", "application/json", http.StatusForbidden},
+		{"from the LAN with a forged ingress header", "192.168.0.10:40000", "/api/hassio_ingress/abcdef", "application/json", http.StatusForbidden},
+		{"from the local nginx without the ingress header", "127.0.0.1:40000", "", "application/json", http.StatusForbidden},
+		{"without a Content-Type", "127.0.0.1:40000", "/api/hassio_ingress/abcdef", "", http.StatusUnsupportedMediaType},
+		{"with a form", "127.0.0.1:40000", "/api/hassio_ingress/abcdef", "application/x-www-form-urlencoded", http.StatusUnsupportedMediaType},
+		{"with text", "[::1]:40000", "/api/hassio_ingress/abcdef", "text/plain", http.StatusUnsupportedMediaType},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/reservations", strings.NewReader(body))
+		req.RemoteAddr = tc.remoteAddr
+		if tc.ingressPath != "" {
+			req.Header.Set("X-Ingress-Path", tc.ingressPath)
+		}
+		if tc.contentType != "" {
+			req.Header.Set("Content-Type", tc.contentType)
+		}
+		rec := apiServe(t, backend, req)
+		assert.Equal(t, tc.expectedStatus, rec.Code, tc.name)
+	}
+	assert.Equal(t, 0, fake.Reloads())
+
+	// the endpoints without a request body need no Content-Type
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/options/reload", nil)
+	rec := apiServe(t, backend, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	req.RemoteAddr = "[::1]:40000"
+	req.Header.Set("X-Ingress-Path", "/api/hassio_ingress/abcdef")
+	rec = apiServe(t, backend, req)
+	assert.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+
+	// reading is still allowed from the LAN
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/reservations", nil)
+	req.RemoteAddr = "192.168.0.10:40000"
+	rec = apiServe(t, backend, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = apiRequest(t, backend, http.MethodPost, "/api/v1/reservations", body)
+	assert.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+}
+
+func TestApiOpenAPI(t *testing.T) {
+	backend := getMockUIBackend()
+
+	rec := apiGet(t, backend, "/api/v1/openapi.json")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var doc map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &doc))
+	assert.Equal(t, "3.0.3", doc["openapi"])
+	assert.Contains(t, doc["paths"], "/clients/current")
+
+	rec = apiGet(t, backend, "/api/v1/openapi.yaml")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = apiGet(t, backend, "/api/v1/no-such-endpoint")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"error"`)
+}
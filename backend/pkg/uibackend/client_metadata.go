@@ -0,0 +1,128 @@
+package uibackend
+
+import (
+	"bytes"
+	"dnsmasq-dhcp-backend/pkg/trackerdb"
+	"fmt"
+	"net"
+	texttemplate "text/template"
+)
+
+// clientMetadata are the metadata of a DHCP client edited from the web UI, with the link template already parsed
+type clientMetadata struct {
+	trackerdb.DhcpClientMetadata
+	linkTemplate *texttemplate.Template // maybe nil
+}
+
+// newClientMetadata validates the given metadata; the link template is parsed exactly like the
+// link templates in the addon options, and must render to an HTTP or HTTPS URL
+func newClientMetadata(m trackerdb.DhcpClientMetadata) (clientMetadata, error) {
+	c := clientMetadata{DhcpClientMetadata: m}
+	if m.Link != "" {
+		linkTemplate, err := parseLinkTemplate(m.Link)
+		if err != nil {
+			return c, fmt.Errorf("invalid golang template found inside 'link': %w", err)
+		}
+
+		// the link is shown in the web UI: render it with sample values to refuse e.g. javascript: URLs
+		var buf bytes.Buffer
+		err = linkTemplate.Execute(&buf, map[string]string{
+			"mac":           m.MacAddr.String(),
+			"ip":            "192.168.1.2",
+			"hostname":      "hostname",
+			"friendly_name": m.FriendlyName,
+			"vendor":        "vendor",
+			"dns_domain":    "lan",
+			"fqdn":          "hostname.lan",
+		})
+		if err != nil {
+			return c, fmt.Errorf("failed to render the golang template found inside 'link': %w", err)
+		}
+		if !isValidLinkURL(buf.String()) {
+			return c, fmt.Errorf("the 'link' must be an HTTP or HTTPS URL without quotes or angle brackets, found [%s]", buf.String())
+		}
+		c.linkTemplate = linkTemplate
+	}
+	return c, nil
+}
+
+// loadClientMetadata reads the metadata of all DHCP clients from the tracker DB
+func (b *UIBackend) loadClientMetadata() error {
+	all, err := b.trackerDB.GetAllDhcpClientMetadata()
+	if err != nil {
+		return err
+	}
+
+	metadata := make(map[string]clientMetadata, len(all))
+	for _, m := range all {
+		c, err := newClientMetadata(m)
+		if err != nil {
+			// this should never happen since templates are validated before being stored
+			b.logger.Warnf("ignoring the link of %s: %s", m.MacAddr, err.Error())
+		}
+		metadata[m.MacAddr.String()] = c
+	}
+
+	b.clientMetadataLock.Lock()
+	b.clientMetadata = metadata
+	b.clientMetadataLock.Unlock()
+
+	b.logger.Infof("Acquired %d DHCP client metadata from the tracker DB\n", len(metadata))
+	return nil
+}
+
+// getClientMetadata returns the metadata edited from the web UI for the given MAC address, if any
+func (b *UIBackend) getClientMetadata(mac net.HardwareAddr) (clientMetadata, bool) {
+	b.clientMetadataLock.Lock()
+	defer b.clientMetadataLock.Unlock()
+	c, ok := b.clientMetadata[mac.String()]
+	return c, ok
+}
+
+// storeClientMetadata saves the given metadata in the tracker DB and triggers a refresh of
+// the current DHCP clients; empty metadata are deleted
+func (b *UIBackend) storeClientMetadata(c clientMetadata) error {
+	if err := b.trackerDB.SetDhcpClientMetadata(c.DhcpClientMetadata); err != nil {
+		return err
+	}
+
+	b.clientMetadataLock.Lock()
+	if b.clientMetadata == nil {
+		b.clientMetadata = make(map[string]clientMetadata)
+	}
+	if c.IsEmpty() {
+		delete(b.clientMetadata, c.MacAddr.String())
+	} else {
+		b.clientMetadata[c.MacAddr.String()] = c
+	}
+	b.clientMetadataLock.Unlock()
+
+	b.triggerClientsRefresh()
+	return nil
+}
+
+// overriddenMetadataFields returns the names of the metadata fields that are ignored for the given
+// MAC address, since the same information is provided by the addon options
+func (b *UIBackend) overriddenMetadataFields(mac net.HardwareAddr) []string {
+	opts := b.opts()
+	fields := []string{}
+
+	friendlyName, hasFriendlyName := opts.friendlyNames[mac.String()]
+	if hasFriendlyName {
+		fields = append(fields, "friendly_name")
+	}
+	reservation, hasReservation := opts.ipAddressReservationsByMAC[mac.String()]
+	if (hasFriendlyName && friendlyName.Link != nil) || (!hasFriendlyName && hasReservation && reservation.Link != nil) {
+		fields = append(fields, "link")
+	}
+	return fields
+}
+
+// triggerClientsRefresh requests the current DHCP clients to be processed again; it never blocks
+func (b *UIBackend) triggerClientsRefresh() {
+	select {
+	case b.refreshClientsCh <- struct{}{}:
+	default:
+		// a refresh is already pending
+	}
+}
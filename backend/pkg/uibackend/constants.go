@@ -6,12 +6,30 @@ import "time"
 // here has to match the server config file!
 var defaultDnsmasqLeasesFile = "/data/dnsmasq.leases"
 
+// the dnsmasq hostsfile storing the IP address reservations created from the web UI is configured
+// in the dnsmasq config file: the value here has to match the server config file!
+var defaultDnsmasqHostsFile = "/data/dnsmasq.hosts"
+
+// the dnsmasq PID file is configured in the dnsmasq config file: the value here has to match the
+// server config file!
+var defaultDnsmasqPidFile = "/run/dnsmasq.pid"
+
+// the epoch of the last SIGHUP sent to dnsmasq; must match the one used by the dhcpscript package
+var defaultDnsmasqReloadEpochFile = "/run/dnsmasq.reloadepoch"
+
 // the home assistant addon options is fixed and cannot be changed actually:
 var defaultHomeAssistantOptionsFile = "/data/options.json"
 
 // the home assistant addon config is fixed and cannot be changed actually:
 var defaultHomeAssistantConfigFile = "/opt/bin/addon-config.yaml"
 
+// the leases of another DHCP server can be imported only from the Home Assistant share folder,
+// mapped read-only inside the addon container by the addon config.yaml
+var leaseImportDir = "/share"
+
+// marker storing the checksum of the last lease database imported, to import each database only once
+var defaultLeaseImportMarker = "/data/lease-import.sha256"
+
 // location for our small DB tracking DHCP clients:
 var defaultDhcpClientTrackerDB = "/data/trackerdb.sqlite3"
 
@@ -22,6 +40,36 @@ var defaultStartEpoch = "/data/startepoch"
 // interval for checking past DHCP clients that need to be removed from the tracker DB
 var pastClientsCheckInterval = 5 * time.Minute
 
+// maximum number of DHCP events kept in the tracker DB for each DHCP client, regardless of
+// the forget_past_clients_after setting
+var maxDhcpEventsPerClient = 200
+
+// how frequently the addon options file is checked for changes
+var optionsCheckInterval = 10 * time.Second
+
+// how frequently the rogue DHCP server detector probes the networks, when not specified in the addon options
+var defaultRogueDhcpProbeInterval = 5 * time.Minute
+
+// how frequently the DHCP clients and statistics are published over MQTT, when not specified in the addon options;
+// changes to the DHCP leases are published immediately regardless of this interval
+var defaultMqttPublishInterval = time.Minute
+
+// defaults of the DHCP range usage alerts, when not specified in the addon options: the usage
+// thresholds are percentages, the horizon is how soon a DHCP range must be forecast to run out of
+// free IP addresses to raise an alert, the trend window is how far back the forecast looks
+var (
+	defaultPoolAlertWarningPercent  = 80
+	defaultPoolAlertCriticalPercent = 95
+	defaultPoolAlertHorizon         = 24 * time.Hour
+	defaultPoolAlertTrendWindow     = 24 * time.Hour
+)
+
+// max duration of each check performed by the /healthz endpoint
+var healthCheckTimeout = 500 * time.Millisecond
+
+// max duration of the graceful shutdown of the HTTP server
+var shutdownTimeout = 5 * time.Second
+
 // These absolute paths must be in sync with the Dockerfile
 var (
 	staticWebFilesDir = "/opt/web/static"
@@ -32,5 +80,34 @@ var (
 var (
 	dnsmasqMarkerForMissingHostname = "*"
 	websocketRelativeUrl            = "/ws"
+	metricsRelativeUrl              = "/metrics"
+	healthzRelativeUrl              = "/healthz"
+	livezRelativeUrl                = "/livez"
+	apiV1Prefix                     = "/api/v1"
 	unknownHostnameHtmlString       = "&lt;unknown&gt;"
 )
+
+// pagination defaults for the REST API
+var (
+	apiDefaultPageLimit = 100
+	apiMaxPageLimit     = 1000
+)
+
+// number of IP addresses returned by the address map endpoint: by default a /22 IPv4 network,
+// at most a /16 IPv4 network; larger networks are walked through in chunks
+var (
+	apiDefaultAddressMapLimit = 1024
+	apiMaxAddressMapLimit     = 65536
+)
+
+// number of free IP addresses suggested for new IP address reservations
+var (
+	defaultSuggestCount = 10
+	maxSuggestCount     = 1000
+)
+
+// max size of the body of the REST API requests
+var apiMaxRequestBodySize int64 = 64 * 1024
+
+// max size of the configuration of another DHCP server sent to the /import endpoint
+var apiMaxImportBodySize int64 = 1024 * 1024
@@ -0,0 +1,304 @@
+package uibackend
+
+import (
+	"dnsmasq-dhcp-backend/pkg/ippool"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// dhcpPoolJSON is a DHCP pool as written in the addon options.
+// The network can be described either by the start/end/netmask parameters (the original format) or
+// by the network parameter in CIDR notation, e.g. "192.168.10.0/24"; in the latter case the DHCP range
+// is given either by the range parameter, e.g. ".50-.150" or "192.168.10.64/26", or by the start/end parameters.
+type dhcpPoolJSON struct {
+	Interface string `json:"interface"`
+	Start     string `json:"start"`
+	End       string `json:"end"`
+	Gateway   string `json:"gateway"`
+	Netmask   string `json:"netmask"`
+	Network   string `json:"network"`
+	Range     string `json:"range"`
+}
+
+// dhcpPoolError is an issue found in a DHCP pool definition
+type dhcpPoolError struct {
+	// Field is the offending parameter of the pool, or empty when the issue concerns the pool as a whole
+	Field   string
+	Message string
+}
+
+func (e dhcpPoolError) Error() string {
+	if e.Field == "" {
+		return e.Message
+	}
+	return e.Field + ": " + e.Message
+}
+
+// dhcpPoolResolver accumulates the issues found while resolving a DHCP pool
+type dhcpPoolResolver struct {
+	errors []dhcpPoolError
+}
+
+func (r *dhcpPoolResolver) errorf(field string, format string, args ...any) {
+	r.errors = append(r.errors, dhcpPoolError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *dhcpPoolResolver) parseAddr(field, value string) netip.Addr {
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		r.errorf(field, "invalid IP address %q", value)
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
+
+// resolveDhcpPool converts a DHCP pool, in any of the supported formats, into an IpNetworkInfo.
+// When the gateway is omitted it defaults to the first host of the network.
+// All the issues found are returned; the IpNetworkInfo is meaningful only when there are none.
+func resolveDhcpPool(p dhcpPoolJSON) (IpNetworkInfo, []dhcpPoolError) {
+	var r dhcpPoolResolver
+	var nw IpNetworkInfo
+	if p.Network != "" {
+		nw = r.resolveNetworkFormat(p)
+	} else {
+		nw = r.resolveLegacyFormat(p)
+	}
+	if len(r.errors) > 0 {
+		return nw, r.errors
+	}
+
+	if !nw.Range().IsValid() {
+		r.errorf("", "invalid DHCP range %s-%s: the end IP must be greater than the start IP", nw.Start, nw.End)
+		return nw, r.errors
+	}
+	if !nw.HasValidIPs() {
+		// RFC 1918 (IPv4 addresses) and RFC 4193 (IPv6 addresses).
+		r.errorf("", "the IP addresses should define a coherent network: a) they should be private IPs only according to RFC 1918 and RFC 4193; b) their start and end IPs must be within the same network")
+		return nw, r.errors
+	}
+	if !nw.HasValidGateway() {
+		if p.Network != "" {
+			r.errorf("gateway", "the gateway %s must be an IP address within the network %s", nw.Gateway, nw.Network)
+		} else {
+			r.errorf("gateway", "the gateway %s must be an IP address within the network defined by the start/end/netmask parameters", nw.Gateway)
+		}
+	}
+	return nw, r.errors
+}
+
+// resolveLegacyFormat resolves a DHCP pool described by the start/end/netmask parameters
+func (r *dhcpPoolResolver) resolveLegacyFormat(p dhcpPoolJSON) IpNetworkInfo {
+	nw := IpNetworkInfo{
+		Interface: p.Interface,
+		Start:     r.parseAddr("start", p.Start),
+		End:       r.parseAddr("end", p.End),
+	}
+	if p.Gateway != "" {
+		nw.Gateway = r.parseAddr("gateway", p.Gateway)
+	}
+	if p.Range != "" {
+		r.errorf("range", "the range parameter requires the network parameter")
+	}
+
+	// IPv6 ranges use a prefix length as netmask
+	isIPv4 := !strings.Contains(p.Start, ":")
+	if p.Netmask == "" {
+		r.errorf("netmask", "missing netmask: provide either the netmask or the network parameter")
+	} else if ones, err := parseNetmask(p.Netmask, isIPv4); err != nil {
+		r.errorf("netmask", "%s", err.Error())
+	} else if nw.Start.IsValid() {
+		nw.Network = netip.PrefixFrom(nw.Start, ones).Masked()
+	}
+
+	if p.Gateway == "" && nw.Network.IsValid() {
+		nw.Gateway = nw.Network.Addr().Next()
+	}
+	return nw
+}
+
+// resolveNetworkFormat resolves a DHCP pool described by the network parameter
+func (r *dhcpPoolResolver) resolveNetworkFormat(p dhcpPoolJSON) IpNetworkInfo {
+	nw := IpNetworkInfo{Interface: p.Interface}
+	prefix, err := netip.ParsePrefix(p.Network)
+	if err != nil {
+		r.errorf("network", "invalid network %q: use the CIDR notation, e.g. 192.168.1.0/24 or fd00::/64", p.Network)
+		return nw
+	}
+	nw.Network = prefix.Masked()
+	isIPv4 := nw.Network.Addr().Is4()
+
+	if p.Netmask != "" {
+		if ones, err := parseNetmask(p.Netmask, isIPv4); err != nil {
+			r.errorf("netmask", "%s", err.Error())
+		} else if ones != nw.Network.Bits() {
+			r.errorf("netmask", "the netmask %s does not match the prefix length of the network %s", p.Netmask, nw.Network)
+		}
+	}
+
+	switch {
+	case p.Range != "" && (p.Start != "" || p.End != ""):
+		r.errorf("range", "the range parameter cannot be used together with the start and end parameters")
+	case p.Range != "":
+		if dhcpR, err := parseRangeInNetwork(p.Range, nw.Network); err != nil {
+			r.errorf("range", "%s", err.Error())
+		} else {
+			nw.Start, nw.End = dhcpR.Start, dhcpR.End
+		}
+	case p.Start != "" || p.End != "":
+		nw.Start = r.parseAddr("start", p.Start)
+		nw.End = r.parseAddr("end", p.End)
+	default:
+		r.errorf("range", "missing DHCP range: provide either the range or the start and end parameters")
+	}
+
+	if p.Gateway != "" {
+		nw.Gateway = r.parseAddr("gateway", p.Gateway)
+	} else {
+		nw.Gateway = nw.Network.Addr().Next()
+	}
+	return nw
+}
+
+// parseRangeInNetwork parses the range parameter of a DHCP pool, which is either:
+//   - a start-end pair, where each IP can be abbreviated to its host part, e.g. ".50-.150" for IPv4
+//     networks or "::100-::1ff" for IPv6 networks;
+//   - a subnet of the network in CIDR notation, e.g. "192.168.10.64/26"; the network and broadcast
+//     addresses of the network are left out.
+func parseRangeInNetwork(s string, network netip.Prefix) (ippool.Range, error) {
+	var dhcpR ippool.Range
+	if subnet, err := netip.ParsePrefix(s); err == nil {
+		subnet = subnet.Masked()
+		if subnet.Addr().BitLen() != network.Addr().BitLen() || subnet.Bits() < network.Bits() || !network.Contains(subnet.Addr()) {
+			return ippool.Range{}, fmt.Errorf("the range %s is not a subnet of the network %s", s, network)
+		}
+		dhcpR = ippool.NewRangeFromPrefix(subnet)
+
+		// the network address is never assigned; the last address is the broadcast one in IPv4 networks
+		whole := ippool.NewRangeFromPrefix(network)
+		if dhcpR.Start == whole.Start {
+			dhcpR.Start = dhcpR.Start.Next()
+		}
+		if dhcpR.End == whole.End && network.Addr().Is4() {
+			dhcpR.End = dhcpR.End.Prev()
+		}
+		return dhcpR, nil
+	}
+
+	startStr, endStr, found := strings.Cut(s, "-")
+	if !found {
+		return ippool.Range{}, fmt.Errorf("invalid range %q: use either a start-end pair, e.g. .50-.150, or a subnet, e.g. 192.168.1.64/26", s)
+	}
+	start, err := expandHostAddr(strings.TrimSpace(startStr), network)
+	if err != nil {
+		return ippool.Range{}, err
+	}
+	end, err := expandHostAddr(strings.TrimSpace(endStr), network)
+	if err != nil {
+		return ippool.Range{}, err
+	}
+	dhcpR = ippool.NewRange(start, end)
+	if !network.Contains(dhcpR.Start) || !network.Contains(dhcpR.End) {
+		return ippool.Range{}, fmt.Errorf("the range %s is outside the network %s", dhcpR, network)
+	}
+	return dhcpR, nil
+}
+
+// expandHostAddr parses an IP address of the given network, which may be abbreviated to its host part:
+// e.g. ".50" or ".1.50" in IPv4 networks replace the last bytes of the network address, while "::100"
+// in IPv6 networks is combined with the network prefix
+func expandHostAddr(s string, network netip.Prefix) (netip.Addr, error) {
+	base := network.Masked().Addr()
+	switch {
+	case base.Is4() && strings.HasPrefix(s, "."):
+		parts := strings.Split(s[1:], ".")
+		if len(parts) > 3 {
+			return netip.Addr{}, fmt.Errorf("invalid IP address %q", s)
+		}
+		addr := base.As4()
+		for i, part := range parts {
+			b, err := strconv.ParseUint(part, 10, 8)
+			if err != nil {
+				return netip.Addr{}, fmt.Errorf("invalid IP address %q", s)
+			}
+			addr[4-len(parts)+i] = byte(b)
+		}
+		return netip.AddrFrom4(addr), nil
+
+	case base.Is6() && strings.HasPrefix(s, "::"):
+		host, err := netip.ParseAddr(s)
+		if err != nil || !host.Is6() {
+			return netip.Addr{}, fmt.Errorf("invalid IP address %q", s)
+		}
+		addr, hostBytes := base.As16(), host.As16()
+		for i := range addr {
+			addr[i] |= hostBytes[i]
+		}
+		return netip.AddrFrom16(addr), nil
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("invalid IP address %q", s)
+	}
+	return addr.Unmap(), nil
+}
+
+// resolvedDhcpPoolJSON is a DHCP pool in the format used by the dnsmasq config template
+type resolvedDhcpPoolJSON struct {
+	Interface string `json:"interface"`
+	Start     string `json:"start"`
+	End       string `json:"end"`
+	Gateway   string `json:"gateway"`
+	Netmask   string `json:"netmask"`
+	Network   string `json:"network"`
+}
+
+// RunResolvePools implements the "resolve-pools" subcommand: it prints on w the DHCP pools of the
+// addon options file (the default one or the one given as first argument) as a JSON array where each pool,
+// whatever its format in the addon options, has its start, end, gateway and netmask parameters filled.
+// The dnsmasq-init script uses it to generate the dnsmasq config. It returns the process exit code.
+func RunResolvePools(args []string, w, errW io.Writer) int {
+	optionsFile := defaultHomeAssistantOptionsFile
+	if len(args) > 0 {
+		optionsFile = args[0]
+	}
+
+	data, err := os.ReadFile(optionsFile) //nolint:gosec
+	if err != nil {
+		_, _ = fmt.Fprintf(errW, "failed to read addon options: %s\n", err.Error())
+		return 2
+	}
+	var cfg addonOptionsJSON
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		_, _ = fmt.Fprintf(errW, "failed to parse addon options: %s\n", err.Error())
+		return 2
+	}
+
+	pools := make([]resolvedDhcpPoolJSON, 0, len(cfg.DhcpPool))
+	for i, p := range cfg.DhcpPool {
+		nw, errs := resolveDhcpPool(p)
+		if len(errs) > 0 {
+			_, _ = fmt.Fprintf(errW, "invalid DHCP pool dhcp_pools[%d]: %s\n", i, errs[0].Error())
+			return 1
+		}
+		pools = append(pools, resolvedDhcpPoolJSON{
+			Interface: nw.Interface,
+			Start:     nw.Start.String(),
+			End:       nw.End.String(),
+			Gateway:   nw.Gateway.String(),
+			Netmask:   nw.Netmask(),
+			Network:   nw.Network.String(),
+		})
+	}
+
+	if err := json.NewEncoder(w).Encode(pools); err != nil {
+		_, _ = fmt.Fprintf(errW, "failed to write the DHCP pools: %s\n", err.Error())
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,202 @@
+package uibackend
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveDhcpPool(t *testing.T) {
+	tests := []struct {
+		name            string
+		pool            dhcpPoolJSON
+		expectedRange   string
+		expectedGateway string
+		expectedNetwork string
+		expectedErrors  []dhcpPoolError
+	}{
+		{
+			name:            "start/end/netmask format",
+			pool:            dhcpPoolJSON{Start: "192.168.1.50", End: "192.168.1.150", Gateway: "192.168.1.254", Netmask: "255.255.255.0"},
+			expectedRange:   "192.168.1.50-192.168.1.150",
+			expectedGateway: "192.168.1.254",
+			expectedNetwork: "192.168.1.0/24",
+		},
+		{
+			name:            "start/end/netmask format without gateway",
+			pool:            dhcpPoolJSON{Start: "10.0.5.10", End: "10.0.6.100", Netmask: "255.255.252.0"},
+			expectedRange:   "10.0.5.10-10.0.6.100",
+			expectedGateway: "10.0.4.1",
+			expectedNetwork: "10.0.4.0/22",
+		},
+		{
+			name:            "network with abbreviated range",
+			pool:            dhcpPoolJSON{Network: "192.168.10.0/24", Range: ".50-.150"},
+			expectedRange:   "192.168.10.50-192.168.10.150",
+			expectedGateway: "192.168.10.1",
+			expectedNetwork: "192.168.10.0/24",
+		},
+		{
+			name:            "network with abbreviated range on 2 bytes",
+			pool:            dhcpPoolJSON{Network: "10.0.4.0/22", Range: ".5.10 - .6.100", Gateway: "10.0.7.254"},
+			expectedRange:   "10.0.5.10-10.0.6.100",
+			expectedGateway: "10.0.7.254",
+			expectedNetwork: "10.0.4.0/22",
+		},
+		{
+			name:            "network with full range",
+			pool:            dhcpPoolJSON{Network: "192.168.10.0/24", Range: "192.168.10.50-192.168.10.150"},
+			expectedRange:   "192.168.10.50-192.168.10.150",
+			expectedGateway: "192.168.10.1",
+			expectedNetwork: "192.168.10.0/24",
+		},
+		{
+			name:            "network with subnet range",
+			pool:            dhcpPoolJSON{Network: "192.168.10.0/24", Range: "192.168.10.64/26"},
+			expectedRange:   "192.168.10.64-192.168.10.127",
+			expectedGateway: "192.168.10.1",
+			expectedNetwork: "192.168.10.0/24",
+		},
+		{
+			name:            "network with the whole network as range",
+			pool:            dhcpPoolJSON{Network: "192.168.10.0/24", Range: "192.168.10.0/24", Gateway: "192.168.10.1"},
+			expectedRange:   "192.168.10.1-192.168.10.254",
+			expectedGateway: "192.168.10.1",
+			expectedNetwork: "192.168.10.0/24",
+		},
+		{
+			name:            "network with start/end and matching netmask",
+			pool:            dhcpPoolJSON{Network: "192.168.10.0/24", Start: "192.168.10.50", End: "192.168.10.150", Netmask: "255.255.255.0"},
+			expectedRange:   "192.168.10.50-192.168.10.150",
+			expectedGateway: "192.168.10.1",
+			expectedNetwork: "192.168.10.0/24",
+		},
+		{
+			name:            "non-canonical network",
+			pool:            dhcpPoolJSON{Network: "192.168.10.1/24", Range: ".50-.150"},
+			expectedRange:   "192.168.10.50-192.168.10.150",
+			expectedGateway: "192.168.10.1",
+			expectedNetwork: "192.168.10.0/24",
+		},
+		{
+			name:            "IPv6 network with abbreviated range",
+			pool:            dhcpPoolJSON{Network: "fd00:1:2:3::/64", Range: "::1000-::1fff", Gateway: "fe80::1"},
+			expectedRange:   "fd00:1:2:3::1000-fd00:1:2:3::1fff",
+			expectedGateway: "fe80::1",
+			expectedNetwork: "fd00:1:2:3::/64",
+		},
+		{
+			name:            "IPv6 network with subnet range",
+			pool:            dhcpPoolJSON{Network: "fd00::/64", Range: "fd00::/112"},
+			expectedRange:   "fd00::1-fd00::ffff",
+			expectedGateway: "fd00::1",
+			expectedNetwork: "fd00::/64",
+		},
+
+		// errors
+		{
+			name:           "invalid network",
+			pool:           dhcpPoolJSON{Network: "192.168.10.0", Range: ".50-.150"},
+			expectedErrors: []dhcpPoolError{{"network", `invalid network "192.168.10.0": use the CIDR notation, e.g. 192.168.1.0/24 or fd00::/64`}},
+		},
+		{
+			name:           "missing range",
+			pool:           dhcpPoolJSON{Network: "192.168.10.0/24"},
+			expectedErrors: []dhcpPoolError{{"range", "missing DHCP range: provide either the range or the start and end parameters"}},
+		},
+		{
+			name:           "both range and start/end",
+			pool:           dhcpPoolJSON{Network: "192.168.10.0/24", Range: ".50-.150", Start: "192.168.10.50"},
+			expectedErrors: []dhcpPoolError{{"range", "the range parameter cannot be used together with the start and end parameters"}},
+		},
+		{
+			name:           "range outside the network",
+			pool:           dhcpPoolJSON{Network: "192.168.10.0/24", Range: "192.168.11.50-192.168.11.150"},
+			expectedErrors: []dhcpPoolError{{"range", "the range 192.168.11.50-192.168.11.150 is outside the network 192.168.10.0/24"}},
+		},
+		{
+			name:           "subnet range outside the network",
+			pool:           dhcpPoolJSON{Network: "192.168.10.0/24", Range: "192.168.0.0/16"},
+			expectedErrors: []dhcpPoolError{{"range", "the range 192.168.0.0/16 is not a subnet of the network 192.168.10.0/24"}},
+		},
+		{
+			name:           "malformed range",
+			pool:           dhcpPoolJSON{Network: "192.168.10.0/24", Range: ".50"},
+			expectedErrors: []dhcpPoolError{{"range", `invalid range ".50": use either a start-end pair, e.g. .50-.150, or a subnet, e.g. 192.168.1.64/26`}},
+		},
+		{
+			name:           "invalid abbreviated IP",
+			pool:           dhcpPoolJSON{Network: "192.168.10.0/24", Range: ".50-.300"},
+			expectedErrors: []dhcpPoolError{{"range", `invalid IP address ".300"`}},
+		},
+		{
+			name:           "reversed range",
+			pool:           dhcpPoolJSON{Network: "192.168.10.0/24", Range: ".150-.50"},
+			expectedErrors: []dhcpPoolError{{"", "invalid DHCP range 192.168.10.150-192.168.10.50: the end IP must be greater than the start IP"}},
+		},
+		{
+			name:           "netmask not matching the network",
+			pool:           dhcpPoolJSON{Network: "192.168.10.0/24", Range: ".50-.150", Netmask: "255.255.0.0"},
+			expectedErrors: []dhcpPoolError{{"netmask", "the netmask 255.255.0.0 does not match the prefix length of the network 192.168.10.0/24"}},
+		},
+		{
+			name:           "gateway outside the network",
+			pool:           dhcpPoolJSON{Network: "192.168.10.0/24", Range: ".50-.150", Gateway: "192.168.11.1"},
+			expectedErrors: []dhcpPoolError{{"gateway", "the gateway 192.168.11.1 must be an IP address within the network 192.168.10.0/24"}},
+		},
+		{
+			name:           "range without network",
+			pool:           dhcpPoolJSON{Start: "192.168.1.50", End: "192.168.1.150", Netmask: "255.255.255.0", Range: ".50-.150"},
+			expectedErrors: []dhcpPoolError{{"range", "the range parameter requires the network parameter"}},
+		},
+		{
+			name:           "missing netmask",
+			pool:           dhcpPoolJSON{Start: "192.168.1.50", End: "192.168.1.150"},
+			expectedErrors: []dhcpPoolError{{"netmask", "missing netmask: provide either the netmask or the network parameter"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nw, errs := resolveDhcpPool(tt.pool)
+			assert.Equal(t, tt.expectedErrors, errs)
+			if len(tt.expectedErrors) > 0 {
+				return
+			}
+			assert.Equal(t, tt.expectedRange, nw.Range().String())
+			assert.Equal(t, tt.expectedGateway, nw.Gateway.String())
+			assert.Equal(t, tt.expectedNetwork, nw.Network.String())
+		})
+	}
+}
+
+func TestRunResolvePools(t *testing.T) {
+	dir := t.TempDir()
+
+	optionsFile := filepath.Join(dir, "options.json")
+	require.NoError(t, os.WriteFile(optionsFile, lintTestOptions(`[
+		{"interface": "eth0", "start": "192.168.1.50", "end": "192.168.1.100", "gateway": "192.168.1.254", "netmask": "255.255.255.0"},
+		{"interface": "eth1", "network": "192.168.2.0/24", "range": ".50-.100"},
+		{"interface": "eth0", "network": "fd00::/64", "range": "::1000-::1fff", "gateway": "fe80::1"}
+	]`, "", ""), 0o600))
+	var out, errOut bytes.Buffer
+	require.Equal(t, 0, RunResolvePools([]string{optionsFile}, &out, &errOut), errOut.String())
+	assert.JSONEq(t, `[
+		{"interface": "eth0", "start": "192.168.1.50", "end": "192.168.1.100", "gateway": "192.168.1.254", "netmask": "255.255.255.0", "network": "192.168.1.0/24"},
+		{"interface": "eth1", "start": "192.168.2.50", "end": "192.168.2.100", "gateway": "192.168.2.1", "netmask": "255.255.255.0", "network": "192.168.2.0/24"},
+		{"interface": "eth0", "start": "fd00::1000", "end": "fd00::1fff", "gateway": "fe80::1", "netmask": "64", "network": "fd00::/64"}
+	]`, out.String())
+
+	invalidFile := filepath.Join(dir, "invalid.json")
+	require.NoError(t, os.WriteFile(invalidFile, lintTestOptions(`[{"interface": "eth0", "network": "192.168.2.0/24"}]`, "", ""), 0o600))
+	out.Reset()
+	errOut.Reset()
+	assert.Equal(t, 1, RunResolvePools([]string{invalidFile}, &out, &errOut))
+	assert.Equal(t, "invalid DHCP pool dhcp_pools[0]: range: missing DHCP range: provide either the range or the start and end parameters\n", errOut.String())
+
+	assert.Equal(t, 2, RunResolvePools([]string{filepath.Join(dir, "missing.json")}, &out, &errOut))
+}
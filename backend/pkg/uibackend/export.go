@@ -0,0 +1,408 @@
+package uibackend
+
+import (
+	"bytes"
+	"dnsmasq-dhcp-backend/pkg/dnsmasqctl"
+	"dnsmasq-dhcp-backend/pkg/logger"
+	"dnsmasq-dhcp-backend/pkg/trackerdb"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// exportDataset identifies what is exported
+type exportDataset string
+
+const (
+	exportCurrentClients exportDataset = "current"
+	exportPastClients    exportDataset = "past"
+	exportReservations   exportDataset = "reservations"
+)
+
+var exportDatasets = []exportDataset{exportCurrentClients, exportPastClients, exportReservations}
+
+// exportFormat identifies the format of an export
+type exportFormat string
+
+const (
+	exportFormatCSV     exportFormat = "csv"
+	exportFormatJSON    exportFormat = "json"
+	exportFormatHosts   exportFormat = "hosts"   // /etc/hosts
+	exportFormatDnsmasq exportFormat = "dnsmasq" // dhcp-host= lines
+	exportFormatISC     exportFormat = "isc"     // ISC dhcpd host {} blocks
+	exportFormatKea     exportFormat = "kea"     // Kea DHCPv4 reservations
+	exportFormatYAML    exportFormat = "yaml"    // dhcp_ip_address_reservations snippet of the addon options
+)
+
+var exportFormats = []exportFormat{
+	exportFormatCSV, exportFormatJSON, exportFormatHosts, exportFormatDnsmasq, exportFormatISC, exportFormatKea, exportFormatYAML,
+}
+
+// the content type and the file extension used by the REST API for each export format
+var exportFormatMediaTypes = map[exportFormat][2]string{
+	exportFormatCSV:     {"text/csv", "csv"},
+	exportFormatJSON:    {"application/json", "json"},
+	exportFormatHosts:   {"text/plain", "hosts"},
+	exportFormatDnsmasq: {"text/plain", "conf"},
+	exportFormatISC:     {"text/plain", "conf"},
+	exportFormatKea:     {"application/json", "json"},
+	exportFormatYAML:    {"application/yaml", "yaml"},
+}
+
+// exportHost is a DHCP client or IP address reservation, as exported in the formats describing
+// hosts, i.e. all formats apart from CSV and JSON
+type exportHost struct {
+	Mac net.HardwareAddr
+	IP  netip.Addr
+
+	// Hostname is always a valid hostname, see exportHostname()
+	Hostname     string
+	FriendlyName string
+}
+
+// the characters not allowed in a hostname
+var invalidHostnameChars = regexp.MustCompile(`[^A-Za-z0-9-]+`)
+
+// exportHostname returns the first of the given names that can be converted into a valid hostname, after
+// replacing any invalid character with a hyphen; it falls back to a name derived from the MAC address
+func exportHostname(mac net.HardwareAddr, names ...string) string {
+	for _, name := range names {
+		h := strings.Trim(invalidHostnameChars.ReplaceAllString(name, "-"), "-")
+		if len(h) > 63 {
+			h = strings.TrimRight(h[:63], "-")
+		}
+		if dnsmasqctl.IsValidHostname(h) {
+			return h
+		}
+	}
+	return "host-" + strings.ReplaceAll(mac.String(), ":", "")
+}
+
+// makeHostnamesUnique appends a numeric suffix to the hostnames already used by a previous host
+func makeHostnamesUnique(hosts []exportHost) {
+	used := make(map[string]bool, len(hosts))
+	for i := range hosts {
+		base := hosts[i].Hostname
+		for n := 2; used[strings.ToLower(hosts[i].Hostname)]; n++ {
+			hosts[i].Hostname = base + "-" + strconv.Itoa(n)
+		}
+		used[strings.ToLower(hosts[i].Hostname)] = true
+	}
+}
+
+// export writes the given dataset in the given format
+func (b *UIBackend) export(w io.Writer, dataset exportDataset, format exportFormat) error {
+	var jsonItems any
+	var csvRows [][]string
+	var hosts []exportHost
+
+	switch dataset {
+	case exportCurrentClients:
+		clients := b.getCurrentClients()
+		jsonItems = clients
+		csvRows = append(csvRows, []string{"mac_addr", "ip_addr", "hostname", "friendly_name", "vendor", "has_static_ip", "is_inside_dhcp_pool", "lease_expires"})
+		for _, c := range clients {
+			hostname := c.Lease.Hostname
+			if hostname == dnsmasqMarkerForMissingHostname {
+				hostname = ""
+			}
+			csvRows = append(csvRows, []string{
+				c.Lease.MacAddr.String(), c.Lease.IPAddr.String(), hostname, c.FriendlyName, c.Vendor,
+				strconv.FormatBool(c.HasStaticIP), strconv.FormatBool(c.IsInsideDHCPPool), strconv.FormatInt(c.Lease.Expires.Unix(), 10),
+			})
+			if c.Lease.MacAddr == nil || c.Lease.IsDHCPv6() {
+				// the hosts formats describe DHCPv4 reservations, which need a MAC address
+				continue
+			}
+			hosts = append(hosts, exportHost{
+				Mac:          c.Lease.MacAddr,
+				IP:           c.Lease.IPAddr,
+				Hostname:     exportHostname(c.Lease.MacAddr, c.FriendlyName, hostname),
+				FriendlyName: c.FriendlyName,
+			})
+		}
+
+	case exportPastClients:
+		clients := b.getPastClients(b.getCurrentClients())
+		jsonItems = clients
+		csvRows = append(csvRows, []string{"mac_addr", "last_ip_addr", "hostname", "friendly_name", "vendor", "has_static_ip", "last_seen"})
+		for _, c := range clients {
+			hostname := c.PastInfo.Hostname
+			if hostname == unknownHostnameHtmlString {
+				hostname = ""
+			}
+			friendlyName := c.FriendlyName
+			if friendlyName == "N/A" {
+				friendlyName = ""
+			}
+			lastIP := ""
+			if c.PastInfo.LastIP.IsValid() {
+				lastIP = c.PastInfo.LastIP.String()
+			}
+			csvRows = append(csvRows, []string{
+				c.PastInfo.MacAddr.String(), lastIP, hostname, friendlyName, c.Vendor,
+				strconv.FormatBool(c.HasStaticIP), strconv.FormatInt(c.PastInfo.LastSeen.Unix(), 10),
+			})
+			if !c.PastInfo.LastIP.IsValid() {
+				// clients tracked before the last IP was recorded cannot be exported as hosts
+				continue
+			}
+			hosts = append(hosts, exportHost{
+				Mac:          c.PastInfo.MacAddr,
+				IP:           c.PastInfo.LastIP,
+				Hostname:     exportHostname(c.PastInfo.MacAddr, friendlyName, hostname),
+				FriendlyName: friendlyName,
+			})
+		}
+
+	case exportReservations:
+		reservations := b.getAllReservations()
+		apiReservations := make([]ApiReservation, 0, len(reservations))
+		csvRows = append(csvRows, []string{"mac_addr", "ip_addr", "name", "friendly_name", "source"})
+		for _, r := range reservations {
+			apiReservation := toApiReservation(r)
+			apiReservations = append(apiReservations, apiReservation)
+			friendlyName := b.getFriendlyNameFor(r.Mac, dnsmasqMarkerForMissingHostname)
+			if friendlyName == "" {
+				friendlyName = r.Name
+			}
+			csvRows = append(csvRows, []string{apiReservation.MacAddr, apiReservation.IPAddr, r.Name, friendlyName, apiReservation.Source})
+			hosts = append(hosts, exportHost{
+				Mac:          r.Mac,
+				IP:           r.IP,
+				Hostname:     exportHostname(r.Mac, r.Name, friendlyName),
+				FriendlyName: friendlyName,
+			})
+		}
+		jsonItems = apiReservations
+
+	default:
+		return fmt.Errorf("unknown dataset %q", dataset)
+	}
+
+	makeHostnamesUnique(hosts)
+
+	switch format {
+	case exportFormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.WriteAll(csvRows); err != nil {
+			return err
+		}
+		return cw.Error()
+	case exportFormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(jsonItems)
+	case exportFormatHosts:
+		return b.exportHostsFile(w, hosts)
+	case exportFormatDnsmasq:
+		return b.exportDnsmasq(w, hosts)
+	case exportFormatISC:
+		return exportISC(w, hosts)
+	case exportFormatKea:
+		return exportKea(w, hosts)
+	case exportFormatYAML:
+		reservations := make([]IpAddressReservation, 0, len(hosts))
+		for _, h := range hosts {
+			reservations = append(reservations, IpAddressReservation{Mac: h.Mac, IP: h.IP, Name: h.Hostname})
+		}
+		return writeAddonOptionsSnippet(w, reservations, nil)
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
+
+// exportHostsFile writes the hosts in the /etc/hosts format
+func (b *UIBackend) exportHostsFile(w io.Writer, hosts []exportHost) error {
+	var buf bytes.Buffer
+	for _, h := range hosts {
+		names := h.Hostname
+		if b.opts().dnsDomain != "" {
+			names = h.Hostname + "." + b.opts().dnsDomain + " " + h.Hostname
+		}
+		line := h.IP.String() + "\t" + names
+		if h.FriendlyName != "" && h.FriendlyName != h.Hostname {
+			line += "\t# " + h.FriendlyName
+		}
+		buf.WriteString(line + "\n")
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// exportDnsmasq writes the hosts as dnsmasq dhcp-host options, like the ones generated for the addon options
+func (b *UIBackend) exportDnsmasq(w io.Writer, hosts []exportHost) error {
+	var buf bytes.Buffer
+	for _, h := range hosts {
+		e := dnsmasqctl.HostsFileEntry{Mac: h.Mac, IP: h.IP, Name: h.Hostname, LeaseTime: b.opts().addressReservationLease}
+		buf.WriteString("dhcp-host=" + e.String() + "\n")
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// exportISC writes the hosts as ISC dhcpd host declarations
+func exportISC(w io.Writer, hosts []exportHost) error {
+	var buf bytes.Buffer
+	for _, h := range hosts {
+		if h.FriendlyName != "" && h.FriendlyName != h.Hostname {
+			buf.WriteString("# " + h.FriendlyName + "\n")
+		}
+		fmt.Fprintf(&buf, "host %s {\n  hardware ethernet %s;\n  fixed-address %s;\n}\n", h.Hostname, h.Mac, h.IP)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// exportKea writes the hosts as the "reservations" list of a Kea DHCPv4 subnet
+func exportKea(w io.Writer, hosts []exportHost) error {
+	type keaReservation struct {
+		HwAddress string `json:"hw-address"`
+		IPAddress string `json:"ip-address"`
+		Hostname  string `json:"hostname"`
+	}
+	reservations := make([]keaReservation, 0, len(hosts))
+	for _, h := range hosts {
+		reservations = append(reservations, keaReservation{HwAddress: h.Mac.String(), IPAddress: h.IP.String(), Hostname: h.Hostname})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(map[string]any{"reservations": reservations})
+}
+
+// addonOptionsSnippet is a part of the addon options, ready to be pasted in the addon configuration
+type addonOptionsSnippet struct {
+	Reservations  []addonReservationYAML  `yaml:"dhcp_ip_address_reservations"`
+	FriendlyNames []addonFriendlyNameYAML `yaml:"dhcp_clients_friendly_names,omitempty"`
+}
+
+type addonReservationYAML struct {
+	Mac  string `yaml:"mac"`
+	Name string `yaml:"name"`
+	IP   string `yaml:"ip"`
+}
+
+type addonFriendlyNameYAML struct {
+	Mac  string `yaml:"mac"`
+	Name string `yaml:"name"`
+}
+
+// writeAddonOptionsSnippet writes the given reservations and friendly names in the YAML format of the addon options
+func writeAddonOptionsSnippet(w io.Writer, reservations []IpAddressReservation, friendlyNames []DhcpClientFriendlyName) error {
+	snippet := addonOptionsSnippet{Reservations: []addonReservationYAML{}}
+	for _, r := range reservations {
+		snippet.Reservations = append(snippet.Reservations, addonReservationYAML{Mac: r.Mac.String(), Name: r.Name, IP: r.IP.String()})
+	}
+	for _, f := range friendlyNames {
+		snippet.FriendlyNames = append(snippet.FriendlyNames, addonFriendlyNameYAML{Mac: f.MacAddress.String(), Name: f.FriendlyName})
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(snippet); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// parseExportRequest validates the dataset and the format of an export
+func parseExportRequest(dataset, format string) (exportDataset, exportFormat, error) {
+	if format == "" {
+		format = string(exportFormatCSV)
+	}
+	if !slices.Contains(exportDatasets, exportDataset(dataset)) {
+		return "", "", fmt.Errorf("unknown dataset %q: valid values are %v", dataset, exportDatasets)
+	}
+	if !slices.Contains(exportFormats, exportFormat(format)) {
+		return "", "", fmt.Errorf("unknown format %q: valid values are %v", format, exportFormats)
+	}
+	return exportDataset(dataset), exportFormat(format), nil
+}
+
+// RunExport is the entrypoint of the "export" mode of the backend binary: it reads the addon options,
+// the DHCP leases and the tracker DB, exactly like the web UI backend does, and exports the
+// requested dataset on the given writer. It returns the process exit code.
+func RunExport(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	format := flags.String("format", string(exportFormatCSV), fmt.Sprintf("output format, one of %v", exportFormats))
+	flags.Usage = func() {
+		_, _ = fmt.Fprintf(stderr, "usage: backend export [-format FORMAT] DATASET\nDATASET is one of %v\n", exportDatasets)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	dataset, outFormat, err := parseExportRequest(flags.Arg(0), *format)
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err.Error())
+		return 2
+	}
+
+	b, closeDB, err := newOfflineUIBackend("export")
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err.Error())
+		return 2
+	}
+	defer closeDB()
+
+	if err := b.export(stdout, dataset, outFormat); err != nil {
+		_, _ = fmt.Fprintf(stderr, "failed to export %s: %s\n", dataset, err.Error())
+		return 1
+	}
+	return 0
+}
+
+// newOfflineUIBackend creates a UIBackend for the CLI subcommands working on the data of the running addon:
+// the addon options, the IP address reservations created from the web UI, the DHCP client metadata and the
+// current DHCP leases are loaded, and the tracker DB is opened; the returned function closes it.
+// The logs of the backend would be mixed with the output of the subcommand: only errors are returned.
+func newOfflineUIBackend(name string) (*UIBackend, func(), error) {
+	db, err := trackerdb.NewDhcpClientTrackerDB(defaultDhcpClientTrackerDB)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open the DHCP clients tracking DB: %w", err)
+	}
+	closeDB := func() {
+		_ = db.Close()
+	}
+	startEpoch, err := ReadFileAndParseInteger(defaultStartEpoch)
+	if err != nil {
+		// only the notes of the past DHCP clients depend on it
+		startEpoch = 0
+	}
+
+	b := newUIBackend(logger.NewCustomLoggerWithWriter(name, io.Discard), *db, startEpoch)
+	if err := b.readAddonOptions(); err != nil {
+		closeDB()
+		return nil, nil, fmt.Errorf("failed to read the addon options: %w", err)
+	}
+	runtime, _, err := b.readRuntimeReservations()
+	if err != nil {
+		closeDB()
+		return nil, nil, fmt.Errorf("failed to read the IP address reservations created from the web UI: %w", err)
+	}
+	b.options.Store(withRuntimeReservations(b.opts(), runtime))
+	if err := b.loadClientMetadata(); err != nil {
+		closeDB()
+		return nil, nil, fmt.Errorf("failed to read the DHCP client metadata: %w", err)
+	}
+	if err := b.readCurrentLeaseFile(); err != nil {
+		closeDB()
+		return nil, nil, fmt.Errorf("failed to read the DHCP leases: %w", err)
+	}
+	return b, closeDB, nil
+}
@@ -0,0 +1,215 @@
+package uibackend
+
+import (
+	"bytes"
+	"encoding/csv"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportHostname(t *testing.T) {
+	mac := MustParseMAC("aa:bb:cc:dd:ee:ff")
+	assert.Equal(t, "laptop", exportHostname(mac, "laptop", "ignored"))
+	assert.Equal(t, "Living-Room-TV", exportHostname(mac, "Living Room TV"))
+	assert.Equal(t, "John-s-iPhone", exportHostname(mac, "John's iPhone!"))
+	assert.Equal(t, "printer", exportHostname(mac, "", "---", "printer"))
+	assert.Equal(t, strings.Repeat("a", 63), exportHostname(mac, strings.Repeat("a", 70)))
+	assert.Equal(t, "host-aabbccddeeff", exportHostname(mac, "", "12h"))
+}
+
+// getMockExportBackend returns the mock backend with an additional IP address reservation created
+// from the web UI, without name, for 'client4'
+func getMockExportBackend() *UIBackend {
+	b := getMockUIBackend()
+	b.processLeaseUpdatesFromArray(getMockLeases())
+
+	opts := *b.opts()
+	opts.dnsDomain = "lan"
+	opts.addressReservationLease = "infinite"
+	client4 := IpAddressReservation{Mac: MustParseMAC("aa:bb:cc:dd:ee:ff"), IP: netip.MustParseAddr("192.168.0.66"), Runtime: true}
+	b.options.Store(withRuntimeReservations(&opts, map[string]IpAddressReservation{client4.Mac.String(): client4}))
+	return b
+}
+
+func TestExportReservations(t *testing.T) {
+	tests := []struct {
+		format   exportFormat
+		expected string
+	}{
+		{
+			format: exportFormatCSV,
+			expected: "mac_addr,ip_addr,name,friendly_name,source\n" +
+				"00:11:22:33:44:56,192.168.0.3,test-friendly-name,test-friendly-name,options\n" +
+				"aa:bb:cc:dd:ee:ff,192.168.0.66,,FriendlyClient4,runtime\n",
+		},
+		{
+			format: exportFormatJSON,
+			expected: `[
+  {
+    "mac_addr": "00:11:22:33:44:56",
+    "ip_addr": "192.168.0.3",
+    "name": "test-friendly-name",
+    "source": "options"
+  },
+  {
+    "mac_addr": "aa:bb:cc:dd:ee:ff",
+    "ip_addr": "192.168.0.66",
+    "name": "",
+    "source": "runtime"
+  }
+]
+`,
+		},
+		{
+			format: exportFormatHosts,
+			expected: "192.168.0.3\ttest-friendly-name.lan test-friendly-name\n" +
+				"192.168.0.66\tFriendlyClient4.lan FriendlyClient4\n",
+		},
+		{
+			format: exportFormatDnsmasq,
+			expected: "dhcp-host=00:11:22:33:44:56,test-friendly-name,192.168.0.3,infinite\n" +
+				"dhcp-host=aa:bb:cc:dd:ee:ff,FriendlyClient4,192.168.0.66,infinite\n",
+		},
+		{
+			format: exportFormatISC,
+			expected: "host test-friendly-name {\n  hardware ethernet 00:11:22:33:44:56;\n  fixed-address 192.168.0.3;\n}\n" +
+				"host FriendlyClient4 {\n  hardware ethernet aa:bb:cc:dd:ee:ff;\n  fixed-address 192.168.0.66;\n}\n",
+		},
+		{
+			format: exportFormatKea,
+			expected: `{
+  "reservations": [
+    {
+      "hw-address": "00:11:22:33:44:56",
+      "ip-address": "192.168.0.3",
+      "hostname": "test-friendly-name"
+    },
+    {
+      "hw-address": "aa:bb:cc:dd:ee:ff",
+      "ip-address": "192.168.0.66",
+      "hostname": "FriendlyClient4"
+    }
+  ]
+}
+`,
+		},
+		{
+			// the first MAC address is quoted since YAML 1.1 would read it as a sexagesimal number
+			format: exportFormatYAML,
+			expected: `dhcp_ip_address_reservations:
+  - mac: "00:11:22:33:44:56"
+    name: test-friendly-name
+    ip: 192.168.0.3
+  - mac: aa:bb:cc:dd:ee:ff
+    name: FriendlyClient4
+    ip: 192.168.0.66
+`,
+		},
+	}
+
+	backend := getMockExportBackend()
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, backend.export(&buf, exportReservations, tt.format))
+			assert.Equal(t, tt.expected, buf.String())
+		})
+	}
+}
+
+func TestExportDnsmasq_IPv6(t *testing.T) {
+	backend := getMockExportBackend()
+	hosts := []exportHost{
+		{Mac: MustParseMAC("aa:bb:cc:dd:ee:01"), IP: netip.MustParseAddr("192.168.0.10"), Hostname: "nas"},
+		{Mac: MustParseMAC("aa:bb:cc:dd:ee:02"), IP: netip.MustParseAddr("fd00::10"), Hostname: "printer"},
+	}
+
+	// dnsmasq requires IPv6 addresses to be enclosed in brackets
+	var buf bytes.Buffer
+	require.NoError(t, backend.exportDnsmasq(&buf, hosts))
+	assert.Equal(t, "dhcp-host=aa:bb:cc:dd:ee:01,nas,192.168.0.10,infinite\n"+
+		"dhcp-host=aa:bb:cc:dd:ee:02,printer,[fd00::10],infinite\n", buf.String())
+}
+
+func TestExportCurrentClients(t *testing.T) {
+	backend := getMockExportBackend()
+
+	var buf bytes.Buffer
+	require.NoError(t, backend.export(&buf, exportCurrentClients, exportFormatCSV))
+	rows, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 5)
+	assert.Equal(t, []string{"mac_addr", "ip_addr", "hostname", "friendly_name", "vendor", "has_static_ip", "is_inside_dhcp_pool", "lease_expires"}, rows[0])
+
+	// friendly names take precedence over the hostnames advertised by the clients
+	buf.Reset()
+	require.NoError(t, backend.export(&buf, exportCurrentClients, exportFormatISC))
+	assert.Contains(t, buf.String(), "host FriendlyClient1 {\n  hardware ethernet 00:11:22:33:44:55;\n  fixed-address 192.168.0.2;\n}\n")
+	assert.Contains(t, buf.String(), "host client3 {\n")
+}
+
+func TestMakeHostnamesUnique(t *testing.T) {
+	hosts := []exportHost{{Hostname: "tv"}, {Hostname: "TV"}, {Hostname: "tv-2"}, {Hostname: "tv"}}
+	makeHostnamesUnique(hosts)
+	assert.Equal(t, "tv", hosts[0].Hostname)
+	assert.Equal(t, "TV-2", hosts[1].Hostname)
+	assert.Equal(t, "tv-2-2", hosts[2].Hostname)
+	assert.Equal(t, "tv-3", hosts[3].Hostname)
+}
+
+func TestApiExport(t *testing.T) {
+	backend := getMockExportBackend()
+
+	rec := apiGet(t, backend, "/api/v1/export/reservations?format=dnsmasq")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, "text/plain; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="dhcp-reservations.conf"`, rec.Header().Get("Content-Disposition"))
+	assert.Contains(t, rec.Body.String(), "dhcp-host=00:11:22:33:44:56,test-friendly-name,192.168.0.3,infinite\n")
+
+	// CSV is the default format
+	rec = apiGet(t, backend, "/api/v1/export/past")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, `attachment; filename="dhcp-past.csv"`, rec.Header().Get("Content-Disposition"))
+
+	for _, url := range []string{"/api/v1/export/everything", "/api/v1/export/current?format=xml"} {
+		rec = apiGet(t, backend, url)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, url)
+	}
+}
+
+func TestRunExport(t *testing.T) {
+	dir := t.TempDir()
+	savedVars := []string{defaultHomeAssistantOptionsFile, defaultDnsmasqLeasesFile, defaultDnsmasqHostsFile, defaultDhcpClientTrackerDB, defaultStartEpoch}
+	defaultHomeAssistantOptionsFile = "../../../test-options.json"
+	defaultDnsmasqLeasesFile = dir + "/dnsmasq.leases"
+	defaultDnsmasqHostsFile = dir + "/dnsmasq.hosts"
+	defaultDhcpClientTrackerDB = dir + "/trackerdb.sqlite3"
+	defaultStartEpoch = dir + "/startepoch" // missing
+	t.Cleanup(func() {
+		defaultHomeAssistantOptionsFile, defaultDnsmasqLeasesFile, defaultDnsmasqHostsFile, defaultDhcpClientTrackerDB, defaultStartEpoch =
+			savedVars[0], savedVars[1], savedVars[2], savedVars[3], savedVars[4]
+	})
+	require.NoError(t, os.WriteFile(defaultDnsmasqLeasesFile, []byte("0 aa:bb:cc:dd:ee:03 192.168.1.60 laptop *\n"), 0o600))
+	require.NoError(t, os.WriteFile(defaultDnsmasqHostsFile, []byte("aa:bb:cc:dd:ee:02,printer,192.168.1.70,24h\n"), 0o600))
+
+	var stdout, stderr bytes.Buffer
+	require.Equal(t, 0, RunExport([]string{"-format", "dnsmasq", "reservations"}, &stdout, &stderr), stderr.String())
+	assert.Equal(t, "dhcp-host=aa:bb:cc:dd:ee:00,static-ip-important-host,192.168.1.15,24h\n"+
+		"dhcp-host=aa:bb:cc:dd:ee:01,static-ip-within-dhcp-range,192.168.1.55,24h\n"+
+		"dhcp-host=aa:bb:cc:dd:ee:02,printer,192.168.1.70,24h\n", stdout.String())
+
+	stdout.Reset()
+	require.Equal(t, 0, RunExport([]string{"-format", "hosts", "current"}, &stdout, &stderr), stderr.String())
+	assert.Equal(t, "192.168.1.60\tlaptop.lan laptop\n", stdout.String())
+
+	// usage errors
+	assert.Equal(t, 2, RunExport(nil, &stdout, &stderr))
+	assert.Equal(t, 2, RunExport([]string{"everything"}, &stdout, &stderr))
+	assert.Equal(t, 2, RunExport([]string{"-format", "xml", "current"}, &stdout, &stderr))
+}
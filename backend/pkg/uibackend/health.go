@@ -0,0 +1,99 @@
+package uibackend
+
+import (
+	"context"
+	"dnsmasq-dhcp-backend/pkg/leasewatcher"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// HealthCheck is the outcome of a single check performed by the /healthz endpoint
+type HealthCheck struct {
+	OK bool `json:"ok"`
+
+	// Skipped is true when the check does not apply to the current configuration
+	Skipped bool   `json:"skipped,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+func newHealthCheck(err error) HealthCheck {
+	if err != nil {
+		return HealthCheck{OK: false, Error: err.Error()}
+	}
+	return HealthCheck{OK: true}
+}
+
+// HealthStatus is returned by the /healthz endpoint
+type HealthStatus struct {
+	// Healthy is true when the lease watcher, the tracker DB and dnsmasq are all working
+	Healthy bool `json:"healthy"`
+
+	LeaseWatcher leasewatcher.Status `json:"lease_watcher"`
+	TrackerDB    HealthCheck         `json:"tracker_db"`
+
+	// Dnsmasq tells whether dnsmasq answers CHAOS queries; skipped when the DNS server is disabled
+	Dnsmasq HealthCheck `json:"dnsmasq"`
+
+	// LastLeaseUpdate is the unix time of the last processing of the lease file; note that the lease
+	// file changes only when DHCP clients get, renew or release their leases, so on a quiet network
+	// LastLeaseUpdateAgeSec might grow large without anything being wrong
+	LastLeaseUpdate       int64   `json:"last_lease_update"`
+	LastLeaseUpdateAgeSec float64 `json:"last_lease_update_age_sec"`
+}
+
+// getHealthStatus runs all the health checks
+func (b *UIBackend) getHealthStatus(ctx context.Context) HealthStatus {
+	var h HealthStatus
+
+	if b.leaseWatcher != nil {
+		h.LeaseWatcher = b.leaseWatcher.Status()
+	} else {
+		h.LeaseWatcher = leasewatcher.Status{State: leasewatcher.StateStopped, Since: b.startTimestamp}
+	}
+
+	dbCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	h.TrackerDB = newHealthCheck(b.trackerDB.Ping(dbCtx))
+
+	if b.opts().dnsEnable {
+		_, err := chaosTXTQuery(fmt.Sprintf("localhost:%d", b.opts().dnsPort), "version.bind", healthCheckTimeout)
+		h.Dnsmasq = newHealthCheck(err)
+	} else {
+		h.Dnsmasq = HealthCheck{OK: true, Skipped: true}
+	}
+
+	b.dhcpClientDataLock.Lock()
+	lastUpdate := b.dhcpClientDataTimestamp
+	b.dhcpClientDataLock.Unlock()
+	if !lastUpdate.IsZero() {
+		h.LastLeaseUpdate = lastUpdate.Unix()
+		h.LastLeaseUpdateAgeSec = time.Since(lastUpdate).Seconds()
+	}
+
+	h.Healthy = h.LeaseWatcher.IsHealthy() && h.TrackerDB.OK && h.Dnsmasq.OK
+	return h
+}
+
+// LivenessStatus is returned by the /livez endpoint
+type LivenessStatus struct {
+	Alive bool `json:"alive"`
+}
+
+// handleLivez answers as long as the backend is able to serve HTTP requests: it is used by the Home
+// Assistant watchdog, that restarts the addon when it fails. Unlike /healthz, it does not fail for
+// conditions that recover by themselves, e.g. while the lease watcher is backing off after an error
+func (b *UIBackend) handleLivez(w http.ResponseWriter, r *http.Request) {
+	b.writeJSON(w, http.StatusOK, LivenessStatus{Alive: true})
+}
+
+// handleHealthz reports the health of the backend, answering with HTTP 503 if anything is broken,
+// so that it can be used by external monitoring; it's a readiness check, not used by the watchdog
+func (b *UIBackend) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	h := b.getHealthStatus(r.Context())
+	status := http.StatusOK
+	if !h.Healthy {
+		status = http.StatusServiceUnavailable
+	}
+	b.writeJSON(w, status, h)
+}
@@ -0,0 +1,113 @@
+package uibackend
+
+import (
+	"context"
+	"dnsmasq-dhcp-backend/pkg/leasewatcher"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// healthzResponse is the subset of the /healthz response checked by the unit tests
+type healthzResponse struct {
+	Healthy      bool `json:"healthy"`
+	LeaseWatcher struct {
+		State leasewatcher.State `json:"state"`
+	} `json:"lease_watcher"`
+	TrackerDB             HealthCheck `json:"tracker_db"`
+	Dnsmasq               HealthCheck `json:"dnsmasq"`
+	LastLeaseUpdate       int64       `json:"last_lease_update"`
+	LastLeaseUpdateAgeSec float64     `json:"last_lease_update_age_sec"`
+}
+
+func getHealthz(t *testing.T, b *UIBackend) (int, healthzResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, healthzRelativeUrl, nil)
+	rec := httptest.NewRecorder()
+	b.handleHealthz(rec, req)
+
+	var h healthzResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &h), rec.Body.String())
+	return rec.Code, h
+}
+
+func TestHealthzHealthy(t *testing.T) {
+	backend := getMockUIBackend()
+	backend.processLeaseUpdatesFromArray(getMockLeases())
+
+	// a lease watcher whose watch never fails
+	backend.leaseWatcher = leasewatcher.NewWatcherWithFunc(backend.logger, "/nonexistent", backend.leasesCh,
+		func(ctx context.Context, filePath string, output chan<- []*leasewatcher.Lease, ready func()) error {
+			defer close(output)
+			ready()
+			<-ctx.Done()
+			return nil
+		})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go backend.leaseWatcher.Run(ctx)
+	require.Eventually(t, func() bool { return backend.leaseWatcher.Status().IsHealthy() }, 5*time.Second, time.Millisecond)
+
+	code, h := getHealthz(t, backend)
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, h.Healthy)
+	assert.Equal(t, leasewatcher.StateWatching, h.LeaseWatcher.State)
+	assert.Equal(t, HealthCheck{OK: true}, h.TrackerDB)
+	assert.Equal(t, HealthCheck{OK: true, Skipped: true}, h.Dnsmasq)
+	assert.NotZero(t, h.LastLeaseUpdate)
+	assert.Less(t, h.LastLeaseUpdateAgeSec, 60.0)
+}
+
+func TestHealthzUnhealthy(t *testing.T) {
+	backend := getMockUIBackend()
+
+	// enable the DNS server on a port where nobody is listening
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	backend.opts().dnsEnable = true
+	backend.opts().dnsPort = conn.LocalAddr().(*net.UDPAddr).Port
+	require.NoError(t, conn.Close())
+
+	code, h := getHealthz(t, backend)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.False(t, h.Healthy)
+	assert.Equal(t, leasewatcher.StateStopped, h.LeaseWatcher.State) // the watcher was never started
+	assert.True(t, h.TrackerDB.OK)
+	assert.False(t, h.Dnsmasq.OK)
+	assert.NotEmpty(t, h.Dnsmasq.Error)
+	assert.Zero(t, h.LastLeaseUpdate)
+}
+
+func TestLivezDuringBackoff(t *testing.T) {
+	backend := getMockUIBackend()
+
+	// a lease watcher whose watch keeps failing, so that it is backing off most of the time
+	backend.leaseWatcher = leasewatcher.NewWatcherWithFunc(backend.logger, "/nonexistent", backend.leasesCh,
+		func(ctx context.Context, filePath string, output chan<- []*leasewatcher.Lease, ready func()) error {
+			defer close(output)
+			return errors.New("inotify failure")
+		})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go backend.leaseWatcher.Run(ctx)
+	require.Eventually(t, func() bool { return backend.leaseWatcher.Status().State == leasewatcher.StateBackoff }, 5*time.Second, time.Millisecond)
+
+	// the readiness check fails...
+	code, h := getHealthz(t, backend)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.False(t, h.Healthy)
+
+	// ...but the watchdog must not restart the addon
+	req := httptest.NewRequest(http.MethodGet, livezRelativeUrl, nil)
+	rec := httptest.NewRecorder()
+	backend.handleLivez(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"alive": true}`, rec.Body.String())
+}
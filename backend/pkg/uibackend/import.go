@@ -0,0 +1,214 @@
+package uibackend
+
+import (
+	"bytes"
+	"dnsmasq-dhcp-backend/pkg/dhcpimport"
+	"dnsmasq-dhcp-backend/pkg/dnsmasqctl"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"strings"
+)
+
+// importResult holds the IP address reservations and the friendly names imported from the configuration
+// of another DHCP server, that can be added to the addon options
+type importResult struct {
+	reservations  []IpAddressReservation
+	friendlyNames []DhcpClientFriendlyName
+
+	// findings has the Path of each ConfigFinding set to the location in the imported configuration
+	findings []ConfigFinding
+}
+
+// importHostname converts the name of an imported host into a name accepted by dnsmasq: a domain
+// name is replaced by its first label, while any other invalid or missing name is sanitized like
+// exports do, since the dhcp-host options generated from the addon options always have a name
+func importHostname(mac net.HardwareAddr, name string) string {
+	if dnsmasqctl.IsValidHostname(name) {
+		return name
+	}
+	if label, _, found := strings.Cut(name, "."); found && dnsmasqctl.IsValidHostname(label) {
+		return label
+	}
+	return exportHostname(mac, name)
+}
+
+// importHosts converts the hosts found in the configuration of another DHCP server into IP address
+// reservations (for hosts with an IP address) and friendly names (for the other hosts), then checks
+// them together with the given addon options, exactly like the addon does when it starts: the hosts
+// causing errors are reported in the findings and left out of the result
+func importHosts(optionsData []byte, hosts []dhcpimport.Host, skipped []dhcpimport.Skipped) (importResult, error) {
+	res := importResult{findings: []ConfigFinding{}}
+	for _, s := range skipped {
+		res.findings = append(res.findings, ConfigFinding{Path: s.Location, Severity: ConfigFindingWarning, Message: "not imported: " + s.Reason})
+	}
+
+	var reservationHosts, friendlyNameHosts []dhcpimport.Host
+	var reservations []IpAddressReservation
+	var friendlyNames []DhcpClientFriendlyName
+	for _, h := range hosts {
+		if !h.IP.IsValid() {
+			friendlyNameHosts = append(friendlyNameHosts, h)
+			friendlyNames = append(friendlyNames, DhcpClientFriendlyName{MacAddress: h.Mac, FriendlyName: h.Name})
+			continue
+		}
+
+		name := importHostname(h.Mac, h.Name)
+		if h.Name != "" && name != h.Name {
+			res.findings = append(res.findings, ConfigFinding{Path: h.Location, Severity: ConfigFindingWarning,
+				Message: fmt.Sprintf("the name %q is not a valid hostname: using %q", h.Name, name)})
+		}
+		reservationHosts = append(reservationHosts, h)
+		reservations = append(reservations, IpAddressReservation{Name: name, Mac: h.Mac, IP: h.IP})
+	}
+
+	// append the imported hosts to the addon options, remembering where each of them comes from
+	cfg := map[string]any{}
+	if len(optionsData) > 0 {
+		if err := json.Unmarshal(optionsData, &cfg); err != nil {
+			return importResult{}, fmt.Errorf("invalid addon options: %w", err)
+		}
+	}
+	locations := map[string]string{}
+	existingReservations, _ := cfg["dhcp_ip_address_reservations"].([]any)
+	reservationPaths := make([]string, len(reservations))
+	for i, r := range reservations {
+		reservationPaths[i] = fmt.Sprintf("dhcp_ip_address_reservations[%d]", len(existingReservations))
+		locations[reservationPaths[i]] = reservationHosts[i].Location
+		existingReservations = append(existingReservations, map[string]any{"mac": r.Mac.String(), "name": r.Name, "ip": r.IP.String()})
+	}
+	cfg["dhcp_ip_address_reservations"] = existingReservations
+	existingFriendlyNames, _ := cfg["dhcp_clients_friendly_names"].([]any)
+	friendlyNamePaths := make([]string, len(friendlyNames))
+	for i, f := range friendlyNames {
+		friendlyNamePaths[i] = fmt.Sprintf("dhcp_clients_friendly_names[%d]", len(existingFriendlyNames))
+		locations[friendlyNamePaths[i]] = friendlyNameHosts[i].Location
+		existingFriendlyNames = append(existingFriendlyNames, map[string]any{"mac": f.MacAddress.String(), "name": f.FriendlyName})
+	}
+	cfg["dhcp_clients_friendly_names"] = existingFriendlyNames
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return importResult{}, err
+	}
+
+	// keep only the findings about the imported hosts
+	rejected := map[string]bool{}
+	for _, f := range LintAddonOptions(data) {
+		entryPath, _, _ := strings.Cut(f.Path, ".")
+		location, imported := locations[entryPath]
+		if !imported {
+			continue
+		}
+		for path, loc := range locations {
+			f.Message = strings.ReplaceAll(f.Message, path, loc)
+		}
+		f.Path = location
+		res.findings = append(res.findings, f)
+		if f.Severity == ConfigFindingError {
+			rejected[entryPath] = true
+		}
+	}
+
+	for i, r := range reservations {
+		if !rejected[reservationPaths[i]] {
+			res.reservations = append(res.reservations, r)
+		}
+	}
+	for i, f := range friendlyNames {
+		if !rejected[friendlyNamePaths[i]] {
+			res.friendlyNames = append(res.friendlyNames, f)
+		}
+	}
+	return res, nil
+}
+
+// yaml returns the imported reservations and friendly names in the YAML format of the addon options
+func (res importResult) yaml() (string, error) {
+	var buf bytes.Buffer
+	if err := writeAddonOptionsSnippet(&buf, res.reservations, res.friendlyNames); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// parseImportFormat validates the format of an import
+func parseImportFormat(format string) (dhcpimport.Format, error) {
+	if !slices.Contains(dhcpimport.Formats, dhcpimport.Format(format)) {
+		return "", fmt.Errorf("unknown format %q: valid values are %v", format, dhcpimport.Formats)
+	}
+	return dhcpimport.Format(format), nil
+}
+
+// RunImport is the entrypoint of the "import" mode of the backend binary: it reads the configuration
+// of another DHCP server from the given file (or from stdin), checks the hosts found inside it against
+// the addon options and writes them in the YAML format of the addon options. It returns the process
+// exit code.
+func RunImport(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	format := flags.String("format", "", fmt.Sprintf("format of the configuration, one of %v", dhcpimport.Formats))
+	flags.Usage = func() {
+		_, _ = fmt.Fprintf(stderr, "usage: backend import -format FORMAT [FILE]\nthe configuration is read from stdin if FILE is missing or is -\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return 2
+	}
+	inFormat, err := parseImportFormat(*format)
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err.Error())
+		return 2
+	}
+
+	in := stdin
+	if flags.NArg() == 1 && flags.Arg(0) != "-" {
+		f, err := os.Open(flags.Arg(0))
+		if err != nil {
+			_, _ = fmt.Fprintf(stderr, "failed to read the configuration: %s\n", err.Error())
+			return 2
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		in = f
+	}
+	hosts, skipped, err := dhcpimport.Parse(inFormat, in)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "failed to parse the configuration: %s\n", err.Error())
+		return 2
+	}
+
+	optionsData, err := os.ReadFile(defaultHomeAssistantOptionsFile)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "failed to read the addon options, the imported hosts are checked only against each other: %s\n", err.Error())
+	}
+	res, err := importHosts(optionsData, hosts, skipped)
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err.Error())
+		return 2
+	}
+	out, err := res.yaml()
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err.Error())
+		return 2
+	}
+
+	for _, f := range res.findings {
+		_, _ = fmt.Fprintln(stderr, f.String())
+	}
+	_, _ = fmt.Fprintf(stderr, "imported %d IP address reservations and %d friendly names: found %d issues\n",
+		len(res.reservations), len(res.friendlyNames), len(res.findings))
+	_, _ = fmt.Fprint(stdout, out)
+	if HasConfigErrors(res.findings) {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,138 @@
+package uibackend
+
+import (
+	"bytes"
+	"dnsmasq-dhcp-backend/pkg/dhcpimport"
+	"encoding/json"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// importTestConfig is a Pi-hole configuration to be imported along with test-options.json
+const importTestConfig = `dhcp-host=aa:bb:cc:dd:ee:10,192.168.1.20,nas.lan
+dhcp-host=aa:bb:cc:dd:ee:11,192.168.1.15,printer
+dhcp-host=aa:bb:cc:dd:ee:12,192.168.1.254
+dhcp-host=aa:bb:cc:dd:ee:13,10.0.0.5,far
+dhcp-host=aa:bb:cc:dd:ee:14,192.168.1.20,duplicate
+dhcp-host=aa:bb:cc:dd:ee:15,Living Room TV
+dhcp-host=id:01:aa:bb:cc:dd:ee:16,192.168.1.30
+`
+
+func TestImportHostname(t *testing.T) {
+	mac := MustParseMAC("aa:bb:cc:dd:ee:ff")
+	assert.Equal(t, "host-aabbccddeeff", importHostname(mac, ""))
+	assert.Equal(t, "nas", importHostname(mac, "nas"))
+	assert.Equal(t, "nas", importHostname(mac, "nas.lan"))
+	assert.Equal(t, "my-nas", importHostname(mac, "my nas"))
+}
+
+func TestImportHosts(t *testing.T) {
+	optionsData, err := os.ReadFile("../../../test-options.json")
+	require.NoError(t, err)
+	hosts, skipped, err := dhcpimport.Parse(dhcpimport.FormatPihole, strings.NewReader(importTestConfig))
+	require.NoError(t, err)
+
+	res, err := importHosts(optionsData, hosts, skipped)
+	require.NoError(t, err)
+	assert.Equal(t, []IpAddressReservation{
+		{Name: "nas", Mac: MustParseMAC("aa:bb:cc:dd:ee:10"), IP: netip.MustParseAddr("192.168.1.20")},
+		{Name: "far", Mac: MustParseMAC("aa:bb:cc:dd:ee:13"), IP: netip.MustParseAddr("10.0.0.5")},
+	}, res.reservations)
+	assert.Equal(t, []DhcpClientFriendlyName{
+		{MacAddress: MustParseMAC("aa:bb:cc:dd:ee:15"), FriendlyName: "Living Room TV"},
+	}, res.friendlyNames)
+
+	findings := make([]string, 0, len(res.findings))
+	for _, f := range res.findings {
+		findings = append(findings, f.String())
+	}
+	assert.ElementsMatch(t, []string{
+		"warning: line 7: not imported: host identified by DHCP client ID",
+		`warning: line 1: the name "nas.lan" is not a valid hostname: using "nas"`,
+		"error: line 2: IP address 192.168.1.15 is already reserved in dhcp_ip_address_reservations[0]",
+		"error: line 3: IP address 192.168.1.254 is the gateway of the network defined in dhcp_pools[0]",
+		"warning: line 4: IP address 10.0.0.5 is outside all the networks defined in dhcp_pools: dnsmasq will never assign it",
+		"error: line 5: IP address 192.168.1.20 is already reserved in line 1",
+	}, findings)
+
+	out, err := res.yaml()
+	require.NoError(t, err)
+	assert.Equal(t, `dhcp_ip_address_reservations:
+  - mac: aa:bb:cc:dd:ee:10
+    name: nas
+    ip: 192.168.1.20
+  - mac: aa:bb:cc:dd:ee:13
+    name: far
+    ip: 10.0.0.5
+dhcp_clients_friendly_names:
+  - mac: aa:bb:cc:dd:ee:15
+    name: Living Room TV
+`, out)
+}
+
+func TestApiImport(t *testing.T) {
+	savedOptionsFile := defaultHomeAssistantOptionsFile
+	defaultHomeAssistantOptionsFile = "../../../test-options.json"
+	t.Cleanup(func() { defaultHomeAssistantOptionsFile = savedOptionsFile })
+	backend := getMockUIBackend()
+
+	rec := apiRequest(t, backend, http.MethodPost, "/api/v1/import?format=pihole", apiImportBody(t, importTestConfig))
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var preview ApiImportPreview
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &preview))
+	assert.Equal(t, []ApiImportedHost{
+		{MacAddr: "aa:bb:cc:dd:ee:10", IPAddr: "192.168.1.20", Name: "nas"},
+		{MacAddr: "aa:bb:cc:dd:ee:13", IPAddr: "10.0.0.5", Name: "far"},
+	}, preview.Reservations)
+	assert.Equal(t, []ApiImportedHost{{MacAddr: "aa:bb:cc:dd:ee:15", Name: "Living Room TV"}}, preview.FriendlyNames)
+	assert.Len(t, preview.Findings, 6)
+	assert.Contains(t, preview.YAML, "dhcp_ip_address_reservations:\n")
+
+	for url, body := range map[string]string{
+		"/api/v1/import":               apiImportBody(t, importTestConfig),
+		"/api/v1/import?format=xml":    apiImportBody(t, importTestConfig),
+		"/api/v1/import?format=kea":    apiImportBody(t, `{"Dhcp4": `),
+		"/api/v1/import?format=isc":    apiImportBody(t, "host laptop {"),
+		"/api/v1/import?format=pihole": importTestConfig, // not a JSON body
+	} {
+		rec = apiRequest(t, backend, http.MethodPost, url, body)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, url)
+	}
+}
+
+// apiImportBody returns the body of a POST /import request carrying the given configuration file
+func apiImportBody(t *testing.T, config string) string {
+	t.Helper()
+	body, err := json.Marshal(apiImportRequest{Config: config})
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestRunImport(t *testing.T) {
+	savedOptionsFile := defaultHomeAssistantOptionsFile
+	defaultHomeAssistantOptionsFile = "../../../test-options.json"
+	t.Cleanup(func() { defaultHomeAssistantOptionsFile = savedOptionsFile })
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 1, RunImport([]string{"-format", "pihole"}, strings.NewReader(importTestConfig), &stdout, &stderr))
+	assert.Contains(t, stdout.String(), "    name: nas\n")
+	assert.Contains(t, stderr.String(), "error: line 5: IP address 192.168.1.20 is already reserved in line 1\n")
+	assert.Contains(t, stderr.String(), "imported 2 IP address reservations and 1 friendly names: found 6 issues\n")
+
+	configFile := t.TempDir() + "/dhcp"
+	require.NoError(t, os.WriteFile(configFile, []byte("config host\n\toption mac 'aa:bb:cc:dd:ee:10'\n\toption ip '192.168.1.20'\n"), 0o600))
+	stdout.Reset()
+	assert.Equal(t, 0, RunImport([]string{"-format", "openwrt", configFile}, nil, &stdout, &stderr))
+	assert.Equal(t, "dhcp_ip_address_reservations:\n  - mac: aa:bb:cc:dd:ee:10\n    name: host-aabbccddee10\n    ip: 192.168.1.20\n", stdout.String())
+
+	// usage errors
+	assert.Equal(t, 2, RunImport(nil, nil, &stdout, &stderr))
+	assert.Equal(t, 2, RunImport([]string{"-format", "isc", "a", "b"}, nil, &stdout, &stderr))
+	assert.Equal(t, 2, RunImport([]string{"-format", "isc", t.TempDir() + "/missing"}, nil, &stdout, &stderr))
+}
@@ -1,48 +1,157 @@
 package uibackend
 
 import (
+	"dnsmasq-dhcp-backend/pkg/ippool"
 	"fmt"
 	"net"
+	"net/netip"
+	"strconv"
+	"strings"
 )
 
 // IpNetworkInfo contains all details about a network attached to the addon, as specified in the config file
 type IpNetworkInfo struct {
 	Interface string
-	Start     net.IP
-	End       net.IP
-	Gateway   net.IP
-	Netmask   net.IPMask
+	Start     netip.Addr
+	End       netip.Addr
+	Gateway   netip.Addr
+
+	// Network is the network containing the DHCP range, in its canonical (masked) form
+	Network netip.Prefix
 }
 
-func (nw IpNetworkInfo) HasValidIPs() bool {
-	// NOTE: IsPrivate reports whether ip is a private address, according to RFC 1918 (IPv4 addresses) and RFC 4193 (IPv6 addresses).
+// newIpNetworkInfo creates the IpNetworkInfo for the given DHCP range, parsing the gateway and netmask
+// as read from the addon config file
+func newIpNetworkInfo(iface string, dhcpR ippool.Range, gateway, netmask string) IpNetworkInfo {
+	ipNetInfo := IpNetworkInfo{
+		Interface: iface,
+		Start:     dhcpR.Start,
+		End:       dhcpR.End,
+	}
+	if gw, err := netip.ParseAddr(gateway); err == nil {
+		ipNetInfo.Gateway = gw.Unmap()
+	}
 
-	if nw.Start.IsPrivate() &&
-		nw.End.IsPrivate() &&
-		nw.Gateway.IsPrivate() {
+	// an invalid netmask leaves the network invalid, which is then reported by HasValidIPs()
+	if ones, err := parseNetmask(netmask, dhcpR.Start.Is4()); err == nil && dhcpR.Start.IsValid() {
+		ipNetInfo.Network = netip.PrefixFrom(dhcpR.Start, ones).Masked()
+	}
+	return ipNetInfo
+}
 
-		// net.IPMask.Size() returns 0,0 in case of invalid netmasks
-		if ones, zeros := nw.Netmask.Size(); ones != 0 && zeros != 0 {
-			// all private IPs and mask is valid: ok
+// parseNetmask parses the netmask of a DHCP range and returns its prefix length: IPv4 ranges use the dotted
+// notation, e.g. "255.255.255.0", while IPv6 ranges use the prefix length, e.g. "64" or "/64", which is what
+// dnsmasq expects for them
+func parseNetmask(netmask string, isIPv4 bool) (int, error) {
+	if !isIPv4 {
+		if m, err := netip.ParseAddr(netmask); err == nil && m.Is6() {
+			// the IPv6 netmask notation, e.g. "ffff:ffff:ffff:ffff::"
+			if ones, bits := net.IPMask(m.AsSlice()).Size(); bits != 0 && ones != 0 {
+				return ones, nil
+			}
+		}
+		ones, err := strconv.Atoi(strings.TrimPrefix(netmask, "/"))
+		if err != nil || ones <= 0 || ones >= 128 {
+			return 0, fmt.Errorf("invalid prefix length %q: IPv6 DHCP ranges need a prefix length like 64", netmask)
+		}
+		return ones, nil
+	}
 
-			// check start/end IPs are in the same network
+	m, err := netip.ParseAddr(netmask)
+	if err != nil || !m.Is4() {
+		return 0, fmt.Errorf("invalid IP address %q", netmask)
+	}
+	// net.IPMask.Size() returns 0,0 in case of non-canonical netmasks
+	ones, bits := net.IPMask(m.AsSlice()).Size()
+	if bits == 0 || ones == 0 {
+		return 0, fmt.Errorf("invalid netmask %q", netmask)
+	}
+	return ones, nil
+}
+
+// IsIPv6 returns true for DHCPv6 ranges
+func (nw IpNetworkInfo) IsIPv6() bool {
+	return nw.Start.Is6()
+}
 
-			theNetwork := net.IPNet{IP: nw.Start, Mask: nw.Netmask}
-			return theNetwork.Contains(nw.End)
+func (nw IpNetworkInfo) HasValidIPs() bool {
+	// NOTE: IsPrivate reports whether ip is a private address, according to RFC 1918 (IPv4 addresses) and RFC 4193 (IPv6 addresses).
+	isValid := func(ip netip.Addr) bool {
+		if nw.IsIPv6() {
+			// IPv6 networks are often assigned a global prefix by the ISP, besides the ULA one
+			return ip.Is6() && (ip.IsPrivate() || ip.IsGlobalUnicast())
 		}
+		return ip.Is4() && ip.IsPrivate()
+	}
+
+	if isValid(nw.Start) &&
+		isValid(nw.End) &&
+		(nw.IsIPv6() || isValid(nw.Gateway)) &&
+		nw.Network.IsValid() && nw.Network.Bits() > 0 {
+
+		// all private IPs and network is valid: ok
+		// check start/end IPs are in the same network
+		return nw.Network.Contains(nw.Start) && nw.Network.Contains(nw.End)
 	}
 	return false
 }
 
 func (nw IpNetworkInfo) HasValidGateway() bool {
-	// ensure IPs are of the same family (IPv4 or IPv6)
-	theNetwork := net.IPNet{IP: nw.Start, Mask: nw.Netmask}
+	if nw.IsIPv6() && nw.Gateway.Is6() && nw.Gateway.IsLinkLocalUnicast() {
+		// IPv6 routers advertise themselves with their link-local address
+		return true
+	}
+
+	// check that the gateway IP is inside the network (this also ensures IPs are of the same family)
+	return nw.Network.IsValid() && nw.Network.Contains(nw.Gateway)
+}
+
+// Range returns the DHCP range (start/end IPs) of this network
+func (nw IpNetworkInfo) Range() ippool.Range {
+	return ippool.NewRange(nw.Start, nw.End)
+}
+
+// ContainsInRange checks if the given IP is inside the DHCP range of this network
+func (nw IpNetworkInfo) ContainsInRange(ip netip.Addr) bool {
+	return nw.Range().Contains(ip)
+}
+
+// ContainsInNetwork checks if the given IP is inside the network;
+// this is typically a superset of the DHCP range
+func (nw IpNetworkInfo) ContainsInNetwork(ip netip.Addr) bool {
+	return nw.Network.IsValid() && nw.Network.Contains(ip.Unmap())
+}
 
-	// check that the gateway IP is inside the network
-	return theNetwork.Contains(nw.Gateway)
+// NetworkAddr returns the network address (i.e. the first address) of the network
+func (nw IpNetworkInfo) NetworkAddr() netip.Addr {
+	if !nw.Network.IsValid() {
+		return netip.Addr{}
+	}
+	return nw.Network.Addr()
+}
+
+// BroadcastAddr returns the broadcast address (i.e. the last address) of the network;
+// IPv6 has no broadcast so an invalid netip.Addr is returned for IPv6 networks
+func (nw IpNetworkInfo) BroadcastAddr() netip.Addr {
+	if !nw.Network.IsValid() || !nw.Network.Addr().Is4() {
+		return netip.Addr{}
+	}
+	return ippool.NewRangeFromPrefix(nw.Network).End
+}
+
+// Netmask returns the netmask of the network in the format dnsmasq expects: the dotted notation
+// for IPv4 networks, e.g. "255.255.255.0", and the prefix length for IPv6 networks, e.g. "64"
+func (nw IpNetworkInfo) Netmask() string {
+	if !nw.Network.IsValid() {
+		return ""
+	}
+	if nw.Network.Addr().Is6() {
+		return strconv.Itoa(nw.Network.Bits())
+	}
+	return net.IP(net.CIDRMask(nw.Network.Bits(), 32)).String()
 }
 
 func (nw IpNetworkInfo) String() string {
-	return fmt.Sprintf("Interface: %s, Start: %s, End: %s, Gateway: %s, Netmask: %s",
-		nw.Interface, nw.Start, nw.End, nw.Gateway, nw.Netmask)
+	return fmt.Sprintf("Interface: %s, Start: %s, End: %s, Gateway: %s, Network: %s",
+		nw.Interface, nw.Start, nw.End, nw.Gateway, nw.Network)
 }
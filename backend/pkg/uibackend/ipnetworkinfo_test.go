@@ -1,8 +1,9 @@
 package uibackend
 
 import (
+	"dnsmasq-dhcp-backend/pkg/ippool"
 	"fmt"
-	"net"
+	"net/netip"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -16,46 +17,46 @@ func TestIpNetworkInfo_HasValidIPs(t *testing.T) {
 		// IPv4
 		{
 			netInfo: IpNetworkInfo{
-				Start:   net.IP{192, 168, 3, 4},     // a private IP
-				End:     net.IP{192, 168, 7, 8},     // a private IP
-				Gateway: net.IP{192, 168, 11, 12},   // a private IP
-				Netmask: net.IPMask{255, 255, 0, 0}, // equivalent to /16
+				Start:   netip.MustParseAddr("192.168.3.4"),      // a private IP
+				End:     netip.MustParseAddr("192.168.7.8"),      // a private IP
+				Gateway: netip.MustParseAddr("192.168.11.12"),    // a private IP
+				Network: netip.MustParsePrefix("192.168.0.0/16"), // a /16 network
 			},
 			expected: true,
 		},
 		{
 			netInfo: IpNetworkInfo{
-				Start:   net.IP{192, 168, 3, 50},      // a private IP
-				End:     net.IP{192, 168, 3, 150},     // a private IP
-				Gateway: net.IP{192, 168, 3, 254},     // a private IP
-				Netmask: net.IPMask{255, 255, 255, 0}, // equivalent to /24
+				Start:   netip.MustParseAddr("192.168.3.50"),     // a private IP
+				End:     netip.MustParseAddr("192.168.3.150"),    // a private IP
+				Gateway: netip.MustParseAddr("192.168.3.254"),    // a private IP
+				Network: netip.MustParsePrefix("192.168.3.0/24"), // a /24 network
 			},
 			expected: true,
 		},
 		{
 			netInfo: IpNetworkInfo{
-				Start:   net.IP{192, 168, 3, 150},     // a private IP
-				End:     net.IP{192, 168, 3, 50},      // a private IP
-				Gateway: net.IP{192, 168, 3, 254},     // a private IP
-				Netmask: net.IPMask{255, 255, 255, 0}, // equivalent to /24
+				Start:   netip.MustParseAddr("192.168.3.150"),    // a private IP
+				End:     netip.MustParseAddr("192.168.3.50"),     // a private IP
+				Gateway: netip.MustParseAddr("192.168.3.254"),    // a private IP
+				Network: netip.MustParsePrefix("192.168.3.0/24"), // a /24 network
 			},
 			expected: true, // start and end are swapped, but the network is still valid
 		},
 		{
 			netInfo: IpNetworkInfo{
-				Start:   net.IP{192, 170, 0, 1},       // not a private IP
-				End:     net.IP{192, 170, 0, 100},     // not a private IP
-				Gateway: net.IP{192, 170, 0, 2},       // no a private IP but inside the network
-				Netmask: net.IPMask{255, 255, 255, 0}, // equivalent to /24
+				Start:   netip.MustParseAddr("192.170.0.1"),      // not a private IP
+				End:     netip.MustParseAddr("192.170.0.100"),    // not a private IP
+				Gateway: netip.MustParseAddr("192.170.0.2"),      // no a private IP but inside the network
+				Network: netip.MustParsePrefix("192.170.0.0/24"), // a /24 network
 			},
 			expected: false,
 		},
 		{
 			netInfo: IpNetworkInfo{
-				Start:   net.IP{1, 2, 3, 4},             // not a private IP
-				End:     net.IP{5, 6, 7, 8},             // not a private IP
-				Gateway: net.IP{192, 168, 3, 254},       // a private IP - not inside the network
-				Netmask: net.IPMask{255, 255, 255, 255}, // equivalent to /32
+				Start:   netip.MustParseAddr("1.2.3.4"),       // not a private IP
+				End:     netip.MustParseAddr("5.6.7.8"),       // not a private IP
+				Gateway: netip.MustParseAddr("192.168.3.254"), // a private IP - not inside the network
+				Network: netip.MustParsePrefix("1.2.3.4/32"),  // a /32 network
 			},
 			expected: false,
 		},
@@ -63,39 +64,48 @@ func TestIpNetworkInfo_HasValidIPs(t *testing.T) {
 		// IPv6
 		{
 			netInfo: IpNetworkInfo{
-				Start:   net.ParseIP("fd12:3456:789a:1::10"),  // a private IP
-				End:     net.ParseIP("fd12:3456:789a:1::100"), // a private IP
-				Gateway: net.ParseIP("fd12:3456:789a:1::1"),   // a private IP
-				Netmask: net.CIDRMask(64, 128),                // this is a /64 IPv6 netmask
+				Start:   netip.MustParseAddr("fd12:3456:789a:1::10"),    // a private IP
+				End:     netip.MustParseAddr("fd12:3456:789a:1::100"),   // a private IP
+				Gateway: netip.MustParseAddr("fd12:3456:789a:1::1"),     // a private IP
+				Network: netip.MustParsePrefix("fd12:3456:789a:1::/64"), // a /64 IPv6 network
 			},
 			expected: true,
 		},
 		{
 			netInfo: IpNetworkInfo{
-				Start:   net.ParseIP("fd12:3456:789a:1::100"), // a private IP - start is greater than end
-				End:     net.ParseIP("fd12:3456:789a:1::10"),  // a private IP
-				Gateway: net.ParseIP("fd12:3456:789a:1::1"),   // a private IP
-				Netmask: net.CIDRMask(64, 128),                // this is a /64 IPv6 netmask
+				Start:   netip.MustParseAddr("fd12:3456:789a:1::100"),   // a private IP - start is greater than end
+				End:     netip.MustParseAddr("fd12:3456:789a:1::10"),    // a private IP
+				Gateway: netip.MustParseAddr("fd12:3456:789a:1::1"),     // a private IP
+				Network: netip.MustParsePrefix("fd12:3456:789a:1::/64"), // a /64 IPv6 network
 			},
 			expected: true, // start and end are swapped, but the network is still valid
 		},
 		{
 			netInfo: IpNetworkInfo{
-				Start:   net.ParseIP("fd12:3456:789a:1::10"),  // a private IP
-				End:     net.ParseIP("fd12:3456:789a:1::100"), // a private IP
-				Gateway: net.ParseIP("fd12:3456:789a:1::1"),   // a private IP
-				Netmask: net.IPMask{255, 255, 255, 255},       // ipv4 netmask with an IPv6 network
+				Start:   netip.MustParseAddr("fd12:3456:789a:1::10"),  // a private IP
+				End:     netip.MustParseAddr("fd12:3456:789a:1::100"), // a private IP
+				Gateway: netip.MustParseAddr("fd12:3456:789a:1::1"),   // a private IP
+				Network: netip.MustParsePrefix("192.168.0.0/32"),      // an IPv4 network with IPv6 start/end IPs
 			},
 			expected: false,
 		},
+		{
+			netInfo: IpNetworkInfo{
+				Start:   netip.MustParseAddr("2001:db8:1:2::1000"),  // a global unicast IP, as assigned by many ISPs
+				End:     netip.MustParseAddr("2001:db8:1:2::1fff"),  // a global unicast IP
+				Gateway: netip.MustParseAddr("fe80::1"),             // the gateway is not used by DHCPv6
+				Network: netip.MustParsePrefix("2001:db8:1:2::/64"), // a /64 IPv6 network
+			},
+			expected: true,
+		},
 
 		// corner cases
 		{
 			netInfo: IpNetworkInfo{
-				Start:   nil,                            // test nil entry
-				End:     nil,                            // test nil entry
-				Gateway: net.IP{1, 2, 3, 4},             // valid IPv4
-				Netmask: net.IPMask{255, 255, 255, 255}, // equivalent to /32
+				Start:   netip.Addr{},                   // test nil entry
+				End:     netip.Addr{},                   // test nil entry
+				Gateway: netip.MustParseAddr("1.2.3.4"), // valid IPv4
+				Network: netip.Prefix{},                 // test invalid entry
 			},
 			expected: false,
 		},
@@ -115,28 +125,28 @@ func TestIpNetworkInfo_HasValidGateway(t *testing.T) {
 		// IPv4
 		{
 			netInfo: IpNetworkInfo{
-				Start:   net.IP{192, 168, 3, 4},
-				End:     net.IP{192, 168, 7, 8},
-				Gateway: net.IP{192, 168, 11, 12},   // gateway is within the (large) network /16
-				Netmask: net.IPMask{255, 255, 0, 0}, // equivalent to /16
+				Start:   netip.MustParseAddr("192.168.3.4"),
+				End:     netip.MustParseAddr("192.168.7.8"),
+				Gateway: netip.MustParseAddr("192.168.11.12"),    // gateway is within the (large) network /16
+				Network: netip.MustParsePrefix("192.168.0.0/16"), // a /16 network
 			},
 			expected: true,
 		},
 		{
 			netInfo: IpNetworkInfo{
-				Start:   net.IP{192, 168, 3, 50},
-				End:     net.IP{192, 168, 3, 150},
-				Gateway: net.IP{192, 168, 3, 254},     // gateway is within the network /24
-				Netmask: net.IPMask{255, 255, 255, 0}, // equivalent to /24
+				Start:   netip.MustParseAddr("192.168.3.50"),
+				End:     netip.MustParseAddr("192.168.3.150"),
+				Gateway: netip.MustParseAddr("192.168.3.254"),    // gateway is within the network /24
+				Network: netip.MustParsePrefix("192.168.3.0/24"), // a /24 network
 			},
 			expected: true, // it's fine to have the gateway outside the range defined by start/end IPs, but it must be within the network defined by start/netmask
 		},
 		{
 			netInfo: IpNetworkInfo{
-				Start:   net.IP{192, 168, 3, 50},
-				End:     net.IP{192, 168, 3, 150},
-				Gateway: net.IP{192, 168, 4, 254},     // invalid gateway, since it belongs to another network
-				Netmask: net.IPMask{255, 255, 255, 0}, // equivalent to /24
+				Start:   netip.MustParseAddr("192.168.3.50"),
+				End:     netip.MustParseAddr("192.168.3.150"),
+				Gateway: netip.MustParseAddr("192.168.4.254"),    // invalid gateway, since it belongs to another network
+				Network: netip.MustParsePrefix("192.168.3.0/24"), // a /24 network
 			},
 			expected: false,
 		},
@@ -144,39 +154,48 @@ func TestIpNetworkInfo_HasValidGateway(t *testing.T) {
 		// IPv6
 		{
 			netInfo: IpNetworkInfo{
-				Start:   net.ParseIP("fd12:3456:789a:1::10"),  // a private IP
-				End:     net.ParseIP("fd12:3456:789a:1::100"), // a private IP
-				Gateway: net.ParseIP("fd12:3456:789a:1::1"),   // a private IP
-				Netmask: net.CIDRMask(64, 128),                // this is a /64 IPv6 netmask
+				Start:   netip.MustParseAddr("fd12:3456:789a:1::10"),    // a private IP
+				End:     netip.MustParseAddr("fd12:3456:789a:1::100"),   // a private IP
+				Gateway: netip.MustParseAddr("fd12:3456:789a:1::1"),     // a private IP
+				Network: netip.MustParsePrefix("fd12:3456:789a:1::/64"), // a /64 IPv6 network
 			},
 			expected: true, // it's fine to have the gateway outside the range defined by start/end IPs, but it must be within the network defined by start/netmask
 		},
 		{
 			netInfo: IpNetworkInfo{
-				Start:   net.ParseIP("fd12:3456:789a:1::10"),  // a private IP
-				End:     net.ParseIP("fd12:3456:789a:1::100"), // a private IP
-				Gateway: net.ParseIP("fd12:3456:789a:1::15"),  // a private IP
-				Netmask: net.CIDRMask(64, 128),                // this is a /64 IPv6 netmask
+				Start:   netip.MustParseAddr("fd12:3456:789a:1::10"),    // a private IP
+				End:     netip.MustParseAddr("fd12:3456:789a:1::100"),   // a private IP
+				Gateway: netip.MustParseAddr("fd12:3456:789a:1::15"),    // a private IP
+				Network: netip.MustParsePrefix("fd12:3456:789a:1::/64"), // a /64 IPv6 network
 			},
 			expected: true,
 		},
 		{
 			netInfo: IpNetworkInfo{
-				Start:   net.ParseIP("fd12:3456:789a:1::10"),  // a private IP
-				End:     net.ParseIP("fd12:3456:789a:1::100"), // a private IP
-				Gateway: net.ParseIP("fd12:ffff:ffff:1::15"),  // a private IP outside the IPv6 network
-				Netmask: net.CIDRMask(64, 128),                // this is a /64 IPv6 netmask
+				Start:   netip.MustParseAddr("fd12:3456:789a:1::10"),    // a private IP
+				End:     netip.MustParseAddr("fd12:3456:789a:1::100"),   // a private IP
+				Gateway: netip.MustParseAddr("fd12:ffff:ffff:1::15"),    // a private IP outside the IPv6 network
+				Network: netip.MustParsePrefix("fd12:3456:789a:1::/64"), // a /64 IPv6 network
 			},
 			expected: false,
 		},
+		{
+			netInfo: IpNetworkInfo{
+				Start:   netip.MustParseAddr("fd12:3456:789a:1::10"),    // a private IP
+				End:     netip.MustParseAddr("fd12:3456:789a:1::100"),   // a private IP
+				Gateway: netip.MustParseAddr("fe80::1"),                 // IPv6 routers advertise their link-local address
+				Network: netip.MustParsePrefix("fd12:3456:789a:1::/64"), // a /64 IPv6 network
+			},
+			expected: true,
+		},
 
 		// corner cases
 		{
 			netInfo: IpNetworkInfo{
-				Start:   nil,                            // test nil entry
-				End:     nil,                            // test nil entry
-				Gateway: net.IP{1, 2, 3, 4},             // valid IPv4
-				Netmask: net.IPMask{255, 255, 255, 255}, // equivalent to /32
+				Start:   netip.Addr{},                   // test nil entry
+				End:     netip.Addr{},                   // test nil entry
+				Gateway: netip.MustParseAddr("1.2.3.4"), // valid IPv4
+				Network: netip.Prefix{},                 // test invalid entry
 			},
 			expected: false,
 		},
@@ -187,3 +206,73 @@ func TestIpNetworkInfo_HasValidGateway(t *testing.T) {
 		assert.Equal(t, test.expected, actual)
 	}
 }
+
+func TestIpNetworkInfo_NetworkAndBroadcastAddr(t *testing.T) {
+	tests := []struct {
+		netInfo           IpNetworkInfo
+		expectedNetwork   string
+		expectedBroadcast string
+	}{
+		{
+			netInfo:           newIpNetworkInfo("eth0", ippool.NewRangeFromString("192.168.1.10", "192.168.1.100"), "192.168.1.1", "255.255.255.0"),
+			expectedNetwork:   "192.168.1.0",
+			expectedBroadcast: "192.168.1.255",
+		},
+		{
+			netInfo:           newIpNetworkInfo("eth0", ippool.NewRangeFromString("10.0.5.10", "10.0.6.100"), "10.0.4.1", "255.255.252.0"),
+			expectedNetwork:   "10.0.4.0",
+			expectedBroadcast: "10.0.7.255",
+		},
+		{
+			// IPv6 has no broadcast address
+			netInfo:           newIpNetworkInfo("eth0", ippool.NewRangeFromString("fd12:3456:789a:1::10", "fd12:3456:789a:1::100"), "fd12:3456:789a:1::1", "ffff:ffff:ffff:ffff::"),
+			expectedNetwork:   "fd12:3456:789a:1::",
+			expectedBroadcast: "invalid IP",
+		},
+		{
+			// invalid netmask
+			netInfo:           newIpNetworkInfo("eth0", ippool.NewRangeFromString("192.168.1.10", "192.168.1.100"), "192.168.1.1", "255.0.255.0"),
+			expectedNetwork:   "invalid IP",
+			expectedBroadcast: "invalid IP",
+		},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expectedNetwork, test.netInfo.NetworkAddr().String(), test.netInfo.String())
+		assert.Equal(t, test.expectedBroadcast, test.netInfo.BroadcastAddr().String(), test.netInfo.String())
+	}
+}
+
+func TestParseNetmask(t *testing.T) {
+	for _, tt := range []struct {
+		netmask  string
+		isIPv4   bool
+		expected int // 0 for invalid netmasks
+	}{
+		{"255.255.255.0", true, 24},
+		{"255.255.252.0", true, 22},
+		{"64", false, 64},
+		{"/112", false, 112},
+		{"ffff:ffff:ffff:ffff::", false, 64},
+		{"24", true, 0},
+		{"255.0.255.0", true, 0},
+		{"255.255.255.0", false, 0},
+		{"128", false, 0},
+		{"not-a-netmask", true, 0},
+	} {
+		ones, err := parseNetmask(tt.netmask, tt.isIPv4)
+		assert.Equal(t, tt.expected, ones, tt.netmask)
+		assert.Equal(t, tt.expected == 0, err != nil, tt.netmask)
+	}
+
+	nw := newIpNetworkInfo("eth0", ippool.NewRangeFromString("fd00::100", "fd00::1ff"), "fe80::1", "64")
+	assert.True(t, nw.IsIPv6())
+	assert.True(t, nw.HasValidIPs())
+	assert.True(t, nw.ContainsInNetwork(netip.MustParseAddr("fd00::ffff")))
+	assert.Equal(t, "/64", IpPoolToHtmlTemplateRanges([]IpNetworkInfo{nw})[0].Netmask)
+	assert.Equal(t, "64", nw.Netmask())
+
+	nw = newIpNetworkInfo("eth0", ippool.NewRangeFromString("10.0.5.10", "10.0.6.100"), "10.0.4.1", "255.255.252.0")
+	assert.Equal(t, "255.255.252.0", nw.Netmask())
+	assert.Equal(t, "10.0.4.0/22", nw.Network.String())
+}
@@ -0,0 +1,194 @@
+package uibackend
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"dnsmasq-dhcp-backend/pkg/dhcpimport"
+	"dnsmasq-dhcp-backend/pkg/dnsmasqctl"
+	"dnsmasq-dhcp-backend/pkg/leasewatcher"
+	"dnsmasq-dhcp-backend/pkg/logger"
+	"dnsmasq-dhcp-backend/pkg/trackerdb"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// selectImportedLeases returns the leases of another DHCP server that dnsmasq can keep serving: the
+// leases that expired, that are outside the DHCP pool, that conflict with an IP address reservation
+// or with a lease already known to dnsmasq are returned as skipped
+func selectImportedLeases(opts *AddonOptions, existing []*leasewatcher.Lease, leases []dhcpimport.Lease, now time.Time) ([]dhcpimport.Lease, []dhcpimport.Skipped) {
+	leasedIPs := map[string]bool{}
+	leasedMACs := map[string]bool{}
+	for _, l := range existing {
+		leasedIPs[l.IPAddr.String()] = true
+		leasedMACs[l.MacAddr.String()] = true
+	}
+
+	var accepted []dhcpimport.Lease
+	var skipped []dhcpimport.Skipped
+	for _, l := range leases {
+		var reason string
+		reservationByIP, hasReservationByIP := opts.ipAddressReservationsByIP[l.IP]
+		reservationByMAC, hasReservationByMAC := opts.ipAddressReservationsByMAC[l.Mac.String()]
+		switch {
+		case !l.Expires.IsZero() && !l.Expires.After(now):
+			reason = fmt.Sprintf("the lease of %s expired on %s", l.IP, l.Expires.Format(time.RFC3339))
+		case !opts.dhcpPool.Contains(l.IP):
+			reason = fmt.Sprintf("IP address %s is outside the DHCP pool", l.IP)
+		case hasReservationByIP && reservationByIP.Mac.String() != l.Mac.String():
+			reason = fmt.Sprintf("IP address %s is reserved for the MAC address %s", l.IP, reservationByIP.Mac)
+		case hasReservationByMAC && reservationByMAC.IP != l.IP:
+			reason = fmt.Sprintf("MAC address %s has the IP address %s reserved", l.Mac, reservationByMAC.IP)
+		case leasedIPs[l.IP.String()]:
+			reason = fmt.Sprintf("IP address %s is already leased by dnsmasq", l.IP)
+		case leasedMACs[l.Mac.String()]:
+			reason = fmt.Sprintf("MAC address %s already has a lease in dnsmasq", l.Mac)
+		}
+		if reason != "" {
+			skipped = append(skipped, dhcpimport.Skipped{Location: l.Location, Reason: reason})
+			continue
+		}
+
+		leasedIPs[l.IP.String()] = true
+		leasedMACs[l.Mac.String()] = true
+		accepted = append(accepted, l)
+	}
+	return accepted, skipped
+}
+
+// dnsmasqLeaseLine converts an imported lease into a line of the dnsmasq lease file, i.e.
+// "<expiry> <MAC address> <IP address> <hostname> <client ID>"
+func dnsmasqLeaseLine(l dhcpimport.Lease) string {
+	var expiry int64 // zero means infinite for dnsmasq
+	if !l.Expires.IsZero() {
+		expiry = l.Expires.Unix()
+	}
+	hostname := dnsmasqMarkerForMissingHostname
+	if dnsmasqctl.IsValidHostname(l.Hostname) {
+		hostname = l.Hostname
+	}
+	return fmt.Sprintf("%d %s %s %s %s\n", expiry, l.Mac, l.IP, hostname, dnsmasqMarkerForMissingHostname)
+}
+
+// appendDnsmasqLeases appends the imported leases to the dnsmasq lease file, that must not be in use
+// by dnsmasq
+func appendDnsmasqLeases(leases []dhcpimport.Lease) error {
+	f, err := os.OpenFile(defaultDnsmasqLeasesFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644) //nolint:gosec
+	if err != nil {
+		return err
+	}
+	for _, l := range leases {
+		if _, err := f.WriteString(dnsmasqLeaseLine(l)); err != nil {
+			_ = f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// RunImportLeases is the entrypoint of the "import-leases" mode of the backend binary, used by the
+// dnsmasq-init script before starting dnsmasq: it imports the valid leases found in the lease database
+// configured in the addon options into the dnsmasq lease file, so that the DHCP clients of another DHCP
+// server keep their IP addresses, and tracks their clients in the tracker DB.
+// Each lease database is imported only once, even if the addon is restarted.
+// All messages are printed on the given writer; the returned exit code is non-zero if the import failed.
+func RunImportLeases(w io.Writer) int {
+	db, err := trackerdb.NewDhcpClientTrackerDB(defaultDhcpClientTrackerDB)
+	if err != nil {
+		_, _ = fmt.Fprintf(w, "failed to open the DHCP clients tracking DB: %s\n", err.Error())
+		return 2
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+	startEpoch, err := ReadFileAndParseInteger(defaultStartEpoch)
+	if err != nil {
+		_, _ = fmt.Fprintf(w, "failed to read the DHCP server start epoch: %s\n", err.Error())
+		return 2
+	}
+
+	b := newUIBackend(logger.NewCustomLoggerWithWriter("import-leases", io.Discard), *db, startEpoch)
+	if err := b.readAddonOptions(); err != nil {
+		_, _ = fmt.Fprintf(w, "failed to read the addon options: %s\n", err.Error())
+		return 2
+	}
+	leaseImportFile := b.opts().leaseImportFile
+	if leaseImportFile == "" {
+		return 0
+	}
+	runtime, _, err := b.readRuntimeReservations()
+	if err != nil {
+		_, _ = fmt.Fprintf(w, "failed to read the IP address reservations created from the web UI: %s\n", err.Error())
+		return 2
+	}
+	opts := withRuntimeReservations(b.opts(), runtime)
+
+	data, err := os.ReadFile(leaseImportFile)
+	if err != nil {
+		_, _ = fmt.Fprintf(w, "failed to read the lease database to import: %s\n", err.Error())
+		return 1
+	}
+	checksum := sha256.Sum256(data)
+	marker := hex.EncodeToString(checksum[:])
+	if imported, err := os.ReadFile(defaultLeaseImportMarker); err == nil && strings.TrimSpace(string(imported)) == marker {
+		_, _ = fmt.Fprintf(w, "the leases of %s have already been imported: skipping the import\n", leaseImportFile)
+		return 0
+	}
+
+	leases, skipped, format, err := dhcpimport.ParseLeases(bytes.NewReader(data))
+	if err != nil {
+		_, _ = fmt.Fprintf(w, "failed to parse %s: %s\n", leaseImportFile, err.Error())
+		return 1
+	}
+
+	leaseFile, err := os.OpenFile(defaultDnsmasqLeasesFile, os.O_RDONLY|os.O_CREATE, 0o600)
+	if err != nil {
+		_, _ = fmt.Fprintf(w, "failed to read the DHCP leases: %s\n", err.Error())
+		return 1
+	}
+	existing, err := leasewatcher.ReadLeases(leaseFile)
+	_ = leaseFile.Close()
+	if err != nil {
+		_, _ = fmt.Fprintf(w, "failed to read the DHCP leases: %s\n", err.Error())
+		return 1
+	}
+
+	now := time.Now()
+	accepted, rejected := selectImportedLeases(opts, existing, leases, now)
+
+	// the clients are tracked before touching the lease file: if that fails, nothing is imported and the
+	// next start retries the whole import, instead of skipping the leases already in the lease file
+	clients := make([]trackerdb.DhcpClient, 0, len(accepted))
+	for _, l := range accepted {
+		clients = append(clients, trackerdb.DhcpClient{
+			MacAddr:              l.Mac,
+			Hostname:             l.Hostname,
+			LastSeen:             now,
+			DhcpServerStartEpoch: startEpoch,
+			LastIP:               l.IP,
+			FirstSeen:            now,
+		})
+	}
+	if err := db.TrackNewDhcpClients(clients); err != nil {
+		_, _ = fmt.Fprintf(w, "failed to track the DHCP clients: %s\n", err.Error())
+		return 1
+	}
+	if err := appendDnsmasqLeases(accepted); err != nil {
+		_, _ = fmt.Fprintf(w, "failed to write the DHCP leases: %s\n", err.Error())
+		return 1
+	}
+	if err := os.WriteFile(defaultLeaseImportMarker, []byte(marker+"\n"), 0o600); err != nil {
+		_, _ = fmt.Fprintf(w, "failed to remember the import of %s: %s\n", leaseImportFile, err.Error())
+		return 1
+	}
+
+	for _, s := range append(skipped, rejected...) {
+		_, _ = fmt.Fprintf(w, "skipped %s\n", s.String())
+	}
+	_, _ = fmt.Fprintf(w, "imported %d leases from %s (%s lease database): skipped %d leases\n",
+		len(accepted), leaseImportFile, format, len(skipped)+len(rejected))
+	return 0
+}
@@ -0,0 +1,220 @@
+package uibackend
+
+import (
+	"bytes"
+	"dnsmasq-dhcp-backend/pkg/dhcpimport"
+	"dnsmasq-dhcp-backend/pkg/leasewatcher"
+	"dnsmasq-dhcp-backend/pkg/trackerdb"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectImportedLeases(t *testing.T) {
+	optionsData, err := os.ReadFile("../../../test-options.json")
+	require.NoError(t, err)
+	opts, err := parseAddonOptions(optionsData)
+	require.NoError(t, err)
+
+	now := time.Now()
+	lease := func(location, mac, ip string, expires time.Time) dhcpimport.Lease {
+		return dhcpimport.Lease{Location: location, Mac: MustParseMAC(mac), IP: netip.MustParseAddr(ip), Expires: expires}
+	}
+	existing := []*leasewatcher.Lease{
+		{MacAddr: MustParseMAC("aa:bb:cc:dd:ee:20"), IPAddr: netip.MustParseAddr("192.168.1.70")},
+	}
+	leases := []dhcpimport.Lease{
+		lease("line 1", "aa:bb:cc:dd:ee:10", "192.168.1.60", now.Add(time.Hour)),
+		lease("line 2", "aa:bb:cc:dd:ee:11", "192.168.2.60", time.Time{}),
+		lease("line 3", "aa:bb:cc:dd:ee:12", "192.168.1.61", now.Add(-time.Hour)),
+		lease("line 4", "aa:bb:cc:dd:ee:13", "192.168.1.200", now.Add(time.Hour)),
+		lease("line 5", "aa:bb:cc:dd:ee:14", "192.168.1.55", now.Add(time.Hour)),
+		lease("line 6", "aa:bb:cc:dd:ee:00", "192.168.1.62", now.Add(time.Hour)),
+		lease("line 7", "aa:bb:cc:dd:ee:01", "192.168.1.55", now.Add(time.Hour)),
+		lease("line 8", "aa:bb:cc:dd:ee:15", "192.168.1.70", now.Add(time.Hour)),
+		lease("line 9", "aa:bb:cc:dd:ee:20", "192.168.1.63", now.Add(time.Hour)),
+		lease("line 10", "aa:bb:cc:dd:ee:10", "192.168.1.64", now.Add(time.Hour)),
+	}
+
+	accepted, skipped := selectImportedLeases(opts, existing, leases, now)
+	assert.Equal(t, []dhcpimport.Lease{leases[0], leases[1], leases[6]}, accepted)
+	reasons := make([]string, 0, len(skipped))
+	for _, s := range skipped {
+		reasons = append(reasons, s.String())
+	}
+	assert.Equal(t, []string{
+		fmt.Sprintf("line 3: the lease of 192.168.1.61 expired on %s", now.Add(-time.Hour).Format(time.RFC3339)),
+		"line 4: IP address 192.168.1.200 is outside the DHCP pool",
+		"line 5: IP address 192.168.1.55 is reserved for the MAC address aa:bb:cc:dd:ee:01",
+		"line 6: MAC address aa:bb:cc:dd:ee:00 has the IP address 192.168.1.15 reserved",
+		"line 8: IP address 192.168.1.70 is already leased by dnsmasq",
+		"line 9: MAC address aa:bb:cc:dd:ee:20 already has a lease in dnsmasq",
+		"line 10: MAC address aa:bb:cc:dd:ee:10 already has a lease in dnsmasq",
+	}, reasons)
+}
+
+func TestDnsmasqLeaseLine(t *testing.T) {
+	l := dhcpimport.Lease{Mac: MustParseMAC("aa:bb:cc:dd:ee:10"), IP: netip.MustParseAddr("192.168.1.60"), Hostname: "laptop", Expires: time.Unix(1704405600, 0)}
+	assert.Equal(t, "1704405600 aa:bb:cc:dd:ee:10 192.168.1.60 laptop *\n", dnsmasqLeaseLine(l))
+
+	l.Expires = time.Time{}
+	l.Hostname = "John's laptop"
+	assert.Equal(t, "0 aa:bb:cc:dd:ee:10 192.168.1.60 * *\n", dnsmasqLeaseLine(l))
+}
+
+// setupRunImportLeases points the files used by RunImportLeases to a temporary directory, with a dnsmasq
+// lease file containing a single lease; it returns the directory and a function setting lease_import.file
+func setupRunImportLeases(t *testing.T) (string, func(leaseImportFile string)) {
+	t.Helper()
+	dir := t.TempDir()
+	savedVars := []string{defaultHomeAssistantOptionsFile, defaultDnsmasqLeasesFile, defaultDnsmasqHostsFile, defaultDhcpClientTrackerDB, defaultStartEpoch, defaultLeaseImportMarker}
+	defaultHomeAssistantOptionsFile = dir + "/options.json"
+	defaultDnsmasqLeasesFile = dir + "/dnsmasq.leases"
+	defaultDnsmasqHostsFile = dir + "/dnsmasq.hosts" // missing
+	defaultDhcpClientTrackerDB = dir + "/trackerdb.sqlite3"
+	defaultStartEpoch = dir + "/startepoch"
+	defaultLeaseImportMarker = dir + "/lease-import.sha256"
+	t.Cleanup(func() {
+		defaultHomeAssistantOptionsFile, defaultDnsmasqLeasesFile, defaultDnsmasqHostsFile, defaultDhcpClientTrackerDB, defaultStartEpoch, defaultLeaseImportMarker =
+			savedVars[0], savedVars[1], savedVars[2], savedVars[3], savedVars[4], savedVars[5]
+	})
+
+	// set lease_import.file in the test options
+	optionsData, err := os.ReadFile("../../../test-options.json")
+	require.NoError(t, err)
+	cfg := map[string]any{}
+	require.NoError(t, json.Unmarshal(optionsData, &cfg))
+	writeOptions := func(leaseImportFile string) {
+		cfg["lease_import"] = map[string]any{"file": leaseImportFile}
+		data, err := json.Marshal(cfg)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(defaultHomeAssistantOptionsFile, data, 0o600))
+	}
+	require.NoError(t, os.WriteFile(defaultStartEpoch, []byte("3\n"), 0o600))
+	require.NoError(t, os.WriteFile(defaultDnsmasqLeasesFile, []byte("0 aa:bb:cc:dd:ee:20 192.168.1.70 * *\n"), 0o600))
+	return dir, writeOptions
+}
+
+func TestRunImportLeases(t *testing.T) {
+	dir, writeOptions := setupRunImportLeases(t)
+
+	// nothing to import
+	var out bytes.Buffer
+	writeOptions("")
+	assert.Equal(t, 0, RunImportLeases(&out))
+	assert.Empty(t, out.String())
+
+	leaseImportFile := dir + "/dhcpd.leases"
+	require.NoError(t, os.WriteFile(leaseImportFile, []byte(`lease 192.168.1.60 {
+  ends never;
+  binding state active;
+  hardware ethernet aa:bb:cc:dd:ee:10;
+  client-hostname "laptop";
+}
+lease 192.168.1.200 {
+  ends never;
+  binding state active;
+  hardware ethernet aa:bb:cc:dd:ee:11;
+}
+`), 0o600))
+	writeOptions(leaseImportFile)
+	assert.Equal(t, 0, RunImportLeases(&out))
+	assert.Equal(t, "skipped line 7: IP address 192.168.1.200 is outside the DHCP pool\n"+
+		"imported 1 leases from "+leaseImportFile+" (isc lease database): skipped 1 leases\n", out.String())
+
+	leases, err := os.ReadFile(defaultDnsmasqLeasesFile)
+	require.NoError(t, err)
+	assert.Equal(t, "0 aa:bb:cc:dd:ee:20 192.168.1.70 * *\n0 aa:bb:cc:dd:ee:10 192.168.1.60 laptop *\n", string(leases))
+
+	db, err := trackerdb.NewDhcpClientTrackerDB(defaultDhcpClientTrackerDB)
+	require.NoError(t, err)
+	client, err := db.GetDhcpClient(MustParseMAC("aa:bb:cc:dd:ee:10"))
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+	require.NotNil(t, client)
+	assert.Equal(t, "laptop", client.Hostname)
+	assert.Equal(t, 3, client.DhcpServerStartEpoch)
+	assert.Equal(t, netip.MustParseAddr("192.168.1.60"), client.LastIP)
+
+	// the same lease database is imported only once
+	out.Reset()
+	assert.Equal(t, 0, RunImportLeases(&out))
+	assert.Contains(t, out.String(), "have already been imported")
+	leasesAfter, err := os.ReadFile(defaultDnsmasqLeasesFile)
+	require.NoError(t, err)
+	assert.Equal(t, leases, leasesAfter)
+
+	// errors
+	require.NoError(t, os.WriteFile(leaseImportFile, []byte("not a lease database\n"), 0o600))
+	assert.Equal(t, 1, RunImportLeases(&out))
+	writeOptions(dir + "/missing")
+	assert.Equal(t, 1, RunImportLeases(&out))
+	require.NoError(t, os.Remove(defaultStartEpoch))
+	assert.Equal(t, 2, RunImportLeases(&out))
+}
+
+func TestRunImportLeases_TrackerDBFailure(t *testing.T) {
+	dir, writeOptions := setupRunImportLeases(t)
+	leaseImportFile := dir + "/dhcpd.leases"
+	require.NoError(t, os.WriteFile(leaseImportFile, []byte(`lease 192.168.1.60 {
+  ends never;
+  hardware ethernet aa:bb:cc:dd:ee:10;
+}
+lease 192.168.1.61 {
+  ends never;
+  hardware ethernet aa:bb:cc:dd:ee:11;
+}
+`), 0o600))
+	writeOptions(leaseImportFile)
+
+	// make the tracker DB fail on the second client
+	db, err := trackerdb.NewDhcpClientTrackerDB(defaultDhcpClientTrackerDB)
+	require.NoError(t, err)
+	_, err = db.DB.Exec(`CREATE TRIGGER fail_import BEFORE INSERT ON dhcp_clients
+		WHEN NEW.mac_addr = 'aa:bb:cc:dd:ee:11' BEGIN SELECT RAISE(ABORT, 'injected failure'); END;`)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	var out bytes.Buffer
+	assert.Equal(t, 1, RunImportLeases(&out))
+	assert.Contains(t, out.String(), "injected failure")
+
+	// nothing was imported...
+	leases, err := os.ReadFile(defaultDnsmasqLeasesFile)
+	require.NoError(t, err)
+	assert.Equal(t, "0 aa:bb:cc:dd:ee:20 192.168.1.70 * *\n", string(leases))
+	assert.NoFileExists(t, defaultLeaseImportMarker)
+
+	// ...so that the next start imports all the leases and tracks all their clients
+	db, err = trackerdb.NewDhcpClientTrackerDB(defaultDhcpClientTrackerDB)
+	require.NoError(t, err)
+	_, err = db.GetDhcpClient(MustParseMAC("aa:bb:cc:dd:ee:10"))
+	assert.ErrorIs(t, err, trackerdb.ErrDhcpClientNotFound)
+	_, err = db.DB.Exec(`DROP TRIGGER fail_import;`)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	out.Reset()
+	assert.Equal(t, 0, RunImportLeases(&out))
+	assert.Contains(t, out.String(), "imported 2 leases")
+	leases, err = os.ReadFile(defaultDnsmasqLeasesFile)
+	require.NoError(t, err)
+	assert.Equal(t, "0 aa:bb:cc:dd:ee:20 192.168.1.70 * *\n0 aa:bb:cc:dd:ee:10 192.168.1.60 * *\n0 aa:bb:cc:dd:ee:11 192.168.1.61 * *\n", string(leases))
+
+	db, err = trackerdb.NewDhcpClientTrackerDB(defaultDhcpClientTrackerDB)
+	require.NoError(t, err)
+	defer func() {
+		_ = db.Close()
+	}()
+	for _, mac := range []string{"aa:bb:cc:dd:ee:10", "aa:bb:cc:dd:ee:11"} {
+		client, err := db.GetDhcpClient(MustParseMAC(mac))
+		require.NoError(t, err, mac)
+		assert.Equal(t, 3, client.DhcpServerStartEpoch)
+	}
+}
@@ -0,0 +1,93 @@
+package uibackend
+
+import (
+	"dnsmasq-dhcp-backend/pkg/leasewatcher"
+	"dnsmasq-dhcp-backend/pkg/trackerdb"
+	"slices"
+	"time"
+)
+
+// diffLeases compares two snapshots of the dnsmasq lease file and returns the list of events
+// that explain how the "previous" snapshot turned into the "current" one.
+// DHCP clients are identified by their MAC address.
+// The returned events are sorted by MAC address, to produce a deterministic output.
+func diffLeases(previous, current []leasewatcher.Lease, now time.Time, startEpoch int) []trackerdb.DhcpEvent {
+	previousByMAC := make(map[string]leasewatcher.Lease, len(previous))
+	for _, l := range previous {
+		previousByMAC[l.MacAddr.String()] = l
+	}
+	currentByMAC := make(map[string]leasewatcher.Lease, len(current))
+	for _, l := range current {
+		currentByMAC[l.MacAddr.String()] = l
+	}
+
+	newEvent := func(t trackerdb.DhcpEventType, l leasewatcher.Lease) trackerdb.DhcpEvent {
+		return trackerdb.DhcpEvent{
+			Timestamp:            now,
+			Type:                 t,
+			MacAddr:              l.MacAddr,
+			IPAddr:               l.IPAddr,
+			Hostname:             l.Hostname,
+			LeaseExpires:         l.Expires,
+			DhcpServerStartEpoch: startEpoch,
+		}
+	}
+
+	events := make([]trackerdb.DhcpEvent, 0)
+	for mac, curr := range currentByMAC {
+		prev, existed := previousByMAC[mac]
+		if !existed {
+			events = append(events, newEvent(trackerdb.DhcpEventJoined, curr))
+			continue
+		}
+
+		ipChanged := prev.IPAddr != curr.IPAddr
+		if ipChanged {
+			e := newEvent(trackerdb.DhcpEventIPChanged, curr)
+			e.PreviousIPAddr = prev.IPAddr
+			events = append(events, e)
+		}
+		if prev.Hostname != curr.Hostname {
+			e := newEvent(trackerdb.DhcpEventHostnameChanged, curr)
+			e.PreviousHostname = prev.Hostname
+			events = append(events, e)
+		}
+		if !ipChanged && !prev.Expires.Equal(curr.Expires) {
+			// a new lease on a different IP is not a renewal
+			events = append(events, newEvent(trackerdb.DhcpEventRenewed, curr))
+		}
+	}
+
+	for mac, prev := range previousByMAC {
+		if _, stillThere := currentByMAC[mac]; stillThere {
+			continue
+		}
+
+		// dnsmasq uses a zero expiration time for infinite leases, which never expire
+		if !prev.Expires.IsZero() && !prev.Expires.After(now) {
+			events = append(events, newEvent(trackerdb.DhcpEventExpired, prev))
+		} else {
+			events = append(events, newEvent(trackerdb.DhcpEventRemoved, prev))
+		}
+	}
+
+	slices.SortStableFunc(events, func(a, b trackerdb.DhcpEvent) int {
+		if c := slices.Compare(a.MacAddr, b.MacAddr); c != 0 {
+			return c
+		}
+		return eventTypeOrder(a.Type) - eventTypeOrder(b.Type)
+	})
+	return events
+}
+
+// eventTypeOrder is used to sort events related to the same DHCP client
+func eventTypeOrder(t trackerdb.DhcpEventType) int {
+	return slices.Index([]trackerdb.DhcpEventType{
+		trackerdb.DhcpEventJoined,
+		trackerdb.DhcpEventIPChanged,
+		trackerdb.DhcpEventHostnameChanged,
+		trackerdb.DhcpEventRenewed,
+		trackerdb.DhcpEventExpired,
+		trackerdb.DhcpEventRemoved,
+	}, t)
+}
@@ -0,0 +1,138 @@
+package uibackend
+
+import (
+	"dnsmasq-dhcp-backend/pkg/leasewatcher"
+	"dnsmasq-dhcp-backend/pkg/trackerdb"
+	"net/http"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffLeases(t *testing.T) {
+	now := time.Now()
+	lease := func(mac, ip, hostname string, expires time.Time) leasewatcher.Lease {
+		return leasewatcher.Lease{
+			MacAddr:  MustParseMAC(mac),
+			IPAddr:   netip.MustParseAddr(ip),
+			Hostname: hostname,
+			Expires:  expires,
+		}
+	}
+
+	type simpleEvent struct {
+		mac       string
+		eventType trackerdb.DhcpEventType
+	}
+
+	tests := []struct {
+		name     string
+		previous []leasewatcher.Lease
+		current  []leasewatcher.Lease
+		expected []simpleEvent
+	}{
+		{
+			name:     "no changes",
+			previous: []leasewatcher.Lease{lease("00:11:22:33:44:55", "192.168.0.2", "client1", now.Add(time.Hour))},
+			current:  []leasewatcher.Lease{lease("00:11:22:33:44:55", "192.168.0.2", "client1", now.Add(time.Hour))},
+			expected: []simpleEvent{},
+		},
+		{
+			name:     "new client",
+			previous: []leasewatcher.Lease{},
+			current:  []leasewatcher.Lease{lease("00:11:22:33:44:55", "192.168.0.2", "client1", now.Add(time.Hour))},
+			expected: []simpleEvent{{"00:11:22:33:44:55", trackerdb.DhcpEventJoined}},
+		},
+		{
+			name:     "renewed lease",
+			previous: []leasewatcher.Lease{lease("00:11:22:33:44:55", "192.168.0.2", "client1", now.Add(time.Hour))},
+			current:  []leasewatcher.Lease{lease("00:11:22:33:44:55", "192.168.0.2", "client1", now.Add(2*time.Hour))},
+			expected: []simpleEvent{{"00:11:22:33:44:55", trackerdb.DhcpEventRenewed}},
+		},
+		{
+			name:     "IP and hostname changed",
+			previous: []leasewatcher.Lease{lease("00:11:22:33:44:55", "192.168.0.2", "client1", now.Add(time.Hour))},
+			current:  []leasewatcher.Lease{lease("00:11:22:33:44:55", "192.168.0.5", "client1-renamed", now.Add(2*time.Hour))},
+			expected: []simpleEvent{
+				{"00:11:22:33:44:55", trackerdb.DhcpEventIPChanged},
+				{"00:11:22:33:44:55", trackerdb.DhcpEventHostnameChanged},
+			},
+		},
+		{
+			name: "expired and removed leases",
+			previous: []leasewatcher.Lease{
+				lease("00:11:22:33:44:55", "192.168.0.2", "client1", now.Add(-time.Minute)),
+				lease("00:11:22:33:44:56", "192.168.0.3", "client2", now.Add(time.Hour)),
+				lease("00:11:22:33:44:57", "192.168.0.4", "client3", time.Time{}), // infinite lease
+			},
+			current: []leasewatcher.Lease{},
+			expected: []simpleEvent{
+				{"00:11:22:33:44:55", trackerdb.DhcpEventExpired},
+				{"00:11:22:33:44:56", trackerdb.DhcpEventRemoved},
+				{"00:11:22:33:44:57", trackerdb.DhcpEventRemoved},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := diffLeases(tt.previous, tt.current, now, 1234)
+
+			got := make([]simpleEvent, 0, len(events))
+			for _, e := range events {
+				assert.Equal(t, now, e.Timestamp)
+				assert.Equal(t, 1234, e.DhcpServerStartEpoch)
+				got = append(got, simpleEvent{e.MacAddr.String(), e.Type})
+			}
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestDiffLeases_PreviousValues(t *testing.T) {
+	now := time.Now()
+	previous := []leasewatcher.Lease{{
+		MacAddr: MustParseMAC("00:11:22:33:44:55"), IPAddr: netip.MustParseAddr("192.168.0.2"), Hostname: "old",
+	}}
+	current := []leasewatcher.Lease{{
+		MacAddr: MustParseMAC("00:11:22:33:44:55"), IPAddr: netip.MustParseAddr("192.168.0.3"), Hostname: "new",
+	}}
+
+	events := diffLeases(previous, current, now, 0)
+	require.Len(t, events, 2)
+	assert.Equal(t, netip.MustParseAddr("192.168.0.2"), events[0].PreviousIPAddr)
+	assert.Equal(t, netip.MustParseAddr("192.168.0.3"), events[0].IPAddr)
+	assert.Equal(t, "old", events[1].PreviousHostname)
+	assert.Equal(t, "new", events[1].Hostname)
+}
+
+func TestProcessLeaseUpdatesFromArray_RecordsEvents(t *testing.T) {
+	backend := getMockUIBackend()
+
+	// the first snapshot is only a baseline
+	backend.processLeaseUpdatesFromArray(getMockLeases())
+	timeline, err := backend.trackerDB.GetDhcpClientTimeline(MustParseMAC("00:11:22:33:44:55"), 0)
+	require.NoError(t, err)
+	assert.Empty(t, timeline)
+
+	// client1 goes away, client2 changes IP
+	leases := getMockLeases()
+	leases[1].IPAddr = netip.MustParseAddr("192.168.0.33")
+	backend.processLeaseUpdatesFromArray(leases[1:])
+
+	timeline, err = backend.trackerDB.GetDhcpClientTimeline(MustParseMAC("00:11:22:33:44:55"), 0)
+	require.NoError(t, err)
+	require.Len(t, timeline, 1)
+	assert.Equal(t, trackerdb.DhcpEventRemoved, timeline[0].Type)
+
+	rec := apiGet(t, backend, "/api/v1/clients/timeline/00:11:22:33:44:56")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"type":"ip_changed"`)
+	assert.Contains(t, rec.Body.String(), `"previous_ip_addr":"192.168.0.3"`)
+
+	rec = apiGet(t, backend, "/api/v1/clients/timeline/not-a-mac")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
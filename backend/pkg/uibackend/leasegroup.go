@@ -0,0 +1,65 @@
+package uibackend
+
+import (
+	"dnsmasq-dhcp-backend/pkg/leasewatcher"
+)
+
+// leaseGroupKeys returns the keys identifying the DHCP client owning the given lease:
+// its MAC address, when known, and its DUID, when known
+func leaseGroupKeys(l *leasewatcher.Lease) []string {
+	keys := make([]string, 0, 2)
+	if l.MacAddr != nil {
+		keys = append(keys, "mac "+l.MacAddr.String())
+	}
+	if l.DUID != nil {
+		keys = append(keys, "duid "+l.DUID.String())
+	}
+	return keys
+}
+
+// groupLeases builds one DhcpClientData for each DHCP client, grouping the leases of dual-stack clients.
+// DHCPv6 leases are attached to the DHCPv4 lease having the same MAC address or DUID (the latter is
+// available for DHCPv4 clients using a RFC 4361 client identifier); DHCPv6 leases of IPv6-only clients
+// are grouped together in the same way. Only the Lease and IPv6Leases fields are filled.
+func groupLeases(leases []*leasewatcher.Lease) []DhcpClientData {
+	ret := make([]DhcpClientData, 0, len(leases))
+	byKey := make(map[string]int)
+
+	register := func(l *leasewatcher.Lease, idx int) {
+		for _, k := range leaseGroupKeys(l) {
+			if _, exists := byKey[k]; !exists {
+				byKey[k] = idx
+			}
+		}
+	}
+
+	for _, l := range leases {
+		if l.IsDHCPv6() {
+			continue
+		}
+		ret = append(ret, DhcpClientData{Lease: *l})
+		register(l, len(ret)-1)
+	}
+
+	for _, l := range leases {
+		if !l.IsDHCPv6() {
+			continue
+		}
+		idx := -1
+		for _, k := range leaseGroupKeys(l) {
+			if i, ok := byKey[k]; ok {
+				idx = i
+				break
+			}
+		}
+		if idx == -1 {
+			ret = append(ret, DhcpClientData{Lease: *l})
+			idx = len(ret) - 1
+		} else {
+			ret[idx].IPv6Leases = append(ret[idx].IPv6Leases, *l)
+		}
+		// a DHCPv6 lease might bring the MAC address or the DUID missing from the other leases of the client
+		register(l, idx)
+	}
+	return ret
+}
@@ -0,0 +1,105 @@
+package uibackend
+
+import (
+	"dnsmasq-dhcp-backend/pkg/duid"
+	"dnsmasq-dhcp-backend/pkg/ippool"
+	"dnsmasq-dhcp-backend/pkg/leasewatcher"
+	"encoding/json"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupLeases(t *testing.T) {
+	mustParseDUID := func(s string) duid.DUID {
+		d, err := duid.Parse(s)
+		require.NoError(t, err)
+		return d
+	}
+
+	leases := []*leasewatcher.Lease{
+		// dual-stack client whose DUID contains its MAC address
+		{MacAddr: MustParseMAC("aa:bb:cc:dd:ee:01"), IPAddr: netip.MustParseAddr("192.168.1.10"), Hostname: "laptop"},
+		{MacAddr: MustParseMAC("aa:bb:cc:dd:ee:01"), IPAddr: netip.MustParseAddr("fd00::10"), DUID: mustParseDUID("00:03:00:01:aa:bb:cc:dd:ee:01"), IAID: 1},
+		{MacAddr: MustParseMAC("aa:bb:cc:dd:ee:01"), IPAddr: netip.MustParseAddr("fd00::11"), DUID: mustParseDUID("00:03:00:01:aa:bb:cc:dd:ee:01"), IAID: 2},
+
+		// dual-stack client using its DUID as DHCPv4 client identifier (RFC 4361)
+		{MacAddr: MustParseMAC("aa:bb:cc:dd:ee:02"), IPAddr: netip.MustParseAddr("192.168.1.11"), DUID: mustParseDUID("00:02:00:00:ab:11:01")},
+		{IPAddr: netip.MustParseAddr("fd00::20"), DUID: mustParseDUID("00:02:00:00:ab:11:01"), IAID: 7},
+
+		// IPv6-only client with an unknown MAC address
+		{IPAddr: netip.MustParseAddr("fd00::30"), DUID: mustParseDUID("00:02:00:00:ab:11:02"), IAID: 1},
+		{IPAddr: netip.MustParseAddr("fd00::31"), DUID: mustParseDUID("00:02:00:00:ab:11:02"), IAID: 2},
+
+		// IPv4-only client
+		{MacAddr: MustParseMAC("aa:bb:cc:dd:ee:03"), IPAddr: netip.MustParseAddr("192.168.1.12")},
+	}
+
+	clients := groupLeases(leases)
+	require.Len(t, clients, 4)
+
+	assert.Equal(t, *leases[0], clients[0].Lease)
+	assert.Equal(t, []leasewatcher.Lease{*leases[1], *leases[2]}, clients[0].IPv6Leases)
+	assert.Equal(t, []netip.Addr{
+		netip.MustParseAddr("192.168.1.10"), netip.MustParseAddr("fd00::10"), netip.MustParseAddr("fd00::11"),
+	}, clients[0].IPAddrs())
+
+	assert.Equal(t, *leases[3], clients[1].Lease)
+	assert.Equal(t, []leasewatcher.Lease{*leases[4]}, clients[1].IPv6Leases)
+
+	assert.Equal(t, *leases[7], clients[2].Lease)
+	assert.Empty(t, clients[2].IPv6Leases)
+
+	assert.Equal(t, *leases[5], clients[3].Lease)
+	assert.Equal(t, []leasewatcher.Lease{*leases[6]}, clients[3].IPv6Leases)
+}
+
+func TestProcessLeaseUpdatesFromArray_DualStack(t *testing.T) {
+	backend := getMockUIBackend()
+	opts := *backend.opts()
+	ipv6Range := newIpNetworkInfo("eth0", ippool.NewRangeFromString("fd00::1000", "fd00::ffff:ffff:ffff:ffff"), "fe80::1", "64")
+	opts.dhcpRanges = append(opts.dhcpRanges, ipv6Range)
+	opts.dhcpPool = ippool.NewPool([]ippool.Range{opts.dhcpRanges[0].Range(), ipv6Range.Range()})
+	backend.options.Store(&opts)
+
+	leases := getMockLeases()
+	clientDUID := duid.DUID{0, 3, 0, 1, 0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+	leases = append(leases,
+		// client1 is dual-stack
+		&leasewatcher.Lease{MacAddr: leases[0].MacAddr, IPAddr: netip.MustParseAddr("fd00::1001"), Hostname: "client1", DUID: clientDUID, IAID: 3, Expires: time.Unix(1704405600, 0)},
+		// an IPv6-only client with unknown MAC address
+		&leasewatcher.Lease{IPAddr: netip.MustParseAddr("fd00::1002"), Hostname: "*", DUID: duid.DUID{0, 2, 0, 0, 0xab, 0x11, 0x42}, IAID: 1},
+	)
+	backend.processLeaseUpdatesFromArray(leases)
+
+	clients := backend.getCurrentClients()
+	require.Len(t, clients, 5)
+	assert.Equal(t, "192.168.0.2", clients[0].Lease.IPAddr.String())
+	require.Len(t, clients[0].IPv6Leases, 1)
+	assert.Equal(t, "fd00::1001", clients[0].IPv6Leases[0].IPAddr.String())
+	assert.Equal(t, "fd00::1002", clients[4].Lease.IPAddr.String())
+	assert.True(t, clients[4].IsInsideDHCPPool)
+	assert.Nil(t, clients[4].Lease.MacAddr)
+
+	data, err := json.Marshal(clients[0])
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"ipv6_leases":[{"expires":1704405600,"ip_addr":"fd00::1001","iaid":3}]`)
+	data, err = json.Marshal(clients[4])
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"mac_addr":"","ip_addr":"fd00::1002","hostname":"*","duid":"00:02:00:00:ab:11:42","iaid":1}`)
+
+	// both the DHCPv4 and DHCPv6 leases are preserved when the clients are processed again
+	assert.Len(t, backend.getCurrentLeases(), len(leases))
+
+	utilization := backend.getDhcpRangesUtilization(clients)
+	require.Len(t, utilization, 2)
+	assert.Equal(t, int64(-1), utilization[1].Size)
+	assert.Equal(t, int64(2), utilization[1].Used)
+	assert.Greater(t, utilization[1].UsagePercent, 0.0)
+
+	// the IPv6-only client is not tracked in the tracker DB nor in MQTT
+	assert.Len(t, backend.getMqttTrackedClients(clients, nil), 4)
+}
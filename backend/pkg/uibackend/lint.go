@@ -0,0 +1,320 @@
+package uibackend
+
+import (
+	"dnsmasq-dhcp-backend/pkg/notifier"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// mqttBrokerSchemes are the URL schemes supported by the MQTT client
+var mqttBrokerSchemes = []string{"tcp", "mqtt", "ssl", "tls", "mqtts", "ws", "wss"}
+
+// ConfigFindingSeverity tells how bad a ConfigFinding is
+type ConfigFindingSeverity string
+
+const (
+	// ConfigFindingError is used for settings that are invalid or that will break DHCP service
+	ConfigFindingError ConfigFindingSeverity = "error"
+
+	// ConfigFindingWarning is used for settings that are accepted but are most likely a mistake
+	ConfigFindingWarning ConfigFindingSeverity = "warning"
+)
+
+// ConfigFinding is a single issue found in the addon options by LintAddonOptions
+type ConfigFinding struct {
+	// Path is the JSON path of the offending setting, e.g. "dhcp_pools[1].start"
+	Path     string                `json:"path"`
+	Severity ConfigFindingSeverity `json:"severity"`
+	Message  string                `json:"message"`
+}
+
+func (f ConfigFinding) String() string {
+	return fmt.Sprintf("%s: %s: %s", f.Severity, f.Path, f.Message)
+}
+
+// configLinter accumulates the findings produced while checking the addon options
+type configLinter struct {
+	findings []ConfigFinding
+}
+
+func (l *configLinter) errorf(path string, format string, args ...any) {
+	l.findings = append(l.findings, ConfigFinding{Path: path, Severity: ConfigFindingError, Message: fmt.Sprintf(format, args...)})
+}
+
+func (l *configLinter) warnf(path string, format string, args ...any) {
+	l.findings = append(l.findings, ConfigFinding{Path: path, Severity: ConfigFindingWarning, Message: fmt.Sprintf(format, args...)})
+}
+
+// lintedNetwork is a DHCP network that passed all per-entry checks
+type lintedNetwork struct {
+	path string
+	info IpNetworkInfo
+}
+
+// lintedReservation is an IP address reservation that passed all per-entry checks
+type lintedReservation struct {
+	path string
+	ip   netip.Addr
+	mac  string
+}
+
+// LintAddonOptions checks the addon options and returns all the issues found, each with the JSON path
+// of the offending setting.
+// Differently from AddonOptions.UnmarshalJSON, which stops at the first invalid setting, this function
+// keeps going and also checks how the settings relate to each other (e.g. overlapping DHCP ranges).
+// An empty slice means the options are fine.
+func LintAddonOptions(data []byte) []ConfigFinding {
+	var cfg addonOptionsJSON
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return []ConfigFinding{{Path: "$", Severity: ConfigFindingError, Message: fmt.Sprintf("invalid JSON: %s", err.Error())}}
+	}
+
+	l := configLinter{findings: []ConfigFinding{}}
+	networks := l.lintDhcpPools(&cfg)
+	reservations := l.lintReservations(&cfg, networks)
+	l.lintFriendlyNames(&cfg, reservations)
+	l.lintMiscSettings(&cfg)
+	l.lintWebhooks(&cfg)
+	return l.findings
+}
+
+func (l *configLinter) lintDhcpPools(cfg *addonOptionsJSON) []lintedNetwork {
+	var networks []lintedNetwork
+	for i, r := range cfg.DhcpPool {
+		path := fmt.Sprintf("dhcp_pools[%d]", i)
+
+		ipNetInfo, errs := resolveDhcpPool(r)
+		for _, err := range errs {
+			if err.Field == "" {
+				l.errorf(path, "%s", err.Message)
+			} else {
+				l.errorf(path+"."+err.Field, "%s", err.Message)
+			}
+		}
+		if len(errs) > 0 {
+			continue
+		}
+		if ipNetInfo.IsIPv6() && strings.Contains(r.Netmask, ":") {
+			l.warnf(path+".netmask", "dnsmasq expects the prefix length for IPv6 DHCP ranges: use e.g. 64 instead of %s", r.Netmask)
+		}
+
+		dhcpR := ipNetInfo.Range()
+		for _, other := range networks {
+			if other.info.Range().Overlaps(dhcpR) {
+				l.errorf(path, "DHCP range %s-%s overlaps with the DHCP range %s-%s defined in %s",
+					dhcpR.Start, dhcpR.End, other.info.Start, other.info.End, other.path)
+			}
+		}
+
+		networks = append(networks, lintedNetwork{path: path, info: ipNetInfo})
+	}
+	return networks
+}
+
+func (l *configLinter) lintReservations(cfg *addonOptionsJSON, networks []lintedNetwork) []lintedReservation {
+	var reservations []lintedReservation
+	for i, r := range cfg.DhcpIpAddressReservations {
+		path := fmt.Sprintf("dhcp_ip_address_reservations[%d]", i)
+
+		valid := true
+		ipAddr, err := netip.ParseAddr(r.IP)
+		if err != nil {
+			l.errorf(path+".ip", "invalid IP address %q", r.IP)
+			valid = false
+		}
+		macAddr, err := net.ParseMAC(r.Mac)
+		if err != nil {
+			l.errorf(path+".mac", "invalid MAC address %q", r.Mac)
+			valid = false
+		}
+		l.lintLinkTemplate(path+".link", r.Link)
+		if !valid {
+			continue
+		}
+
+		for _, other := range reservations {
+			if other.mac == macAddr.String() {
+				l.errorf(path+".mac", "MAC address %s is already reserved in %s", macAddr, other.path)
+			}
+			if other.ip == ipAddr {
+				l.errorf(path+".ip", "IP address %s is already reserved in %s", ipAddr, other.path)
+			}
+		}
+
+		inAnyNetwork := false
+		for _, nw := range networks {
+			if !nw.info.ContainsInNetwork(ipAddr) {
+				continue
+			}
+			inAnyNetwork = true
+
+			switch ipAddr {
+			case nw.info.Gateway:
+				l.errorf(path+".ip", "IP address %s is the gateway of the network defined in %s", ipAddr, nw.path)
+			case nw.info.NetworkAddr():
+				l.errorf(path+".ip", "IP address %s is the network address of the network defined in %s", ipAddr, nw.path)
+			case nw.info.BroadcastAddr():
+				l.errorf(path+".ip", "IP address %s is the broadcast address of the network defined in %s", ipAddr, nw.path)
+			}
+		}
+		if !inAnyNetwork && len(networks) > 0 {
+			l.warnf(path+".ip", "IP address %s is outside all the networks defined in dhcp_pools: dnsmasq will never assign it", ipAddr)
+		}
+
+		reservations = append(reservations, lintedReservation{path: path, ip: ipAddr, mac: macAddr.String()})
+	}
+	return reservations
+}
+
+func (l *configLinter) lintFriendlyNames(cfg *addonOptionsJSON, reservations []lintedReservation) {
+	seenMACs := map[string]string{}
+	for i, client := range cfg.DhcpClientsFriendlyNames {
+		path := fmt.Sprintf("dhcp_clients_friendly_names[%d]", i)
+
+		l.lintLinkTemplate(path+".link", client.Link)
+		macAddr, err := net.ParseMAC(client.Mac)
+		if err != nil {
+			l.errorf(path+".mac", "invalid MAC address %q", client.Mac)
+			continue
+		}
+
+		if otherPath, ok := seenMACs[macAddr.String()]; ok {
+			l.warnf(path+".mac", "MAC address %s already has a friendly name in %s; only the last one will be used", macAddr, otherPath)
+		}
+		seenMACs[macAddr.String()] = path
+
+		for _, r := range reservations {
+			if r.mac == macAddr.String() {
+				l.warnf(path+".mac", "MAC address %s also has an IP address reservation in %s; consider setting the name and link there instead", macAddr, r.path)
+			}
+		}
+	}
+}
+
+func (l *configLinter) lintLinkTemplate(path, link string) {
+	if link == "" {
+		return
+	}
+	if _, err := texttemplate.New("linkTemplate").Parse(link); err != nil {
+		l.errorf(path, "invalid golang template %q: %s", link, err.Error())
+	}
+}
+
+func (l *configLinter) lintMiscSettings(cfg *addonOptionsJSON) {
+	if cfg.WebUI.Port <= 0 || cfg.WebUI.Port > 32768 {
+		l.errorf("web_ui.port", "invalid web UI port number: %d", cfg.WebUI.Port)
+	}
+	if _, err := parseDuration(cfg.DhcpServer.ForgetPastClientsAfter); err != nil {
+		l.errorf("dhcp_server.forget_past_clients_after", "invalid time duration %q", cfg.DhcpServer.ForgetPastClientsAfter)
+	}
+	if cfg.Mqtt.Enable {
+		if cfg.Mqtt.Broker == "" {
+			l.errorf("mqtt.broker", "MQTT is enabled but no broker is specified")
+		} else if u, err := url.Parse(cfg.Mqtt.Broker); err != nil || !slices.Contains(mqttBrokerSchemes, u.Scheme) {
+			l.errorf("mqtt.broker", "invalid MQTT broker URL %q: expected something like tcp://core-mosquitto:1883", cfg.Mqtt.Broker)
+		}
+	}
+	if cfg.LeaseImport.File != "" && !strings.HasPrefix(filepath.Clean(cfg.LeaseImport.File), leaseImportDir+"/") {
+		l.warnf("lease_import.file", "the file %q is outside %s, the only folder of Home Assistant readable by the addon", cfg.LeaseImport.File, leaseImportDir)
+	}
+	l.lintPoolAlerts(cfg)
+}
+
+func (l *configLinter) lintPoolAlerts(cfg *addonOptionsJSON) {
+	warning, critical := cfg.PoolAlerts.WarningPercent, cfg.PoolAlerts.CriticalPercent
+	if warning <= 0 {
+		warning = defaultPoolAlertWarningPercent
+	}
+	if critical <= 0 {
+		critical = defaultPoolAlertCriticalPercent
+	}
+	if warning > critical {
+		l.errorf("pool_alerts.warning_percent", "the warning threshold %d%% must not exceed the critical threshold %d%%", warning, critical)
+	}
+	if h := cfg.PoolAlerts.Horizon; h != "" {
+		if d, err := parseDuration(h); err != nil || d < 0 {
+			l.errorf("pool_alerts.exhaustion_horizon", "invalid time duration %q", h)
+		}
+	}
+	if w := cfg.PoolAlerts.TrendWindow; w != "" {
+		if d, err := parseDuration(w); err != nil || d <= 0 {
+			l.errorf("pool_alerts.trend_window", "invalid time duration %q", w)
+		} else if d < time.Hour {
+			l.warnf("pool_alerts.trend_window", "a trend window shorter than 1h makes the forecast very sensitive to a few DHCP clients joining at once")
+		}
+	}
+}
+
+func (l *configLinter) lintWebhooks(cfg *addonOptionsJSON) {
+	for i, w := range cfg.Webhooks {
+		path := fmt.Sprintf("webhooks[%d]", i)
+		if !isValidWebhookURL(w.URL) {
+			l.errorf(path+".url", "invalid URL %q: only http:// and https:// URLs are supported", w.URL)
+		}
+		for j, ev := range w.Events {
+			if !notifier.IsValidEventType(ev) {
+				l.errorf(fmt.Sprintf("%s.events[%d]", path, j), "unknown event type %q: valid event types are %v", ev, notifier.AllEventTypes)
+			}
+		}
+		if w.Payload != "" {
+			if _, err := notifier.ParsePayloadTemplate(w.Payload); err != nil {
+				l.errorf(path+".payload", "invalid golang template %q: %s", w.Payload, err.Error())
+			}
+		}
+	}
+}
+
+// HasConfigErrors returns true if at least one of the findings has ConfigFindingError severity
+func HasConfigErrors(findings []ConfigFinding) bool {
+	for _, f := range findings {
+		if f.Severity == ConfigFindingError {
+			return true
+		}
+	}
+	return false
+}
+
+// RunValidate is the entrypoint of the "validate" mode of the backend binary, used by the
+// dnsmasq-init script to check the addon options before starting dnsmasq.
+// The optional argument is the path of the options file to check.
+// All findings are printed on the given writer; the returned exit code is non-zero only if the options
+// cannot be read or parsed at all. The other errors found by LintAddonOptions do not prevent the addon
+// from starting, since they used to be accepted by former versions: they're reported in the addon log
+// and at the top of the web UI instead.
+func RunValidate(args []string, w io.Writer) int {
+	optionsFile := defaultHomeAssistantOptionsFile
+	if len(args) > 0 {
+		optionsFile = args[0]
+	}
+
+	data, err := os.ReadFile(optionsFile) //nolint:gosec
+	if err != nil {
+		_, _ = fmt.Fprintf(w, "failed to read addon options: %s\n", err.Error())
+		return 2
+	}
+
+	findings := LintAddonOptions(data)
+	for _, f := range findings {
+		_, _ = fmt.Fprintln(w, f.String())
+	}
+	if _, err := parseAddonOptions(data); err != nil {
+		_, _ = fmt.Fprintf(w, "%s is invalid: %s\n", optionsFile, err.Error())
+		return 1
+	}
+	if HasConfigErrors(findings) {
+		_, _ = fmt.Fprintf(w, "%s has errors: found %d issues; starting anyway, but please fix them\n", optionsFile, len(findings))
+		return 0
+	}
+	_, _ = fmt.Fprintf(w, "%s is valid: found %d issues\n", optionsFile, len(findings))
+	return 0
+}
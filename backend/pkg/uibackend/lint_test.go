@@ -0,0 +1,272 @@
+package uibackend
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lintTestOptions returns an addon options file using the given JSON snippets for the DHCP pools,
+// reservations and friendly names; empty snippets are replaced by valid defaults
+func lintTestOptions(pools, reservations, friendlyNames string) []byte {
+	if pools == "" {
+		pools = `[
+			{"interface": "eth0", "start": "192.168.1.50", "end": "192.168.1.100", "gateway": "192.168.1.1", "netmask": "255.255.255.0"},
+			{"interface": "eth1", "start": "192.168.2.50", "end": "192.168.2.100", "gateway": "192.168.2.1", "netmask": "255.255.255.0"}
+		]`
+	}
+	if reservations == "" {
+		reservations = "[]"
+	}
+	if friendlyNames == "" {
+		friendlyNames = "[]"
+	}
+	return []byte(`{
+		"dhcp_pools": ` + pools + `,
+		"dhcp_ip_address_reservations": ` + reservations + `,
+		"dhcp_clients_friendly_names": ` + friendlyNames + `,
+		"dhcp_server": {"forget_past_clients_after": "1w"},
+		"web_ui": {"port": 8976}
+	}`)
+}
+
+func TestLintAddonOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  []byte
+		expected []ConfigFinding
+	}{
+		{
+			name: "valid options",
+			options: lintTestOptions("",
+				`[{"name": "nas", "mac": "aa:bb:cc:dd:ee:00", "ip": "192.168.1.15", "link": "http://{{ .ip }}"}]`,
+				`[{"name": "phone", "mac": "aa:bb:cc:dd:ee:01"}]`),
+			expected: []ConfigFinding{},
+		},
+		{
+			name: "all per-entry errors are reported",
+			options: []byte(`{
+				"dhcp_pools": [
+					{"interface": "eth0", "start": "192.168.1.500", "end": "192.168.1.100", "gateway": "192.168.1.1", "netmask": "foo"},
+					{"interface": "eth1", "start": "192.168.2.100", "end": "192.168.2.50", "gateway": "192.168.2.1", "netmask": "255.255.255.0"},
+					{"interface": "eth2", "start": "192.168.3.50", "end": "192.168.3.100", "gateway": "192.168.4.1", "netmask": "255.255.255.0"}
+				],
+				"dhcp_ip_address_reservations": [{"name": "x", "mac": "not-a-mac", "ip": "not-an-ip", "link": "{{ .ip"}],
+				"dhcp_clients_friendly_names": [{"name": "y", "mac": "zz:zz"}],
+				"dhcp_server": {"forget_past_clients_after": "forever"},
+				"web_ui": {"port": 0}
+			}`),
+			expected: []ConfigFinding{
+				{Path: "dhcp_pools[0].start", Severity: ConfigFindingError, Message: `invalid IP address "192.168.1.500"`},
+				{Path: "dhcp_pools[0].netmask", Severity: ConfigFindingError, Message: `invalid IP address "foo"`},
+				{Path: "dhcp_pools[1]", Severity: ConfigFindingError, Message: "invalid DHCP range 192.168.2.100-192.168.2.50: the end IP must be greater than the start IP"},
+				{Path: "dhcp_pools[2].gateway", Severity: ConfigFindingError, Message: "the gateway 192.168.4.1 must be an IP address within the network defined by the start/end/netmask parameters"},
+				{Path: "dhcp_ip_address_reservations[0].ip", Severity: ConfigFindingError, Message: `invalid IP address "not-an-ip"`},
+				{Path: "dhcp_ip_address_reservations[0].mac", Severity: ConfigFindingError, Message: `invalid MAC address "not-a-mac"`},
+				{Path: "dhcp_ip_address_reservations[0].link", Severity: ConfigFindingError, Message: `invalid golang template "{{ .ip": template: linkTemplate:1: unclosed action`},
+				{Path: "dhcp_clients_friendly_names[0].mac", Severity: ConfigFindingError, Message: `invalid MAC address "zz:zz"`},
+				{Path: "web_ui.port", Severity: ConfigFindingError, Message: "invalid web UI port number: 0"},
+				{Path: "dhcp_server.forget_past_clients_after", Severity: ConfigFindingError, Message: `invalid time duration "forever"`},
+			},
+		},
+		{
+			name: "overlapping ranges",
+			options: lintTestOptions(`[
+				{"interface": "eth0", "start": "192.168.1.50", "end": "192.168.1.100", "gateway": "192.168.1.1", "netmask": "255.255.255.0"},
+				{"interface": "eth0", "start": "192.168.1.150", "end": "192.168.1.200", "gateway": "192.168.1.1", "netmask": "255.255.255.0"},
+				{"interface": "eth0", "start": "192.168.1.90", "end": "192.168.1.160", "gateway": "192.168.1.1", "netmask": "255.255.255.0"}
+			]`, "", ""),
+			expected: []ConfigFinding{
+				{Path: "dhcp_pools[2]", Severity: ConfigFindingError, Message: "DHCP range 192.168.1.90-192.168.1.160 overlaps with the DHCP range 192.168.1.50-192.168.1.100 defined in dhcp_pools[0]"},
+				{Path: "dhcp_pools[2]", Severity: ConfigFindingError, Message: "DHCP range 192.168.1.90-192.168.1.160 overlaps with the DHCP range 192.168.1.150-192.168.1.200 defined in dhcp_pools[1]"},
+			},
+		},
+		{
+			name: "reservations on special addresses",
+			options: lintTestOptions("", `[
+				{"name": "gw", "mac": "aa:bb:cc:dd:ee:00", "ip": "192.168.1.1"},
+				{"name": "net", "mac": "aa:bb:cc:dd:ee:01", "ip": "192.168.2.0"},
+				{"name": "bcast", "mac": "aa:bb:cc:dd:ee:02", "ip": "192.168.2.255"},
+				{"name": "elsewhere", "mac": "aa:bb:cc:dd:ee:03", "ip": "10.0.0.5"}
+			]`, ""),
+			expected: []ConfigFinding{
+				{Path: "dhcp_ip_address_reservations[0].ip", Severity: ConfigFindingError, Message: "IP address 192.168.1.1 is the gateway of the network defined in dhcp_pools[0]"},
+				{Path: "dhcp_ip_address_reservations[1].ip", Severity: ConfigFindingError, Message: "IP address 192.168.2.0 is the network address of the network defined in dhcp_pools[1]"},
+				{Path: "dhcp_ip_address_reservations[2].ip", Severity: ConfigFindingError, Message: "IP address 192.168.2.255 is the broadcast address of the network defined in dhcp_pools[1]"},
+				{Path: "dhcp_ip_address_reservations[3].ip", Severity: ConfigFindingWarning, Message: "IP address 10.0.0.5 is outside all the networks defined in dhcp_pools: dnsmasq will never assign it"},
+			},
+		},
+		{
+			name: "duplicated reservations",
+			options: lintTestOptions("", `[
+				{"name": "a", "mac": "aa:bb:cc:dd:ee:00", "ip": "192.168.1.10"},
+				{"name": "b", "mac": "AA:BB:CC:DD:EE:00", "ip": "192.168.1.11"},
+				{"name": "c", "mac": "aa:bb:cc:dd:ee:02", "ip": "192.168.1.10"}
+			]`, ""),
+			expected: []ConfigFinding{
+				{Path: "dhcp_ip_address_reservations[1].mac", Severity: ConfigFindingError, Message: "MAC address aa:bb:cc:dd:ee:00 is already reserved in dhcp_ip_address_reservations[0]"},
+				{Path: "dhcp_ip_address_reservations[2].ip", Severity: ConfigFindingError, Message: "IP address 192.168.1.10 is already reserved in dhcp_ip_address_reservations[0]"},
+			},
+		},
+		{
+			name: "friendly names overlapping with reservations",
+			options: lintTestOptions("",
+				`[{"name": "nas", "mac": "aa:bb:cc:dd:ee:00", "ip": "192.168.1.15"}]`,
+				`[
+					{"name": "nas again", "mac": "AA:BB:CC:DD:EE:00"},
+					{"name": "phone", "mac": "aa:bb:cc:dd:ee:01"},
+					{"name": "phone again", "mac": "aa:bb:cc:dd:ee:01"}
+				]`),
+			expected: []ConfigFinding{
+				{Path: "dhcp_clients_friendly_names[0].mac", Severity: ConfigFindingWarning, Message: "MAC address aa:bb:cc:dd:ee:00 also has an IP address reservation in dhcp_ip_address_reservations[0]; consider setting the name and link there instead"},
+				{Path: "dhcp_clients_friendly_names[2].mac", Severity: ConfigFindingWarning, Message: "MAC address aa:bb:cc:dd:ee:01 already has a friendly name in dhcp_clients_friendly_names[1]; only the last one will be used"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, LintAddonOptions(tt.options))
+		})
+	}
+}
+
+func TestLintAddonOptions_IPv6(t *testing.T) {
+	withIPv6Pool := func(netmask string) []byte {
+		return lintTestOptions(`[
+			{"interface": "eth0", "start": "192.168.1.50", "end": "192.168.1.100", "gateway": "192.168.1.1", "netmask": "255.255.255.0"},
+			{"interface": "eth0", "start": "fd00::1000", "end": "fd00::1fff", "gateway": "fe80::1", "netmask": "`+netmask+`"}
+		]`, "", "")
+	}
+
+	assert.Empty(t, LintAddonOptions(withIPv6Pool("64")))
+	assert.Empty(t, LintAddonOptions(withIPv6Pool("/64")))
+	assert.Equal(t, []ConfigFinding{
+		{Path: "dhcp_pools[1].netmask", Severity: ConfigFindingWarning, Message: "dnsmasq expects the prefix length for IPv6 DHCP ranges: use e.g. 64 instead of ffff:ffff:ffff:ffff::"},
+	}, LintAddonOptions(withIPv6Pool("ffff:ffff:ffff:ffff::")))
+	assert.Equal(t, []ConfigFinding{
+		{Path: "dhcp_pools[1].netmask", Severity: ConfigFindingError, Message: `invalid prefix length "255.255.255.0": IPv6 DHCP ranges need a prefix length like 64`},
+	}, LintAddonOptions(withIPv6Pool("255.255.255.0")))
+}
+
+func TestLintAddonOptions_NetworkFormat(t *testing.T) {
+	assert.Empty(t, LintAddonOptions(lintTestOptions(`[
+		{"interface": "eth0", "network": "192.168.1.0/24", "range": ".50-.100"},
+		{"interface": "eth1", "network": "192.168.2.0/24", "range": "192.168.2.64/26", "gateway": "192.168.2.254"},
+		{"interface": "eth0", "network": "fd00::/64", "range": "::1000-::1fff", "gateway": "fe80::1"}
+	]`, `[{"name": "nas", "mac": "aa:bb:cc:dd:ee:00", "ip": "192.168.1.15"}]`, "")))
+
+	assert.Equal(t, []ConfigFinding{
+		{Path: "dhcp_pools[1].range", Severity: ConfigFindingError, Message: "the range 192.168.3.50-192.168.3.100 is outside the network 192.168.2.0/24"},
+		{Path: "dhcp_pools[2]", Severity: ConfigFindingError, Message: "DHCP range 192.168.1.64-192.168.1.127 overlaps with the DHCP range 192.168.1.50-192.168.1.100 defined in dhcp_pools[0]"},
+		{Path: "dhcp_ip_address_reservations[0].ip", Severity: ConfigFindingError, Message: "IP address 192.168.1.1 is the gateway of the network defined in dhcp_pools[0]"},
+		{Path: "dhcp_ip_address_reservations[0].ip", Severity: ConfigFindingError, Message: "IP address 192.168.1.1 is the gateway of the network defined in dhcp_pools[2]"},
+	}, LintAddonOptions(lintTestOptions(`[
+		{"interface": "eth0", "network": "192.168.1.0/24", "range": ".50-.100"},
+		{"interface": "eth1", "network": "192.168.2.0/24", "range": "192.168.3.50-192.168.3.100"},
+		{"interface": "eth0", "network": "192.168.1.0/24", "range": "192.168.1.64/26"}
+	]`, `[{"name": "router", "mac": "aa:bb:cc:dd:ee:00", "ip": "192.168.1.1"}]`, "")))
+}
+
+func TestLintAddonOptions_InvalidJSON(t *testing.T) {
+	findings := LintAddonOptions([]byte(`{"dhcp_pools": 3}`))
+	require.Len(t, findings, 1)
+	assert.Equal(t, "$", findings[0].Path)
+	assert.Equal(t, ConfigFindingError, findings[0].Severity)
+}
+
+func TestLintAddonOptions_Mqtt(t *testing.T) {
+	withMqtt := func(mqtt string) []byte {
+		options := lintTestOptions("", "", "")
+		return append(options[:len(options)-1], []byte(`, "mqtt": `+mqtt+`}`)...)
+	}
+
+	assert.Empty(t, LintAddonOptions(withMqtt(`{"enable": false, "broker": ""}`)))
+	assert.Empty(t, LintAddonOptions(withMqtt(`{"enable": true, "broker": "tcp://core-mosquitto:1883"}`)))
+	assert.Equal(t, []ConfigFinding{
+		{Path: "mqtt.broker", Severity: ConfigFindingError, Message: "MQTT is enabled but no broker is specified"},
+	}, LintAddonOptions(withMqtt(`{"enable": true, "broker": ""}`)))
+	assert.Equal(t, []ConfigFinding{
+		{Path: "mqtt.broker", Severity: ConfigFindingError, Message: `invalid MQTT broker URL "core-mosquitto:1883": expected something like tcp://core-mosquitto:1883`},
+	}, LintAddonOptions(withMqtt(`{"enable": true, "broker": "core-mosquitto:1883"}`)))
+}
+
+func TestLintAddonOptions_Webhooks(t *testing.T) {
+	options := lintTestOptions("", "", "")
+	options = append(options[:len(options)-1], []byte(`, "webhooks": [
+		{"name": "ok", "url": "https://ntfy.sh/my-topic", "events": ["new_client"], "payload": "{\"text\": {{ json .hostname }}}"},
+		{"name": "bad", "url": "ftp://example.com", "events": ["new_client", "exploded"], "payload": "{{ .ip"}
+	]}`)...)
+
+	assert.Equal(t, []ConfigFinding{
+		{Path: "webhooks[1].url", Severity: ConfigFindingError, Message: `invalid URL "ftp://example.com": only http:// and https:// URLs are supported`},
+		{Path: "webhooks[1].events[1]", Severity: ConfigFindingError, Message: `unknown event type "exploded": valid event types are [new_client client_left reservation_mismatch pool_exhausted pool_alert]`},
+		{Path: "webhooks[1].payload", Severity: ConfigFindingError, Message: `invalid golang template "{{ .ip": template: payloadTemplate:1: unclosed action`},
+	}, LintAddonOptions(options))
+}
+
+func TestLintAddonOptions_LeaseImport(t *testing.T) {
+	withLeaseImport := func(file string) []byte {
+		options := lintTestOptions("", "", "")
+		return append(options[:len(options)-1], []byte(`, "lease_import": {"file": "`+file+`"}}`)...)
+	}
+
+	assert.Empty(t, LintAddonOptions(withLeaseImport("")))
+	assert.Empty(t, LintAddonOptions(withLeaseImport("/share/dhcpd.leases")))
+	assert.Equal(t, []ConfigFinding{
+		{Path: "lease_import.file", Severity: ConfigFindingWarning, Message: `the file "/share/../data/dnsmasq.leases" is outside /share, the only folder of Home Assistant readable by the addon`},
+	}, LintAddonOptions(withLeaseImport("/share/../data/dnsmasq.leases")))
+}
+
+func TestLintAddonOptions_PoolAlerts(t *testing.T) {
+	withPoolAlerts := func(poolAlerts string) []byte {
+		options := lintTestOptions("", "", "")
+		return append(options[:len(options)-1], []byte(`, "pool_alerts": `+poolAlerts+`}`)...)
+	}
+
+	assert.Empty(t, LintAddonOptions(withPoolAlerts(`{}`)))
+	assert.Empty(t, LintAddonOptions(withPoolAlerts(`{"warning_percent": 70, "critical_percent": 90, "exhaustion_horizon": "2d", "trend_window": "1w"}`)))
+	assert.Empty(t, LintAddonOptions(withPoolAlerts(`{"exhaustion_horizon": "0"}`)))
+	assert.Equal(t, []ConfigFinding{
+		{Path: "pool_alerts.warning_percent", Severity: ConfigFindingError, Message: "the warning threshold 97% must not exceed the critical threshold 95%"},
+		{Path: "pool_alerts.exhaustion_horizon", Severity: ConfigFindingError, Message: `invalid time duration "soon"`},
+		{Path: "pool_alerts.trend_window", Severity: ConfigFindingWarning, Message: "a trend window shorter than 1h makes the forecast very sensitive to a few DHCP clients joining at once"},
+	}, LintAddonOptions(withPoolAlerts(`{"warning_percent": 97, "exhaustion_horizon": "soon", "trend_window": "10m"}`)))
+}
+
+func TestLintAddonOptions_TestOptionsFile(t *testing.T) {
+	// the options used for the addon development must be free of errors
+	data, err := os.ReadFile("../../../test-options.json")
+	require.NoError(t, err)
+	assert.False(t, HasConfigErrors(LintAddonOptions(data)))
+}
+
+func TestRunValidate(t *testing.T) {
+	dir := t.TempDir()
+
+	validFile := filepath.Join(dir, "valid.json")
+	require.NoError(t, os.WriteFile(validFile, lintTestOptions("", "", ""), 0o600))
+	var out bytes.Buffer
+	assert.Equal(t, 0, RunValidate([]string{validFile}, &out))
+	assert.Contains(t, out.String(), "is valid")
+
+	invalidFile := filepath.Join(dir, "invalid.json")
+	require.NoError(t, os.WriteFile(invalidFile, lintTestOptions("", `[{"name": "gw", "mac": "aa:bb:cc:dd:ee:00", "ip": "192.168.1.1"}]`, ""), 0o600))
+	out.Reset()
+	assert.Equal(t, 0, RunValidate([]string{invalidFile}, &out), "semantic errors must not prevent the addon from starting")
+	assert.Contains(t, out.String(), "error: dhcp_ip_address_reservations[0].ip: IP address 192.168.1.1 is the gateway")
+	assert.Contains(t, out.String(), "starting anyway")
+
+	unparsableFile := filepath.Join(dir, "unparsable.json")
+	require.NoError(t, os.WriteFile(unparsableFile, []byte(`{"dhcp_pools": "not a list"}`), 0o600))
+	out.Reset()
+	assert.Equal(t, 1, RunValidate([]string{unparsableFile}, &out))
+	assert.Contains(t, out.String(), "is invalid")
+
+	out.Reset()
+	assert.Equal(t, 2, RunValidate([]string{filepath.Join(dir, "missing.json")}, &out))
+}
@@ -0,0 +1,265 @@
+package uibackend
+
+import (
+	"dnsmasq-dhcp-backend/pkg/ippool"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "dnsmasq"
+
+// metricsCollector is a prometheus.Collector that computes all DHCP/DNS metrics on-demand,
+// every time the /metrics endpoint is scraped. This avoids the need to keep gauges
+// in sync with the dnsmasq lease file watcher.
+type metricsCollector struct {
+	backend *UIBackend
+
+	// DHCP metrics
+	poolSize             *prometheus.Desc
+	rangeSize            *prometheus.Desc
+	rangeActiveLeases    *prometheus.Desc
+	rangeReservedAddrs   *prometheus.Desc
+	rangeFreeAddrs       *prometheus.Desc
+	ifaceActiveLeases    *prometheus.Desc
+	currentClients       *prometheus.Desc
+	pastClients          *prometheus.Desc
+	trackerDBQueryErrors prometheus.Counter
+
+	// DNS metrics
+	dnsUp                  *prometheus.Desc
+	dnsCacheSize           *prometheus.Desc
+	dnsCacheHits           *prometheus.Desc
+	dnsCacheMisses         *prometheus.Desc
+	dnsCacheInsertions     *prometheus.Desc
+	dnsCacheEvictions      *prometheus.Desc
+	dnsUpstreamQueriesSent *prometheus.Desc
+	dnsUpstreamQueriesFail *prometheus.Desc
+}
+
+func newMetricsCollector(b *UIBackend) *metricsCollector {
+	rangeLabels := []string{"interface", "range"}
+	return &metricsCollector{
+		backend: b,
+
+		poolSize: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "dhcp", "pool_size"),
+			"Number of IP addresses in the whole DHCP pool, i.e. the sum of all DHCP ranges.",
+			nil, nil),
+		rangeSize: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "dhcp", "range_size"),
+			"Number of IP addresses in the DHCP range.",
+			rangeLabels, nil),
+		rangeActiveLeases: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "dhcp", "range_active_leases"),
+			"Number of DHCP leases currently active with an IP address inside the DHCP range.",
+			rangeLabels, nil),
+		rangeReservedAddrs: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "dhcp", "range_reserved_addresses"),
+			"Number of IP addresses inside the DHCP range having an IP address reservation.",
+			rangeLabels, nil),
+		rangeFreeAddrs: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "dhcp", "range_free_addresses"),
+			"Number of IP addresses inside the DHCP range neither leased nor reserved.",
+			rangeLabels, nil),
+		ifaceActiveLeases: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "dhcp", "interface_active_leases"),
+			"Number of DHCP leases currently active with an IP address inside the network served on the interface.",
+			[]string{"interface"}, nil),
+		currentClients: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "dhcp", "current_clients"),
+			"Number of DHCP clients currently holding a lease, split by static (IP address reservation) and dynamic.",
+			[]string{"type"}, nil),
+		pastClients: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "dhcp", "past_clients"),
+			"Number of DHCP clients tracked in the past which are not holding a lease anymore.",
+			nil, nil),
+		trackerDBQueryErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "dhcp",
+			Name:      "tracker_db_query_errors_total",
+			Help:      "Number of failed queries to the tracker DB while collecting metrics.",
+		}),
+
+		dnsUp: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "dns", "up"),
+			"Whether the dnsmasq DNS server answered all CHAOS queries for its statistics (1) or not (0).",
+			nil, nil),
+		dnsCacheSize: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "dns", "cache_size"),
+			"Configured size of the DNS cache.",
+			nil, nil),
+		dnsCacheHits: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "dns", "cache_hits_total"),
+			"Number of DNS queries answered from the cache.",
+			nil, nil),
+		dnsCacheMisses: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "dns", "cache_misses_total"),
+			"Number of DNS queries that could not be answered from the cache.",
+			nil, nil),
+		dnsCacheInsertions: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "dns", "cache_insertions_total"),
+			"Number of entries inserted in the DNS cache.",
+			nil, nil),
+		dnsCacheEvictions: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "dns", "cache_evictions_total"),
+			"Number of entries evicted from the DNS cache before their expiration.",
+			nil, nil),
+		dnsUpstreamQueriesSent: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "dns", "upstream_queries_sent_total"),
+			"Number of DNS queries forwarded to the upstream server.",
+			[]string{"server"}, nil),
+		dnsUpstreamQueriesFail: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "dns", "upstream_queries_failed_total"),
+			"Number of DNS queries forwarded to the upstream server which failed.",
+			[]string{"server"}, nil),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *metricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.poolSize
+	ch <- c.rangeSize
+	ch <- c.rangeActiveLeases
+	ch <- c.rangeReservedAddrs
+	ch <- c.rangeFreeAddrs
+	ch <- c.ifaceActiveLeases
+	ch <- c.currentClients
+	ch <- c.pastClients
+	c.trackerDBQueryErrors.Describe(ch)
+
+	ch <- c.dnsUp
+	ch <- c.dnsCacheSize
+	ch <- c.dnsCacheHits
+	ch <- c.dnsCacheMisses
+	ch <- c.dnsCacheInsertions
+	ch <- c.dnsCacheEvictions
+	ch <- c.dnsUpstreamQueriesSent
+	ch <- c.dnsUpstreamQueriesFail
+}
+
+// Collect implements prometheus.Collector
+func (c *metricsCollector) Collect(ch chan<- prometheus.Metric) {
+	c.collectDhcpMetrics(ch)
+	c.trackerDBQueryErrors.Collect(ch)
+	if c.backend.opts().dnsEnable {
+		c.collectDnsMetrics(ch)
+	}
+}
+
+func (c *metricsCollector) collectDhcpMetrics(ch chan<- prometheus.Metric) {
+	b := c.backend
+	currentClients := b.getCurrentClients()
+
+	ch <- prometheus.MustNewConstMetric(c.poolSize, prometheus.GaugeValue, bigToFloat64(b.opts().dhcpPool.BigSize()))
+
+	// per-range metrics
+	for _, u := range b.getDhcpRangesUtilization(currentClients) {
+		rangeLabel := fmt.Sprintf("%s-%s", u.Start, u.End)
+		size, free := float64(u.Size), float64(u.Free)
+		if u.Size == -1 {
+			// IPv6 ranges can be too large for an int64, yet a float64 approximation is fine for metrics
+			size = bigToFloat64(ippool.NewRangeFromString(u.Start, u.End).BigSize())
+			free = size * (100 - u.UsagePercent) / 100
+		}
+		ch <- prometheus.MustNewConstMetric(c.rangeSize, prometheus.GaugeValue,
+			size, u.Interface, rangeLabel)
+		ch <- prometheus.MustNewConstMetric(c.rangeActiveLeases, prometheus.GaugeValue,
+			float64(u.Used), u.Interface, rangeLabel)
+		ch <- prometheus.MustNewConstMetric(c.rangeReservedAddrs, prometheus.GaugeValue,
+			float64(u.Reserved), u.Interface, rangeLabel)
+		ch <- prometheus.MustNewConstMetric(c.rangeFreeAddrs, prometheus.GaugeValue,
+			free, u.Interface, rangeLabel)
+	}
+
+	// per-interface metrics: multiple DHCP ranges might be defined on the same interface
+	// and network, so make sure each DHCP client is counted only once
+	leasesPerIface := make(map[string]int)
+	for _, n := range b.opts().dhcpRanges {
+		leasesPerIface[n.Interface] = 0
+	}
+	for _, client := range currentClients {
+		countedIfaces := make(map[string]bool)
+		for _, n := range b.opts().dhcpRanges {
+			for _, ip := range client.IPAddrs() {
+				if !countedIfaces[n.Interface] && n.ContainsInNetwork(ip) {
+					countedIfaces[n.Interface] = true
+					leasesPerIface[n.Interface]++
+				}
+			}
+		}
+	}
+	for iface, numLeases := range leasesPerIface {
+		ch <- prometheus.MustNewConstMetric(c.ifaceActiveLeases, prometheus.GaugeValue, float64(numLeases), iface)
+	}
+
+	// static vs dynamic clients
+	numStatic := 0
+	for _, client := range currentClients {
+		if client.HasStaticIP {
+			numStatic++
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(c.currentClients, prometheus.GaugeValue, float64(numStatic), "static")
+	ch <- prometheus.MustNewConstMetric(c.currentClients, prometheus.GaugeValue, float64(len(currentClients)-numStatic), "dynamic")
+
+	// past clients
+	currentClientsMacs := make([]net.HardwareAddr, 0, len(currentClients))
+	for _, client := range currentClients {
+		currentClientsMacs = append(currentClientsMacs, client.Lease.MacAddr)
+	}
+	deadClients, err := b.trackerDB.GetDeadDhcpClients(currentClientsMacs)
+	if err != nil {
+		b.logger.Warnf("failed to get list of dead/past DHCP clients for metrics: %s", err.Error())
+		c.trackerDBQueryErrors.Inc()
+	} else {
+		ch <- prometheus.MustNewConstMetric(c.pastClients, prometheus.GaugeValue, float64(len(deadClients)))
+	}
+}
+
+func (c *metricsCollector) collectDnsMetrics(ch chan<- prometheus.Metric) {
+	stats, err := c.backend.getLocalDnsStats()
+	if err != nil {
+		c.backend.logger.Warnf("failed to get updated DNS stats for metrics: %s", err.Error())
+		ch <- prometheus.MustNewConstMetric(c.dnsUp, prometheus.GaugeValue, 0)
+		// the stats that could not be retrieved are zero: exporting them would look like a counter reset
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.dnsUp, prometheus.GaugeValue, 1)
+
+	ch <- prometheus.MustNewConstMetric(c.dnsCacheSize, prometheus.GaugeValue, float64(stats.CacheSize))
+	ch <- prometheus.MustNewConstMetric(c.dnsCacheHits, prometheus.CounterValue, float64(stats.CacheHits))
+	ch <- prometheus.MustNewConstMetric(c.dnsCacheMisses, prometheus.CounterValue, float64(stats.CacheMisses))
+	ch <- prometheus.MustNewConstMetric(c.dnsCacheInsertions, prometheus.CounterValue, float64(stats.CacheInsertions))
+	ch <- prometheus.MustNewConstMetric(c.dnsCacheEvictions, prometheus.CounterValue, float64(stats.CacheEvictions))
+
+	for _, upstream := range stats.UpstreamServers {
+		ch <- prometheus.MustNewConstMetric(c.dnsUpstreamQueriesSent, prometheus.CounterValue,
+			float64(upstream.QueriesSent), upstream.ServerURL)
+		ch <- prometheus.MustNewConstMetric(c.dnsUpstreamQueriesFail, prometheus.CounterValue,
+			float64(upstream.QueriesFailed), upstream.ServerURL)
+	}
+}
+
+// newMetricsHandler returns the HTTP handler for the /metrics endpoint, exposing both the
+// DHCP/DNS metrics and the standard Go runtime metrics
+func (b *UIBackend) newMetricsHandler() http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		newMetricsCollector(b),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// bigToFloat64 returns the float64 closest to the given integer
+func bigToFloat64(n *big.Int) float64 {
+	f, _ := new(big.Float).SetInt(n).Float64()
+	return f
+}
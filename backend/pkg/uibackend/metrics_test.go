@@ -0,0 +1,92 @@
+package uibackend
+
+import (
+	"dnsmasq-dhcp-backend/pkg/trackerdb"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsCollector(t *testing.T) {
+	backend := getMockUIBackend()
+	backend.processLeaseUpdatesFromArray(getMockLeases())
+	backend.trackerDB = trackerdb.NewTestDBWithData([]trackerdb.DhcpClient{
+		{MacAddr: MustParseMAC("00:11:22:33:44:55"), Hostname: "client1", LastSeen: time.Now()}, // this is a current client
+		{MacAddr: MustParseMAC("de:ad:be:ef:00:01"), Hostname: "old-laptop", LastSeen: time.Now().Add(-time.Hour)},
+	})
+
+	expected := `
+# HELP dnsmasq_dhcp_current_clients Number of DHCP clients currently holding a lease, split by static (IP address reservation) and dynamic.
+# TYPE dnsmasq_dhcp_current_clients gauge
+dnsmasq_dhcp_current_clients{type="dynamic"} 3
+dnsmasq_dhcp_current_clients{type="static"} 1
+# HELP dnsmasq_dhcp_interface_active_leases Number of DHCP leases currently active with an IP address inside the network served on the interface.
+# TYPE dnsmasq_dhcp_interface_active_leases gauge
+dnsmasq_dhcp_interface_active_leases{interface="eth0"} 4
+# HELP dnsmasq_dhcp_past_clients Number of DHCP clients tracked in the past which are not holding a lease anymore.
+# TYPE dnsmasq_dhcp_past_clients gauge
+dnsmasq_dhcp_past_clients 1
+# HELP dnsmasq_dhcp_range_active_leases Number of DHCP leases currently active with an IP address inside the DHCP range.
+# TYPE dnsmasq_dhcp_range_active_leases gauge
+dnsmasq_dhcp_range_active_leases{interface="eth0",range="192.168.0.1-192.168.0.100"} 3
+# HELP dnsmasq_dhcp_range_free_addresses Number of IP addresses inside the DHCP range neither leased nor reserved.
+# TYPE dnsmasq_dhcp_range_free_addresses gauge
+dnsmasq_dhcp_range_free_addresses{interface="eth0",range="192.168.0.1-192.168.0.100"} 97
+# HELP dnsmasq_dhcp_range_size Number of IP addresses in the DHCP range.
+# TYPE dnsmasq_dhcp_range_size gauge
+dnsmasq_dhcp_range_size{interface="eth0",range="192.168.0.1-192.168.0.100"} 100
+`
+	err := testutil.CollectAndCompare(newMetricsCollector(backend), strings.NewReader(expected),
+		"dnsmasq_dhcp_current_clients",
+		"dnsmasq_dhcp_interface_active_leases",
+		"dnsmasq_dhcp_past_clients",
+		"dnsmasq_dhcp_range_active_leases",
+		"dnsmasq_dhcp_range_free_addresses",
+		"dnsmasq_dhcp_range_size",
+	)
+	require.NoError(t, err)
+
+	// DNS is disabled in the mock backend: no DNS metrics must be exported
+	assert.Equal(t, 0, testutil.CollectAndCount(newMetricsCollector(backend), "dnsmasq_dns_up"))
+
+	problems, err := testutil.CollectAndLint(newMetricsCollector(backend))
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+}
+
+func TestMetricsCollector_DnsDown(t *testing.T) {
+	backend := getMockUIBackend()
+	opts := *backend.opts()
+	opts.dnsEnable = true
+	opts.dnsPort = 1 // nothing is listening here
+	backend.options.Store(&opts)
+
+	// only the dnsmasq_dns_up gauge is exported: zero counters would be taken as a reset by Prometheus
+	expected := `
+# HELP dnsmasq_dns_up Whether the dnsmasq DNS server answered all CHAOS queries for its statistics (1) or not (0).
+# TYPE dnsmasq_dns_up gauge
+dnsmasq_dns_up 0
+`
+	require.NoError(t, testutil.CollectAndCompare(newMetricsCollector(backend), strings.NewReader(expected), "dnsmasq_dns_up"))
+	assert.Equal(t, 0, testutil.CollectAndCount(newMetricsCollector(backend), "dnsmasq_dns_cache_hits_total"))
+	assert.Equal(t, 0, testutil.CollectAndCount(newMetricsCollector(backend), "dnsmasq_dns_cache_size"))
+}
+
+func TestMetricsHandler(t *testing.T) {
+	backend := getMockUIBackend()
+	backend.processLeaseUpdatesFromArray(getMockLeases())
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	rec := httptest.NewRecorder()
+	backend.newMetricsHandler().ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "dnsmasq_dhcp_pool_size 100")
+	assert.Contains(t, rec.Body.String(), "go_goroutines")
+}
@@ -0,0 +1,144 @@
+package uibackend
+
+import (
+	"dnsmasq-dhcp-backend/pkg/ippool"
+	"dnsmasq-dhcp-backend/pkg/notifier"
+	"fmt"
+	"slices"
+	"time"
+
+	human_duration "github.com/davidbanham/human_duration/v3"
+)
+
+// evaluateDhcpRangeAlert computes the alert level of a DHCP range from its current usage, the forecast
+// of its usage and the thresholds of the addon options
+func evaluateDhcpRangeAlert(nw IpNetworkInfo, u ippool.RangeUsage, f ippool.UsageForecast, opts *AddonOptions) DhcpRangeAlert {
+	alert := DhcpRangeAlert{
+		Interface:           nw.Interface,
+		Start:               nw.Start.String(),
+		End:                 nw.End.String(),
+		Level:               DhcpRangeAlertOK,
+		Reasons:             []string{},
+		UsagePercent:        u.UsagePercent(),
+		TrendPerHour:        f.TrendPerHour,
+		TimeToExhaustionSec: -1,
+	}
+	if f.Exhausts {
+		alert.TimeToExhaustionSec = int64(f.TimeToExhaustion.Seconds())
+	}
+	raise := func(level DhcpRangeAlertLevel, format string, args ...any) {
+		if level == DhcpRangeAlertCritical || alert.Level == DhcpRangeAlertOK {
+			alert.Level = level
+		}
+		alert.Reasons = append(alert.Reasons, fmt.Sprintf(format, args...))
+	}
+
+	switch {
+	case u.Size > 0 && u.Free == 0:
+		raise(DhcpRangeAlertCritical, "no free IP address left")
+	case alert.UsagePercent >= float64(opts.poolAlertCriticalPercent):
+		raise(DhcpRangeAlertCritical, "usage is at %.1f%%, above the critical threshold of %d%%", alert.UsagePercent, opts.poolAlertCriticalPercent)
+	case alert.UsagePercent >= float64(opts.poolAlertWarningPercent):
+		raise(DhcpRangeAlertWarning, "usage is at %.1f%%, above the warning threshold of %d%%", alert.UsagePercent, opts.poolAlertWarningPercent)
+	}
+	if f.Exhausts && f.TimeToExhaustion > 0 && f.TimeToExhaustion < opts.poolAlertHorizon {
+		raise(DhcpRangeAlertWarning, "at the current trend of %+.1f IP addresses per hour, no free IP address will be left in %s",
+			f.TrendPerHour, human_duration.ShortString(f.TimeToExhaustion, human_duration.Minute))
+	}
+	return alert
+}
+
+// checkDhcpRangesAlerts records the current usage of each DHCP range, updates their alerts and, if requested,
+// notifies the DHCP ranges whose alert level changed
+func (b *UIBackend) checkDhcpRangesAlerts(now time.Time, notify bool) {
+	opts := b.opts()
+	leased, reserved := b.getLeasedAndReservedIPs(b.getCurrentClients())
+
+	b.dhcpRangesAlertsLock.Lock()
+	if b.dhcpRangesHistory == nil {
+		b.dhcpRangesHistory = make(map[string]*ippool.UsageHistory)
+		b.dhcpRangesAlerts = make(map[string]DhcpRangeAlert)
+	}
+	var changed []notifier.Event
+	keys := make([]string, 0, len(opts.dhcpRanges))
+	for _, nw := range opts.dhcpRanges {
+		key := nw.Range().String()
+		keys = append(keys, key)
+
+		usage := nw.Range().Usage(leased, reserved)
+		history, ok := b.dhcpRangesHistory[key]
+		if !ok {
+			history = ippool.NewUsageHistory(opts.poolAlertTrendWindow)
+			b.dhcpRangesHistory[key] = history
+		}
+		history.Add(now, usage.Busy)
+
+		alert := evaluateDhcpRangeAlert(nw, usage, history.Forecast(now, usage), opts)
+		previous, wasEvaluated := b.dhcpRangesAlerts[key]
+		b.dhcpRangesAlerts[key] = alert
+		if wasEvaluated && previous.Level != alert.Level {
+			changed = append(changed, notifier.Event{
+				Type:      notifier.EventPoolAlert,
+				Timestamp: now,
+				Pool: &notifier.PoolUsage{
+					Interface: alert.Interface,
+					Start:     alert.Start,
+					End:       alert.End,
+					Size:      usage.Size,
+					Used:      usage.Used,
+					Reserved:  usage.Reserved,
+					Alert: &notifier.PoolAlert{
+						Level:               string(alert.Level),
+						Reasons:             alert.Reasons,
+						UsagePercent:        alert.UsagePercent,
+						TimeToExhaustionSec: alert.TimeToExhaustionSec,
+					},
+				},
+			})
+		}
+	}
+
+	// forget the DHCP ranges removed from the addon options
+	for key := range b.dhcpRangesHistory {
+		if !slices.Contains(keys, key) {
+			delete(b.dhcpRangesHistory, key)
+			delete(b.dhcpRangesAlerts, key)
+		}
+	}
+	b.dhcpRangesAlertsLock.Unlock()
+
+	if !notify {
+		return
+	}
+	for _, ev := range changed {
+		b.logger.Warnf("Notifying %s", ev.String())
+		for _, n := range b.notifiers {
+			n.Notify(ev)
+		}
+	}
+}
+
+// getDhcpRangesAlerts returns the latest alert of each configured DHCP range, in the same order of the
+// "dhcp_pools" addon option; DHCP ranges whose usage was never recorded are reported as not running out of
+// free IP addresses
+func (b *UIBackend) getDhcpRangesAlerts() []DhcpRangeAlert {
+	b.dhcpRangesAlertsLock.Lock()
+	defer b.dhcpRangesAlertsLock.Unlock()
+
+	ret := make([]DhcpRangeAlert, 0, len(b.opts().dhcpRanges))
+	for _, nw := range b.opts().dhcpRanges {
+		alert, ok := b.dhcpRangesAlerts[nw.Range().String()]
+		if !ok {
+			alert = DhcpRangeAlert{
+				Interface:           nw.Interface,
+				Start:               nw.Start.String(),
+				End:                 nw.End.String(),
+				Level:               DhcpRangeAlertOK,
+				Reasons:             []string{},
+				TimeToExhaustionSec: -1,
+			}
+		}
+		ret = append(ret, alert)
+	}
+	return ret
+}
@@ -0,0 +1,149 @@
+package uibackend
+
+import (
+	"dnsmasq-dhcp-backend/pkg/ippool"
+	"dnsmasq-dhcp-backend/pkg/leasewatcher"
+	"dnsmasq-dhcp-backend/pkg/notifier"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluateDhcpRangeAlert(t *testing.T) {
+	opts := getMockUIBackend().opts()
+	nw := opts.dhcpRanges[0]
+
+	tests := []struct {
+		name            string
+		usage           ippool.RangeUsage
+		forecast        ippool.UsageForecast
+		expectedLevel   DhcpRangeAlertLevel
+		expectedReasons []string
+	}{
+		{
+			name:          "low usage",
+			usage:         ippool.RangeUsage{Size: 100, Busy: 10, Free: 90},
+			expectedLevel: DhcpRangeAlertOK,
+		},
+		{
+			name:            "above the warning threshold",
+			usage:           ippool.RangeUsage{Size: 100, Busy: 85, Free: 15},
+			expectedLevel:   DhcpRangeAlertWarning,
+			expectedReasons: []string{"usage is at 85.0%, above the warning threshold of 80%"},
+		},
+		{
+			name:            "above the critical threshold",
+			usage:           ippool.RangeUsage{Size: 100, Busy: 97, Free: 3},
+			expectedLevel:   DhcpRangeAlertCritical,
+			expectedReasons: []string{"usage is at 97.0%, above the critical threshold of 95%"},
+		},
+		{
+			name:            "exhausted",
+			usage:           ippool.RangeUsage{Size: 100, Busy: 100, Free: 0},
+			forecast:        ippool.UsageForecast{Exhausts: true},
+			expectedLevel:   DhcpRangeAlertCritical,
+			expectedReasons: []string{"no free IP address left"},
+		},
+		{
+			name:            "forecast to run out within the horizon",
+			usage:           ippool.RangeUsage{Size: 100, Busy: 40, Free: 60},
+			forecast:        ippool.UsageForecast{HasTrend: true, TrendPerHour: 10, Exhausts: true, TimeToExhaustion: 6 * time.Hour},
+			expectedLevel:   DhcpRangeAlertWarning,
+			expectedReasons: []string{"at the current trend of +10.0 IP addresses per hour, no free IP address will be left in 6h"},
+		},
+		{
+			name:          "forecast to run out beyond the horizon",
+			usage:         ippool.RangeUsage{Size: 100, Busy: 40, Free: 60},
+			forecast:      ippool.UsageForecast{HasTrend: true, TrendPerHour: 1, Exhausts: true, TimeToExhaustion: 60 * time.Hour},
+			expectedLevel: DhcpRangeAlertOK,
+		},
+		{
+			name:     "critical usage and forecast",
+			usage:    ippool.RangeUsage{Size: 100, Busy: 96, Free: 4},
+			forecast: ippool.UsageForecast{HasTrend: true, TrendPerHour: 2, Exhausts: true, TimeToExhaustion: 2 * time.Hour},
+			// the forecast does not lower the level
+			expectedLevel: DhcpRangeAlertCritical,
+			expectedReasons: []string{
+				"usage is at 96.0%, above the critical threshold of 95%",
+				"at the current trend of +2.0 IP addresses per hour, no free IP address will be left in 2h",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alert := evaluateDhcpRangeAlert(nw, tt.usage, tt.forecast, opts)
+			assert.Equal(t, tt.expectedLevel, alert.Level)
+			if tt.expectedReasons == nil {
+				tt.expectedReasons = []string{}
+			}
+			assert.Equal(t, tt.expectedReasons, alert.Reasons)
+		})
+	}
+}
+
+func TestCheckDhcpRangesAlerts(t *testing.T) {
+	backend := getMockUIBackend()
+	recorder := &notifier.Recorder{}
+	backend.notifiers = []notifier.Notifier{recorder}
+
+	// setClients replaces the current DHCP clients with n clients in the DHCP range, from 192.168.0.4 onward
+	setClients := func(n int) {
+		clients := make([]DhcpClientData, 0, n)
+		for i := range n {
+			clients = append(clients, DhcpClientData{Lease: leasewatcher.Lease{
+				MacAddr: MustParseMAC("de:ad:be:ef:00:01"),
+				IPAddr:  netip.AddrFrom4([4]byte{192, 168, 0, byte(4 + i)}),
+			}})
+		}
+		backend.dhcpClientDataLock.Lock()
+		backend.dhcpClientData = clients
+		backend.dhcpClientDataLock.Unlock()
+	}
+
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	backend.checkDhcpRangesAlerts(t0, true)
+	assert.Empty(t, recorder.Events())
+	assert.Equal(t, DhcpRangeAlertOK, backend.getDhcpRangesAlerts()[0].Level)
+
+	// 20 new clients in one hour: the DHCP range will run out of IP addresses in a few hours
+	setClients(20)
+	backend.checkDhcpRangesAlerts(t0.Add(time.Hour), true)
+	alert := backend.getDhcpRangesAlerts()[0]
+	assert.Equal(t, DhcpRangeAlertWarning, alert.Level)
+	assert.Positive(t, alert.TrendPerHour)
+	assert.Greater(t, alert.TimeToExhaustionSec, int64(0))
+	events := recorder.Events()
+	require.Len(t, events, 1)
+	assert.Equal(t, notifier.EventPoolAlert, events[0].Type)
+	assert.Equal(t, "warning", events[0].Pool.Alert.Level)
+	assert.Equal(t, int64(20), events[0].Pool.Used)
+	assert.Equal(t, int64(1), events[0].Pool.Reserved)
+
+	// no notification while the level stays the same
+	backend.checkDhcpRangesAlerts(t0.Add(90*time.Minute), true)
+	assert.Empty(t, recorder.Events())
+
+	setClients(95)
+	backend.checkDhcpRangesAlerts(t0.Add(2*time.Hour), true)
+	assert.Equal(t, DhcpRangeAlertCritical, backend.getDhcpRangesAlerts()[0].Level)
+	require.Len(t, recorder.Events(), 1)
+
+	// once the clients are gone and the trend window has passed, the alert is cleared
+	setClients(0)
+	backend.checkDhcpRangesAlerts(t0.Add(48*time.Hour), true)
+	alert = backend.getDhcpRangesAlerts()[0]
+	assert.Equal(t, DhcpRangeAlertOK, alert.Level)
+	assert.Equal(t, int64(-1), alert.TimeToExhaustionSec)
+	events = recorder.Events()
+	require.Len(t, events, 1)
+	assert.Equal(t, "ok", events[0].Pool.Alert.Level)
+
+	// the alerts of the DHCP ranges removed from the addon options are forgotten
+	backend.opts().dhcpRanges = nil
+	backend.checkDhcpRangesAlerts(t0.Add(49*time.Hour), true)
+	assert.Empty(t, backend.getDhcpRangesAlerts())
+	assert.Empty(t, backend.dhcpRangesHistory)
+}
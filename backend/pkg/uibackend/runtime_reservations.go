@@ -0,0 +1,249 @@
+package uibackend
+
+import (
+	"dnsmasq-dhcp-backend/pkg/dnsmasqctl"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/netip"
+	"slices"
+)
+
+// errors returned when creating, editing or deleting the IP address reservations from the web UI
+var (
+	errInvalidReservation     = errors.New("invalid IP address reservation")
+	errConflictingReservation = errors.New("conflicting IP address reservation")
+	errReservationNotFound    = errors.New("no IP address reservation created from the web UI")
+	errDnsmasqNotReloaded     = errors.New("the IP address reservation was saved but dnsmasq could not be asked to apply it")
+)
+
+// withRuntimeReservations returns a copy of the given addon options where the given IP address reservations
+// created from the web UI are added to the ones of the addon options, replacing any reservation created
+// from the web UI that was merged previously. The reservations of the addon options take precedence
+// over conflicting reservations created from the web UI.
+func withRuntimeReservations(opts *AddonOptions, runtime map[string]IpAddressReservation) *AddonOptions {
+	merged := *opts
+	merged.ipAddressReservationsByIP = make(map[netip.Addr]IpAddressReservation, len(opts.ipAddressReservationsByIP)+len(runtime))
+	merged.ipAddressReservationsByMAC = make(map[string]IpAddressReservation, len(opts.ipAddressReservationsByMAC)+len(runtime))
+	for ip, r := range opts.ipAddressReservationsByIP {
+		if !r.Runtime {
+			merged.ipAddressReservationsByIP[ip] = r
+		}
+	}
+	for mac, r := range opts.ipAddressReservationsByMAC {
+		if !r.Runtime {
+			merged.ipAddressReservationsByMAC[mac] = r
+		}
+	}
+
+	for mac, r := range runtime {
+		_, hasMacConflict := merged.ipAddressReservationsByMAC[mac]
+		_, hasIpConflict := merged.ipAddressReservationsByIP[r.IP]
+		if hasMacConflict || hasIpConflict {
+			continue
+		}
+		merged.ipAddressReservationsByIP[r.IP] = r
+		merged.ipAddressReservationsByMAC[mac] = r
+	}
+	return &merged
+}
+
+// checkRuntimeReservation validates an IP address reservation created from the web UI against the
+// DHCP networks, the other reservations and the current DHCP leases. Any reservation for the same
+// MAC address found in the given runtime reservations is ignored, since it's going to be replaced.
+func (b *UIBackend) checkRuntimeReservation(opts *AddonOptions, runtime map[string]IpAddressReservation, r IpAddressReservation) error {
+	if r.Name != "" && !dnsmasqctl.IsValidHostname(r.Name) {
+		return fmt.Errorf("%w: the name %q is not a valid hostname: use only letters, digits and hyphens", errInvalidReservation, r.Name)
+	}
+
+	inAnyNetwork := false
+	for _, nw := range opts.dhcpRanges {
+		if !nw.ContainsInNetwork(r.IP) {
+			continue
+		}
+		inAnyNetwork = true
+
+		switch r.IP {
+		case nw.Gateway, nw.NetworkAddr(), nw.BroadcastAddr():
+			return fmt.Errorf("%w: the IP address %s is the gateway, network or broadcast address of the network %s",
+				errInvalidReservation, r.IP, nw.String())
+		}
+	}
+	if !inAnyNetwork {
+		return fmt.Errorf("%w: the IP address %s is outside all the networks defined in dhcp_pools", errInvalidReservation, r.IP)
+	}
+
+	mac := r.Mac.String()
+	if other, ok := opts.ipAddressReservationsByMAC[mac]; ok && !other.Runtime {
+		return fmt.Errorf("%w: the MAC address %s already has the IP address %s reserved in the addon options",
+			errConflictingReservation, mac, other.IP)
+	}
+	if other, ok := opts.ipAddressReservationsByIP[r.IP]; ok && !other.Runtime {
+		return fmt.Errorf("%w: the IP address %s is already reserved in the addon options for the MAC address %s",
+			errConflictingReservation, r.IP, other.Mac)
+	}
+	for otherMac, other := range runtime {
+		if otherMac != mac && other.IP == r.IP {
+			return fmt.Errorf("%w: the IP address %s is already reserved for the MAC address %s",
+				errConflictingReservation, r.IP, otherMac)
+		}
+	}
+
+	for _, c := range b.getCurrentClients() {
+		if c.Lease.IPAddr == r.IP && c.Lease.MacAddr.String() != mac {
+			return fmt.Errorf("%w: the IP address %s is currently leased to the MAC address %s",
+				errConflictingReservation, r.IP, c.Lease.MacAddr)
+		}
+	}
+	return nil
+}
+
+// saveRuntimeReservations writes the given reservations to the dnsmasq hostsfile
+func (b *UIBackend) saveRuntimeReservations(runtime map[string]IpAddressReservation) error {
+	entries := make([]dnsmasqctl.HostsFileEntry, 0, len(runtime))
+	for _, r := range runtime {
+		entries = append(entries, dnsmasqctl.HostsFileEntry{
+			Mac:  r.Mac,
+			IP:   r.IP,
+			Name: r.Name,
+			// same lease time used for the reservations of the addon options
+			LeaseTime: b.opts().addressReservationLease,
+		})
+	}
+	if err := dnsmasqctl.WriteHostsFile(defaultDnsmasqHostsFile, entries); err != nil {
+		return fmt.Errorf("failed to write the dnsmasq hostsfile: %w", err)
+	}
+	return nil
+}
+
+// readRuntimeReservations reads the IP address reservations created from the web UI from the dnsmasq
+// hostsfile; it returns only the reservations which are still valid, e.g. that do not conflict with
+// the addon options, together with the number of discarded reservations
+func (b *UIBackend) readRuntimeReservations() (map[string]IpAddressReservation, int, error) {
+	entries, err := dnsmasqctl.ReadHostsFile(defaultDnsmasqHostsFile)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	runtime := make(map[string]IpAddressReservation, len(entries))
+	for _, e := range entries {
+		r := IpAddressReservation{Name: e.Name, Mac: e.Mac, IP: e.IP, Runtime: true}
+		if err := b.checkRuntimeReservation(b.opts(), runtime, r); err != nil {
+			b.logger.Warnf("discarding the IP address reservation [%s] created from the web UI: %s", e.String(), err.Error())
+			continue
+		}
+		runtime[e.Mac.String()] = r
+	}
+	return runtime, len(entries) - len(runtime), nil
+}
+
+// loadRuntimeReservations reads the IP address reservations created from the web UI and puts them
+// in use; reservations which are not valid anymore, e.g. because the addon options changed meanwhile,
+// are removed from the hostsfile
+func (b *UIBackend) loadRuntimeReservations() error {
+	b.optionsLock.Lock()
+	defer b.optionsLock.Unlock()
+
+	runtime, discarded, err := b.readRuntimeReservations()
+	if err != nil {
+		return err
+	}
+	b.runtimeReservations = runtime
+	b.options.Store(withRuntimeReservations(b.opts(), runtime))
+
+	if discarded > 0 {
+		if err := b.saveRuntimeReservations(runtime); err != nil {
+			return err
+		}
+		if err := b.dnsmasqCtl.ReloadHostsFile(); err != nil {
+			b.logger.Warnf("failed to reload the dnsmasq hostsfile: %s", err.Error())
+		}
+	}
+
+	b.logger.Infof("Acquired %d IP address reservations created from the web UI\n", len(runtime))
+	return nil
+}
+
+// getRuntimeReservation returns the IP address reservation created from the web UI for the given MAC address, if any
+func (b *UIBackend) getRuntimeReservation(mac net.HardwareAddr) (IpAddressReservation, bool) {
+	b.optionsLock.Lock()
+	defer b.optionsLock.Unlock()
+	r, ok := b.runtimeReservations[mac.String()]
+	return r, ok
+}
+
+// getAllReservations returns all IP address reservations in use, sorted by IP address
+func (b *UIBackend) getAllReservations() []IpAddressReservation {
+	return slices.SortedFunc(maps.Values(b.opts().ipAddressReservationsByIP), func(a, b IpAddressReservation) int {
+		return a.IP.Compare(b.IP)
+	})
+}
+
+// setRuntimeReservation creates (or replaces, if the replace flag is set) the IP address reservation
+// for r.Mac, then asks dnsmasq to apply it
+func (b *UIBackend) setRuntimeReservation(r IpAddressReservation, replace bool) error {
+	b.optionsLock.Lock()
+	defer b.optionsLock.Unlock()
+
+	mac := r.Mac.String()
+	_, exists := b.runtimeReservations[mac]
+	if replace && !exists {
+		return fmt.Errorf("%w for the MAC address %s", errReservationNotFound, mac)
+	}
+	if !replace && exists {
+		return fmt.Errorf("%w: the MAC address %s already has an IP address reservation created from the web UI",
+			errConflictingReservation, mac)
+	}
+
+	r.Runtime = true
+	r.Link = nil // links are provided through the client metadata
+	if err := b.checkRuntimeReservation(b.opts(), b.runtimeReservations, r); err != nil {
+		return err
+	}
+
+	runtime := maps.Clone(b.runtimeReservations)
+	if runtime == nil {
+		runtime = make(map[string]IpAddressReservation)
+	}
+	runtime[mac] = r
+	return b.applyRuntimeReservations(runtime)
+}
+
+// deleteRuntimeReservation removes the IP address reservation created from the web UI for the
+// given MAC address, then asks dnsmasq to forget it
+func (b *UIBackend) deleteRuntimeReservation(mac net.HardwareAddr) error {
+	b.optionsLock.Lock()
+	defer b.optionsLock.Unlock()
+
+	if _, exists := b.runtimeReservations[mac.String()]; !exists {
+		if _, inOptions := b.opts().ipAddressReservationsByMAC[mac.String()]; inOptions {
+			return fmt.Errorf("%w: the IP address reservation of the MAC address %s is defined in the addon options and can be removed only from there",
+				errConflictingReservation, mac)
+		}
+		return fmt.Errorf("%w for the MAC address %s", errReservationNotFound, mac)
+	}
+
+	runtime := maps.Clone(b.runtimeReservations)
+	delete(runtime, mac.String())
+	return b.applyRuntimeReservations(runtime)
+}
+
+// applyRuntimeReservations saves the given reservations, puts them in use and asks dnsmasq to read
+// the hostsfile again; the caller must hold the optionsLock
+func (b *UIBackend) applyRuntimeReservations(runtime map[string]IpAddressReservation) error {
+	if err := b.saveRuntimeReservations(runtime); err != nil {
+		return err
+	}
+	b.runtimeReservations = runtime
+	b.options.Store(withRuntimeReservations(b.opts(), runtime))
+
+	// the reservations affect the HasStaticIP field of the current DHCP clients
+	b.triggerClientsRefresh()
+
+	if err := b.dnsmasqCtl.ReloadHostsFile(); err != nil {
+		b.logger.Warnf("failed to reload the dnsmasq hostsfile: %s", err.Error())
+		return fmt.Errorf("%w: %w; restart the addon to apply it", errDnsmasqNotReloaded, err)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package uibackend
+
+import (
+	"dnsmasq-dhcp-backend/pkg/dnsmasqctl"
+	"net/netip"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithRuntimeReservations(t *testing.T) {
+	fromOptions := IpAddressReservation{Name: "nas", Mac: MustParseMAC("aa:bb:cc:dd:ee:01"), IP: netip.MustParseAddr("192.168.0.10")}
+	opts := newAddonOptions()
+	opts.ipAddressReservationsByIP[fromOptions.IP] = fromOptions
+	opts.ipAddressReservationsByMAC[fromOptions.Mac.String()] = fromOptions
+
+	printer := IpAddressReservation{Name: "printer", Mac: MustParseMAC("aa:bb:cc:dd:ee:02"), IP: netip.MustParseAddr("192.168.0.20"), Runtime: true}
+	conflicting := IpAddressReservation{Mac: MustParseMAC("aa:bb:cc:dd:ee:03"), IP: fromOptions.IP, Runtime: true}
+	merged := withRuntimeReservations(opts, map[string]IpAddressReservation{
+		printer.Mac.String():     printer,
+		conflicting.Mac.String(): conflicting,
+	})
+	assert.Len(t, merged.ipAddressReservationsByIP, 2)
+	assert.Equal(t, fromOptions, merged.ipAddressReservationsByIP[fromOptions.IP], "the addon options take precedence")
+	assert.Equal(t, printer, merged.ipAddressReservationsByMAC[printer.Mac.String()])
+	assert.Len(t, opts.ipAddressReservationsByIP, 1, "the original options must not be modified")
+
+	// merging again replaces the previous runtime reservations
+	merged = withRuntimeReservations(merged, nil)
+	assert.Len(t, merged.ipAddressReservationsByIP, 1)
+	assert.Len(t, merged.ipAddressReservationsByMAC, 1)
+}
+
+func TestLoadRuntimeReservations(t *testing.T) {
+	savedHostsFile := defaultDnsmasqHostsFile
+	defaultDnsmasqHostsFile = t.TempDir() + "/dnsmasq.hosts"
+	t.Cleanup(func() { defaultDnsmasqHostsFile = savedHostsFile })
+
+	require.NoError(t, os.WriteFile(defaultDnsmasqHostsFile, []byte(
+		"00:11:22:33:44:57,printer,192.168.0.101,infinite\n"+
+			"00:11:22:33:44:58,192.168.0.3,infinite\n"+ // reserved in the addon options meanwhile
+			"00:11:22:33:44:59,10.0.0.3,infinite\n"), 0o600)) // the DHCP network changed meanwhile
+
+	backend := getMockUIBackend()
+	fake := dnsmasqctl.NewFakeController()
+	backend.dnsmasqCtl = fake
+	require.NoError(t, backend.loadRuntimeReservations())
+
+	r, ok := backend.getRuntimeReservation(MustParseMAC("00:11:22:33:44:57"))
+	require.True(t, ok)
+	assert.Equal(t, "printer", r.Name)
+	assert.True(t, backend.hasIpAddressReservationByIP(netip.MustParseAddr("192.168.0.101"), MustParseMAC("00:11:22:33:44:57")))
+	assert.Len(t, backend.getAllReservations(), 2)
+
+	// the discarded reservations are removed from the hostsfile, so that dnsmasq stops using them
+	entries, err := dnsmasqctl.ReadHostsFile(defaultDnsmasqHostsFile)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, 1, fake.Reloads())
+}
+
+func TestSetRuntimeReservation_IPv6(t *testing.T) {
+	savedHostsFile := defaultDnsmasqHostsFile
+	defaultDnsmasqHostsFile = t.TempDir() + "/dnsmasq.hosts"
+	t.Cleanup(func() { defaultDnsmasqHostsFile = savedHostsFile })
+
+	backend := getMockUIBackend()
+	opts := *backend.opts()
+	opts.dhcpRanges = append(slices.Clone(opts.dhcpRanges), IpNetworkInfo{
+		Interface: "eth0",
+		Start:     netip.MustParseAddr("fd00::100"),
+		End:       netip.MustParseAddr("fd00::1ff"),
+		Network:   netip.MustParsePrefix("fd00::/64"),
+	})
+	opts.addressReservationLease = "infinite"
+	backend.options.Store(&opts)
+
+	r := IpAddressReservation{Name: "nas", Mac: MustParseMAC("00:11:22:33:44:57"), IP: netip.MustParseAddr("fd00::10")}
+	require.NoError(t, backend.setRuntimeReservation(r, false))
+
+	// dnsmasq requires IPv6 addresses to be enclosed in brackets
+	data, err := os.ReadFile(defaultDnsmasqHostsFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "00:11:22:33:44:57,nas,[fd00::10],infinite\n")
+
+	// the reservation survives a restart of the addon
+	backend.runtimeReservations = nil
+	require.NoError(t, backend.loadRuntimeReservations())
+	loaded, ok := backend.getRuntimeReservation(r.Mac)
+	require.True(t, ok)
+	assert.Equal(t, r.IP, loaded.IP)
+
+	// the network address of an IPv6 network cannot be reserved
+	r = IpAddressReservation{Mac: MustParseMAC("00:11:22:33:44:58"), IP: netip.MustParseAddr("fd00::")}
+	assert.ErrorIs(t, backend.setRuntimeReservation(r, false), errInvalidReservation)
+}
@@ -0,0 +1,136 @@
+package uibackend
+
+import (
+	"dnsmasq-dhcp-backend/pkg/ippool"
+	"flag"
+	"fmt"
+	"io"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// suggestRequest describes which free IP addresses of a network should be suggested for new IP address reservations
+type suggestRequest struct {
+	count int
+	opts  ippool.SuggestOptions
+
+	// seenWithin limits the past DHCP clients whose last IP address is avoided to the ones seen
+	// within this time; zero means all the past DHCP clients recorded in the tracker DB
+	seenWithin time.Duration
+}
+
+// parseExcludedRange parses an IP address range to leave out of the suggestions: a single IP address,
+// a start-end pair or a subnet, where IP addresses can be abbreviated like in the range of a DHCP pool
+func parseExcludedRange(s string, network netip.Prefix) (ippool.Range, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "-") && !strings.Contains(s, "/") {
+		ip, err := expandHostAddr(s, network)
+		if err != nil {
+			return ippool.Range{}, err
+		}
+		return ippool.NewRange(ip, ip), nil
+	}
+	return parseRangeInNetwork(s, network)
+}
+
+// parseSuggestRequest validates the parameters of a request of free IP addresses in the given network;
+// exclude is a list of comma-separated lists of ranges accepted by parseExcludedRange
+func parseSuggestRequest(nw IpNetworkInfo, countStr string, exclude []string, preferOutsidePool bool, seenWithinStr string) (suggestRequest, error) {
+	req := suggestRequest{count: defaultSuggestCount}
+	req.opts.PreferOutsidePool = preferOutsidePool
+
+	if countStr != "" {
+		count, err := strconv.Atoi(countStr)
+		if err != nil || count <= 0 || count > maxSuggestCount {
+			return req, fmt.Errorf("invalid 'count' parameter %q: expecting a value between 1 and %d", countStr, maxSuggestCount)
+		}
+		req.count = count
+	}
+	for _, list := range exclude {
+		for _, s := range strings.Split(list, ",") {
+			if strings.TrimSpace(s) == "" {
+				continue
+			}
+			r, err := parseExcludedRange(s, nw.Network)
+			if err != nil {
+				return req, fmt.Errorf("invalid 'exclude' parameter %q: %w", s, err)
+			}
+			req.opts.Exclude = append(req.opts.Exclude, r)
+		}
+	}
+	if seenWithinStr != "" {
+		seenWithin, err := time.ParseDuration(seenWithinStr)
+		if err != nil || seenWithin < 0 {
+			return req, fmt.Errorf("invalid 'seen_within' parameter %q: expecting a duration like 720h", seenWithinStr)
+		}
+		req.seenWithin = seenWithin
+	}
+	return req, nil
+}
+
+// suggestFreeAddresses returns the IP addresses of the given network that can be used for new IP address
+// reservations: they are not the gateway, and are neither reserved, nor leased, nor the last IP address
+// of a past DHCP client seen recently
+func (b *UIBackend) suggestFreeAddresses(nw IpNetworkInfo, currentClients []DhcpClientData, req suggestRequest) []netip.Addr {
+	var seenSince time.Time
+	if req.seenWithin > 0 {
+		seenSince = time.Now().Add(-req.seenWithin)
+	}
+	n, _ := b.networkAddresses(nw, currentClients, seenSince)
+	return ippool.SuggestFreeAddresses(n, req.count, req.opts)
+}
+
+// RunSuggest is the entrypoint of the "suggest" mode of the backend binary: it reads the addon options,
+// the DHCP leases and the tracker DB, exactly like the web UI backend does, and prints one per line the
+// free IP addresses of the network of the given DHCP range. It returns the process exit code.
+func RunSuggest(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("suggest", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	count := flags.Int("count", defaultSuggestCount, "number of IP addresses to suggest")
+	exclude := flags.String("exclude", "", "comma-separated IP addresses, start-end ranges or subnets to leave out, e.g. .1-.20,.250")
+	preferOutsidePool := flags.Bool("prefer-outside-pool", false, "suggest first the IP addresses outside the DHCP ranges")
+	seenWithin := flags.Duration("seen-within", 0, "avoid only the IP addresses of past DHCP clients seen within this time (default all)")
+	flags.Usage = func() {
+		_, _ = fmt.Fprintf(stderr, "usage: backend suggest [flags] POOL_INDEX\nPOOL_INDEX is the index of the DHCP range in the dhcp_pools option\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	b, closeDB, err := newOfflineUIBackend("suggest")
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err.Error())
+		return 2
+	}
+	defer closeDB()
+
+	idx, err := strconv.Atoi(flags.Arg(0))
+	if err != nil || idx < 0 || idx >= len(b.opts().dhcpRanges) {
+		_, _ = fmt.Fprintf(stderr, "invalid POOL_INDEX %q: expecting an index between 0 and %d\n", flags.Arg(0), len(b.opts().dhcpRanges)-1)
+		return 2
+	}
+	nw := b.opts().dhcpRanges[idx]
+	req, err := parseSuggestRequest(nw, strconv.Itoa(*count), []string{*exclude}, *preferOutsidePool, "")
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err.Error())
+		return 2
+	}
+	req.seenWithin = *seenWithin
+
+	ips := b.suggestFreeAddresses(nw, b.getCurrentClients(), req)
+	if len(ips) == 0 {
+		_, _ = fmt.Fprintf(stderr, "no free IP address found in the network %s\n", nw.Network)
+		return 1
+	}
+	for _, ip := range ips {
+		_, _ = fmt.Fprintln(stdout, ip.String())
+	}
+	return 0
+}
@@ -1,14 +1,14 @@
 package uibackend
 
 import (
+	"dnsmasq-dhcp-backend/pkg/leasewatcher"
+	"dnsmasq-dhcp-backend/pkg/roguedhcp"
 	"dnsmasq-dhcp-backend/pkg/trackerdb"
 	"encoding/json"
 	htmltemplate "html/template"
 	"net"
 	"net/netip"
 	texttemplate "text/template"
-
-	"github.com/b0ch3nski/go-dnsmasq-utils/dnsmasq"
 )
 
 // DhcpClientFriendlyName is the 1:1 binding between a MAC address and a human-friendly name
@@ -19,19 +19,28 @@ type DhcpClientFriendlyName struct {
 }
 
 // IpAddressReservation represents a static IP configuration loaded from the addon configuration file
+// or created from the web UI
 type IpAddressReservation struct {
 	Name string
 	Mac  net.HardwareAddr
 	IP   netip.Addr
 	Link *texttemplate.Template // maybe nil
+
+	// Runtime is true for the reservations created from the web UI, which are stored in the
+	// dnsmasq hostsfile rather than in the addon options
+	Runtime bool
 }
 
 // DhcpClientData holds all the information the backend has about a particular DHCP client,
 // currently "connected" to the dnsmasq server.
 // In this context "connected" means: that sent DHCP traffic since the dnsmasq server was started.
 type DhcpClientData struct {
-	// the lease as it is parsed from dnsmasq LEASE file:
-	Lease dnsmasq.Lease
+	// the lease as it is parsed from dnsmasq LEASE file: this is the DHCPv4 lease for dual-stack
+	// clients and the first DHCPv6 lease for IPv6-only clients
+	Lease leasewatcher.Lease
+
+	// IPv6Leases are the other DHCPv6 leases of the same client, grouped by MAC address or DUID
+	IPv6Leases []leasewatcher.Lease
 
 	// metadata associated with the DHCP client (obtained from configuration):
 
@@ -55,46 +64,105 @@ type DhcpClientData struct {
 	// produce a string which is intended to be an URL/URI to show for each DHCP client in the web UI.
 	// If such link template is available in config, this field gets populated.
 	EvaluatedLink string
+
+	// Vendor is the manufacturer of the network card, as found in the OUI registry; empty if unknown
+	Vendor string
+
+	// IsRandomizedMac indicates whether the DHCP client uses a locally-administered MAC address,
+	// typically a "private" address picked at random by phones and laptops
+	IsRandomizedMac bool
+
+	// UserNote is the free-text note edited from the web UI, if any
+	UserNote string
+
+	// HasRuntimeReservation indicates whether an IP address reservation was created from the web UI
+	// for the MAC address of this client; the reserved IP might differ from the leased one until
+	// the client renews its lease
+	HasRuntimeReservation bool
 }
 
 // MarshalJSON customizes the JSON serialization for DhcpClientData
 func (d DhcpClientData) MarshalJSON() ([]byte, error) {
+	type ipv6Lease struct {
+		Expires int64  `json:"expires"`
+		IPAddr  string `json:"ip_addr"`
+		IAID    uint32 `json:"iaid"`
+	}
+	ipv6Leases := make([]ipv6Lease, 0, len(d.IPv6Leases))
+	for _, l := range d.IPv6Leases {
+		ipv6Leases = append(ipv6Leases, ipv6Lease{Expires: l.Expires.Unix(), IPAddr: l.IPAddr.String(), IAID: l.IAID})
+	}
+	leaseDUID := ""
+	if d.Lease.DUID != nil {
+		leaseDUID = d.Lease.DUID.String()
+	}
+
 	return json.Marshal(&struct {
 		Lease struct {
 			Expires  int64  `json:"expires"`
 			MacAddr  string `json:"mac_addr"`
 			IPAddr   string `json:"ip_addr"`
 			Hostname string `json:"hostname"`
+			DUID     string `json:"duid"`
+			IAID     uint32 `json:"iaid"`
 		} `json:"lease"`
-		HasStaticIP      bool   `json:"has_static_ip"`
-		IsInsideDHCPPool bool   `json:"is_inside_dhcp_pool"`
-		FriendlyName     string `json:"friendly_name"`
-		EvaluatedLink    string `json:"evaluated_link"`
+		IPv6Leases       []ipv6Lease `json:"ipv6_leases"`
+		HasStaticIP      bool        `json:"has_static_ip"`
+		IsInsideDHCPPool bool        `json:"is_inside_dhcp_pool"`
+		FriendlyName     string      `json:"friendly_name"`
+		EvaluatedLink    string      `json:"evaluated_link"`
+		Vendor           string      `json:"vendor"`
+		IsRandomizedMac  bool        `json:"is_randomized_mac"`
+		UserNote         string      `json:"user_note"`
+
+		HasRuntimeReservation bool `json:"has_runtime_reservation"`
 	}{
 		Lease: struct {
 			Expires  int64  `json:"expires"`
 			MacAddr  string `json:"mac_addr"`
 			IPAddr   string `json:"ip_addr"`
 			Hostname string `json:"hostname"`
+			DUID     string `json:"duid"`
+			IAID     uint32 `json:"iaid"`
 		}{
 			Expires:  d.Lease.Expires.Unix(), // unix time, the number of seconds elapsed since January 1, 1970 UTC
 			MacAddr:  d.Lease.MacAddr.String(),
 			IPAddr:   d.Lease.IPAddr.String(),
 			Hostname: d.Lease.Hostname,
+			DUID:     leaseDUID,
+			IAID:     d.Lease.IAID,
 		},
+		IPv6Leases:       ipv6Leases,
 		HasStaticIP:      d.HasStaticIP,
 		IsInsideDHCPPool: d.IsInsideDHCPPool,
 		FriendlyName:     d.FriendlyName,
 		EvaluatedLink:    d.EvaluatedLink,
+		Vendor:           d.Vendor,
+		IsRandomizedMac:  d.IsRandomizedMac,
+		UserNote:         d.UserNote,
+
+		HasRuntimeReservation: d.HasRuntimeReservation,
 	})
 }
 
+// IPAddrs returns all the IP addresses leased to the DHCP client
+func (d DhcpClientData) IPAddrs() []netip.Addr {
+	ips := []netip.Addr{d.Lease.IPAddr}
+	for _, l := range d.IPv6Leases {
+		ips = append(ips, l.IPAddr)
+	}
+	return ips
+}
+
 // PastDhcpClientData identifies a DHCP client that was connected in the past, but not anymore
 type PastDhcpClientData struct {
-	PastInfo     trackerdb.DhcpClient `json:"past_info"`
-	HasStaticIP  bool                 `json:"has_static_ip"`
-	FriendlyName string               `json:"friendly_name"`
-	Notes        string               `json:"notes"`
+	PastInfo        trackerdb.DhcpClient `json:"past_info"`
+	HasStaticIP     bool                 `json:"has_static_ip"`
+	FriendlyName    string               `json:"friendly_name"`
+	Notes           string               `json:"notes"`
+	Vendor          string               `json:"vendor"`
+	IsRandomizedMac bool                 `json:"is_randomized_mac"`
+	UserNote        string               `json:"user_note"`
 }
 
 type DnsUpstreamStats struct {
@@ -134,6 +202,73 @@ type WebSocketMessage struct {
 
 	// DnsStats provides a live feed about DNS server basic metrics.
 	DnsStats DnsServerStats `json:"dns_stats"`
+
+	// DhcpRangesUtilization provides the usage of each DHCP range, in the same order of the
+	// "dhcp_pools" addon option.
+	DhcpRangesUtilization []DhcpRangeUtilization `json:"dhcp_ranges_utilization"`
+
+	// DhcpRangesAlerts tells which DHCP ranges are running out of free IP addresses, in the same order
+	// of the "dhcp_pools" addon option.
+	DhcpRangesAlerts []DhcpRangeAlert `json:"dhcp_ranges_alerts"`
+
+	// RogueDhcpServers lists the DHCP servers, other than this addon, answering on the DHCP networks.
+	// It's always empty when the rogue DHCP server detection is disabled.
+	RogueDhcpServers []roguedhcp.RogueServer `json:"rogue_dhcp_servers"`
+}
+
+// DhcpRangeUtilization describes how many IP addresses of a DHCP range are currently in use.
+// The pair (Interface, Start-End) identifies the DHCP range.
+type DhcpRangeUtilization struct {
+	Interface string `json:"interface"`
+	Start     string `json:"start"`
+	End       string `json:"end"`
+
+	// Size is the number of IP addresses in the range, or -1 if too large to be represented
+	Size int64 `json:"size"`
+
+	// Used is the number of IP addresses in the range currently leased to a DHCP client
+	Used int64 `json:"used"`
+
+	// Reserved is the number of IP addresses in the range having an IP address reservation
+	Reserved int64 `json:"reserved"`
+
+	// Free is the number of IP addresses in the range neither leased nor reserved, or -1 if Size is -1
+	Free int64 `json:"free"`
+
+	// UsagePercent is the percentage of leased or reserved IP addresses of the range
+	UsagePercent float64 `json:"usage_percent"`
+}
+
+// DhcpRangeAlertLevel tells how close a DHCP range is to run out of free IP addresses
+type DhcpRangeAlertLevel string
+
+const (
+	DhcpRangeAlertOK       DhcpRangeAlertLevel = "ok"
+	DhcpRangeAlertWarning  DhcpRangeAlertLevel = "warning"
+	DhcpRangeAlertCritical DhcpRangeAlertLevel = "critical"
+)
+
+// DhcpRangeAlert tells whether a DHCP range is running out of free IP addresses, based on its current
+// usage and on the trend of its usage. The pair (Interface, Start-End) identifies the DHCP range.
+type DhcpRangeAlert struct {
+	Interface string `json:"interface"`
+	Start     string `json:"start"`
+	End       string `json:"end"`
+
+	Level DhcpRangeAlertLevel `json:"level"`
+
+	// Reasons explains why the Level is not DhcpRangeAlertOK
+	Reasons []string `json:"reasons"`
+
+	// UsagePercent is the percentage of leased or reserved IP addresses of the range
+	UsagePercent float64 `json:"usage_percent"`
+
+	// TrendPerHour is the growth per hour of the leased or reserved IP addresses over the trend window
+	TrendPerHour float64 `json:"trend_per_hour"`
+
+	// TimeToExhaustionSec is the number of seconds before the range is forecast to run out of free
+	// IP addresses, or -1 if the range is not running out of them
+	TimeToExhaustionSec int64 `json:"time_to_exhaustion_sec"`
 }
 
 // HtmlTemplateIpRange is used inside HtmlTemplate
@@ -163,6 +298,9 @@ type HtmlTemplate struct {
 	DnsEnabled string
 	DnsDomain  string
 
+	// issues found in the addon options
+	ConfigFindings []ConfigFinding
+
 	// embedded contents
 	CssFileContent        htmltemplate.CSS
 	JavascriptFileContent htmltemplate.JS
@@ -4,7 +4,14 @@ import (
 	"bytes"
 	"cmp"
 	"context"
+	"dnsmasq-dhcp-backend/pkg/dnsmasqctl"
+	"dnsmasq-dhcp-backend/pkg/ippool"
+	"dnsmasq-dhcp-backend/pkg/leasewatcher"
 	"dnsmasq-dhcp-backend/pkg/logger"
+	"dnsmasq-dhcp-backend/pkg/mqttpublisher"
+	"dnsmasq-dhcp-backend/pkg/notifier"
+	"dnsmasq-dhcp-backend/pkg/oui"
+	"dnsmasq-dhcp-backend/pkg/roguedhcp"
 	"dnsmasq-dhcp-backend/pkg/trackerdb"
 	"encoding/json"
 	"errors"
@@ -20,12 +27,12 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	texttemplate "text/template"
 	"time"
 
 	human_duration "github.com/davidbanham/human_duration/v3"
 
-	"github.com/b0ch3nski/go-dnsmasq-utils/dnsmasq"
 	"github.com/gorilla/websocket"
 	"gopkg.in/yaml.v3"
 )
@@ -33,10 +40,40 @@ import (
 type UIBackend struct {
 	logger *logger.CustomLogger
 
-	// The configuration for this backend
-	options AddonOptions
+	// The configuration for this backend; the addon options are replaced as a whole when
+	// they get reloaded, see reloadAddonOptions()
+	options atomic.Pointer[AddonOptions]
 	config  AddonConfig
 
+	// the addon options as read at startup, i.e. the ones dnsmasq is running with
+	startupOptions     *AddonOptions
+	startupOptionsData []byte
+
+	// issues found in the addon options and changes to the addon options since startup,
+	// both shown in the web UI
+	configFindings []ConfigFinding
+	optionsChanges OptionsChanges
+
+	// IP address reservations created from the web UI, indexed by MAC address; they are
+	// merged into the addon options, see withRuntimeReservations()
+	runtimeReservations map[string]IpAddressReservation
+
+	optionsLock sync.Mutex // protects the 3 fields above and serializes the changes to the options
+
+	// channel used to request a reload of the addon options
+	reloadOptionsCh chan struct{}
+
+	// friendly names, notes and links edited from the web UI, indexed by MAC address
+	clientMetadata     map[string]clientMetadata
+	clientMetadataLock sync.Mutex
+
+	// channel used to request the current DHCP clients to be processed again, e.g. after
+	// their metadata has been edited
+	refreshClientsCh chan struct{}
+
+	// sends commands to the running dnsmasq instance, e.g. to apply the runtime reservations
+	dnsmasqCtl dnsmasqctl.Controller
+
 	// time this application was started
 	startTimestamp time.Time
 	startEpoch     int
@@ -53,18 +90,55 @@ type UIBackend struct {
 	clients     map[*websocket.Conn]bool
 	clientsLock sync.Mutex
 
+	// set by closeWebSockets: no more websockets are accepted afterwards; protected by clientsLock
+	websocketsClosed bool
+
 	// the most updated view on DHCP clients currently available
 	dhcpClientData     []DhcpClientData
 	dhcpClientDataLock sync.Mutex
 
+	// time of the last update of dhcpClientData
+	dhcpClientDataTimestamp time.Time
+
 	// DB tracking all DHCP clients, used to provide the "past DHCP clients" feature
 	trackerDB trackerdb.DhcpClientTrackerDB
 
+	// detector of other DHCP servers on the same networks; nil when disabled
+	rogueDhcpDetector *roguedhcp.Detector
+
+	// publisher of DHCP clients and statistics to Home Assistant over MQTT; nil when disabled
+	mqttPublisher *mqttpublisher.Publisher
+
+	// destinations of the notifications about DHCP events
+	notifiers []notifier.Notifier
+
+	// DHCP ranges without free IP addresses, indexed by start-end; used to notify only
+	// when a DHCP range becomes exhausted
+	exhaustedDhcpRanges map[string]bool
+
+	// usage history and latest alert of each DHCP range, indexed by start-end
+	dhcpRangesHistory    map[string]*ippool.UsageHistory
+	dhcpRangesAlerts     map[string]DhcpRangeAlert
+	dhcpRangesAlertsLock sync.Mutex // protects the 2 fields above
+
 	// channel used to broadcast tabular data from backend->frontend
 	broadcastCh chan struct{}
 
+	// channel used to trigger an immediate MQTT update when the DHCP clients change
+	mqttUpdateCh chan struct{}
+
 	// channel used to link a goroutine watching for DHCP lease file changes and the DHCP lease file processor
-	leasesCh chan []*dnsmasq.Lease
+	leasesCh chan []*leasewatcher.Lease
+
+	// supervisor of the watch on the DHCP lease file; nil until ListenAndServe is called
+	leaseWatcher *leasewatcher.Watcher
+
+	// listener used by ListenAndServe; when nil, ListenAndServe listens on the web UI port (hook for unit tests)
+	listener net.Listener
+
+	// tracks all goroutines started by ListenAndServe, including the WebSocket handlers, so that
+	// the tracker DB is closed only once all of them are done
+	goroutines sync.WaitGroup
 }
 
 // ReadFileAndParseInteger reads a file, parses the number, and returns it as an integer
@@ -87,11 +161,12 @@ func ReadFileAndParseInteger(filename string) (int, error) {
 	return num, nil
 }
 
-func NewUIBackend(logger *logger.CustomLogger) UIBackend {
+// NewUIBackend opens the tracker DB and creates the UIBackend; it returns nil in case of errors
+func NewUIBackend(logger *logger.CustomLogger) *UIBackend {
 	db, err := trackerdb.NewDhcpClientTrackerDB(defaultDhcpClientTrackerDB)
 	if err != nil {
 		logger.Fatalf("Failed to open DHCP clients tracking DB: %s", err.Error())
-		return UIBackend{}
+		return nil
 	}
 
 	logger.Infof("Successfully opened DHCP clients tracking DB at %s", defaultDhcpClientTrackerDB)
@@ -102,25 +177,32 @@ func NewUIBackend(logger *logger.CustomLogger) UIBackend {
 	startEpoch, err = ReadFileAndParseInteger(defaultStartEpoch)
 	if err != nil {
 		logger.Fatalf("Failed to open start Epoch file: %s", err.Error())
-		return UIBackend{}
+		return nil
 	}
 
 	logger.Infof("The current DHCP start Epoch is at %d", startEpoch)
 
-	return UIBackend{
-		logger: logger,
-		options: AddonOptions{
-			ipAddressReservationsByIP:  make(map[netip.Addr]IpAddressReservation),
-			ipAddressReservationsByMAC: make(map[string]IpAddressReservation),
-			friendlyNames:              make(map[string]DhcpClientFriendlyName),
-		},
-		startTimestamp: time.Now(),
-		startEpoch:     startEpoch,
-		clients:        make(map[*websocket.Conn]bool),
-		dhcpClientData: nil,
-		trackerDB:      *db,
-		broadcastCh:    make(chan struct{}),
-		leasesCh:       make(chan []*dnsmasq.Lease),
+	b := newUIBackend(logger, *db, startEpoch)
+	b.isTestingMode = isTestingMode
+	return b
+}
+
+// newUIBackend creates a UIBackend using the given tracker DB; the addon options are read later,
+// by ListenAndServe
+func newUIBackend(logger *logger.CustomLogger, db trackerdb.DhcpClientTrackerDB, startEpoch int) *UIBackend {
+	b := &UIBackend{
+		logger:           logger,
+		startTimestamp:   time.Now(),
+		startEpoch:       startEpoch,
+		clients:          make(map[*websocket.Conn]bool),
+		dhcpClientData:   nil,
+		trackerDB:        db,
+		broadcastCh:      make(chan struct{}),
+		mqttUpdateCh:     make(chan struct{}, 1),
+		leasesCh:         make(chan []*leasewatcher.Lease),
+		reloadOptionsCh:  make(chan struct{}, 1),
+		refreshClientsCh: make(chan struct{}, 1),
+		dnsmasqCtl:       dnsmasqctl.NewPidFileController(defaultDnsmasqPidFile, defaultDnsmasqReloadEpochFile),
 		upgrader: websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool {
 				return true
@@ -131,14 +213,20 @@ func NewUIBackend(logger *logger.CustomLogger) UIBackend {
 			Handler:           nil,
 			ReadHeaderTimeout: 3 * time.Second,
 		},
-		isTestingMode: isTestingMode,
 	}
+	b.options.Store(newAddonOptions())
+	return b
+}
+
+// opts returns the addon options currently in use
+func (b *UIBackend) opts() *AddonOptions {
+	return b.options.Load()
 }
 
 func (b *UIBackend) logRequestMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// this logging is quite verbose, enable only if explicitly asked so
-		if b.options.logWebUI {
+		if b.opts().logWebUI {
 			// print headers
 			var headerStr string
 			for name, values := range r.Header {
@@ -158,7 +246,8 @@ func (b *UIBackend) logRequestMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-func (b *UIBackend) generateWebSocketMessage() WebSocketMessage {
+// getCurrentClients returns a copy of the most updated list of current DHCP clients, sorted by IP
+func (b *UIBackend) getCurrentClients() []DhcpClientData {
 	// get a copy of latest status -- lock it during the copy, to avoid race conditions
 	// with the dnsmasq.leases watcher goroutine:
 	b.dhcpClientDataLock.Lock()
@@ -171,28 +260,25 @@ func (b *UIBackend) generateWebSocketMessage() WebSocketMessage {
 		return a.Lease.IPAddr.Compare(b.Lease.IPAddr)
 	})
 
+	return currentClients
+}
+
+// getPastClients queries the tracker DB for all DHCP clients that are not part of the
+// given list of current clients and enriches them with metadata from the configuration
+func (b *UIBackend) getPastClients(currentClients []DhcpClientData) []PastDhcpClientData {
 	// convert currentClients to a simple slice of MAC addresses
 	currentClientsMacs := make([]net.HardwareAddr, 0, len(currentClients))
 	for _, c := range currentClients {
 		currentClientsMacs = append(currentClientsMacs, c.Lease.MacAddr)
 	}
 
-	// if the dnsmasq-provided hostname is an asterisk *, that indicates that the DHCP client
-	// did not advertise his own hostname to the DHCP server.
-	// Make this more clear:
-	for _, c := range currentClients {
-		if c.Lease.Hostname == dnsmasqMarkerForMissingHostname {
-			c.Lease.Hostname = unknownHostnameHtmlString
-		}
-	}
-
 	// now get from the tracker DB some historical data about "dead DHCP clients"
 	deadClients, err := b.trackerDB.GetDeadDhcpClients(currentClientsMacs)
 	if err != nil {
 		b.logger.Warnf("failed to get list of dead/past DHCP clients: %s", err.Error())
 		// keep going with an empty list
 		deadClients = []trackerdb.DhcpClient{}
-	} else if b.options.logWebUI {
+	} else if b.opts().logWebUI {
 		b.logger.Infof("Running query to the tracker DB: found %d past/dead DHCP clients", len(deadClients))
 	}
 
@@ -204,16 +290,23 @@ func (b *UIBackend) generateWebSocketMessage() WebSocketMessage {
 		// fill additional metadata
 		pastClients[i].HasStaticIP = b.hasIpAddressReservationByMAC(deadC.MacAddr)
 		pastClients[i].FriendlyName = b.getFriendlyNameFor(deadC.MacAddr, deadC.Hostname)
-		if pastClients[i].FriendlyName == deadC.Hostname {
-			// look also in the IP address reservations "friendly names"
-			if pastClients[i].HasStaticIP {
-				pastClients[i].FriendlyName = b.options.ipAddressReservationsByMAC[deadC.MacAddr.String()].Name
+		if stored, ok := b.getClientMetadata(deadC.MacAddr); ok {
+			pastClients[i].UserNote = stored.Note
+		}
+		if _, hasFriendlyName := b.opts().friendlyNames[deadC.MacAddr.String()]; !hasFriendlyName {
+			// look also in the IP address reservations "friendly names", which take precedence
+			// over the friendly names edited from the web UI
+			// (the reservations created from the web UI might have no name)
+			if r := b.opts().ipAddressReservationsByMAC[deadC.MacAddr.String()]; pastClients[i].HasStaticIP && r.Name != "" {
+				pastClients[i].FriendlyName = r.Name
 			}
 		}
 
 		if pastClients[i].FriendlyName == "" {
 			pastClients[i].FriendlyName = "N/A"
 		}
+		pastClients[i].Vendor = oui.Lookup(deadC.MacAddr)
+		pastClients[i].IsRandomizedMac = oui.IsRandomized(deadC.MacAddr)
 		if pastClients[i].PastInfo.Hostname == "" {
 			pastClients[i].PastInfo.Hostname = unknownHostnameHtmlString
 		}
@@ -239,9 +332,64 @@ func (b *UIBackend) generateWebSocketMessage() WebSocketMessage {
 		return cmp.Compare(a.PastInfo.LastSeen.Unix(), b.PastInfo.LastSeen.Unix())
 	})
 
+	return pastClients
+}
+
+// getLeasedAndReservedIPs returns the IP addresses leased to the given DHCP clients and the reserved ones
+func (b *UIBackend) getLeasedAndReservedIPs(currentClients []DhcpClientData) (leased, reserved []netip.Addr) {
+	leased = make([]netip.Addr, 0, len(currentClients))
+	for _, c := range currentClients {
+		leased = append(leased, c.IPAddrs()...)
+	}
+	reserved = make([]netip.Addr, 0, len(b.opts().ipAddressReservationsByIP))
+	for ip := range b.opts().ipAddressReservationsByIP {
+		reserved = append(reserved, ip)
+	}
+	return leased, reserved
+}
+
+// getDhcpRangesUtilization computes the usage of each configured DHCP range given the list of current clients
+func (b *UIBackend) getDhcpRangesUtilization(currentClients []DhcpClientData) []DhcpRangeUtilization {
+	leased, reserved := b.getLeasedAndReservedIPs(currentClients)
+	ret := make([]DhcpRangeUtilization, 0, len(b.opts().dhcpRanges))
+	for _, n := range b.opts().dhcpRanges {
+		usage := n.Range().Usage(leased, reserved)
+		ret = append(ret, DhcpRangeUtilization{
+			Interface:    n.Interface,
+			Start:        n.Start.String(),
+			End:          n.End.String(),
+			Size:         usage.Size,
+			Used:         usage.Used,
+			Reserved:     usage.Reserved,
+			Free:         usage.Free,
+			UsagePercent: usage.UsagePercent(),
+		})
+	}
+	return ret
+}
+
+// getLocalDnsStats queries the dnsmasq instance running alongside this backend for its DNS stats
+func (b *UIBackend) getLocalDnsStats() (DnsServerStats, error) {
 	// this code is meant to be executed on the same machine/container where dnsmasq is running, so
 	// that's why we pass "localhost" as DNS server host:
-	dnsStats, err := getDnsStats("localhost", b.options.dnsPort)
+	return getDnsStats("localhost", b.opts().dnsPort)
+}
+
+func (b *UIBackend) generateWebSocketMessage() WebSocketMessage {
+	currentClients := b.getCurrentClients()
+
+	// if the dnsmasq-provided hostname is an asterisk *, that indicates that the DHCP client
+	// did not advertise his own hostname to the DHCP server.
+	// Make this more clear:
+	for _, c := range currentClients {
+		if c.Lease.Hostname == dnsmasqMarkerForMissingHostname {
+			c.Lease.Hostname = unknownHostnameHtmlString
+		}
+	}
+
+	pastClients := b.getPastClients(currentClients)
+
+	dnsStats, err := b.getLocalDnsStats()
 	if err != nil {
 		b.logger.Warnf("failed to get updated DNS stats: %s", err.Error())
 		// keep going
@@ -249,17 +397,33 @@ func (b *UIBackend) generateWebSocketMessage() WebSocketMessage {
 
 	// finally build the websocket message
 	return WebSocketMessage{
-		CurrentClients: currentClients,
-		PastClients:    pastClients,
-		DnsStats:       dnsStats,
+		CurrentClients:        currentClients,
+		PastClients:           pastClients,
+		DnsStats:              dnsStats,
+		DhcpRangesUtilization: b.getDhcpRangesUtilization(currentClients),
+		DhcpRangesAlerts:      b.getDhcpRangesAlerts(),
+		RogueDhcpServers:      b.getRogueDhcpServers(),
 	}
 }
 
 // WebSocket connection handler
 func (b *UIBackend) handleWebSocketConn(w http.ResponseWriter, r *http.Request) {
+	// hijacked connections are not tracked by http.Server.Shutdown: track them in the goroutines
+	// WaitGroup, unless the shutdown has already started
+	b.clientsLock.Lock()
+	if b.websocketsClosed {
+		b.clientsLock.Unlock()
+		http.Error(w, "server shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	b.goroutines.Add(1)
+	b.clientsLock.Unlock()
+	defer b.goroutines.Done()
+
 	ws, err := b.upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		b.logger.Fatalf("Failed to upgrade websocket connection: %s", err)
+		b.logger.Warnf("Failed to upgrade websocket connection: %s", err)
+		return
 	}
 	defer func() {
 		_ = ws.Close()
@@ -271,6 +435,13 @@ func (b *UIBackend) handleWebSocketConn(w http.ResponseWriter, r *http.Request)
 
 	// register new client
 	b.clientsLock.Lock()
+	if b.websocketsClosed {
+		// closeWebSockets ran during the upgrade: it could not close this connection
+		b.clientsLock.Unlock()
+		closeMsg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+		_ = ws.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(time.Second))
+		return
+	}
 	b.clients[ws] = true
 	if err := ws.WriteJSON(msg); err != nil { // push the current status on the websocket
 		b.logger.Warnf("failed to push initial data to the new websocket: %s", err.Error())
@@ -294,19 +465,36 @@ func (b *UIBackend) handleWebSocketConn(w http.ResponseWriter, r *http.Request)
 	}
 }
 
-// Broadcast updater: any update posted on the broadcastCh is broadcasted to all clients
-func (b *UIBackend) broadcastUpdatesToClients() {
-	var tickerCh <-chan time.Time
-	if b.options.webUIRefreshInterval > 0 {
-		ticker := time.NewTicker(b.options.webUIRefreshInterval)
-		tickerCh = ticker.C
-	} else {
-		// refresh is disabled, create a channel that will never get a message
-		tickerCh = make(<-chan time.Time)
-	}
+// Broadcast updater: any update posted on the broadcastCh is broadcasted to all clients, until
+// the context is cancelled
+func (b *UIBackend) broadcastUpdatesToClients(ctx context.Context) {
+	var ticker *time.Ticker
+	var tickerCh <-chan time.Time // when refresh is disabled this is nil, so it never gets a message
+	var tickerInterval time.Duration
+	defer func() {
+		if ticker != nil {
+			ticker.Stop()
+		}
+	}()
 
 	for {
+		// the refresh interval might have changed after a reload of the addon options
+		if interval := b.opts().webUIRefreshInterval; interval != tickerInterval {
+			if ticker != nil {
+				ticker.Stop()
+				ticker, tickerCh = nil, nil
+			}
+			if interval > 0 {
+				ticker = time.NewTicker(interval)
+				tickerCh = ticker.C
+			}
+			tickerInterval = interval
+		}
+
 		select {
+		case <-ctx.Done():
+			return
+
 		case <-b.broadcastCh:
 			// if we get a message from this channel, it means the global list of
 			// current DHCP clients has changed
@@ -320,7 +508,11 @@ func (b *UIBackend) broadcastUpdatesToClients() {
 			//    considered "stale" and get reset)
 		}
 
-		if len(b.clients) > 0 {
+		b.clientsLock.Lock()
+		numClients := len(b.clients)
+		b.clientsLock.Unlock()
+
+		if numClients > 0 {
 			// regen message
 			msg := b.generateWebSocketMessage()
 
@@ -335,7 +527,7 @@ func (b *UIBackend) broadcastUpdatesToClients() {
 					delete(b.clients, client)
 				} else {
 					numSuccess++
-					if b.options.logWebUI {
+					if b.opts().logWebUI {
 						_, err := json.Marshal(msg)
 						if err != nil {
 							b.logger.Infof("Failed to marshal to JSON: %s.\nMessage:%v\n", err.Error(), msg)
@@ -347,7 +539,7 @@ func (b *UIBackend) broadcastUpdatesToClients() {
 			}
 			b.clientsLock.Unlock()
 
-			if b.options.logWebUI {
+			if b.opts().logWebUI {
 				b.logger.Infof("Successfully pushed %d/%d current/past DHCP clients to %d websockets",
 					len(msg.CurrentClients), len(msg.PastClients), numSuccess)
 			}
@@ -356,6 +548,23 @@ func (b *UIBackend) broadcastUpdatesToClients() {
 	}
 }
 
+// closeWebSockets sends a close frame to all WebSocket clients and closes their connections;
+// new WebSocket connections are refused afterwards
+func (b *UIBackend) closeWebSockets() {
+	b.clientsLock.Lock()
+	defer b.clientsLock.Unlock()
+	b.websocketsClosed = true
+
+	closeMsg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	for client := range b.clients {
+		if err := client.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(time.Second)); err != nil {
+			b.logger.Warnf("failed to send close frame to WebSocket: %s", err.Error())
+		}
+		_ = client.Close()
+		delete(b.clients, client)
+	}
+}
+
 // Reload the templates. Typically this happens only once at startup, but when testing
 // env var is set, it happens on every page load.
 func (b *UIBackend) reloadTemplates() {
@@ -394,9 +603,11 @@ func (b *UIBackend) renderPage(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	opts := b.opts()
+
 	// DNS
 	dnsEnableString := "disabled"
-	if b.options.dnsEnable {
+	if opts.dnsEnable {
 		dnsEnableString = "enabled"
 	}
 
@@ -407,19 +618,21 @@ func (b *UIBackend) renderPage(w http.ResponseWriter, r *http.Request) {
 		// Based on the scheme used by the browser, the websocket will use the associated scheme
 		// ('wss' for 'https' and 'ws' for 'http)
 		WebSocketURI:            XIngressPath[0] + websocketRelativeUrl,
-		DhcpRanges:              IpPoolToHtmlTemplateRanges(b.options.dhcpRanges),
-		DhcpPoolSize:            b.options.dhcpPool.Size(),
-		DefaultLease:            b.options.defaultLease,
-		AddressReservationLease: b.options.addressReservationLease,
+		DhcpRanges:              IpPoolToHtmlTemplateRanges(opts.dhcpRanges),
+		DhcpPoolSize:            opts.dhcpPool.Size(),
+		DefaultLease:            opts.defaultLease,
+		AddressReservationLease: opts.addressReservationLease,
 		// we approximate the DHCP server start time with this app's start time;
 		// the reason is that inside the HA addon, dnsmasq is started at about the same
 		// time of this app
 		DHCPServerStartTime:        b.startTimestamp.Unix(),
-		DHCPForgetPastClientsAfter: human_duration.ShortString(b.options.forgetPastClientsAfter, human_duration.Minute),
+		DHCPForgetPastClientsAfter: human_duration.ShortString(opts.forgetPastClientsAfter, human_duration.Minute),
 
 		// DNS config info
 		DnsEnabled: dnsEnableString,
-		DnsDomain:  b.options.dnsDomain,
+		DnsDomain:  opts.dnsDomain,
+
+		ConfigFindings: b.getConfigFindings(),
 
 		// misc
 		AddonVersion: b.config.Version,
@@ -429,32 +642,60 @@ func (b *UIBackend) renderPage(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		b.logger.Warnf("error while rendering template: %s\n", err.Error())
 		// keep going
-	} else if b.options.logWebUI {
+	} else if b.opts().logWebUI {
 		b.logger.Infof("Successfully rendered web page template, responding with 200 OK\n")
 	}
 }
 
-// Read from the leasesCh and push to broadcastCh
-func (b *UIBackend) processLeaseUpdates() {
+// Read from the leasesCh and push to broadcastCh, until the context is cancelled.
+// Reloads of the addon options are performed here as well, since they require the
+// current DHCP clients to be processed again.
+func (b *UIBackend) processLeaseUpdates(ctx context.Context) {
 	i := 0
 	for {
-		updatedLeases := <-b.leasesCh
-		b.logger.Infof("INotify detected a change (#%d) to the DHCP client lease file... list size before=%d, after=%d clients\n",
-			i, len(b.dhcpClientData), len(updatedLeases))
+		var updatedLeases []*leasewatcher.Lease
+		select {
+		case <-ctx.Done():
+			return
+
+		case updatedLeases = <-b.leasesCh:
+			b.logger.Infof("Detected a change (#%d) to the DHCP client lease file... list size before=%d, after=%d clients\n",
+				i, len(b.dhcpClientData), len(updatedLeases))
+			i += 1
+
+		case <-b.reloadOptionsCh:
+			if _, err := b.reloadAddonOptions(); err != nil {
+				b.logger.Warnf("failed to reload the addon options: %s", err.Error())
+				continue
+			}
+			// friendly names and links might have changed
+			updatedLeases = b.getCurrentLeases()
+
+		case <-b.refreshClientsCh:
+			updatedLeases = b.getCurrentLeases()
+		}
+
 		b.processLeaseUpdatesFromArray(updatedLeases)
 
 		// once the new list of DHCP client data entries is ready, notify the broadcast channel
-		b.broadcastCh <- struct{}{}
-		i += 1
+		select {
+		case <-ctx.Done():
+			return
+		case b.broadcastCh <- struct{}{}:
+		}
+		b.triggerMqttUpdate()
 	}
 }
 
 func (b *UIBackend) getFriendlyNameFor(mac net.HardwareAddr, hostname string) string {
 	// do we have a friendly-name registered for this MAC address?
-	metadata, ok := b.options.friendlyNames[mac.String()]
+	metadata, ok := b.opts().friendlyNames[mac.String()]
 	if ok {
 		// yes: enrich with some metadata this DHCP client entry
 		return metadata.FriendlyName
+	} else if stored, ok := b.getClientMetadata(mac); ok && stored.FriendlyName != "" {
+		// the user provided a friendly name from the web UI
+		return stored.FriendlyName
 	} else if hostname != dnsmasqMarkerForMissingHostname {
 		// no: user didn't provide any friendly name but the dnsmasq DHCP server
 		// has received (over DHCP protocol) an hostname... better than nothing:
@@ -465,46 +706,62 @@ func (b *UIBackend) getFriendlyNameFor(mac net.HardwareAddr, hostname string) st
 }
 
 func (b *UIBackend) hasIpAddressReservationByIP(ip netip.Addr, macExpected net.HardwareAddr) bool {
-	_, hasReservation := b.options.ipAddressReservationsByIP[ip]
+	_, hasReservation := b.opts().ipAddressReservationsByIP[ip]
 	if hasReservation {
 		// the IP address provided is a reserved one...
 		// check if the MAC address is the one for which that IP was intended...
-		if strings.EqualFold(macExpected.String(), b.options.ipAddressReservationsByIP[ip].Mac.String()) {
+		if strings.EqualFold(macExpected.String(), b.opts().ipAddressReservationsByIP[ip].Mac.String()) {
 			return true
 		} else {
 			b.logger.Warnf("the IP %s was leased to MAC address %s, but in configuration it was reserved for MAC %s\n",
-				ip.String(), macExpected.String(), b.options.ipAddressReservationsByIP[ip].Mac.String())
+				ip.String(), macExpected.String(), b.opts().ipAddressReservationsByIP[ip].Mac.String())
 		}
 	}
 	return false
 }
 
 func (b *UIBackend) hasIpAddressReservationByMAC(mac net.HardwareAddr) bool {
-	_, hasReservation := b.options.ipAddressReservationsByMAC[mac.String()]
+	_, hasReservation := b.opts().ipAddressReservationsByMAC[mac.String()]
 	return hasReservation
 }
 
-// isValidURI checks if the given string is a valid URI.
-func isValidURI(uri string) bool {
+// isValidWebhookURL checks if the given string is a valid HTTP or HTTPS URL
+func isValidWebhookURL(uri string) bool {
 	parsedURL, err := url.ParseRequestURI(uri)
-	return err == nil && parsedURL.Scheme != "" && parsedURL.Host != ""
+	return err == nil && (parsedURL.Scheme == "http" || parsedURL.Scheme == "https") && parsedURL.Host != ""
+}
+
+// isValidLinkURL checks if the given string is a valid HTTP or HTTPS URL that can be placed in
+// an HTML attribute of the web UI, i.e. one without quotes or angle brackets
+func isValidLinkURL(uri string) bool {
+	return isValidWebhookURL(uri) && !strings.ContainsAny(uri, "\"'`<>")
 }
 
 func (b *UIBackend) evaluateLink(hostname string, ip netip.Addr, mac net.HardwareAddr) string {
 	var theTemplate *texttemplate.Template
 	var friendlyName string
 
-	r, hasFriendlyName := b.options.friendlyNames[mac.String()]
+	r, hasFriendlyName := b.opts().friendlyNames[mac.String()]
 	if hasFriendlyName {
 		theTemplate = r.Link
 		friendlyName = r.FriendlyName
 	} else {
-		r, hasReservation := b.options.ipAddressReservationsByIP[ip]
+		r, hasReservation := b.opts().ipAddressReservationsByIP[ip]
 		if hasReservation {
 			theTemplate = r.Link
 		}
 	}
 
+	// the addon options take precedence over the metadata edited from the web UI
+	if stored, ok := b.getClientMetadata(mac); ok {
+		if theTemplate == nil {
+			theTemplate = stored.linkTemplate
+		}
+		if friendlyName == "" {
+			friendlyName = stored.FriendlyName
+		}
+	}
+
 	if theTemplate == nil {
 		return ""
 	}
@@ -518,9 +775,10 @@ func (b *UIBackend) evaluateLink(hostname string, ip netip.Addr, mac net.Hardwar
 		"ip":            ip.String(),
 		"hostname":      hostname,
 		"friendly_name": friendlyName,
-		"dns_domain":    b.options.dnsDomain,
+		"vendor":        oui.Lookup(mac),
+		"dns_domain":    b.opts().dnsDomain,
 		// 'fqdn' is something that should be resolvable by the dnsmasq DNS server:
-		"fqdn": fmt.Sprintf("%s.%s", hostname, b.options.dnsDomain),
+		"fqdn": fmt.Sprintf("%s.%s", hostname, b.opts().dnsDomain),
 	})
 	if err != nil {
 		b.logger.Warnf("failed to render the link template [%v]", theTemplate)
@@ -528,29 +786,40 @@ func (b *UIBackend) evaluateLink(hostname string, ip netip.Addr, mac net.Hardwar
 	}
 
 	lnk := buf.String()
-	if !isValidURI(lnk) {
+	if !isValidLinkURL(lnk) {
 		b.logger.Warnf("rendering [%v] produced an invalid URI [%s]", theTemplate, lnk)
 		return ""
 	}
 	return lnk
 }
 
-// Process a slice of dnsmasq.Lease and store that into the UIBackend object
-func (b *UIBackend) processLeaseUpdatesFromArray(updatedLeases []*dnsmasq.Lease) {
+// Process a slice of leasewatcher.Lease and store that into the UIBackend object
+func (b *UIBackend) processLeaseUpdatesFromArray(updatedLeases []*leasewatcher.Lease) {
 	b.dhcpClientDataLock.Lock()
-	b.dhcpClientData = make([]DhcpClientData, 0, len(updatedLeases) /* capacity */)
-	for _, lease := range updatedLeases {
 
-		d := DhcpClientData{Lease: *lease}
+	// the very first snapshot is just a baseline: there's nothing to compare it against
+	isBaseline := b.dhcpClientData == nil
+	previousTimestamp := b.dhcpClientDataTimestamp
+	b.dhcpClientDataTimestamp = time.Now()
+	previousLeases := trackedLeases(b.dhcpClientData)
+
+	// dual-stack DHCP clients have both DHCPv4 and DHCPv6 leases: show them as a single client
+	b.dhcpClientData = groupLeases(updatedLeases)
+	for i := range b.dhcpClientData {
+		d := &b.dhcpClientData[i]
+		lease := &d.Lease
 
 		// fill metadata
 		d.FriendlyName = b.getFriendlyNameFor(lease.MacAddr, lease.Hostname)
 		d.HasStaticIP = b.hasIpAddressReservationByIP(lease.IPAddr, lease.MacAddr)
-		d.IsInsideDHCPPool = b.options.dhcpPool.Contains(lease.IPAddr)
+		d.HasRuntimeReservation = b.opts().ipAddressReservationsByMAC[lease.MacAddr.String()].Runtime
+		d.IsInsideDHCPPool = slices.ContainsFunc(d.IPAddrs(), b.opts().dhcpPool.Contains)
 		d.EvaluatedLink = b.evaluateLink(lease.Hostname, lease.IPAddr, lease.MacAddr)
-
-		// processing complete:
-		b.dhcpClientData = append(b.dhcpClientData, d)
+		d.Vendor = oui.Lookup(lease.MacAddr)
+		d.IsRandomizedMac = oui.IsRandomized(lease.MacAddr)
+		if stored, ok := b.getClientMetadata(lease.MacAddr); ok {
+			d.UserNote = stored.Note
+		}
 	}
 
 	// sort the slice by IP
@@ -558,9 +827,144 @@ func (b *UIBackend) processLeaseUpdatesFromArray(updatedLeases []*dnsmasq.Lease)
 		return a.Lease.IPAddr.Compare(b.Lease.IPAddr)
 	})
 
+	currentLeases := trackedLeases(b.dhcpClientData)
+
 	b.dhcpClientDataLock.Unlock()
 
 	b.logger.Infof("Updated DHCP clients internal status with %d entries\n", len(b.dhcpClientData))
+
+	if !isBaseline {
+		events := diffLeases(previousLeases, currentLeases, time.Now(), b.startEpoch)
+		b.recordDhcpEvents(events)
+		b.notifyDhcpEvents(events, previousTimestamp)
+	}
+	b.checkDhcpRangesExhaustion(!isBaseline)
+	b.checkDhcpRangesAlerts(time.Now(), !isBaseline)
+}
+
+// trackedLeases returns the main lease of the given DHCP clients, skipping the DHCPv6 clients with
+// an unknown MAC address, since the tracker DB identifies DHCP clients by their MAC address
+func trackedLeases(clients []DhcpClientData) []leasewatcher.Lease {
+	leases := make([]leasewatcher.Lease, 0, len(clients))
+	for _, d := range clients {
+		if d.Lease.MacAddr != nil {
+			leases = append(leases, d.Lease)
+		}
+	}
+	return leases
+}
+
+// checkDhcpRangesExhaustion looks for DHCP ranges that just ran out of free IP addresses and,
+// if requested, notifies them
+func (b *UIBackend) checkDhcpRangesExhaustion(notify bool) {
+	if b.exhaustedDhcpRanges == nil {
+		b.exhaustedDhcpRanges = make(map[string]bool)
+	}
+
+	for _, u := range b.getDhcpRangesUtilization(b.getCurrentClients()) {
+		key := u.Start + "-" + u.End
+		exhausted := u.Size > 0 && u.Free == 0
+		wasExhausted := b.exhaustedDhcpRanges[key]
+		b.exhaustedDhcpRanges[key] = exhausted
+		if !exhausted || wasExhausted || !notify {
+			continue
+		}
+
+		ev := notifier.Event{
+			Type:      notifier.EventPoolExhausted,
+			Timestamp: time.Now(),
+			Pool: &notifier.PoolUsage{
+				Interface: u.Interface,
+				Start:     u.Start,
+				End:       u.End,
+				Size:      u.Size,
+				Used:      u.Used,
+				Reserved:  u.Reserved,
+			},
+		}
+		b.logger.Warnf("Notifying %s", ev.String())
+		for _, n := range b.notifiers {
+			n.Notify(ev)
+		}
+	}
+}
+
+// isNeverSeenClient returns true if the given MAC address was not in the tracker DB before the given time.
+// Note that the dnsmasq DHCP script adds new clients to the tracker DB as soon as they get a lease, so
+// clients first seen after the given time are also considered new.
+func (b *UIBackend) isNeverSeenClient(mac net.HardwareAddr, since time.Time) bool {
+	client, err := b.trackerDB.GetDhcpClient(mac)
+	if errors.Is(err, trackerdb.ErrDhcpClientNotFound) {
+		return true
+	}
+	if err != nil {
+		b.logger.Warnf("failed to look up DHCP client %s in tracker DB: %s", mac.String(), err.Error())
+		return false
+	}
+	// the tracker DB stores timestamps with a 1sec resolution
+	return !client.FirstSeen.Before(since.Truncate(time.Second))
+}
+
+// notifyDhcpEvents converts the DHCP events relevant to the user into notifications and hands
+// them to all notifiers. The given time is the time of the previous snapshot of the lease file.
+func (b *UIBackend) notifyDhcpEvents(events []trackerdb.DhcpEvent, previousTimestamp time.Time) {
+	if len(b.notifiers) == 0 {
+		return
+	}
+
+	var notifications []notifier.Event
+	for _, e := range events {
+		hostname := e.Hostname
+		if hostname == dnsmasqMarkerForMissingHostname {
+			hostname = ""
+		}
+		ev := notifier.Event{
+			Timestamp:    e.Timestamp,
+			MacAddr:      e.MacAddr,
+			IPAddr:       e.IPAddr,
+			Hostname:     hostname,
+			FriendlyName: b.getFriendlyNameFor(e.MacAddr, e.Hostname),
+		}
+
+		switch e.Type {
+		case trackerdb.DhcpEventJoined, trackerdb.DhcpEventIPChanged:
+			if e.Type == trackerdb.DhcpEventJoined && b.isNeverSeenClient(e.MacAddr, previousTimestamp) {
+				ev.Type = notifier.EventNewClient
+				notifications = append(notifications, ev)
+			}
+			if r, ok := b.opts().ipAddressReservationsByIP[e.IPAddr]; ok && !strings.EqualFold(r.Mac.String(), e.MacAddr.String()) {
+				ev.Type = notifier.EventReservationMismatch
+				ev.ReservedMacAddr = r.Mac
+				notifications = append(notifications, ev)
+			}
+		case trackerdb.DhcpEventExpired, trackerdb.DhcpEventRemoved:
+			ev.Type = notifier.EventClientLeft
+			notifications = append(notifications, ev)
+		}
+	}
+
+	for _, ev := range notifications {
+		b.logger.Infof("Notifying %s", ev.String())
+		for _, n := range b.notifiers {
+			n.Notify(ev)
+		}
+	}
+}
+
+// recordDhcpEvents stores the given events into the tracker DB
+func (b *UIBackend) recordDhcpEvents(events []trackerdb.DhcpEvent) {
+	if len(events) == 0 {
+		return
+	}
+	for _, e := range events {
+		if e.Type != trackerdb.DhcpEventRenewed || b.opts().logDHCP {
+			b.logger.Infof("DHCP event: %s", e.String())
+		}
+	}
+	if err := b.trackerDB.AddDhcpEvents(events); err != nil {
+		b.logger.Warnf("failed to store %d DHCP events in tracker DB: %s", len(events), err.Error())
+		// keep going
+	}
 }
 
 // Reads the current DNS masq lease file, before any INotify hook gets installed, to get a baseline
@@ -575,7 +979,7 @@ func (b *UIBackend) readCurrentLeaseFile() error {
 	defer func() {
 		_ = leaseFile.Close()
 	}()
-	leases, errRead := dnsmasq.ReadLeases(leaseFile)
+	leases, errRead := leasewatcher.ReadLeases(leaseFile)
 	if errRead != nil {
 		return errRead
 	}
@@ -604,18 +1008,30 @@ func (b *UIBackend) readAddonOptions() error {
 	}
 
 	// JSON parse
-	err = json.Unmarshal(data, &b.options)
+	opts, err := parseAddonOptions(data)
 	if err != nil {
 		return err
 	}
+	b.options.Store(opts)
+	b.startupOptions = opts
+	b.startupOptionsData = data
+
+	// look for settings that are accepted but are most likely a mistake
+	findings := LintAddonOptions(data)
+	for _, f := range findings {
+		b.logger.Warnf("addon options: %s\n", f.String())
+	}
+	b.optionsLock.Lock()
+	b.configFindings = findings
+	b.optionsLock.Unlock()
 
-	b.logger.Infof("Acquired %d DHCP network/ranges\n", len(b.options.dhcpRanges))
-	b.logger.Infof("Acquired %d IP address reservations\n", len(b.options.ipAddressReservationsByIP))
-	b.logger.Infof("Acquired %d friendly name definitions\n", len(b.options.friendlyNames))
+	b.logger.Infof("Acquired %d DHCP network/ranges\n", len(opts.dhcpRanges))
+	b.logger.Infof("Acquired %d IP address reservations\n", len(opts.ipAddressReservationsByIP))
+	b.logger.Infof("Acquired %d friendly name definitions\n", len(opts.friendlyNames))
 	b.logger.Infof("DHCP requests logging enabled=%t; cleanup threshold for past DHCP clients set to %s\n",
-		b.options.logDHCP, human_duration.ShortString(b.options.forgetPastClientsAfter, human_duration.Minute))
+		opts.logDHCP, human_duration.ShortString(opts.forgetPastClientsAfter, human_duration.Minute))
 	b.logger.Infof("Web server on port %d; Web UI logging enabled=%t; Web UI refresh interval=%s\n",
-		b.options.webUIPort, b.options.logWebUI, b.options.webUIRefreshInterval.String())
+		opts.webUIPort, opts.logWebUI, opts.webUIRefreshInterval.String())
 
 	return nil
 }
@@ -660,31 +1076,251 @@ func (b *UIBackend) readAddonConfig() error {
 }
 
 // forgetPastDhcpClients typically runs in a separate goroutine and removes past DHCP clients
-// above some configurable threshold
-func (b *UIBackend) forgetPastDhcpClients() {
+// above some configurable threshold, together with the excess DHCP events, until the context is cancelled
+func (b *UIBackend) forgetPastDhcpClients(ctx context.Context) {
+	ticker := time.NewTicker(pastClientsCheckInterval)
+	defer ticker.Stop()
+
 	for {
-		purgedClients, err := b.trackerDB.PurgeOldDeadClients(b.options.forgetPastClientsAfter)
+		// this setting might change after a reload of the addon options
+		forgetPastClientsAfter := b.opts().forgetPastClientsAfter
+		if forgetPastClientsAfter > 0 {
+			b.purgePastDhcpClients(forgetPastClientsAfter)
+		}
+		b.purgeExcessDhcpEvents()
 
+		// wait some time before next check
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgePastDhcpClients removes from the tracker DB the past DHCP clients and the DHCP events
+// older than the given threshold
+func (b *UIBackend) purgePastDhcpClients(forgetPastClientsAfter time.Duration) {
+	purgedClients, err := b.trackerDB.PurgeOldDeadClients(forgetPastClientsAfter)
+
+	if err != nil {
+		b.logger.Warnf("failed to purge past clients from tracker DB: %s", err.Error())
+	} else if len(purgedClients) > 0 {
+		desc := ""
+		for _, c := range purgedClients {
+			desc += fmt.Sprintf("%s, ", c.String())
+		}
+		b.logger.Infof("Purged %d past DHCP clients from tracker DB, last seen more than %s time ago: %s",
+			len(purgedClients), forgetPastClientsAfter, desc)
+	} /* else {
+		b.logger.Info("No past DHCP client to purge from tracker DB")
+	} */
+
+	// events are kept for the same amount of time past DHCP clients are remembered
+	numPurgedEvents, err := b.trackerDB.PurgeOldDhcpEvents(forgetPastClientsAfter)
+	if err != nil {
+		b.logger.Warnf("failed to purge old DHCP events from tracker DB: %s", err.Error())
+	} else if numPurgedEvents > 0 {
+		b.logger.Infof("Purged %d DHCP events from tracker DB, older than %s", numPurgedEvents, forgetPastClientsAfter)
+	}
+}
+
+// purgeExcessDhcpEvents bounds the size of the DHCP events table, also when past DHCP clients
+// are never forgotten
+func (b *UIBackend) purgeExcessDhcpEvents() {
+	numPurgedEvents, err := b.trackerDB.PurgeExcessDhcpEvents(maxDhcpEventsPerClient)
+	if err != nil {
+		b.logger.Warnf("failed to purge excess DHCP events from tracker DB: %s", err.Error())
+	} else if numPurgedEvents > 0 {
+		b.logger.Infof("Purged %d DHCP events from tracker DB, keeping the last %d of each client", numPurgedEvents, maxDhcpEventsPerClient)
+	}
+}
+
+// dhcpInterfaces returns the network interfaces listed in the "dhcp_pools" addon option, without duplicates
+func (b *UIBackend) dhcpInterfaces() []string {
+	var interfaces []string
+	for _, r := range b.opts().dhcpRanges {
+		if !slices.Contains(interfaces, r.Interface) {
+			interfaces = append(interfaces, r.Interface)
+		}
+	}
+	return interfaces
+}
+
+// startRogueDhcpDetector starts probing all DHCP networks looking for other DHCP servers
+func (b *UIBackend) startRogueDhcpDetector(ctx context.Context, transport roguedhcp.Transport) {
+	interfaces := b.dhcpInterfaces()
+	b.logger.Infof("Starting rogue DHCP server detection on interfaces %v every %s\n",
+		interfaces, b.opts().rogueDhcpProbeInterval.String())
+
+	b.rogueDhcpDetector = roguedhcp.NewDetector(b.logger, transport, interfaces)
+	b.startGoroutine(func() { b.rogueDhcpDetector.Run(ctx, b.opts().rogueDhcpProbeInterval) })
+}
+
+// getRogueDhcpServers returns the rogue DHCP servers detected so far
+func (b *UIBackend) getRogueDhcpServers() []roguedhcp.RogueServer {
+	if b.rogueDhcpDetector == nil {
+		return []roguedhcp.RogueServer{}
+	}
+	return b.rogueDhcpDetector.RogueServers()
+}
+
+// startMqttPublisher starts publishing DHCP clients and statistics to Home Assistant through the given client
+func (b *UIBackend) startMqttPublisher(ctx context.Context, client mqttpublisher.Client) {
+	b.logger.Infof("Starting MQTT publishing to broker %s every %s\n",
+		b.opts().mqttConfig.BrokerURL, b.opts().mqttPublishInterval.String())
+
+	b.mqttPublisher = mqttpublisher.NewPublisher(b.logger, client, b.opts().mqttConfig)
+	b.startGoroutine(func() { b.publishUpdatesToMqtt(ctx) })
+}
+
+// triggerMqttUpdate asks for an MQTT update without waiting for the next publish interval
+func (b *UIBackend) triggerMqttUpdate() {
+	select {
+	case b.mqttUpdateCh <- struct{}{}:
+	default:
+		// an update is already pending
+	}
+}
+
+// publishUpdatesToMqtt publishes to MQTT every time the DHCP clients change and periodically,
+// until the context is cancelled
+func (b *UIBackend) publishUpdatesToMqtt(ctx context.Context) {
+	ticker := time.NewTicker(b.opts().mqttPublishInterval)
+	defer ticker.Stop()
+	defer b.mqttPublisher.Close()
+
+	for {
+		if err := b.publishToMqtt(); err != nil {
+			b.logger.Warnf("failed to publish to MQTT: %s", err.Error())
+			// keep going, failed messages will be published again at next update
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-b.mqttUpdateCh:
+		case <-ticker.C:
+		}
+	}
+}
+
+// getMqttTrackedClients converts current and past DHCP clients into MQTT device trackers
+func (b *UIBackend) getMqttTrackedClients(currentClients []DhcpClientData, pastClients []PastDhcpClientData) []mqttpublisher.TrackedClient {
+	tracked := make([]mqttpublisher.TrackedClient, 0, len(currentClients)+len(pastClients))
+	for _, c := range currentClients {
+		if c.Lease.MacAddr == nil {
+			// device trackers are identified by the MAC address
+			continue
+		}
+		hostname := c.Lease.Hostname
+		if hostname == dnsmasqMarkerForMissingHostname {
+			hostname = ""
+		}
+		tracked = append(tracked, mqttpublisher.TrackedClient{
+			MacAddr:      c.Lease.MacAddr,
+			IPAddr:       c.Lease.IPAddr,
+			Hostname:     hostname,
+			FriendlyName: c.FriendlyName,
+			Home:         true,
+		})
+	}
+	for _, c := range pastClients {
+		// undo the decorations added by getPastClients for the web UI
+		hostname := c.PastInfo.Hostname
+		if hostname == unknownHostnameHtmlString {
+			hostname = ""
+		}
+		friendlyName := c.FriendlyName
+		if friendlyName == "N/A" {
+			friendlyName = ""
+		}
+		tracked = append(tracked, mqttpublisher.TrackedClient{
+			MacAddr:      c.PastInfo.MacAddr,
+			IPAddr:       c.PastInfo.LastIP,
+			Hostname:     hostname,
+			FriendlyName: friendlyName,
+			Home:         false,
+		})
+	}
+	return tracked
+}
+
+// publishToMqtt publishes the current and past DHCP clients, the DHCP ranges usage and the DNS stats
+func (b *UIBackend) publishToMqtt() error {
+	currentClients := b.getCurrentClients()
+	pastClients := b.getPastClients(currentClients)
+
+	var pools []mqttpublisher.PoolStats
+	for _, u := range b.getDhcpRangesUtilization(currentClients) {
+		pools = append(pools, mqttpublisher.PoolStats{
+			Interface:    u.Interface,
+			Start:        u.Start,
+			End:          u.End,
+			Size:         u.Size,
+			Used:         u.Used,
+			Reserved:     u.Reserved,
+			Free:         u.Free,
+			UsagePercent: u.UsagePercent,
+		})
+	}
+
+	var dns *mqttpublisher.DnsStats
+	if b.opts().dnsEnable {
+		stats, err := b.getLocalDnsStats()
 		if err != nil {
-			b.logger.Warnf("failed to purge past clients from tracker DB: %s", err.Error())
-		} else if len(purgedClients) > 0 {
-			desc := ""
-			for _, c := range purgedClients {
-				desc += fmt.Sprintf("%s, ", c.String())
+			b.logger.Warnf("failed to get updated DNS stats: %s", err.Error())
+			// keep going without DNS stats
+		} else {
+			dns = &mqttpublisher.DnsStats{
+				CacheSize:       stats.CacheSize,
+				CacheInsertions: stats.CacheInsertions,
+				CacheEvictions:  stats.CacheEvictions,
+				CacheMisses:     stats.CacheMisses,
+				CacheHits:       stats.CacheHits,
 			}
-			b.logger.Infof("Purged %d past DHCP clients from tracker DB, last seen more than %s time ago: %s",
-				len(purgedClients), b.options.forgetPastClientsAfter, desc)
-		} /* else {
-			b.logger.Info("No past DHCP client to purge from tracker DB")
-		} */
+		}
+	}
 
-		time.Sleep(pastClientsCheckInterval) // wait some time before next check
+	return b.mqttPublisher.Update(b.getMqttTrackedClients(currentClients, pastClients), pools, dns)
+}
+
+// startWebhooks starts the delivery of notifications to the webhooks listed in the addon options
+func (b *UIBackend) startWebhooks(ctx context.Context, client notifier.HTTPClient) {
+	for _, target := range b.opts().webhooks {
+		b.logger.Infof("Starting webhook %s for events %v\n", target.Name, target.Events)
+		w := notifier.NewWebhook(b.logger, target, client)
+		b.startGoroutine(func() { w.Run(ctx) })
+		b.notifiers = append(b.notifiers, w)
 	}
 }
 
+// startHomeAssistantEvents starts firing Home Assistant events through the Supervisor API
+func (b *UIBackend) startHomeAssistantEvents(ctx context.Context, client notifier.HTTPClient, baseURL, token string) {
+	b.logger.Infof("Starting to fire Home Assistant events through %s\n", baseURL)
+	s := notifier.NewSupervisorEvents(b.logger, client, baseURL, token)
+	b.startGoroutine(func() { s.Run(ctx) })
+	b.notifiers = append(b.notifiers, s)
+}
+
+// startGoroutine runs f in a new goroutine tracked by ListenAndServe
+func (b *UIBackend) startGoroutine(f func()) {
+	b.goroutines.Add(1)
+	go func() {
+		defer b.goroutines.Done()
+		f()
+	}()
+}
+
 // ListenAndServe is starting the whole UI backend:
-// a web server, a WebSocket server, INotify-based watch on dnsmasq lease files, etc
-func (b *UIBackend) ListenAndServe() error {
+// a web server, a WebSocket server, INotify-based watch on dnsmasq lease files, etc.
+// When the context is cancelled, everything is shut down gracefully: WebSocket clients receive
+// a close frame, in-flight HTTP requests are completed, all goroutines are stopped and finally
+// the tracker DB is closed. In such case nil is returned.
+func (b *UIBackend) ListenAndServe(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	b.reloadTemplates()
 
 	mux := http.NewServeMux()
@@ -699,6 +1335,16 @@ func (b *UIBackend) ListenAndServe() error {
 	// Serve Websocket requests
 	mux.HandleFunc(websocketRelativeUrl, b.handleWebSocketConn)
 
+	// Serve the REST API
+	b.registerAPIHandlers(mux)
+
+	// Serve Prometheus metrics
+	mux.Handle("GET "+metricsRelativeUrl, b.newMetricsHandler())
+
+	// Serve the health checks
+	mux.HandleFunc("GET "+healthzRelativeUrl, b.handleHealthz)
+	mux.HandleFunc("GET "+livezRelativeUrl, b.handleLivez)
+
 	// Read friendly names from the HomeAssistant addon config
 	if err := b.readAddonOptions(); err != nil {
 		b.logger.Fatalf("error while reading HomeAssistant addon options: %s\n", err.Error())
@@ -709,6 +1355,18 @@ func (b *UIBackend) ListenAndServe() error {
 		return err
 	}
 
+	// Read the IP address reservations created from the web UI
+	if err := b.loadRuntimeReservations(); err != nil {
+		b.logger.Warnf("failed to read the IP address reservations created from the web UI: %s", err.Error())
+		// keep going without them
+	}
+
+	// Read friendly names, notes and links edited from the web UI
+	if err := b.loadClientMetadata(); err != nil {
+		b.logger.Warnf("failed to read DHCP client metadata from the tracker DB: %s", err.Error())
+		// keep going without them
+	}
+
 	// Initialize current DHCP client data table
 	if err := b.readCurrentLeaseFile(); err != nil {
 		b.logger.Fatalf("error while reading DHCP leases file: %s\n", err.Error())
@@ -716,28 +1374,85 @@ func (b *UIBackend) ListenAndServe() error {
 	}
 
 	// Watch for updates on DHCP leases file and push to leasesCh
-	ctx := context.Background()
-	go func() {
-		err := dnsmasq.WatchLeases(ctx, defaultDnsmasqLeasesFile, b.leasesCh)
-		if err != nil {
-			b.logger.Fatalf("error while watching DHCP leases file: %s\n", err.Error())
+	b.leaseWatcher = leasewatcher.NewWatcher(b.logger, defaultDnsmasqLeasesFile, b.leasesCh)
+	b.startGoroutine(func() { b.leaseWatcher.Run(ctx) })
+
+	// Notify DHCP events to external systems
+	b.startWebhooks(ctx, http.DefaultClient)
+	if b.opts().homeAssistantEventsEnable {
+		token := os.Getenv("SUPERVISOR_TOKEN")
+		if token == "" {
+			b.logger.Warnf("cannot fire Home Assistant events: SUPERVISOR_TOKEN is not set\n")
+		} else {
+			b.startHomeAssistantEvents(ctx, http.DefaultClient, notifier.DefaultSupervisorCoreAPI, token)
 		}
-	}()
+	}
 
 	// Read from the leasesCh and push to broadcastCh
-	go b.processLeaseUpdates()
+	b.startGoroutine(func() { b.processLeaseUpdates(ctx) })
 
 	// Read from the broadcastCh chan and push to all Websocket clients
-	go b.broadcastUpdatesToClients()
+	b.startGoroutine(func() { b.broadcastUpdatesToClients(ctx) })
 
 	// Check old tracker DB entries and delete them
-	if b.options.forgetPastClientsAfter > 0 {
-		go b.forgetPastDhcpClients()
+	b.startGoroutine(func() { b.forgetPastDhcpClients(ctx) })
+
+	// Reload the addon options when they get changed
+	b.startGoroutine(func() { b.watchAddonOptions(ctx) })
+
+	// Look for other DHCP servers
+	if b.opts().rogueDhcpDetectorEnable {
+		b.startRogueDhcpDetector(ctx, roguedhcp.NewTransport())
+	}
+
+	// Expose DHCP clients and statistics to Home Assistant
+	if b.opts().mqttEnable {
+		b.startMqttPublisher(ctx, mqttpublisher.NewPahoClient(b.opts().mqttConfig))
 	}
 
 	// Start server
-	b.logger.Infof("Starting server to listen on port %d\n", b.options.webUIPort)
-	b.server.Addr = fmt.Sprintf(":%d", b.options.webUIPort)
+	if b.listener == nil {
+		b.logger.Infof("Starting server to listen on port %d\n", b.opts().webUIPort)
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", b.opts().webUIPort))
+		if err != nil {
+			b.logger.Fatalf("error while listening on port %d: %s\n", b.opts().webUIPort, err.Error())
+			b.shutdown(cancel)
+			return err
+		}
+		b.listener = listener
+	}
 	b.server.Handler = mux
-	return b.server.ListenAndServe()
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- b.server.Serve(b.listener)
+	}()
+
+	var err error
+	select {
+	case <-ctx.Done():
+		b.logger.Info("Shutting down the web backend")
+	case err = <-serveErr:
+		b.logger.Fatalf("error while serving HTTP requests: %s\n", err.Error())
+	}
+	b.shutdown(cancel)
+	return err
+}
+
+// shutdown stops the HTTP server, closes all WebSockets, waits for all goroutines to terminate
+// and finally closes the tracker DB
+func (b *UIBackend) shutdown(cancel context.CancelFunc) {
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelShutdown()
+	if err := b.server.Shutdown(shutdownCtx); err != nil {
+		b.logger.Warnf("failed to shut down the HTTP server gracefully: %s", err.Error())
+	}
+
+	b.closeWebSockets()
+	cancel()
+	b.goroutines.Wait()
+
+	if err := b.trackerDB.Close(); err != nil {
+		b.logger.Warnf("failed to close the tracker DB: %s", err.Error())
+	}
+	b.logger.Info("Web backend stopped")
 }
@@ -1,17 +1,27 @@
 package uibackend
 
 import (
+	"context"
+	"dnsmasq-dhcp-backend/pkg/dnsmasqctl"
 	"dnsmasq-dhcp-backend/pkg/ippool"
+	"dnsmasq-dhcp-backend/pkg/leasewatcher"
 	"dnsmasq-dhcp-backend/pkg/logger"
+	"dnsmasq-dhcp-backend/pkg/mqttpublisher"
+	"dnsmasq-dhcp-backend/pkg/notifier"
 	"dnsmasq-dhcp-backend/pkg/trackerdb"
+	"encoding/json"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"net/netip"
+	"os"
 	"testing"
 	"text/template"
+	"time"
 
-	"github.com/b0ch3nski/go-dnsmasq-utils/dnsmasq"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/gorilla/websocket"
 )
 
 // MustParseMAC acts like ParseMAC but panics if in case of an error
@@ -27,8 +37,8 @@ func MustParseTemplate(s string) *template.Template {
 	return template.Must(template.New("test").Parse(s))
 }
 
-func getMockLeases() []*dnsmasq.Lease {
-	return []*dnsmasq.Lease{
+func getMockLeases() []*leasewatcher.Lease {
+	return []*leasewatcher.Lease{
 		{
 			// client1
 			MacAddr:  MustParseMAC("00:11:22:33:44:55"),
@@ -83,12 +93,27 @@ func getMockUIBackend() *UIBackend {
 			},
 		},
 		dhcpPool: ippool.NewPoolFromString("192.168.0.1", "192.168.0.100"),
+		dhcpRanges: []IpNetworkInfo{
+			{
+				Interface: "eth0",
+				Start:     netip.MustParseAddr("192.168.0.1"),
+				End:       netip.MustParseAddr("192.168.0.100"),
+				Gateway:   netip.MustParseAddr("192.168.0.254"),
+				Network:   netip.MustParsePrefix("192.168.0.0/24"),
+			},
+		},
+		poolAlertWarningPercent:  defaultPoolAlertWarningPercent,
+		poolAlertCriticalPercent: defaultPoolAlertCriticalPercent,
+		poolAlertHorizon:         defaultPoolAlertHorizon,
+		poolAlertTrendWindow:     defaultPoolAlertTrendWindow,
 	}
-	return &UIBackend{
-		logger:    logger.NewCustomLogger("unit tests"),
-		options:   backendopts,
-		trackerDB: trackerdb.NewTestDB(),
+	b := &UIBackend{
+		logger:     logger.NewCustomLogger("unit tests"),
+		trackerDB:  trackerdb.NewTestDB(),
+		dnsmasqCtl: dnsmasqctl.NewFakeController(),
 	}
+	b.options.Store(&backendopts)
+	return b
 }
 
 // TestEvaluateLink tests evaluateLink() helper with valid template data.
@@ -135,6 +160,48 @@ func TestEvaluateLink(t *testing.T) {
 	}
 }
 
+// TestEvaluateLinkWithVendor tests the "vendor" variable of link templates
+func TestEvaluateLinkWithVendor(t *testing.T) {
+	backend := getMockUIBackend()
+	mac := MustParseMAC("b8:27:eb:00:00:01") // a Raspberry Pi
+	backend.opts().friendlyNames[mac.String()] = DhcpClientFriendlyName{
+		MacAddress:   mac,
+		FriendlyName: "RPi",
+		Link:         MustParseTemplate("https://{{ .ip }}/?vendor={{ urlquery .vendor }}"),
+	}
+
+	result := backend.evaluateLink("raspberrypi", netip.MustParseAddr("192.168.0.10"), mac)
+	if expected := "https://192.168.0.10/?vendor=Raspberry+Pi+Foundation"; result != expected {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+}
+
+// TestEvaluateLinkUnsafe tests that evaluateLink() drops the links that are not HTTP or HTTPS URLs
+// or that would break out of the href attribute of the web UI
+func TestEvaluateLinkUnsafe(t *testing.T) {
+	backend := getMockUIBackend()
+	mac := MustParseMAC("b8:27:eb:00:00:01")
+
+	for _, link := range []string{
+		"javascript://x/%0aalert(1)",
+		"javascript:alert(1)",
+		"data:text/html,<script>alert(1)</script>",
+		`http://x/"onmouseover=alert(1)//`,
+		"http://x/'onmouseover=alert(1)//",
+		"http://{{ .hostname }}/",
+	} {
+		backend.opts().friendlyNames[mac.String()] = DhcpClientFriendlyName{
+			MacAddress:   mac,
+			FriendlyName: "RPi",
+			Link:         MustParseTemplate(link),
+		}
+		result := backend.evaluateLink("x><img src=x onerror=alert(1)", netip.MustParseAddr("192.168.0.10"), mac)
+		if result != "" {
+			t.Errorf("expected no link for %q, got %q", link, result)
+		}
+	}
+}
+
 // Test function
 func TestProcessLeaseUpdatesFromArray(t *testing.T) {
 	// Prepare mock data
@@ -148,7 +215,7 @@ func TestProcessLeaseUpdatesFromArray(t *testing.T) {
 	// NOTE: the expected data must be sorted by IP address
 	expectedClientData := []DhcpClientData{
 		{
-			Lease: dnsmasq.Lease{
+			Lease: leasewatcher.Lease{
 				MacAddr:  MustParseMAC("00:11:22:33:44:55"),
 				IPAddr:   netip.MustParseAddr("192.168.0.2"),
 				Hostname: "client1",
@@ -159,7 +226,7 @@ func TestProcessLeaseUpdatesFromArray(t *testing.T) {
 			EvaluatedLink:    "https://192.168.0.2/client1-page",
 		},
 		{
-			Lease: dnsmasq.Lease{
+			Lease: leasewatcher.Lease{
 				MacAddr:  MustParseMAC("00:11:22:33:44:56"),
 				IPAddr:   netip.MustParseAddr("192.168.0.3"),
 				Hostname: "client2",
@@ -170,7 +237,7 @@ func TestProcessLeaseUpdatesFromArray(t *testing.T) {
 			EvaluatedLink:    "https://192.168.0.3",
 		},
 		{
-			Lease: dnsmasq.Lease{
+			Lease: leasewatcher.Lease{
 				MacAddr:  MustParseMAC("aa:bb:cc:dd:ee:ff"),
 				IPAddr:   netip.MustParseAddr("192.168.0.66"),
 				Hostname: "client4",
@@ -179,9 +246,10 @@ func TestProcessLeaseUpdatesFromArray(t *testing.T) {
 			HasStaticIP:      false,
 			IsInsideDHCPPool: true,
 			EvaluatedLink:    "https://client4/client4-page",
+			IsRandomizedMac:  true, // the locally-administered bit is set in 0xaa
 		},
 		{
-			Lease: dnsmasq.Lease{
+			Lease: leasewatcher.Lease{
 				MacAddr:  MustParseMAC("00:11:22:33:44:57"),
 				IPAddr:   netip.MustParseAddr("192.168.0.101"),
 				Hostname: "client3",
@@ -194,7 +262,303 @@ func TestProcessLeaseUpdatesFromArray(t *testing.T) {
 	}
 
 	// Validate that the state is updated as expected
-	if diff := cmp.Diff(backend.dhcpClientData, expectedClientData, cmpopts.EquateComparable(netip.Addr{})); diff != "" {
+	// the vendor depends on the content of the embedded OUI registry, see TestEvaluateLinkWithVendor
+	if diff := cmp.Diff(backend.dhcpClientData, expectedClientData, cmpopts.EquateComparable(netip.Addr{}),
+		cmpopts.IgnoreFields(DhcpClientData{}, "Vendor")); diff != "" {
+		t.Errorf("Mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestGetDhcpRangesUtilization(t *testing.T) {
+	backend := getMockUIBackend()
+	backend.processLeaseUpdatesFromArray(getMockLeases())
+
+	expected := []DhcpRangeUtilization{
+		{
+			Interface: "eth0",
+			Start:     "192.168.0.1",
+			End:       "192.168.0.100",
+			Size:      100,
+			Used:      3, // client3 is outside the DHCP range
+			Reserved:  1, // client2 has an IP address reservation inside the DHCP range
+			Free:      97,
+
+			UsagePercent: 3,
+		},
+	}
+	if diff := cmp.Diff(expected, backend.getDhcpRangesUtilization(backend.getCurrentClients())); diff != "" {
+		t.Errorf("Mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestPublishToMqtt(t *testing.T) {
+	backend := getMockUIBackend()
+	backend.trackerDB = trackerdb.NewTestDBWithData([]trackerdb.DhcpClient{
+		{
+			// a past client that never advertised its hostname
+			MacAddr: MustParseMAC("dd:ee:aa:dd:00:01"),
+			LastIP:  netip.MustParseAddr("192.168.0.50"),
+		},
+	})
+	backend.processLeaseUpdatesFromArray(getMockLeases()[:2])
+
+	currentClients := backend.getCurrentClients()
+	expected := []mqttpublisher.TrackedClient{
+		{
+			MacAddr:      MustParseMAC("00:11:22:33:44:55"),
+			IPAddr:       netip.MustParseAddr("192.168.0.2"),
+			Hostname:     "client1",
+			FriendlyName: "FriendlyClient1",
+			Home:         true,
+		},
+		{
+			MacAddr:      MustParseMAC("00:11:22:33:44:56"),
+			IPAddr:       netip.MustParseAddr("192.168.0.3"),
+			Hostname:     "client2",
+			FriendlyName: "client2",
+			Home:         true,
+		},
+		{
+			MacAddr: MustParseMAC("dd:ee:aa:dd:00:01"),
+			IPAddr:  netip.MustParseAddr("192.168.0.50"),
+			Home:    false,
+		},
+	}
+	got := backend.getMqttTrackedClients(currentClients, backend.getPastClients(currentClients))
+	if diff := cmp.Diff(expected, got, cmpopts.EquateComparable(netip.Addr{})); diff != "" {
+		t.Errorf("Mismatch (-want +got):\n%s", diff)
+	}
+
+	client := mqttpublisher.NewFakeClient()
+	backend.mqttPublisher = mqttpublisher.NewPublisher(backend.logger, client, mqttpublisher.Config{})
+	if err := backend.publishToMqtt(); err != nil {
+		t.Fatalf("publishToMqtt failed: %s", err.Error())
+	}
+
+	for topic, want := range map[string]string{
+		"dnsmasq_dhcp/client/001122334455/state":                 mqttpublisher.StateHome,
+		"dnsmasq_dhcp/client/ddeeaadd0001/state":                 mqttpublisher.StateNotHome,
+		"dnsmasq_dhcp/pool/eth0_192_168_0_1_192_168_0_100/state": `{"size":100,"used":2,"reserved":1,"free":98,"usage_percent":2}`,
+	} {
+		if got, _ := client.Retained(topic); got != want {
+			t.Errorf("topic %s: want %q, got %q", topic, want, got)
+		}
+	}
+}
+
+func TestNotifyDhcpEvents(t *testing.T) {
+	backend := getMockUIBackend()
+	longAgo := time.Now().Add(-30 * 24 * time.Hour)
+	backend.trackerDB = trackerdb.NewTestDBWithData([]trackerdb.DhcpClient{
+		{MacAddr: MustParseMAC("00:11:22:33:44:56"), Hostname: "client2", LastSeen: longAgo},
+		{MacAddr: MustParseMAC("00:11:22:33:44:57"), Hostname: "client3", LastSeen: longAgo},
+	})
+	recorder := &notifier.Recorder{}
+	backend.notifiers = []notifier.Notifier{recorder}
+
+	mockLeases := getMockLeases()
+	backend.processLeaseUpdatesFromArray(mockLeases[:2]) // baseline: client1 and client2
+
+	// client2 leaves, client3 comes back, a never-seen client gets the IP reserved to client2
+	// and client4 joins for the first time
+	intruder := &leasewatcher.Lease{
+		MacAddr:  MustParseMAC("de:ad:be:ef:00:01"),
+		IPAddr:   netip.MustParseAddr("192.168.0.3"),
+		Hostname: "*",
+	}
+	backend.processLeaseUpdatesFromArray([]*leasewatcher.Lease{mockLeases[0], mockLeases[2], mockLeases[3], intruder})
+
+	expected := []notifier.Event{
+		{
+			Type:     notifier.EventClientLeft,
+			MacAddr:  MustParseMAC("00:11:22:33:44:56"),
+			IPAddr:   netip.MustParseAddr("192.168.0.3"),
+			Hostname: "client2", FriendlyName: "client2",
+		},
+		{
+			Type:     notifier.EventNewClient,
+			MacAddr:  MustParseMAC("aa:bb:cc:dd:ee:ff"),
+			IPAddr:   netip.MustParseAddr("192.168.0.66"),
+			Hostname: "client4", FriendlyName: "FriendlyClient4",
+		},
+		{
+			Type:    notifier.EventNewClient,
+			MacAddr: MustParseMAC("de:ad:be:ef:00:01"),
+			IPAddr:  netip.MustParseAddr("192.168.0.3"),
+		},
+		{
+			Type:            notifier.EventReservationMismatch,
+			MacAddr:         MustParseMAC("de:ad:be:ef:00:01"),
+			IPAddr:          netip.MustParseAddr("192.168.0.3"),
+			ReservedMacAddr: MustParseMAC("00:11:22:33:44:56"),
+		},
+	}
+	if diff := cmp.Diff(expected, recorder.Events(),
+		cmpopts.EquateComparable(netip.Addr{}), cmpopts.IgnoreFields(notifier.Event{}, "Timestamp")); diff != "" {
 		t.Errorf("Mismatch (-want +got):\n%s", diff)
 	}
 }
+
+func TestHomeAssistantEvents(t *testing.T) {
+	// stand-in for the Supervisor proxy of the Home Assistant Core API
+	fired := make(chan string, 10)
+	supervisor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fired <- r.URL.Path
+	}))
+	defer supervisor.Close()
+
+	backend := getMockUIBackend()
+	backend.opts().dhcpRanges[0].Start = netip.MustParseAddr("192.168.0.2")
+	backend.opts().dhcpRanges[0].End = netip.MustParseAddr("192.168.0.4")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	backend.startHomeAssistantEvents(ctx, supervisor.Client(), supervisor.URL+"/core/api", "test-token")
+
+	// baseline: client1 holds .2, .3 is reserved to client2, .4 is still free
+	mockLeases := getMockLeases()
+	backend.processLeaseUpdatesFromArray(mockLeases[:1])
+
+	// a new client takes the last free IP of the range
+	backend.processLeaseUpdatesFromArray([]*leasewatcher.Lease{mockLeases[0], {
+		MacAddr:  MustParseMAC("de:ad:be:ef:00:01"),
+		IPAddr:   netip.MustParseAddr("192.168.0.4"),
+		Hostname: "newcomer",
+	}})
+
+	for _, expected := range []string{
+		"/core/api/events/dnsmasq_dhcp_new_client",
+		"/core/api/events/dnsmasq_dhcp_pool_exhausted",
+		"/core/api/events/dnsmasq_dhcp_pool_alert", // from ok to critical
+	} {
+		select {
+		case path := <-fired:
+			if path != expected {
+				t.Errorf("expected event %s, got %s", expected, path)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("event %s not fired", expected)
+		}
+	}
+
+	// no more events while the range stays exhausted
+	backend.processLeaseUpdatesFromArray([]*leasewatcher.Lease{mockLeases[0], {
+		MacAddr:  MustParseMAC("de:ad:be:ef:00:01"),
+		IPAddr:   netip.MustParseAddr("192.168.0.4"),
+		Hostname: "newcomer-renamed",
+	}})
+	select {
+	case path := <-fired:
+		t.Errorf("unexpected event %s", path)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// startTestUIBackend runs ListenAndServe on a random port, using the addon options and config of this repository;
+// it returns the address of the web server and a channel receiving the result of ListenAndServe
+func startTestUIBackend(ctx context.Context, t *testing.T) (*UIBackend, string, <-chan error) {
+	t.Helper()
+
+	leaseFile := t.TempDir() + "/dnsmasq.leases"
+	if err := os.WriteFile(leaseFile, []byte("0 00:11:22:33:44:55 192.168.1.2 client1 *\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	savedVars := []string{defaultHomeAssistantOptionsFile, defaultHomeAssistantConfigFile, templatesDir, defaultDnsmasqLeasesFile, defaultDnsmasqHostsFile}
+	defaultHomeAssistantOptionsFile = "../../../test-options.json"
+	defaultHomeAssistantConfigFile = "../../../config.yaml"
+	templatesDir = "../../../frontend"
+	defaultDnsmasqLeasesFile = leaseFile
+	defaultDnsmasqHostsFile = t.TempDir() + "/dnsmasq.hosts"
+	t.Cleanup(func() {
+		defaultHomeAssistantOptionsFile, defaultHomeAssistantConfigFile, templatesDir, defaultDnsmasqLeasesFile, defaultDnsmasqHostsFile =
+			savedVars[0], savedVars[1], savedVars[2], savedVars[3], savedVars[4]
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := newUIBackend(logger.NewCustomLogger("unit tests"), trackerdb.NewTestDB(), 1)
+	backend.listener = listener
+	backend.dnsmasqCtl = dnsmasqctl.NewFakeController()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- backend.ListenAndServe(ctx)
+	}()
+	return backend, listener.Addr().String(), done
+}
+
+func TestListenAndServeShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	backend, addr, done := startTestUIBackend(ctx, t)
+
+	// a WebSocket client gets the current DHCP clients as soon as it connects
+	ws, _, err := websocket.DefaultDialer.Dial("ws://"+addr+websocketRelativeUrl, nil)
+	if err != nil {
+		t.Fatalf("failed to connect the WebSocket: %s", err)
+	}
+	defer func() {
+		_ = ws.Close()
+	}()
+	var msg struct {
+		CurrentClients []json.RawMessage `json:"current_clients"`
+	}
+	if err := ws.ReadJSON(&msg); err != nil {
+		t.Fatalf("failed to read from the WebSocket: %s", err)
+	}
+	if len(msg.CurrentClients) != 1 {
+		t.Errorf("expected 1 current DHCP client, got %d", len(msg.CurrentClients))
+	}
+
+	cancel()
+
+	// the WebSocket client is told that the server is going away...
+	_, _, err = ws.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("expected a close frame, got %v", err)
+	}
+
+	// ...and everything stops cleanly
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("ListenAndServe failed: %s", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("ListenAndServe did not return")
+	}
+	if _, err := http.Get("http://" + addr + healthzRelativeUrl); err == nil { //nolint:noctx
+		t.Errorf("the web server is still running")
+	}
+	if err := backend.trackerDB.Ping(context.Background()); err == nil {
+		t.Errorf("the tracker DB is still open")
+	}
+	if state := backend.leaseWatcher.Status().State; state != leasewatcher.StateStopped {
+		t.Errorf("expected the lease watcher to be stopped, got %s", state)
+	}
+}
+
+func TestHandleWebSocketConnAfterClose(t *testing.T) {
+	backend := getMockUIBackend()
+	backend.clients = make(map[*websocket.Conn]bool)
+	backend.closeWebSockets()
+
+	// once the shutdown has started, new WebSockets are refused without being tracked
+	req := httptest.NewRequest(http.MethodGet, websocketRelativeUrl, nil)
+	rec := httptest.NewRecorder()
+	backend.handleWebSocketConn(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+	if len(backend.clients) != 0 {
+		t.Errorf("expected no registered WebSocket, got %d", len(backend.clients))
+	}
+	backend.goroutines.Wait() // must not block
+}
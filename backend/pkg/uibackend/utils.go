@@ -2,19 +2,22 @@ package uibackend
 
 import (
 	"fmt"
-	"net"
 	"time"
 )
 
 func IpPoolToHtmlTemplateRanges(networks []IpNetworkInfo) []HtmlTemplateIpRange {
 	ranges := make([]HtmlTemplateIpRange, 0, len(networks))
 	for _, n := range networks {
+		netmask := n.Netmask()
+		if n.IsIPv6() {
+			netmask = "/" + netmask
+		}
 		ranges = append(ranges, HtmlTemplateIpRange{
 			Start:     n.Start.String(),
 			End:       n.End.String(),
 			Interface: n.Interface,
 			Gateway:   n.Gateway.String(),
-			Netmask:   net.IP(n.Netmask).String(),
+			Netmask:   netmask,
 		})
 	}
 	return ranges
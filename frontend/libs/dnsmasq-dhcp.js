@@ -123,6 +123,7 @@ function initCurrentTable() {
                 { title: 'Link', type: 'string' },
                 { title: 'IP Address', type: 'ip-address' },
                 { title: 'MAC Address', type: 'string' },
+                { title: 'Vendor', type: 'string' },
                 { title: 'Expires in', 'orderDataType': 'custom-date-order' },
                 { title: 'Static IP?', type: 'string' }
             ],
@@ -159,6 +160,7 @@ function initPastTable() {
                 { title: 'Friendly Name', type: 'string' },
                 { title: 'Hostname', type: 'string' },
                 { title: 'MAC Address', type: 'string' },
+                { title: 'Vendor', type: 'string' },
                 { title: 'Static IP?', type: 'string' },
                 { title: 'Last Seen hh:mm:ss ago', 'orderDataType': 'custom-date-order' },
                 { title: 'Notes', type: 'string' }
@@ -210,10 +212,49 @@ function initTableDarkOrLightTheme() {
     console.log("Adapting the web UI to the auto-detected color-scheme: " + prefers);
 }
 
+function initClientMetadataDialog() {
+    // the edit buttons are re-created every time the tables are refreshed: use event delegation
+    document.addEventListener('click', (event) => {
+        const btn = event.target.closest('.editMetadataBtn');
+        if (btn) {
+            openClientMetadataDialog(btn.getAttribute('data-mac'));
+        }
+    });
+
+    document.getElementById("client_metadata_form").addEventListener('submit', (event) => {
+        if (event.submitter && event.submitter.value == "save") {
+            // keep the dialog open until the backend accepts the changes
+            event.preventDefault();
+            saveClientMetadata();
+        }
+    });
+}
+
+function initReservationDialog() {
+    // the reserve/edit buttons are re-created every time the tables are refreshed: use event delegation
+    document.addEventListener('click', (event) => {
+        const btn = event.target.closest('.reservationBtn');
+        if (btn) {
+            openReservationDialog(btn.getAttribute('data-mac'), btn.getAttribute('data-ip'),
+                                  btn.getAttribute('data-existing') == "true");
+        }
+    });
+
+    document.getElementById("reservation_form").addEventListener('submit', (event) => {
+        if (event.submitter && (event.submitter.value == "save" || event.submitter.value == "delete")) {
+            // keep the dialog open until the backend accepts the changes
+            event.preventDefault();
+            saveReservation(event.submitter.value == "delete");
+        }
+    });
+}
+
 function initAll() {
     initCurrentTable()
     initPastTable()
     initDnsUpstreamServersTable()
+    initClientMetadataDialog()
+    initReservationDialog()
     initTabs()
     initTableDarkOrLightTheme()
 }
@@ -250,6 +291,158 @@ function setConfig(webSocketURI, dhcpServerStartTime, dhcpPoolSize) {
 }
 
 
+/* CLIENT METADATA EDITING FUNCTIONS */
+
+function apiURI(path) {
+    // the REST API is served by the same backend serving the websocket, which is reachable
+    // through the same HomeAssistant ingress path
+    return config["webSocketURI"].replace(/\/ws$/, "") + "/api/v1" + path;
+}
+
+function openClientMetadataDialog(macAddr) {
+    const dialog = document.getElementById("client_metadata_dialog");
+    const form = document.getElementById("client_metadata_form");
+    const errorElem = document.getElementById("client_metadata_error");
+
+    fetch(apiURI("/clients/metadata/" + encodeURIComponent(macAddr)))
+        .then((response) => response.json())
+        .then((metadata) => {
+            document.getElementById("client_metadata_mac").innerText = metadata.mac_addr;
+            form.elements["friendly_name"].value = metadata.friendly_name;
+            form.elements["note"].value = metadata.note;
+            form.elements["link"].value = metadata.link;
+
+            overridden = ""
+            if (metadata.overridden_by_options.length > 0) {
+                overridden = "The addon configuration already provides the " + metadata.overridden_by_options.join(" and ") +
+                             " of this client: the values entered here for them are ignored."
+            }
+            document.getElementById("client_metadata_overridden").innerText = overridden;
+            errorElem.innerText = "";
+            dialog.showModal();
+        })
+        .catch((error) => console.error("Failed to get the metadata of " + macAddr, error));
+}
+
+function saveClientMetadata() {
+    const dialog = document.getElementById("client_metadata_dialog");
+    const form = document.getElementById("client_metadata_form");
+    const errorElem = document.getElementById("client_metadata_error");
+    const macAddr = document.getElementById("client_metadata_mac").innerText;
+
+    fetch(apiURI("/clients/metadata/" + encodeURIComponent(macAddr)), {
+        method: "PUT",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify({
+            "friendly_name": form.elements["friendly_name"].value,
+            "note": form.elements["note"].value,
+            "link": form.elements["link"].value,
+        }),
+    })
+        .then((response) => response.json().then((body) => {
+            if (!response.ok) {
+                errorElem.innerText = body.error;
+                return;
+            }
+            // the tables get refreshed by the backend through the websocket
+            dialog.close();
+        }))
+        .catch((error) => {
+            errorElem.innerText = "Failed to save: " + error;
+        });
+}
+
+
+/* IP ADDRESS RESERVATION FUNCTIONS */
+
+function openReservationDialog(macAddr, ipAddr, existing) {
+    const dialog = document.getElementById("reservation_dialog");
+    const form = document.getElementById("reservation_form");
+
+    document.getElementById("reservation_mac").innerText = macAddr;
+    document.getElementById("reservation_error").innerText = "";
+    form.elements["ip_addr"].value = ipAddr;
+    form.elements["name"].value = "";
+    form.dataset.existing = existing;
+    document.getElementById("reservation_delete_btn").hidden = !existing;
+    if (!existing) {
+        // reserving the current IP address of the client
+        dialog.showModal();
+        return;
+    }
+
+    fetch(apiURI("/reservations/" + encodeURIComponent(macAddr)))
+        .then((response) => response.json())
+        .then((reservation) => {
+            form.elements["ip_addr"].value = reservation.ip_addr;
+            form.elements["name"].value = reservation.name;
+            dialog.showModal();
+        })
+        .catch((error) => console.error("Failed to get the IP address reservation of " + macAddr, error));
+}
+
+function saveReservation(deleteIt) {
+    const dialog = document.getElementById("reservation_dialog");
+    const form = document.getElementById("reservation_form");
+    const errorElem = document.getElementById("reservation_error");
+    const macAddr = document.getElementById("reservation_mac").innerText;
+    const body = {
+        "ip_addr": form.elements["ip_addr"].value,
+        "name": form.elements["name"].value,
+    };
+
+    var request;
+    if (deleteIt) {
+        request = fetch(apiURI("/reservations/" + encodeURIComponent(macAddr)), { method: "DELETE" });
+    } else if (form.dataset.existing == "true") {
+        request = fetch(apiURI("/reservations/" + encodeURIComponent(macAddr)), {
+            method: "PUT",
+            headers: { "Content-Type": "application/json" },
+            body: JSON.stringify(body),
+        });
+    } else {
+        body["mac_addr"] = macAddr;
+        request = fetch(apiURI("/reservations"), {
+            method: "POST",
+            headers: { "Content-Type": "application/json" },
+            body: JSON.stringify(body),
+        });
+    }
+
+    request
+        .then((response) => {
+            if (response.ok) {
+                // the tables get refreshed by the backend through the websocket
+                dialog.close();
+                return;
+            }
+            return response.json().then((body) => {
+                errorElem.innerText = body.error;
+            });
+        })
+        .catch((error) => {
+            errorElem.innerText = "Failed to save: " + error;
+        });
+}
+
+function formatStaticIP(item) {
+    var str = item.has_static_ip ? "YES" : "NO";
+    if (!item.lease.mac_addr || item.lease.ip_addr.includes(":")) {
+        // IP address reservations are supported only for DHCPv4 clients
+        return str;
+    }
+    if (item.has_runtime_reservation) {
+        // reservation created from the web UI: it can be edited or deleted
+        str += "<button class='reservationBtn' data-mac='" + item.lease.mac_addr + "' data-ip='" + item.lease.ip_addr +
+               "' data-existing='true' title='Edit or delete the IP address reservation'>&#9998;</button>";
+    } else if (!item.has_static_ip) {
+        str += "<button class='reservationBtn' data-mac='" + item.lease.mac_addr + "' data-ip='" + item.lease.ip_addr +
+               "' data-existing='false' title='Reserve this IP address'>&#128204;</button>";
+    }
+    return str;
+}
+
+
 /* DYNAMIC UPDATES PROCESSING FUNCTIONS */
 
 function compareArraysIgnoringColumns(a, b, columnsToIgnore) {
@@ -280,6 +473,61 @@ function compareArraysIgnoringColumns(a, b, columnsToIgnore) {
     }
 }
   
+function formatVendor(item) {
+    if (item.vendor) {
+        return item.vendor;
+    }
+    if (item.is_randomized_mac) {
+        // phones and laptops using "private" Wi-Fi addresses: there's no vendor to show
+        return "<i>Randomized MAC</i>";
+    }
+    return "Unknown";
+}
+
+function formatFriendlyName(friendlyName, userNote, macAddr) {
+    var str = escapeHtml(friendlyName);
+    if (userNote) {
+        str += "<br/><span class='userNote'>" + escapeHtml(userNote) + "</span>";
+    }
+    if (!macAddr) {
+        // DHCPv6 client with unknown MAC address: metadata are stored by MAC address
+        return str;
+    }
+    // the button opens the dialog to edit the friendly name, note and link of this client
+    str += "<button class='editMetadataBtn' data-mac='" + macAddr + "' title='Edit name, note and link'>&#9998;</button>";
+    return str;
+}
+
+function formatIPAddresses(item) {
+    // dual-stack clients have DHCPv6 leases besides the main one
+    var str = item.lease.ip_addr;
+    if (item.ipv6_leases != null) {
+        item.ipv6_leases.forEach(function (l) {
+            str += "<br/>" + l.ip_addr;
+        });
+    }
+    return str;
+}
+
+function formatMacAddress(item) {
+    if (item.lease.mac_addr) {
+        return item.lease.mac_addr;
+    }
+    // DHCPv6 clients are identified by their DUID, which not always contains the MAC address
+    return "<i>DUID " + item.lease.duid + "</i>";
+}
+
+function formatAddressCount(count) {
+    // IPv6 ranges contain too many IP addresses to be counted
+    return count < 0 ? "a huge number of" : count;
+}
+
+function escapeHtml(str) {
+    // friendly names and notes are free text edited by the user
+    return String(str).replace(/&/g, "&amp;").replace(/</g, "&lt;").replace(/>/g, "&gt;")
+                      .replace(/"/g, "&quot;").replace(/'/g, "&#39;");
+}
+
 function processWebSocketDHCPCurrentClients(data) {
     console.log("Websocket connection: received " + data.current_clients.length + " current DHCP clients from websocket");
 
@@ -294,11 +542,10 @@ function processWebSocketDHCPCurrentClients(data) {
         if (item.is_inside_dhcp_pool)
             dhcp_addresses_used += 1;
 
-        static_ip_str = "NO";
         if (item.has_static_ip) {
-            static_ip_str = "YES";
             dhcp_static_ip += 1;
         }
+        static_ip_str = formatStaticIP(item);
 
         // Apparently not all browsers use fonts supporting the U+1F855 symbol... 
         // E.g. my Android phone does not render it
@@ -307,7 +554,9 @@ function processWebSocketDHCPCurrentClients(data) {
         // hopefully the U+29C9 symbol is more commonly supported:
         external_link_symbol="⧉" // https://www.compart.com/en/unicode/U+29C9
         if (item.evaluated_link) {
-            link_str = "<a href=\"" + item.evaluated_link + "\" target=\"_blank\">" + item.evaluated_link + " " + external_link_symbol + "</a>"
+            // the backend accepts only HTTP and HTTPS links, but they are still escaped like any other text
+            var evaluated_link = escapeHtml(item.evaluated_link);
+            link_str = "<a href=\"" + evaluated_link + "\" target=\"_blank\" rel=\"noopener noreferrer\">" + evaluated_link + " " + external_link_symbol + "</a>"
         } else {
             link_str = "N/A"
         }
@@ -315,13 +564,13 @@ function processWebSocketDHCPCurrentClients(data) {
         // append new row
         time_left_str = formatTimeLeft(item.lease.expires)
         newData.push([index + 1,
-            item.friendly_name, item.lease.hostname, link_str,
-            item.lease.ip_addr, item.lease.mac_addr, 
+            formatFriendlyName(item.friendly_name, item.user_note, item.lease.mac_addr), item.lease.hostname, link_str,
+            formatIPAddresses(item), formatMacAddress(item), formatVendor(item),
             time_left_str, static_ip_str]);
         newTimeLeftColumn.push(time_left_str);
     });
 
-    var index_of_time_left_column = 6;
+    var index_of_time_left_column = 7;
     var currentData = table_current.data().toArray();
     if (compareArraysIgnoringColumns(currentData, newData, [index_of_time_left_column])) {
         console.log("No change in current DHCP clients, updating only the time-left column");
@@ -357,13 +606,13 @@ function processWebSocketDHCPPastClients(data) {
         // append new row
         last_seen_str = formatTimeSince(item.past_info.last_seen)
         newData.push([index + 1,
-            item.friendly_name, item.past_info.hostname, 
-            item.past_info.mac_addr, static_ip_str, 
+            formatFriendlyName(item.friendly_name, item.user_note, item.past_info.mac_addr), item.past_info.hostname, 
+            item.past_info.mac_addr, formatVendor(item), static_ip_str,
             last_seen_str, item.notes]);
         newLastSeenColumn.push(last_seen_str);
     });
 
-    var index_of_time_last_seen_column = 5;
+    var index_of_time_last_seen_column = 6;
     var currentData = table_past.data().toArray();
     if (compareArraysIgnoringColumns(currentData, newData, [index_of_time_last_seen_column])) {
         console.log("No change in past DHCP clients, updating only the last-seen column");
@@ -391,13 +640,49 @@ function updateDHCPStatus(data, dhcp_static_ip, dhcp_addresses_used, messageElem
         usagePerc = Math.round(usagePerc * 10) / 10
     }
 
+    // format the usage of each DHCP range, so that it's clear which one is running out of addresses
+    ranges_str = ""
+    if (data.dhcp_ranges_utilization != null && data.dhcp_ranges_utilization.length > 1) {
+        data.dhcp_ranges_utilization.forEach(function (item, index) {
+            rangeUsagePerc = Math.round(item.usage_percent * 10) / 10
+            ranges_str += "&nbsp;&nbsp;DHCP range " + item.start + " - " + item.end + " on " + item.interface + ": " +
+                        item.used + " leased, " + item.reserved + " reserved, " + formatAddressCount(item.free) + " free IP addresses; usage is at " +
+                        rangeUsagePerc + "%.<br/>"
+        });
+    }
+
+    // report the DHCP ranges running out of free IP addresses, or forecast to do so soon
+    alerts_str = ""
+    if (data.dhcp_ranges_alerts != null) {
+        data.dhcp_ranges_alerts.forEach(function (item, index) {
+            if (item.level == "ok") {
+                return;
+            }
+            alerts_str += "<span class='boldText'>" + item.level.toUpperCase() + ":</span> DHCP range " + item.start + " - " + item.end +
+                        " on " + item.interface + ": " + item.reasons.join("; ") + ".<br/>";
+        });
+    }
+
+    // report any other DHCP server answering on our networks: this is typically a router that turned its own DHCP server back on
+    rogue_str = ""
+    if (data.rogue_dhcp_servers != null && data.rogue_dhcp_servers.length > 0) {
+        rogue_str = "<span class='boldText'>WARNING: " + data.rogue_dhcp_servers.length + " rogue DHCP servers</span> detected:<br/>"
+        data.rogue_dhcp_servers.forEach(function (item, index) {
+            rogue_str += "&nbsp;&nbsp;DHCP server " + item.server_ip + " (MAC " + item.server_mac + ") on " + item.interface +
+                        " offered IP address " + item.offered_ip + ", last seen " + formatTimeSince(item.last_seen) + " hh:mm:ss ago.<br/>";
+        });
+    }
+
     // format server uptime
     uptime_str = formatTimeSince(config["dhcpServerStartTime"])
 
     // update the message
     messageElem.innerHTML = "<span class='boldText'>" + data.current_clients.length + " clients</span> currently hold a DHCP lease.<br/>" + 
                         dhcp_static_ip + " clients have a static IP address configuration.<br/>" +
-                        dhcp_addresses_used + " clients are within the DHCP pool. DHCP pool contains " + config["dhcpPoolSize"] + " IP addresses and its usage is at " + usagePerc + "%.<br/>" +
+                        dhcp_addresses_used + " clients are within the DHCP pool. DHCP pool contains " + formatAddressCount(config["dhcpPoolSize"]) + " IP addresses and its usage is at " + usagePerc + "%.<br/>" +
+                        ranges_str +
+                        alerts_str +
+                        rogue_str +
                         "<span class='boldText'>" + data.past_clients.length + " past clients</span> contacted the server some time ago but failed to do so since last DHCP server restart, " + 
                         uptime_str + " hh:mm:ss ago.<br/>";
 }
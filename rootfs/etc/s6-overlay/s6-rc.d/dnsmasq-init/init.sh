@@ -9,6 +9,7 @@ ADDON_CONFIG="/data/options.json"
 ADDON_CONFIG_RESOLVED="/data/options.resolved.json"
 DNSMASQ_CONFIG="/etc/dnsmasq.conf"
 DNSMASQ_LEASE_DATABASE="/data/dnsmasq.leases"
+DNSMASQ_HOSTS_FILE="/data/dnsmasq.hosts"
 
 # 5min is a reasonable threshold
 JUST_REBOOTED_THRESHOLD_SEC=300
@@ -100,6 +101,20 @@ function process_dns_servers() {
     fi
 }
 
+function resolve_dhcp_pools() {
+    # the DHCP pools can be written either with start/end/netmask or with the network/range
+    # CIDR notation: the backend converts all of them into the start/end/netmask/gateway format
+    local pools
+    if ! pools="$(/opt/bin/backend resolve-pools ${ADDON_CONFIG})"; then
+        bashio::exit.nok "Failed to resolve the DHCP pools, see the log above."
+    fi
+    log_info "Resolved DHCP pools are: ${pools}"
+
+    jq --compact-output --argjson pools "${pools}" '.dhcp_pools_resolved=$pools' \
+        ${ADDON_CONFIG_RESOLVED} >${ADDON_CONFIG_RESOLVED}.tmp
+    mv ${ADDON_CONFIG_RESOLVED}.tmp ${ADDON_CONFIG_RESOLVED}
+}
+
 function bump_dhcp_server_start_epoch() {
     updated_epoch="$(date +%s)"
     echo $updated_epoch > "$ADDON_DHCP_SERVER_START_EPOCH"
@@ -132,6 +147,13 @@ function reset_dhcp_leases_database_if_just_rebooted() {
 
 log_info "Starting dnsmasq configuration..."
 
+log_info "Validating the addon configuration..."
+# only a configuration that cannot be parsed at all stops the addon: the other issues found
+# are logged here and shown at the top of the web UI
+if ! /opt/bin/backend validate ${ADDON_CONFIG}; then
+    bashio::exit.nok "The addon configuration cannot be parsed, see the log above. Please fix it and restart the addon."
+fi
+
 should_reset_on_reboot=$(bashio::config 'dhcp_server.reset_dhcp_lease_database_on_reboot')
 if [[ "$should_reset_on_reboot" = "null" ]]; then
     should_reset_on_reboot=false
@@ -144,6 +166,13 @@ fi
 log_info "Advancing the DHCP server start epoch..."
 bump_dhcp_server_start_epoch
 
+# the leases of another DHCP server are imported after advancing the start epoch, so that the
+# imported DHCP clients are tracked as current clients, and before dnsmasq reads its lease database
+log_info "Importing the DHCP leases of another DHCP server, if configured..."
+if ! /opt/bin/backend import-leases; then
+    log_info "Failed to import the DHCP leases, see the log above. Continuing without them."
+fi
+
 # by default the resolved config is equal to the original config
 cp ${ADDON_CONFIG} ${ADDON_CONFIG_RESOLVED}
 
@@ -152,6 +181,12 @@ log_info "Resolving NTP hostnames eventually provided..."
 resolve_ntp_servers
 log_info "Processing DHCP DNS server list..."
 process_dns_servers
+log_info "Resolving DHCP pools..."
+resolve_dhcp_pools
+
+# the IP address reservations created from the web UI are written by the backend
+# in the dnsmasq hostsfile: make sure it exists even before the first reservation
+touch ${DNSMASQ_HOSTS_FILE}
 
 log_info "Configuring dnsmasq..."
 tempio \